@@ -18,6 +18,7 @@ import (
 	"k8s.io/test-infra/pkg/flagutil"
 	"k8s.io/test-infra/prow/config/secret"
 	prowflagutil "k8s.io/test-infra/prow/flagutil"
+	git "k8s.io/test-infra/prow/git/v2"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/interrupts"
 	"k8s.io/test-infra/prow/pjutil"
@@ -32,6 +33,8 @@ type options struct {
 
 	externalPluginsConfig string
 
+	staleReviewCheckPeriod time.Duration
+
 	webhookSecretFile string
 }
 
@@ -53,6 +56,8 @@ func gatherOptions() options {
 	fs.StringVar(&o.externalPluginsConfig, "external-plugins-config",
 		"/etc/external_plugins_config/external_plugins_config.yaml", "Path to external plugin config file.")
 	fs.BoolVar(&o.dryRun, "dry-run", true, "Dry run for testing. Uses API tokens but does not mutate.")
+	fs.DurationVar(&o.staleReviewCheckPeriod, "stale-review-check-period", time.Hour,
+		"Period duration for periodic checks of the stale review requests.")
 	fs.StringVar(&o.webhookSecretFile, "hmac-secret-file",
 		"/etc/webhook/hmac", "Path to the file containing the GitHub HMAC secret.")
 
@@ -88,6 +93,17 @@ func main() {
 	// but if we use the APP auth later we will have to handle the err.
 	_ = githubClient.Throttle(360, 360)
 
+	// The git client keeps the mirror clones of the repositories as the cache for git blame.
+	gitClient, err := o.github.GitClientFactory("", nil, o.dryRun)
+	if err != nil {
+		logrus.WithError(err).Fatal("Error getting Git client.")
+	}
+	interrupts.OnInterrupt(func() {
+		if err := gitClient.Clean(); err != nil {
+			logrus.WithError(err).Error("Could not clean up git client cache.")
+		}
+	})
+
 	// Skip https verify.
 	//nolint:gosec
 	tr := &http.Transport{
@@ -100,10 +116,24 @@ func main() {
 		tokenGenerator: secret.GetTokenGenerator(o.webhookSecretFile),
 		gc:             githubClient,
 		ol:             ol,
+		gcf:            gitClient,
 		configAgent:    epa,
 		log:            log,
 	}
 
+	// Report the invalid entries of the availability files early, they are checked again as they change.
+	blunderbuss.CheckAvailabilityFiles(epa.Config(), log)
+
+	defer interrupts.WaitForGracefulShutdown()
+	interrupts.TickLiteral(func() {
+		start := time.Now()
+		blunderbuss.CheckAvailabilityFiles(epa.Config(), log)
+		if err := blunderbuss.HandleStaleReviewRequests(githubClient, epa.Config(), ol, gitClient, log); err != nil {
+			log.WithError(err).Error("Error during periodic check of the stale review requests.")
+		}
+		log.WithField("duration", fmt.Sprintf("%v", time.Since(start))).Info("Periodic check complete.")
+	}, o.staleReviewCheckPeriod)
+
 	health := pjutil.NewHealth()
 	health.ServeReady()
 
@@ -114,7 +144,6 @@ func main() {
 	externalplugins.ServeExternalPluginHelp(mux, log, helpProvider)
 	httpServer := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
 
-	defer interrupts.WaitForGracefulShutdown()
 	interrupts.ListenAndServe(httpServer, 5*time.Second)
 }
 
@@ -125,6 +154,7 @@ type server struct {
 	gc             github.Client
 
 	ol          ownersclient.OwnersLoader
+	gcf         git.ClientFactory
 	configAgent *tiexternalplugins.ConfigAgent
 	log         *logrus.Entry
 }
@@ -157,7 +187,7 @@ func (s *server) handleEvent(eventType, eventGUID string, payload []byte) error
 			return err
 		}
 		go func() {
-			if err := blunderbuss.HandleIssueCommentEvent(s.gc, &ice, config, s.ol, l); err != nil {
+			if err := blunderbuss.HandleIssueCommentEvent(s.gc, &ice, config, s.ol, s.gcf, l); err != nil {
 				l.WithField("event-type", eventType).WithError(err).Info("Error handling event.")
 			}
 		}()
@@ -167,7 +197,7 @@ func (s *server) handleEvent(eventType, eventGUID string, payload []byte) error
 			return err
 		}
 		go func() {
-			if err := blunderbuss.HandlePullRequestEvent(s.gc, &pe, config, s.ol, l); err != nil {
+			if err := blunderbuss.HandlePullRequestEvent(s.gc, &pe, config, s.ol, s.gcf, l); err != nil {
 				l.WithField("event-type", eventType).WithError(err).Info("Error handling event.")
 			}
 		}()
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -27,6 +28,9 @@ type options struct {
 
 	externalPluginsConfig string
 
+	jobQueueFile   string
+	jobRetryPeriod time.Duration
+
 	webhookSecretFile string
 }
 
@@ -50,6 +54,10 @@ func gatherOptions() options {
 	fs.BoolVar(&o.dryRun, "dry-run", true, "Dry run for testing. Uses API tokens but does not mutate.")
 	fs.StringVar(&o.webhookSecretFile, "hmac-secret-file",
 		"/etc/webhook/hmac", "Path to the file containing the GitHub HMAC secret.")
+	fs.StringVar(&o.jobQueueFile, "job-queue-file", "",
+		"Path to the JSON file to persist the cherry-pick jobs, empty means the cherry-picks are done immediately.")
+	fs.DurationVar(&o.jobRetryPeriod, "job-retry-period", time.Minute,
+		"Period duration for running the retried and restored cherry-pick jobs.")
 
 	for _, group := range []flagutil.OptionGroup{&o.github} {
 		group.AddFlags(fs)
@@ -127,6 +135,17 @@ func main() {
 		Repos: repos,
 	}
 
+	if o.jobQueueFile != "" {
+		queue, err := cherrypicker.NewFileJobQueue(o.jobQueueFile)
+		if err != nil {
+			log.WithError(err).Fatalf("Error loading cherry-pick jobs from %q.", o.jobQueueFile)
+		}
+		server.Queue = queue
+		interrupts.Run(func(ctx context.Context) {
+			server.RunJobWorker(ctx, o.jobRetryPeriod)
+		})
+	}
+
 	health := pjutil.NewHealth()
 	health.ServeReady()
 
@@ -26,7 +26,8 @@ import (
 )
 
 type options struct {
-	port int
+	port         int
+	internalPort int
 
 	dryRun bool
 	github prowflagutil.GitHubOptions
@@ -34,6 +35,10 @@ type options struct {
 	externalPluginsConfig string
 
 	webhookSecretFile string
+
+	freezeSyncPeriod time.Duration
+
+	auditLogFile string
 }
 
 // validate validates github options.
@@ -51,11 +56,17 @@ func gatherOptions() options {
 	o := options{}
 	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	fs.IntVar(&o.port, "port", 80, "Port to listen on.")
+	fs.IntVar(&o.internalPort, "internal-port", 8889,
+		"Port to serve the audit API on, it should not be exposed to the public like the webhook port.")
 	fs.StringVar(&o.externalPluginsConfig, "external-plugins-config",
 		"/etc/external_plugins_config/external_plugins_config.yaml", "Path to external plugin config file.")
 	fs.BoolVar(&o.dryRun, "dry-run", true, "Dry run for testing. Uses API tokens but does not mutate.")
 	fs.StringVar(&o.webhookSecretFile, "hmac-secret-file",
 		"/etc/webhook/hmac", "Path to the file containing the GitHub HMAC secret.")
+	fs.DurationVar(&o.freezeSyncPeriod, "freeze-sync-period", time.Minute,
+		"Period duration for checking the start of the merge freezes.")
+	fs.StringVar(&o.auditLogFile, "audit-log-file", "",
+		"Path to the JSON lines file to append the merge audit records, empty means the audit is disabled.")
 
 	for _, group := range []flagutil.OptionGroup{&o.github} {
 		group.AddFlags(fs)
@@ -97,24 +108,51 @@ func main() {
 	client := &http.Client{Transport: tr}
 	ol := &ownersclient.OwnersClient{Client: client}
 
+	var al merge.AuditLogger
+	var auditStore *merge.FileAuditStore
+	if o.auditLogFile != "" {
+		auditStore = merge.NewFileAuditStore(o.auditLogFile)
+		al = auditStore
+	}
+
 	server := &server{
 		tokenGenerator: secret.GetTokenGenerator(o.webhookSecretFile),
 		gc:             githubClient,
 		ol:             ol,
+		al:             al,
 		configAgent:    epa,
 		log:            log,
 	}
 
+	defer interrupts.WaitForGracefulShutdown()
+	freezeWatcher := &merge.FreezeWatcher{}
+	interrupts.TickLiteral(func() {
+		if err := freezeWatcher.Sync(githubClient, epa.Config(), al, time.Now(), log); err != nil {
+			log.WithError(err).Error("Error during periodic sync of the merge freezes.")
+		}
+	}, o.freezeSyncPeriod)
+
 	health := pjutil.NewHealth()
 	health.ServeReady()
 
 	mux := http.NewServeMux()
 	mux.Handle("/", server)
 
+	// The audit API is unauthenticated, so it is served on the internal port.
+	if auditStore != nil {
+		internalMux := http.NewServeMux()
+		internalMux.Handle("/audit", &merge.AuditHandler{Store: auditStore, Log: log.WithField("client", "audit")})
+		internalServer := &http.Server{
+			Addr:              ":" + strconv.Itoa(o.internalPort),
+			Handler:           internalMux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		interrupts.ListenAndServe(internalServer, 5*time.Second)
+	}
+
 	helpProvider := merge.HelpProvider(epa)
 	externalplugins.ServeExternalPluginHelp(mux, log, helpProvider)
 	httpServer := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
-	defer interrupts.WaitForGracefulShutdown()
 	interrupts.ListenAndServe(httpServer, 5*time.Second)
 }
 
@@ -125,6 +163,7 @@ type server struct {
 	gc             github.Client
 
 	ol          ownersclient.OwnersLoader
+	al          merge.AuditLogger
 	configAgent *tiexternalplugins.ConfigAgent
 	log         *logrus.Entry
 }
@@ -162,7 +201,7 @@ func (s *server) handleEvent(eventType, eventGUID string, payload []byte) error
 			ice.Repo.Owner.Login, ice.Repo.Name, ice.Issue.Number,
 		)
 		go func() {
-			if err := merge.HandleIssueCommentEvent(s.gc, &ice, config, s.ol, cp, l); err != nil {
+			if err := merge.HandleIssueCommentEvent(s.gc, &ice, config, s.ol, cp, s.al, l); err != nil {
 				l.WithField("event-type", eventType).WithError(err).Info("Error handling event.")
 			}
 		}()
@@ -177,7 +216,7 @@ func (s *server) handleEvent(eventType, eventGUID string, payload []byte) error
 			pullReviewCommentEvent.Repo.Owner.Login, pullReviewCommentEvent.Repo.Name, pullReviewCommentEvent.PullRequest.Number,
 		)
 		go func() {
-			if err := merge.HandlePullReviewCommentEvent(s.gc, &pullReviewCommentEvent, config, s.ol, cp, l); err != nil {
+			if err := merge.HandlePullReviewCommentEvent(s.gc, &pullReviewCommentEvent, config, s.ol, cp, s.al, l); err != nil {
 				l.WithField("event-type", eventType).WithError(err).Info("Error handling event.")
 			}
 		}()
@@ -187,7 +226,27 @@ func (s *server) handleEvent(eventType, eventGUID string, payload []byte) error
 			return err
 		}
 		go func() {
-			if err := merge.HandlePullRequestEvent(s.gc, &pe, config, l); err != nil {
+			if err := merge.HandlePullRequestEvent(s.gc, &pe, config, s.al, l); err != nil {
+				l.WithField("event-type", eventType).WithError(err).Info("Error handling event.")
+			}
+		}()
+	case tiexternalplugins.StatusEvent:
+		var se github.StatusEvent
+		if err := json.Unmarshal(payload, &se); err != nil {
+			return err
+		}
+		go func() {
+			if err := merge.HandleStatusEvent(s.gc, &se, config, s.ol, s.al, l); err != nil {
+				l.WithField("event-type", eventType).WithError(err).Info("Error handling event.")
+			}
+		}()
+	case tiexternalplugins.CheckRunEvent:
+		var cre merge.CheckRunEvent
+		if err := json.Unmarshal(payload, &cre); err != nil {
+			return err
+		}
+		go func() {
+			if err := merge.HandleCheckRunEvent(s.gc, &cre, config, s.ol, s.al, l); err != nil {
 				l.WithField("event-type", eventType).WithError(err).Info("Error handling event.")
 			}
 		}()
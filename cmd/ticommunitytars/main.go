@@ -24,7 +24,8 @@ import (
 )
 
 type options struct {
-	port int
+	port         int
+	internalPort int
 
 	pluginConfig          string
 	dryRun                bool
@@ -33,6 +34,10 @@ type options struct {
 
 	updatePeriod time.Duration
 
+	plan       bool
+	planRepo   string
+	planBranch string
+
 	webhookSecretFile string
 }
 
@@ -50,6 +55,8 @@ func gatherOptions() options {
 	o := options{}
 	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 	fs.IntVar(&o.port, "port", 8888, "Port to listen on.")
+	fs.IntVar(&o.internalPort, "internal-port", 8889,
+		"Port to serve the plan API on, it should not be exposed to the public like the webhook port.")
 	fs.StringVar(&o.pluginConfig, "plugin-config", "/etc/plugins/plugins.yaml", "Path to plugin config file.")
 	fs.StringVar(&o.externalPluginsConfig, "external-plugins-config",
 		"/etc/external_plugins_config/external_plugins_config.yaml", "Path to external plugin config file.")
@@ -57,6 +64,9 @@ func gatherOptions() options {
 	fs.DurationVar(&o.updatePeriod, "update-period", time.Minute*20, "Period duration for periodic scans of all PRs.")
 	fs.StringVar(&o.webhookSecretFile, "hmac-secret-file", "/etc/webhook/hmac",
 		"Path to the file containing the GitHub HMAC secret.")
+	fs.BoolVar(&o.plan, "plan", false, "Print the plan of the next update of all PRs in JSON and exit.")
+	fs.StringVar(&o.planRepo, "plan-repo", "", "Only plan the PRs of the repo in org/repo format.")
+	fs.StringVar(&o.planBranch, "plan-branch", "", "Only plan the PRs of the base branch.")
 
 	for _, group := range []flagutil.OptionGroup{&o.github} {
 		group.AddFlags(fs)
@@ -78,8 +88,11 @@ func main() {
 		log.WithError(err).Fatalf("Error loading plugin config from %q.", o.pluginConfig)
 	}
 
-	if err := secret.Add(o.webhookSecretFile); err != nil {
-		logrus.WithError(err).Fatal("Error starting secrets agent.")
+	// The webhook is not served when planning.
+	if !o.plan {
+		if err := secret.Add(o.webhookSecretFile); err != nil {
+			logrus.WithError(err).Fatal("Error starting secrets agent.")
+		}
 	}
 
 	epa := &tiexternalplugins.ConfigAgent{}
@@ -95,6 +108,16 @@ func main() {
 	// but if we use the APP auth later we will have to handle the err.
 	_ = githubClient.Throttle(360, 360)
 
+	if o.plan {
+		plans := tars.Plan(log, githubClient, pa.Config(), epa.Config(), o.planRepo, o.planBranch)
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(plans); err != nil {
+			log.WithError(err).Fatal("Error printing the plan.")
+		}
+		return
+	}
+
 	server := &Server{
 		tokenGenerator: secret.GetTokenGenerator(o.webhookSecretFile),
 		ghc:            githubClient,
@@ -116,10 +139,21 @@ func main() {
 
 	mux := http.NewServeMux()
 	mux.Handle("/", server)
+	mux.Handle("/postponements", &tars.PostponementHandler{Log: log.WithField("client", "postponements")})
 	helpProvider := tars.HelpProvider(epa)
 	externalplugins.ServeExternalPluginHelp(mux, log, helpProvider)
 	httpServer := &http.Server{Addr: ":" + strconv.Itoa(o.port), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
 
+	// The plan API is unauthenticated and expensive, so it is served on the internal port.
+	internalMux := http.NewServeMux()
+	internalMux.Handle("/plan", tars.NewPlanHandler(log.WithField("client", "plan"), githubClient, pa.Config, epa.Config))
+	internalServer := &http.Server{
+		Addr:              ":" + strconv.Itoa(o.internalPort),
+		Handler:           internalMux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	interrupts.ListenAndServe(internalServer, 5*time.Second)
 	interrupts.ListenAndServe(httpServer, 5*time.Second)
 }
 
@@ -1,8 +1,12 @@
 package blunderbuss
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
+	"math/rand"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,6 +15,7 @@ import (
 	"github.com/ti-community-infra/tichi/internal/pkg/ownersclient"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/prow/config"
+	git "k8s.io/test-infra/prow/git/v2"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/pluginhelp"
 	"k8s.io/test-infra/prow/pluginhelp/externalplugins"
@@ -30,7 +35,17 @@ const (
 )
 
 var (
-	match = regexp.MustCompile(`(?mi)^/auto-cc\s*$`)
+	match = regexp.MustCompile(`(?mi)^/auto-cc(?:\s+(reroll))?\s*$`)
+
+	configInfoMaxOpenReviewRequests = "Reviewers who already have %d open review requests are not requested."
+	configInfoLoadAware             = "Reviewers who have more open review requests or review slower recently " +
+		"are less likely to be requested."
+	configInfoAvailability   = "Reviewers who are away according to the availability calendar are not requested."
+	configInfoBlameExpertise = "The expertise of the reviewers is scored by git blame of the modified lines, " +
+		"the score of each line decays by half every %d days."
+	configInfoStaleReview = "Reviewers who do not respond to the review request in %d hours are pinged once, " +
+		"and then swapped with other reviewers if they still do not respond in %d hours."
+	configInfoExplainSelection = "The reason of the reviewer selection is explained in a collapsible comment."
 )
 
 var sleep = time.Sleep
@@ -41,6 +56,14 @@ type githubClient interface {
 	GetIssueLabels(org, repo string, number int) ([]github.Label, error)
 	GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error)
 	ListFileCommits(org, repo, path string) ([]github.RepositoryCommit, error)
+	FindIssuesWithOrg(org, query, sort string, asc bool) ([]github.Issue, error)
+	ListReviews(org, repo string, number int) ([]github.Review, error)
+	GetSingleCommit(org, repo, SHA string) (github.RepositoryCommit, error)
+	UnrequestReview(org, repo string, number int, logins []string) error
+	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error)
+	CreateComment(org, repo string, number int, comment string) error
+	BotUserChecker() (func(candidate string) bool, error)
+	QueryWithGitHubAppsSupport(ctx context.Context, q interface{}, vars map[string]interface{}, org string) error
 }
 
 // HelpProvider constructs the PluginHelp for this plugin that takes into account enabled repositories.
@@ -59,6 +82,33 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 				configInfoStrings = append(configInfoStrings, "<li>"+configString(opts.MaxReviewerCount)+"</li>")
 				isConfigured = true
 			}
+			if opts.MaxOpenReviewRequests > 0 {
+				configInfoStrings = append(configInfoStrings, "<li>"+fmt.Sprintf(configInfoMaxOpenReviewRequests,
+					opts.MaxOpenReviewRequests)+"</li>")
+				isConfigured = true
+			}
+			if opts.LoadAware {
+				configInfoStrings = append(configInfoStrings, "<li>"+configInfoLoadAware+"</li>")
+				isConfigured = true
+			}
+			if opts.AvailabilityFile != "" {
+				configInfoStrings = append(configInfoStrings, "<li>"+configInfoAvailability+"</li>")
+				isConfigured = true
+			}
+			if opts.BlameExpertise {
+				configInfoStrings = append(configInfoStrings, "<li>"+fmt.Sprintf(configInfoBlameExpertise,
+					opts.BlameHalfLifeDays)+"</li>")
+				isConfigured = true
+			}
+			if opts.StaleReviewHours > 0 {
+				configInfoStrings = append(configInfoStrings, "<li>"+fmt.Sprintf(configInfoStaleReview,
+					opts.StaleReviewHours, opts.StaleReviewHours)+"</li>")
+				isConfigured = true
+			}
+			if opts.ExplainSelection {
+				configInfoStrings = append(configInfoStrings, "<li>"+configInfoExplainSelection+"</li>")
+				isConfigured = true
+			}
 			configInfoStrings = append(configInfoStrings, "</ul>")
 			if isConfigured {
 				configInfo[repo.String()] = strings.Join(configInfoStrings, "\n")
@@ -86,11 +136,12 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 			Events:  []string{tiexternalplugins.PullRequestEvent, tiexternalplugins.IssueCommentEvent},
 		}
 		pluginHelp.AddCommand(pluginhelp.Command{
-			Usage:       "/auto-cc",
-			Featured:    false,
-			Description: "Manually request reviews from reviewers for a PR.",
-			Examples:    []string{"/auto-cc"},
-			WhoCanUse:   "Everyone",
+			Usage:    "/auto-cc [reroll]",
+			Featured: false,
+			Description: "Manually request reviews from reviewers for a PR. The same PR always gets the same reviewers " +
+				"from the same candidates, use reroll to replace the requested reviewers with a new draw.",
+			Examples:  []string{"/auto-cc", "/auto-cc reroll"},
+			WhoCanUse: "Everyone",
 		})
 		return pluginHelp, nil
 	}
@@ -107,7 +158,7 @@ func configString(maxReviewerCount int) string {
 
 // HandlePullRequestEvent handles a GitHub pull request event and requests review.
 func HandlePullRequestEvent(gc githubClient, pe *github.PullRequestEvent,
-	cfg *tiexternalplugins.Configuration, ol ownersclient.OwnersLoader, log *logrus.Entry) error {
+	cfg *tiexternalplugins.Configuration, ol ownersclient.OwnersLoader, gcf git.ClientFactory, log *logrus.Entry) error {
 	pr := &pe.PullRequest
 	// If a PR already has reviewers, we do not automatically assign them.
 	if len(pr.RequestedReviewers) > 0 {
@@ -131,6 +182,8 @@ func HandlePullRequestEvent(gc githubClient, pe *github.PullRequestEvent,
 			pr,
 			log,
 			ol,
+			gcf,
+			"",
 		)
 	}
 
@@ -162,6 +215,8 @@ func HandlePullRequestEvent(gc githubClient, pe *github.PullRequestEvent,
 			pr,
 			log,
 			ol,
+			gcf,
+			"",
 		)
 	}
 
@@ -170,15 +225,21 @@ func HandlePullRequestEvent(gc githubClient, pe *github.PullRequestEvent,
 
 // HandleIssueCommentEvent handles a GitHub issue comment event and requests review.
 func HandleIssueCommentEvent(gc githubClient, ce *github.IssueCommentEvent, cfg *tiexternalplugins.Configuration,
-	ol ownersclient.OwnersLoader, log *logrus.Entry) error {
+	ol ownersclient.OwnersLoader, gcf git.ClientFactory, log *logrus.Entry) error {
 	// Only consider open PRs and new comments.
 	if ce.Action != github.IssueCommentActionCreated || !ce.Issue.IsPullRequest() || ce.Issue.State == "closed" {
 		return nil
 	}
 
-	if !match.MatchString(ce.Comment.Body) {
+	matches := match.FindStringSubmatch(ce.Comment.Body)
+	if matches == nil {
 		return nil
 	}
+	// Each reroll gets a new draw by the comment, and the retry of the same comment gets the same draw.
+	var reroll string
+	if matches[1] != "" {
+		reroll = strconv.Itoa(ce.Comment.ID)
+	}
 
 	repo := &ce.Repo
 
@@ -202,31 +263,113 @@ func HandleIssueCommentEvent(gc githubClient, ce *github.IssueCommentEvent, cfg
 		pr,
 		log,
 		ol,
+		gcf,
+		reroll,
 	)
 }
 
+// handle requests reviews from the reviewers selected for the PR, the requested reviewers are replaced
+// with a new draw if it is a reroll.
 func handle(gc githubClient, opts *tiexternalplugins.TiCommunityBlunderbuss, repo *github.Repo, pr *github.PullRequest,
-	log *logrus.Entry, ol ownersclient.OwnersLoader) error {
+	log *logrus.Entry, ol ownersclient.OwnersLoader, gcf git.ClientFactory, reroll string) error {
+	var previousReviewers []github.User
+	if reroll != "" {
+		previousReviewers = pr.RequestedReviewers
+		pr.RequestedReviewers = nil
+	}
+
+	selection, err := selectReviewers(gc, opts, repo, pr, opts.MaxReviewerCount, nil, reroll, log, ol, gcf)
+	if err != nil {
+		return err
+	}
+
+	if len(previousReviewers) != 0 {
+		selected := sets.NewString(selection.reviewers...)
+		var unrequested []string
+		for _, reviewer := range previousReviewers {
+			if !selected.Has(reviewer.Login) {
+				unrequested = append(unrequested, reviewer.Login)
+			}
+		}
+		if len(unrequested) != 0 {
+			log.Infof("Removing the review requests of %s for the reroll.", unrequested)
+			if err := gc.UnrequestReview(repo.Owner.Login, repo.Name, pr.Number, unrequested); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Infof("Requesting reviews from users %s.", selection.reviewers)
+	err = gc.RequestReview(repo.Owner.Login, repo.Name, pr.Number, selection.reviewers)
+	if err != nil || !opts.ExplainSelection || len(selection.reviewers) == 0 {
+		return err
+	}
+	return gc.CreateComment(repo.Owner.Login, repo.Name, pr.Number, explainSelection(selection))
+}
+
+// selectReviewers selects at most count reviewers for the pull request by the weights of their contributions
+// to the changes, all available reviewers are selected if the count is 0. The excluded reviewers are never selected,
+// which map the reviewers to the reasons of the exclusions. The selection is seeded by the PR, the salt and the reroll,
+// so the same candidates always get the same reviewers.
+func selectReviewers(gc githubClient, opts *tiexternalplugins.TiCommunityBlunderbuss, repo *github.Repo,
+	pr *github.PullRequest, count int, excludedReviewers map[string]string, reroll string, log *logrus.Entry,
+	ol ownersclient.OwnersLoader, gcf git.ClientFactory) (*reviewerSelection, error) {
 	owners, err := ol.LoadOwners(opts.PullOwnersEndpoint, repo.Owner.Login, repo.Name, pr.Number)
 	if err != nil {
-		return fmt.Errorf("error loading repo owners: %v", err)
+		return nil, fmt.Errorf("error loading repo owners: %v", err)
 	}
+	selection := newReviewerSelection(owners.Reviewers)
 
 	// List all available reviewers.
+	awayReviewers := listAwayReviewers(opts.AvailabilityFile, timeNow(), log)
 	availableReviewers := listAvailableReviewers(pr.User.Login, owners.Reviewers, opts.IncludeReviewers,
-		opts.ExcludeReviewers, pr.RequestedReviewers)
+		opts.ExcludeReviewers, pr.RequestedReviewers, awayReviewers)
+	for _, reviewer := range owners.Reviewers {
+		if !availableReviewers.Has(reviewer) {
+			selection.exclusions[reviewer] = exclusionReason(reviewer, pr.User.Login, opts,
+				pr.RequestedReviewers, awayReviewers)
+		}
+	}
+	for _, reviewer := range availableReviewers.List() {
+		if reason, ok := excludedReviewers[github.NormLogin(reviewer)]; ok {
+			availableReviewers.Delete(reviewer)
+			selection.exclusions[reviewer] = reason
+		}
+	}
 
-	maxReviewerCount := opts.MaxReviewerCount
-	// If maxReviewerCount is not set or there are not enough reviewers, then all reviewers are assigned.
-	if maxReviewerCount == 0 || len(availableReviewers) <= maxReviewerCount {
-		log.Infof("Requesting all available reviewers %s.", availableReviewers.List())
-		return gc.RequestReview(repo.Owner.Login, repo.Name, pr.Number, availableReviewers.List())
+	// Filter out the overloaded reviewers.
+	if opts.MaxOpenReviewRequests > 0 {
+		loads := listReviewerLoads(gc, opts, repo.Owner.Login, repo.Name, availableReviewers, nil, log)
+		unloadedReviewers := filterOverloadedReviewers(availableReviewers, loads, opts.MaxOpenReviewRequests, log)
+		for _, reviewer := range availableReviewers.Difference(unloadedReviewers).List() {
+			selection.exclusions[reviewer] = fmt.Sprintf("already has %d open review requests",
+				loads[reviewer].openRequests)
+		}
+		availableReviewers = unloadedReviewers
+	}
+
+	// If count is not set or there are not enough reviewers, then all reviewers are selected.
+	if count == 0 || len(availableReviewers) <= count {
+		log.Infof("Selecting all available reviewers %s.", availableReviewers.List())
+		selection.reviewers = availableReviewers.List()
+		return selection, nil
 	}
 
 	// List the contributors of the changes.
-	contributors, err := listChangesContributors(gc, repo.Owner.Login, repo.Name, pr.Number, log)
-	if err != nil {
-		return err
+	var contributors map[string]uint
+	if opts.BlameExpertise && gcf != nil {
+		contributors, err = listBlameContributors(gc, gcf, opts, repo.Owner.Login, repo.Name, pr, log)
+		if err != nil {
+			log.WithError(err).Warn("Failed to list the contributors by git blame, falling back to the file commits.")
+		}
+		selection.weightSource = blameWeightSource
+	}
+	if contributors == nil {
+		contributors, err = listChangesContributors(gc, repo.Owner.Login, repo.Name, pr.Number, log)
+		if err != nil {
+			return nil, err
+		}
+		selection.weightSource = commitsWeightSource
 	}
 
 	// Filter out unavailable contributors.
@@ -237,39 +380,76 @@ func handle(gc githubClient, opts *tiexternalplugins.TiCommunityBlunderbuss, rep
 	}
 
 	// The default weight for other reviewers is 1.
+	weightedReviewers := sets.StringKeySet(contributors)
 	for _, reviewer := range availableReviewers.List() {
 		_, ok := contributors[reviewer]
 		if !ok {
 			contributors[reviewer] = defaultWeight
 		}
 	}
-	// Create weighted selectors chooser on the number of changes made to the code.
-	var choices []wr.Choice
-	for contributor, weight := range contributors {
-		choices = append(choices, wr.Choice{
-			Item:   contributor,
-			Weight: weight,
-		})
+	// Down-weight the reviewers who have more open review requests or review slower recently,
+	// the review latency is only estimated for the contributors of the changes.
+	if opts.LoadAware {
+		loads := listReviewerLoads(gc, opts, repo.Owner.Login, repo.Name, availableReviewers, weightedReviewers, log)
+		for contributor, weight := range contributors {
+			contributors[contributor] = loadWeight(weight, loads[contributor])
+		}
+		selection.weightSource += loadWeightSource
 	}
-	reviewers := sets.NewString()
-
-	chooser, err := wr.NewChooser(
-		choices...,
-	)
+	selection.weights = contributors
+	// Pick the reviewers randomly by the weights of the changes made to the code.
+	seed := selectionSeed(repo.Owner.Login, repo.Name, pr.Number, opts.SelectionSalt, reroll)
+	reviewers, err := pickReviewers(contributors, count, rand.New(rand.NewSource(seed))) //nolint:gosec
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for len(reviewers) < maxReviewerCount {
-		// Rand pick.
-		reviewers.Insert(chooser.Pick().(string))
+
+	selection.reviewers = reviewers
+	return selection, nil
+}
+
+// selectionSeed returns the seed of the reviewer selection derived from the identity of the PR,
+// the salt and the reroll.
+func selectionSeed(org, repo string, number int, salt, reroll string) int64 {
+	h := fnv.New64a()
+	_, _ = fmt.Fprintf(h, "%s/%s#%d/%s/%s", org, repo, number, salt, reroll)
+	return int64(h.Sum64())
+}
+
+// pickReviewers picks at most count reviewers randomly by the weights without replacement,
+// it stops when there are no more reviewers with positive weights.
+func pickReviewers(weights map[string]uint, count int, rs *rand.Rand) ([]string, error) {
+	// The choices are sorted so that the same source always picks the same reviewers.
+	var choices []wr.Choice
+	for _, reviewer := range sets.StringKeySet(weights).List() {
+		if weights[reviewer] > 0 {
+			choices = append(choices, wr.Choice{Item: reviewer, Weight: weights[reviewer]})
+		}
 	}
 
-	log.Infof("Requesting reviews from users %s.", reviewers.List())
-	return gc.RequestReview(repo.Owner.Login, repo.Name, pr.Number, reviewers.List())
+	reviewers := sets.NewString()
+	for len(reviewers) < count && len(choices) != 0 {
+		chooser, err := wr.NewChooser(append([]wr.Choice(nil), choices...)...)
+		if err != nil {
+			return nil, err
+		}
+		reviewer := chooser.PickSource(rs).(string)
+		reviewers.Insert(reviewer)
+
+		for i, choice := range choices {
+			if choice.Item == reviewer {
+				choices = append(choices[:i], choices[i+1:]...)
+				break
+			}
+		}
+	}
+	return reviewers.List(), nil
 }
 
+// listAvailableReviewers returns the reviewers who can be requested, the author, the excluded reviewers,
+// the requested reviewers and the reviewers who are away are filtered out.
 func listAvailableReviewers(author string, reviewers []string, includeReviewers []string, excludeReviewers []string,
-	requestedReviewers []github.User) sets.String {
+	requestedReviewers []github.User, awayReviewers sets.String) sets.String {
 	authorSet := sets.NewString(github.NormLogin(author))
 	includeReviewersSet := sets.NewString(includeReviewers...)
 	excludeReviewersSet := sets.NewString(excludeReviewers...)
@@ -281,6 +461,13 @@ func listAvailableReviewers(author string, reviewers []string, includeReviewers
 	reviewersSet := sets.NewString()
 	reviewersSet.Insert(reviewers...)
 
+	// The reviewers who are away are never requested.
+	for _, reviewer := range reviewersSet.List() {
+		if awayReviewers.Has(github.NormLogin(reviewer)) {
+			reviewersSet.Delete(reviewer)
+		}
+	}
+
 	if len(includeReviewers) != 0 {
 		nonReviewers := includeReviewersSet.Difference(reviewersSet)
 		includeReviewersSet = includeReviewersSet.Difference(nonReviewers)
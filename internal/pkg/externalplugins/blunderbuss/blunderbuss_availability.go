@@ -0,0 +1,297 @@
+package blunderbuss
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+	"sigs.k8s.io/yaml"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+const (
+	// availabilityDateLayout is the layout of the date of the absences in the YAML availability file.
+	availabilityDateLayout = "2006-01-02"
+	// availabilityTimeLayout is the layout of the time of the absences in the YAML availability file.
+	availabilityTimeLayout = "2006-01-02 15:04"
+	// iCalendarDateLayout is the layout of the DATE value in the iCalendar file.
+	iCalendarDateLayout = "20060102"
+	// iCalendarTimeLayout is the layout of the DATE-TIME value in the iCalendar file.
+	iCalendarTimeLayout = "20060102T150405"
+)
+
+// availability specifies the absences of the reviewers.
+type availability struct {
+	// TimeZone specifies the time zone of the start and end of the absences, defaults to UTC.
+	TimeZone string            `json:"time_zone,omitempty"`
+	Absences []reviewerAbsence `json:"absences,omitempty"`
+}
+
+// reviewerAbsence specifies a period in which the reviewer is away.
+type reviewerAbsence struct {
+	// Login is the GitHub login of the reviewer.
+	Login string `json:"login"`
+	// Start is the start of the absence, in the format of `2006-01-02` or `2006-01-02 15:04`.
+	Start string `json:"start"`
+	// End is the end of the absence, in the format of `2006-01-02` or `2006-01-02 15:04`,
+	// the date without the time means the whole day is included.
+	End string `json:"end"`
+	// Reason is the reason of the absence, such as vacation.
+	Reason string `json:"reason,omitempty"`
+}
+
+// absencePeriod is a parsed absence of a reviewer.
+type absencePeriod struct {
+	login      string
+	start, end time.Time
+}
+
+// availabilityCache caches the absences parsed from the availability files, so that each file is only parsed
+// and its invalid entries are only reported again when it changes.
+var availabilityCache = struct {
+	sync.Mutex
+	files map[string]cachedAvailability
+}{files: make(map[string]cachedAvailability)}
+
+// cachedAvailability is the absences parsed from a version of the availability file.
+type cachedAvailability struct {
+	modTime time.Time
+	size    int64
+	periods []absencePeriod
+}
+
+// listAwayReviewers returns the reviewers who are away at the time according to the availability file.
+func listAwayReviewers(path string, t time.Time, log *logrus.Entry) sets.String {
+	awayReviewers := sets.NewString()
+	if path == "" {
+		return awayReviewers
+	}
+
+	periods, err := loadAbsencePeriods(path, log)
+	if err != nil {
+		log.WithError(err).Warnf("Failed to load the availability file %s.", path)
+		return awayReviewers
+	}
+
+	for _, period := range periods {
+		// The expired or future absences are ignored.
+		if t.Before(period.start) || !t.Before(period.end) {
+			continue
+		}
+		awayReviewers.Insert(github.NormLogin(period.login))
+	}
+	return awayReviewers
+}
+
+// CheckAvailabilityFiles loads the availability files of the config, so that the invalid entries are reported
+// as soon as the files are configured or changed instead of when the reviewers are requested.
+func CheckAvailabilityFiles(cfg *tiexternalplugins.Configuration, log *logrus.Entry) {
+	checked := sets.NewString()
+	for _, blunderbuss := range cfg.TiCommunityBlunderbuss {
+		path := blunderbuss.AvailabilityFile
+		if path == "" || checked.Has(path) {
+			continue
+		}
+		checked.Insert(path)
+		if _, err := loadAbsencePeriods(path, log); err != nil {
+			log.WithError(err).Errorf("Failed to load the availability file %s.", path)
+		}
+	}
+}
+
+// loadAbsencePeriods loads the absences from the availability file, the files with the .ics extension are
+// parsed as iCalendar files and the others are parsed as YAML files. The invalid entries are skipped
+// and reported once for each version of the file, the valid entries are still loaded.
+func loadAbsencePeriods(path string, log *logrus.Entry) ([]absencePeriod, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	availabilityCache.Lock()
+	defer availabilityCache.Unlock()
+	cached, ok := availabilityCache.files[path]
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.periods, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var periods []absencePeriod
+	var errs []error
+	if strings.EqualFold(filepath.Ext(path), ".ics") {
+		periods, errs = parseICalendarAbsences(content)
+	} else {
+		periods, errs = parseYAMLAbsences(content)
+	}
+	if len(errs) != 0 {
+		log.WithError(utilerrors.NewAggregate(errs)).Errorf("Skipped the invalid entries of the availability file %s.",
+			path)
+	}
+
+	availabilityCache.files[path] = cachedAvailability{modTime: info.ModTime(), size: info.Size(), periods: periods}
+	return periods, nil
+}
+
+// parseYAMLAbsences parses the absences from the YAML availability file, it returns the valid absences
+// and the errors of the invalid ones. The absences fall back to UTC if the time zone is invalid.
+func parseYAMLAbsences(content []byte) ([]absencePeriod, []error) {
+	var a availability
+	if err := yaml.Unmarshal(content, &a); err != nil {
+		return nil, []error{err}
+	}
+
+	var errs []error
+	location, err := time.LoadLocation(a.TimeZone)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid time zone %s, falling back to UTC: %v", a.TimeZone, err))
+		location = time.UTC
+	}
+
+	var periods []absencePeriod
+	for i, absence := range a.Absences {
+		if absence.Login == "" {
+			errs = append(errs, fmt.Errorf("the login of the absence %d is missing", i+1))
+			continue
+		}
+		start, _, err := parseAvailabilityTime(absence.Start, location)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid start %s of %s", absence.Start, absence.Login))
+			continue
+		}
+		end, isDate, err := parseAvailabilityTime(absence.End, location)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid end %s of %s", absence.End, absence.Login))
+			continue
+		}
+		if isDate {
+			end = end.AddDate(0, 0, 1)
+		}
+		periods = append(periods, absencePeriod{login: absence.Login, start: start, end: end})
+	}
+	return periods, errs
+}
+
+// parseAvailabilityTime parses the time in the YAML availability file, it returns true if the value is a date.
+func parseAvailabilityTime(value string, location *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(availabilityDateLayout, value, location); err == nil {
+		return t, true, nil
+	}
+	t, err := time.ParseInLocation(availabilityTimeLayout, value, location)
+	return t, false, err
+}
+
+// parseICalendarAbsences parses the absences from the events of the iCalendar file,
+// the summary of each event is the GitHub login of the reviewer. It returns the valid absences
+// and the errors of the invalid events.
+func parseICalendarAbsences(content []byte) ([]absencePeriod, []error) {
+	var periods []absencePeriod
+	var errs []error
+	var period *absencePeriod
+	// invalid is set when a property of the current event is invalid, so that the event is skipped.
+	var invalid error
+	for _, line := range unfoldICalendarLines(content) {
+		name, params, value := parseICalendarLine(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			period = &absencePeriod{}
+			invalid = nil
+		case name == "END" && value == "VEVENT":
+			if period == nil {
+				errs = append(errs, fmt.Errorf("unexpected END:VEVENT"))
+				continue
+			}
+			switch {
+			case invalid != nil:
+				errs = append(errs, fmt.Errorf("skipped the event of %s: %v", period.login, invalid))
+			case period.login == "" || period.start.IsZero():
+				errs = append(errs, fmt.Errorf("the SUMMARY or DTSTART of the event is missing"))
+			default:
+				if period.end.IsZero() {
+					period.end = period.start.AddDate(0, 0, 1)
+				}
+				periods = append(periods, *period)
+			}
+			period = nil
+		case period == nil:
+			continue
+		case name == "SUMMARY":
+			period.login = strings.TrimPrefix(strings.TrimSpace(value), "@")
+		case name == "DTSTART" || name == "DTEND":
+			t, err := parseICalendarTime(params, value)
+			if err != nil {
+				invalid = fmt.Errorf("invalid %s %s: %v", name, value, err)
+				continue
+			}
+			if name == "DTSTART" {
+				period.start = t
+			} else {
+				period.end = t
+			}
+		}
+	}
+	return periods, errs
+}
+
+// unfoldICalendarLines returns the content lines of the iCalendar file with the folded lines joined.
+func unfoldICalendarLines(content []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) != 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// parseICalendarLine returns the name, the parameters and the value of the content line.
+func parseICalendarLine(line string) (string, map[string]string, string) {
+	parts := strings.SplitN(line, ":", 2)
+	if len(parts) != 2 {
+		return "", nil, ""
+	}
+
+	params := make(map[string]string)
+	fields := strings.Split(parts[0], ";")
+	for _, field := range fields[1:] {
+		if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = kv[1]
+		}
+	}
+	return strings.ToUpper(fields[0]), params, parts[1]
+}
+
+// parseICalendarTime parses the DATE or DATE-TIME value, the floating time without the TZID is treated as UTC.
+func parseICalendarTime(params map[string]string, value string) (time.Time, error) {
+	location := time.UTC
+	if tzid, ok := params["TZID"]; ok {
+		var err error
+		if location, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if params["VALUE"] == "DATE" || len(value) == len(iCalendarDateLayout) {
+		return time.ParseInLocation(iCalendarDateLayout, value, location)
+	}
+	if strings.HasSuffix(value, "Z") {
+		return time.ParseInLocation(iCalendarTimeLayout, strings.TrimSuffix(value, "Z"), time.UTC)
+	}
+	return time.ParseInLocation(iCalendarTimeLayout, value, location)
+}
@@ -0,0 +1,230 @@
+package blunderbuss
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+)
+
+const yamlAvailability = `time_zone: Asia/Shanghai
+absences:
+  - login: reviewer1
+    start: 2021-06-01
+    end: 2021-06-10
+    reason: vacation
+  - login: Reviewer2
+    start: 2021-06-05 09:00
+    end: 2021-06-05 18:00
+  - login: reviewer3
+    start: 2021-05-01
+    end: 2021-05-10
+`
+
+const iCalendarAvailability = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:reviewer1\r\n" +
+	"DTSTART;VALUE=DATE:20210601\r\n" +
+	"DTEND;VALUE=DATE:20210611\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:@Review\r\n" +
+	" er2\r\n" +
+	"DTSTART;TZID=Asia/Shanghai:20210605T090000\r\n" +
+	"DTEND;TZID=Asia/Shanghai:20210605T180000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:reviewer3\r\n" +
+	"DTSTART:20210501T000000Z\r\n" +
+	"DTEND:20210510T000000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestListAwayReviewers(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"availability.yaml": yamlAvailability,
+		"availability.ics":  iCalendarAvailability,
+		"broken.yaml":       "absences:\n  - login: reviewer1\n    start: tomorrow\n",
+		"partial.yaml": "absences:\n  - login: reviewer1\n    start: tomorrow\n    end: 2021-06-10\n" +
+			"  - start: 2021-06-01\n    end: 2021-06-10\n" +
+			"  - login: reviewer2\n    start: 2021-06-01\n    end: 2021-06-10\n",
+		"invalid-time-zone.yaml": "time_zone: Mars/Olympus\n" +
+			"absences:\n  - login: reviewer1\n    start: 2021-06-01\n    end: 2021-06-10\n",
+		"partial.ics": "BEGIN:VCALENDAR\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			"SUMMARY:reviewer1\r\n" +
+			"DTSTART;TZID=Mars/Olympus:20210605T090000\r\n" +
+			"END:VEVENT\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			"DTSTART;VALUE=DATE:20210601\r\n" +
+			"END:VEVENT\r\n" +
+			"BEGIN:VEVENT\r\n" +
+			"SUMMARY:reviewer2\r\n" +
+			"DTSTART;VALUE=DATE:20210601\r\n" +
+			"DTEND;VALUE=DATE:20210611\r\n" +
+			"END:VEVENT\r\n" +
+			"END:VCALENDAR\r\n",
+		"malformed.yaml": "absences: [\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write the availability file: %v", err)
+		}
+	}
+
+	var testcases = []struct {
+		name   string
+		file   string
+		time   time.Time
+		expect []string
+	}{
+		{
+			name:   "yaml in the whole day absence",
+			file:   "availability.yaml",
+			time:   time.Date(2021, 6, 10, 15, 0, 0, 0, time.UTC),
+			expect: []string{"reviewer1"},
+		},
+		{
+			name:   "yaml after the whole day absence",
+			file:   "availability.yaml",
+			time:   time.Date(2021, 6, 10, 16, 0, 0, 0, time.UTC),
+			expect: []string{},
+		},
+		{
+			name:   "yaml in the overlapped absences",
+			file:   "availability.yaml",
+			time:   time.Date(2021, 6, 5, 2, 0, 0, 0, time.UTC),
+			expect: []string{"reviewer1", "reviewer2"},
+		},
+		{
+			name:   "ics in the whole day absence",
+			file:   "availability.ics",
+			time:   time.Date(2021, 6, 10, 23, 0, 0, 0, time.UTC),
+			expect: []string{"reviewer1"},
+		},
+		{
+			name:   "ics in the overlapped absences",
+			file:   "availability.ics",
+			time:   time.Date(2021, 6, 5, 2, 0, 0, 0, time.UTC),
+			expect: []string{"reviewer1", "reviewer2"},
+		},
+		{
+			name:   "ics in the absence with UTC time",
+			file:   "availability.ics",
+			time:   time.Date(2021, 5, 9, 23, 0, 0, 0, time.UTC),
+			expect: []string{"reviewer3"},
+		},
+		{
+			name:   "yaml with the invalid entries skipped",
+			file:   "partial.yaml",
+			time:   time.Date(2021, 6, 5, 2, 0, 0, 0, time.UTC),
+			expect: []string{"reviewer2"},
+		},
+		{
+			name:   "yaml with the invalid time zone falling back to UTC",
+			file:   "invalid-time-zone.yaml",
+			time:   time.Date(2021, 6, 10, 23, 0, 0, 0, time.UTC),
+			expect: []string{"reviewer1"},
+		},
+		{
+			name:   "ics with the invalid events skipped",
+			file:   "partial.ics",
+			time:   time.Date(2021, 6, 5, 2, 0, 0, 0, time.UTC),
+			expect: []string{"reviewer2"},
+		},
+		{
+			name:   "malformed file",
+			file:   "malformed.yaml",
+			time:   time.Date(2021, 6, 5, 2, 0, 0, 0, time.UTC),
+			expect: []string{},
+		},
+		{
+			name:   "broken file",
+			file:   "broken.yaml",
+			time:   time.Date(2021, 6, 5, 2, 0, 0, 0, time.UTC),
+			expect: []string{},
+		},
+		{
+			name:   "missing file",
+			file:   "missing.yaml",
+			time:   time.Date(2021, 6, 5, 2, 0, 0, 0, time.UTC),
+			expect: []string{},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			away := listAwayReviewers(filepath.Join(dir, tc.file), tc.time, logrus.WithField("plugin", PluginName))
+			if !reflect.DeepEqual(away.List(), tc.expect) {
+				t.Errorf("away reviewers mismatch: got %v, want %v", away.List(), tc.expect)
+			}
+		})
+	}
+}
+
+func TestListAwayReviewersAfterChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "availability.yaml")
+	now := time.Date(2021, 6, 5, 2, 0, 0, 0, time.UTC)
+	log := logrus.WithField("plugin", PluginName)
+
+	if err := os.WriteFile(path, []byte(yamlAvailability), 0600); err != nil {
+		t.Fatalf("failed to write the availability file: %v", err)
+	}
+	CheckAvailabilityFiles(&externalplugins.Configuration{
+		TiCommunityBlunderbuss: []externalplugins.TiCommunityBlunderbuss{{AvailabilityFile: path}},
+	}, log)
+	if away := listAwayReviewers(path, now, log); !reflect.DeepEqual(away.List(), []string{"reviewer1", "reviewer2"}) {
+		t.Errorf("away reviewers mismatch: got %v", away.List())
+	}
+
+	// The file is parsed again when it changes.
+	content := "absences:\n  - login: reviewer3\n    start: 2021-06-01\n    end: 2021-06-10\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write the availability file: %v", err)
+	}
+	if away := listAwayReviewers(path, now, log); !reflect.DeepEqual(away.List(), []string{"reviewer3"}) {
+		t.Errorf("away reviewers mismatch after the change: got %v", away.List())
+	}
+}
+
+func TestHandleWithAwayReviewers(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2021, 6, 5, 2, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	path := filepath.Join(t.TempDir(), "availability.yaml")
+	if err := os.WriteFile(path, []byte(yamlAvailability), 0600); err != nil {
+		t.Fatalf("failed to write the availability file: %v", err)
+	}
+
+	pr := &github.PullRequest{Number: 5, User: github.User{Login: "author"}}
+	fc := newFakeGitHubClient(pr, nil, nil)
+	foc := &fakeOwnersClient{reviewers: []string{"reviewer1", "reviewer2", "reviewer3", "reviewer4"}}
+	opts := &externalplugins.TiCommunityBlunderbuss{
+		Repos:            []string{"org/repo"},
+		MaxReviewerCount: 2,
+		AvailabilityFile: path,
+	}
+	repo := &github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}
+
+	err := handle(fc, opts, repo, pr, logrus.WithField("plugin", PluginName), foc, nil, "")
+	if err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+
+	expect := []string{"reviewer3", "reviewer4"}
+	if !reflect.DeepEqual(fc.requested, expect) {
+		t.Errorf("requested reviewers mismatch: got %v, want %v", fc.requested, expect)
+	}
+}
@@ -0,0 +1,213 @@
+package blunderbuss
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	git "k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/utils/exec"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+var (
+	// hunkHeaderRe matches the hunk header of the patch, such as `@@ -10,7 +10,8 @@`.
+	hunkHeaderRe = regexp.MustCompile(`(?m)^@@ -(\d+)(?:,(\d+))? \+\d+(?:,\d+)? @@`)
+	// noreplyEmailRe matches the noreply email of GitHub, such as `12345+login@users.noreply.github.com`.
+	noreplyEmailRe = regexp.MustCompile(`^(?:\d+\+)?([^@]+)@users\.noreply\.github\.com$`)
+	// blameHeaderRe matches the header line of each line in the porcelain format of git blame.
+	blameHeaderRe = regexp.MustCompile(`^([0-9a-f]{40}) \d+ \d+`)
+)
+
+// emailLogins caches the GitHub logins of the commit author emails, it is shared by all the pull requests
+// because the authors of the commits never change.
+var emailLogins = struct {
+	sync.Mutex
+	logins map[string]string
+}{logins: make(map[string]string)}
+
+// lineRange is a range of the lines in a file.
+type lineRange struct {
+	start, count int
+}
+
+// blameLine is the author information of a line in git blame.
+type blameLine struct {
+	sha   string
+	email string
+	time  time.Time
+}
+
+// listBlameContributors returns the weights of the authors of the lines modified by the pull request in the base
+// branch. The weight of each line decays by half every half-life days since it was committed.
+func listBlameContributors(gc githubClient, gcf git.ClientFactory, opts *tiexternalplugins.TiCommunityBlunderbuss,
+	org, repo string, pr *github.PullRequest, log *logrus.Entry) (map[string]uint, error) {
+	changes, err := gc.GetPullRequestChanges(org, repo, pr.Number)
+	if err != nil {
+		return nil, fmt.Errorf("error get pull request changes: %v", err)
+	}
+
+	r, err := gcf.ClientFor(org, repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get git client for %s/%s: %v", org, repo, err)
+	}
+	defer func() {
+		if err := r.Clean(); err != nil {
+			log.WithError(err).Error("Error cleaning up repo.")
+		}
+	}()
+
+	if exists, err := r.CommitExists(pr.Base.SHA); err != nil || !exists {
+		return nil, fmt.Errorf("the base commit %s does not exist in the clone", pr.Base.SHA)
+	}
+
+	now := timeNow()
+	scores := make(map[string]float64)
+	commits := make(map[string]string)
+	for _, change := range changes {
+		// The new files have no history.
+		if change.Status == "added" {
+			continue
+		}
+		filename := change.Filename
+		if change.PreviousFilename != "" {
+			filename = change.PreviousFilename
+		}
+
+		ranges := parseHunkRanges(change.Patch)
+		// GitHub omits the patch of the large changes, so the whole file is blamed.
+		if change.Patch == "" {
+			ranges = []lineRange{{}}
+		}
+
+		for _, lr := range ranges {
+			lines, err := blame(r.Directory(), pr.Base.SHA, filename, lr)
+			if err != nil {
+				log.WithError(err).Warnf("Failed to blame %s.", filename)
+				continue
+			}
+			for _, line := range lines {
+				age := now.Sub(line.time).Hours() / 24
+				if age < 0 {
+					age = 0
+				}
+				scores[line.email] += math.Pow(0.5, age/float64(opts.BlameHalfLifeDays))
+				commits[line.email] = line.sha
+			}
+		}
+	}
+
+	contributors := make(map[string]uint)
+	for email, score := range scores {
+		login := resolveEmailLogin(gc, org, repo, email, commits[email], log)
+		if login == "" {
+			continue
+		}
+		contributors[login] += uint(math.Ceil(score))
+	}
+	return contributors, nil
+}
+
+// parseHunkRanges returns the ranges of the lines in the base file that the hunks of the patch cover,
+// the context lines around the changes are included.
+func parseHunkRanges(patch string) []lineRange {
+	var ranges []lineRange
+	for _, match := range hunkHeaderRe.FindAllStringSubmatch(patch, -1) {
+		start, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+		count := 1
+		if match[2] != "" {
+			if count, err = strconv.Atoi(match[2]); err != nil {
+				continue
+			}
+		}
+		if start == 0 || count == 0 {
+			continue
+		}
+		ranges = append(ranges, lineRange{start: start, count: count})
+	}
+	return ranges
+}
+
+// blame returns the author information of the lines of the file at the revision,
+// the whole file is blamed if the range is empty.
+func blame(dir, revision, filename string, lr lineRange) ([]blameLine, error) {
+	args := []string{"blame", "--line-porcelain"}
+	if lr.count > 0 {
+		args = append(args, "-L", fmt.Sprintf("%d,+%d", lr.start, lr.count))
+	}
+	args = append(args, revision, "--", filename)
+
+	cmd := exec.New().Command("git", args...)
+	cmd.SetDir(dir)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseBlamePorcelain(out)
+}
+
+// parseBlamePorcelain parses the output of git blame in the line porcelain format.
+func parseBlamePorcelain(out []byte) ([]blameLine, error) {
+	var lines []blameLine
+	var line blameLine
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			lines = append(lines, line)
+			line = blameLine{}
+		case blameHeaderRe.MatchString(text):
+			line.sha = blameHeaderRe.FindStringSubmatch(text)[1]
+		case strings.HasPrefix(text, "author-mail "):
+			line.email = strings.Trim(strings.TrimPrefix(text, "author-mail "), "<>")
+		case strings.HasPrefix(text, "author-time "):
+			seconds, err := strconv.ParseInt(strings.TrimPrefix(text, "author-time "), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid author time %s", text)
+			}
+			line.time = time.Unix(seconds, 0)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// resolveEmailLogin returns the GitHub login of the commit author email, it is parsed from the noreply email
+// or found by the commit on GitHub. It returns empty if the author is not a GitHub user.
+func resolveEmailLogin(gc githubClient, org, repo, email, sha string, log *logrus.Entry) string {
+	if match := noreplyEmailRe.FindStringSubmatch(email); match != nil {
+		return match[1]
+	}
+
+	emailLogins.Lock()
+	login, ok := emailLogins.logins[email]
+	emailLogins.Unlock()
+	if ok {
+		return login
+	}
+
+	commit, err := gc.GetSingleCommit(org, repo, sha)
+	if err != nil {
+		log.WithError(err).Warnf("Failed to get the author of commit %s.", sha)
+		return ""
+	}
+	login = commit.Author.Login
+
+	emailLogins.Lock()
+	emailLogins.logins[email] = login
+	emailLogins.Unlock()
+	return login
+}
@@ -0,0 +1,172 @@
+package blunderbuss
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/git/localgit"
+	"k8s.io/test-infra/prow/github"
+)
+
+// commitAs commits the file with the author and the date.
+func commitAs(t *testing.T, dir, author, date, file, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	for _, args := range [][]string{
+		{"add", file},
+		{"commit", "-m", "update " + file, "--author", author},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("failed to run git %v: %v, %s", args, err, out)
+		}
+	}
+}
+
+func TestParseHunkRanges(t *testing.T) {
+	var testcases = []struct {
+		name   string
+		patch  string
+		expect []lineRange
+	}{
+		{
+			name:   "multiple hunks",
+			patch:  "@@ -1,5 +1,6 @@ package main\n context\n+added\n@@ -20,7 +21,6 @@\n-removed\n",
+			expect: []lineRange{{start: 1, count: 5}, {start: 20, count: 7}},
+		},
+		{
+			name:   "single line hunk",
+			patch:  "@@ -3 +3 @@\n-a\n+b\n",
+			expect: []lineRange{{start: 3, count: 1}},
+		},
+		{
+			name:  "insertion into the empty file",
+			patch: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "no hunks",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			ranges := parseHunkRanges(tc.patch)
+			if !reflect.DeepEqual(ranges, tc.expect) {
+				t.Errorf("ranges mismatch: got %v, want %v", ranges, tc.expect)
+			}
+		})
+	}
+}
+
+func TestListBlameContributors(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	lg, gcf, err := localgit.NewV2()
+	if err != nil {
+		t.Fatalf("Making localgit: %v", err)
+	}
+	defer func() {
+		if err := lg.Clean(); err != nil {
+			t.Errorf("Cleaning up localgit: %v", err)
+		}
+		if err := gcf.Clean(); err != nil {
+			t.Errorf("Cleaning up client: %v", err)
+		}
+	}()
+	if err := lg.MakeFakeRepo("org", "repo"); err != nil {
+		t.Fatalf("Making fake repo: %v", err)
+	}
+	dir := filepath.Join(lg.Dir, "org", "repo")
+	lines := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"}
+	commitAs(t, dir, "alice <12345+alice@users.noreply.github.com>", "2019-06-01T00:00:00Z",
+		"a.go", strings.Join(lines, "\n")+"\n")
+	copy(lines[5:], []string{"six", "seven", "eight", "nine", "ten"})
+	commitAs(t, dir, "bob <bob@example.com>", "2021-05-31T00:00:00Z",
+		"a.go", strings.Join(lines, "\n")+"\n")
+	commitAs(t, dir, "carol <carol@example.com>", "2021-05-31T00:00:00Z",
+		"b.go", "b\n")
+	baseSHA, err := lg.RevParse("org", "repo", "HEAD")
+	if err != nil {
+		t.Fatalf("Getting base SHA: %v", err)
+	}
+	bobSHA, err := lg.RevParse("org", "repo", "HEAD~1")
+	if err != nil {
+		t.Fatalf("Getting commit SHA: %v", err)
+	}
+
+	changes := []github.PullRequestChange{
+		{
+			Filename: "a.go",
+			Status:   "modified",
+			Patch:    "@@ -4,5 +4,6 @@\n 4\n 5\n+new\n six\n seven\n eight\n",
+		},
+		{
+			Filename: "c.go",
+			Status:   "added",
+			Patch:    "@@ -0,0 +1 @@\n+c\n",
+		},
+	}
+
+	var testcases = []struct {
+		name               string
+		baseSHA            string
+		expectContributors map[string]uint
+		expectFallback     bool
+	}{
+		{
+			name:    "blame the modified lines",
+			baseSHA: strings.TrimSpace(baseSHA),
+			// The two lines of alice decay to about 0.12 and the three lines of bob decay to about 2.99.
+			expectContributors: map[string]uint{"alice": 1, "bob": 3},
+		},
+		{
+			name:           "base commit not in the clone",
+			baseSHA:        "0000000000000000000000000000000000000000",
+			expectFallback: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			pr := &github.PullRequest{Number: 5, Base: github.PullRequestBranch{SHA: tc.baseSHA}}
+			fc := newFakeGitHubClient(pr, changes, nil)
+			fc.commits = map[string]github.RepositoryCommit{
+				strings.TrimSpace(bobSHA): {Author: github.User{Login: "bob"}},
+			}
+			opts := &externalplugins.TiCommunityBlunderbuss{BlameHalfLifeDays: 180}
+
+			contributors, err := listBlameContributors(fc, gcf, opts, "org", "repo", pr,
+				logrus.WithField("plugin", PluginName))
+			if tc.expectFallback {
+				if err == nil {
+					t.Fatalf("expected error to fall back, but got contributors %v", contributors)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+			if !reflect.DeepEqual(contributors, tc.expectContributors) {
+				t.Errorf("contributors mismatch: got %v, want %v", contributors, tc.expectContributors)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package blunderbuss
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+const (
+	blameWeightSource   = "the number of the modified lines written by the reviewer, decayed by the age of the lines"
+	commitsWeightSource = "the number of the commits to the changed files by the reviewer"
+	loadWeightSource    = ", down-weighted by the open review requests and the recent review latency"
+)
+
+// reviewerSelection records how the reviewers are selected, it is used to explain the selection to the contributors.
+type reviewerSelection struct {
+	// candidates are the reviewers of the PR loaded from the owners.
+	candidates []string
+	// exclusions maps the excluded candidates to the reasons.
+	exclusions map[string]string
+	// weights maps the available reviewers to their weights, it is nil if all of them are selected.
+	weights map[string]uint
+	// weightSource describes how the weights are calculated.
+	weightSource string
+	// reviewers are the selected reviewers.
+	reviewers []string
+}
+
+func newReviewerSelection(candidates []string) *reviewerSelection {
+	return &reviewerSelection{
+		candidates: candidates,
+		exclusions: make(map[string]string),
+	}
+}
+
+// exclusionReason returns the reason why the candidate is not available.
+func exclusionReason(candidate, author string, opts *tiexternalplugins.TiCommunityBlunderbuss,
+	requestedReviewers []github.User, awayReviewers sets.String) string {
+	login := github.NormLogin(candidate)
+	if login == github.NormLogin(author) {
+		return "the author of the PR"
+	}
+	for _, reviewer := range requestedReviewers {
+		if github.NormLogin(reviewer.Login) == login {
+			return "already requested"
+		}
+	}
+	if awayReviewers.Has(login) {
+		return "away according to the availability calendar"
+	}
+	if len(opts.IncludeReviewers) != 0 && !sets.NewString(opts.IncludeReviewers...).Has(candidate) {
+		return "not in `include_reviewers`"
+	}
+	if sets.NewString(opts.ExcludeReviewers...).Has(candidate) {
+		return "in `exclude_reviewers`"
+	}
+	return "unavailable"
+}
+
+// explainSelection returns the collapsible explanation of the reviewer selection.
+func explainSelection(selection *reviewerSelection) string {
+	var explanation strings.Builder
+	explanation.WriteString("<details>\n<summary>Why were these reviewers requested?</summary>\n\n")
+	fmt.Fprintf(&explanation, "Candidates from the OWNERS: %s\n\n", strings.Join(selection.candidates, ", "))
+
+	selected := sets.NewString(selection.reviewers...)
+	candidates := append([]string(nil), selection.candidates...)
+	sort.Strings(candidates)
+	explanation.WriteString("| Reviewer | Weight | Result |\n| --- | --- | --- |\n")
+	for _, candidate := range candidates {
+		weight := "-"
+		if w, ok := selection.weights[candidate]; ok {
+			weight = fmt.Sprintf("%d", w)
+		}
+
+		result := "not picked"
+		if reason, ok := selection.exclusions[candidate]; ok {
+			result = "excluded: " + reason
+		} else if selected.Has(candidate) {
+			result = "**requested**"
+		}
+		fmt.Fprintf(&explanation, "| %s | %s | %s |\n", candidate, weight, result)
+	}
+
+	if selection.weights == nil {
+		explanation.WriteString("\nAll the available reviewers are requested because there are not more of them " +
+			"than the maximum reviewer count.\n")
+	} else {
+		fmt.Fprintf(&explanation, "\nThe reviewers are picked randomly by the weight, which is %s. "+
+			"The weight of the reviewers without contributions defaults to %d.\n",
+			selection.weightSource, defaultWeight)
+	}
+	explanation.WriteString("</details>")
+	return explanation.String()
+}
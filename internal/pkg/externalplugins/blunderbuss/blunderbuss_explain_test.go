@@ -0,0 +1,123 @@
+package blunderbuss
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestHandleWithSelectionExplanation(t *testing.T) {
+	var testcases = []struct {
+		name             string
+		maxReviewerCount int
+		explainSelection bool
+		reviewers        []string
+		fileCommits      map[string][]github.RepositoryCommit
+
+		expectComment bool
+		expectRows    []string
+		expectText    string
+	}{
+		{
+			name:             "explain the weighted selection",
+			maxReviewerCount: 1,
+			explainSelection: true,
+			reviewers:        []string{"author", "requested", "excluded", "reviewer1", "reviewer2"},
+			fileCommits: map[string][]github.RepositoryCommit{
+				"a.go": {
+					{Author: github.User{Login: "reviewer1"}},
+					{Author: github.User{Login: "reviewer1"}},
+					{Author: github.User{Login: "reviewer1"}},
+				},
+			},
+			expectComment: true,
+			expectRows: []string{
+				"| author | - | excluded: the author of the PR |",
+				"| excluded | - | excluded: in `exclude_reviewers` |",
+				"| requested | - | excluded: already requested |",
+				"| reviewer1 | 3 |",
+				"| reviewer2 | 1 |",
+			},
+			expectText: commitsWeightSource,
+		},
+		{
+			name:             "explain the selection of all reviewers",
+			maxReviewerCount: 2,
+			explainSelection: true,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			expectComment:    true,
+			expectRows: []string{
+				"| reviewer1 | - | **requested** |",
+				"| reviewer2 | - | **requested** |",
+			},
+			expectText: "All the available reviewers are requested",
+		},
+		{
+			name:             "explanation disabled",
+			maxReviewerCount: 1,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+		},
+		{
+			name:             "no reviewers to explain",
+			maxReviewerCount: 1,
+			explainSelection: true,
+			reviewers:        []string{"author"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			pr := &github.PullRequest{
+				Number:             5,
+				User:               github.User{Login: "author"},
+				RequestedReviewers: []github.User{{Login: "requested"}},
+			}
+			fc := newFakeGitHubClient(pr, []github.PullRequestChange{{Filename: "a.go"}}, tc.fileCommits)
+			foc := &fakeOwnersClient{reviewers: tc.reviewers}
+			opts := &externalplugins.TiCommunityBlunderbuss{
+				Repos:            []string{"org/repo"},
+				MaxReviewerCount: tc.maxReviewerCount,
+				ExcludeReviewers: []string{"excluded"},
+				ExplainSelection: tc.explainSelection,
+			}
+			repo := &github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}
+
+			err := handle(fc, opts, repo, pr, logrus.WithField("plugin", PluginName), foc, nil, "")
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			if !tc.expectComment {
+				if len(fc.createdComments) != 0 {
+					t.Fatalf("expected no comment, but got %v", fc.createdComments)
+				}
+				return
+			}
+			if len(fc.createdComments) != 1 {
+				t.Fatalf("expected one comment, but got %v", fc.createdComments)
+			}
+			comment := fc.createdComments[0]
+			if !strings.HasPrefix(comment, "<details>") || !strings.HasSuffix(comment, "</details>") {
+				t.Errorf("expected the collapsible comment, but got %s", comment)
+			}
+			for _, row := range tc.expectRows {
+				if !strings.Contains(comment, row) {
+					t.Errorf("expected the row %q in the comment %s", row, comment)
+				}
+			}
+			if !strings.Contains(comment, tc.expectText) {
+				t.Errorf("expected %q in the comment %s", tc.expectText, comment)
+			}
+			for _, reviewer := range fc.requested {
+				if !strings.Contains(comment, "| "+reviewer+" | ") ||
+					strings.Count(comment, "**requested**") != len(fc.requested) {
+					t.Errorf("expected the requested reviewer %s in the comment %s", reviewer, comment)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package blunderbuss
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+const (
+	// maxLatencySamples specifies the max number of the recently reviewed pull requests
+	// used to estimate the review latency of a reviewer.
+	maxLatencySamples = 5
+	// loadWeightScale scales up the weight before it is down-weighted by the load,
+	// so that the contribution weights are still distinguishable.
+	loadWeightScale = 100
+	// reviewerLoadTTL specifies how long the review loads of the reviewers are cached.
+	reviewerLoadTTL = 10 * time.Minute
+	// openRequestsBatchSize specifies the max number of the reviewers whose open review requests
+	// are counted in one query.
+	openRequestsBatchSize = 50
+)
+
+// timeNow returns the current time, it is replaced in the tests.
+var timeNow = time.Now
+
+// reviewerLoad is the current review load of a reviewer.
+type reviewerLoad struct {
+	// openRequests is the number of the open pull requests requesting the review of the reviewer in the org.
+	openRequests int
+	// latency is the average time from the review requests of the recently reviewed pull requests to the first
+	// reviews of the reviewer, it is zero if the reviewer has no recent reviews or its latency is not estimated.
+	latency time.Duration
+}
+
+// reviewerLoadCache caches the review loads of the reviewers in each org, it is shared by all the pull requests
+// so that the loads are not fetched again for every pull request within reviewerLoadTTL.
+var reviewerLoadCache = struct {
+	sync.Mutex
+	values map[string]cachedLoadValue
+}{values: make(map[string]cachedLoadValue)}
+
+// cachedLoadValue is a cached value of the review load and the time when it is fetched.
+type cachedLoadValue struct {
+	value     int64
+	fetchedAt time.Time
+}
+
+// cachedLoadValueOf returns the cached value of the key if it is not expired.
+func cachedLoadValueOf(key string, now time.Time) (int64, bool) {
+	reviewerLoadCache.Lock()
+	defer reviewerLoadCache.Unlock()
+	cached, ok := reviewerLoadCache.values[key]
+	if !ok || now.Sub(cached.fetchedAt) >= reviewerLoadTTL {
+		return 0, false
+	}
+	return cached.value, true
+}
+
+// setCachedLoadValue caches the value of the key fetched at now, and prunes the expired values.
+func setCachedLoadValue(key string, value int64, now time.Time) {
+	reviewerLoadCache.Lock()
+	defer reviewerLoadCache.Unlock()
+	for k, v := range reviewerLoadCache.values {
+		if now.Sub(v.fetchedAt) >= reviewerLoadTTL {
+			delete(reviewerLoadCache.values, k)
+		}
+	}
+	reviewerLoadCache.values[key] = cachedLoadValue{value: value, fetchedAt: now}
+}
+
+// getCachedLoadValue returns the cached value of the key if it is not expired, otherwise it fetches the value
+// and caches it. The value is not cached if it fails to be fetched.
+func getCachedLoadValue(key string, fetch func() (int64, error)) (int64, error) {
+	now := timeNow()
+	if value, ok := cachedLoadValueOf(key, now); ok {
+		return value, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return 0, err
+	}
+	setCachedLoadValue(key, value, now)
+	return value, nil
+}
+
+// listReviewerLoads returns the review loads of the reviewers. The open review requests of the reviewers are
+// counted in batches, while the review latency takes several requests for each reviewer, so it is only estimated
+// for the latencyReviewers. The loads are cached per org, and failing to get the load of a reviewer
+// is treated as no load.
+func listReviewerLoads(gc githubClient, opts *tiexternalplugins.TiCommunityBlunderbuss, org, repo string,
+	reviewers, latencyReviewers sets.String, log *logrus.Entry) map[string]reviewerLoad {
+	now := timeNow()
+	openRequestsKey := func(reviewer string) string {
+		return fmt.Sprintf("%s:open-requests:%s", org, github.NormLogin(reviewer))
+	}
+
+	loads := make(map[string]reviewerLoad)
+	var uncachedReviewers []string
+	for _, reviewer := range reviewers.List() {
+		if openRequests, ok := cachedLoadValueOf(openRequestsKey(reviewer), now); ok {
+			loads[reviewer] = reviewerLoad{openRequests: int(openRequests)}
+			continue
+		}
+		uncachedReviewers = append(uncachedReviewers, reviewer)
+	}
+	if len(uncachedReviewers) != 0 {
+		counts, err := countOpenReviewRequests(gc, org, uncachedReviewers)
+		if err != nil {
+			log.WithError(err).Warnf("Failed to count the open review requests of %s.", uncachedReviewers)
+		}
+		for reviewer, count := range counts {
+			setCachedLoadValue(openRequestsKey(reviewer), int64(count), now)
+			loads[reviewer] = reviewerLoad{openRequests: count}
+		}
+	}
+
+	for _, reviewer := range reviewers.Intersection(latencyReviewers).List() {
+		key := fmt.Sprintf("%s/%s:latency:%d:%s", org, repo, opts.ReviewLatencyDays, github.NormLogin(reviewer))
+		latency, err := getCachedLoadValue(key, func() (int64, error) {
+			latency, err := estimateReviewLatency(gc, org, repo, reviewer, opts.ReviewLatencyDays)
+			return int64(latency), err
+		})
+		if err != nil {
+			log.WithError(err).Warnf("Failed to estimate the review latency of %s.", reviewer)
+		}
+		load := loads[reviewer]
+		load.latency = time.Duration(latency)
+		loads[reviewer] = load
+	}
+	return loads
+}
+
+// searchCount is the number of the issues found by a search.
+type searchCount struct {
+	IssueCount githubql.Int
+}
+
+// openRequestsSearchQuery returns the search query of the open pull requests requesting the review of the user
+// in the org.
+func openRequestsSearchQuery(org, login string) string {
+	return fmt.Sprintf("org:%s is:pr is:open user-review-requested:%s", org, login)
+}
+
+// newOpenRequestsQuery returns the query which counts the open review requests of the reviewers in one request,
+// the search of each reviewer is aliased by its index, such as:
+//
+//	reviewer0: search(query: $query0, type: ISSUE) { issueCount }
+//	reviewer1: search(query: $query1, type: ISSUE) { issueCount }
+func newOpenRequestsQuery(org string, logins []string, vars map[string]interface{}) reflect.Value {
+	fields := make([]reflect.StructField, 0, len(logins))
+	for i, login := range logins {
+		query := fmt.Sprintf("query%d", i)
+		vars[query] = githubql.String(openRequestsSearchQuery(org, login))
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Search%d", i),
+			Type: reflect.TypeOf(searchCount{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"reviewer%d: search(query: $%s, type: ISSUE)"`, i, query)),
+		})
+	}
+	return reflect.New(reflect.StructOf(fields))
+}
+
+// countOpenReviewRequests returns the number of the open pull requests requesting the review of each user
+// in the org. The users are counted in batches instead of one search for each user, which would soon reach
+// the rate limit of the search API.
+func countOpenReviewRequests(gc githubClient, org string, logins []string) (map[string]int, error) {
+	counts := make(map[string]int, len(logins))
+	for start := 0; start < len(logins); start += openRequestsBatchSize {
+		end := start + openRequestsBatchSize
+		if end > len(logins) {
+			end = len(logins)
+		}
+		batch := logins[start:end]
+
+		vars := make(map[string]interface{})
+		q := newOpenRequestsQuery(org, batch, vars)
+		if err := gc.QueryWithGitHubAppsSupport(context.Background(), q.Interface(), vars, org); err != nil {
+			return counts, err
+		}
+		for i, login := range batch {
+			counts[login] = int(q.Elem().Field(i).Interface().(searchCount).IssueCount)
+		}
+	}
+	return counts, nil
+}
+
+// estimateReviewLatency returns the average time from the review requests of the pull requests reviewed by the user
+// in the recent days to the first reviews of the user. The time before the user is requested is not counted,
+// and the pull requests reviewed without being requested are not sampled.
+func estimateReviewLatency(gc githubClient, org, repo, login string, days int) (time.Duration, error) {
+	since := timeNow().AddDate(0, 0, -days).Format("2006-01-02")
+	query := fmt.Sprintf("repo:%s/%s is:pr reviewed-by:%s updated:>=%s", org, repo, login, since)
+	issues, err := gc.FindIssuesWithOrg(org, query, "updated", false)
+	if err != nil {
+		return 0, err
+	}
+
+	var total time.Duration
+	var samples int
+	for _, issue := range issues {
+		if samples >= maxLatencySamples {
+			break
+		}
+
+		reviews, err := gc.ListReviews(org, repo, issue.Number)
+		if err != nil {
+			return 0, err
+		}
+
+		var firstReviewAt time.Time
+		for _, review := range reviews {
+			if github.NormLogin(review.User.Login) != github.NormLogin(login) {
+				continue
+			}
+			if firstReviewAt.IsZero() || review.SubmittedAt.Before(firstReviewAt) {
+				firstReviewAt = review.SubmittedAt
+			}
+		}
+		if firstReviewAt.IsZero() {
+			continue
+		}
+
+		requests, err := listReviewRequests(gc, org, repo, issue.Number)
+		if err != nil {
+			return 0, err
+		}
+		// The latest request before the first review is the one the user responded to.
+		var requestedAt time.Time
+		for _, t := range requests[github.NormLogin(login)] {
+			if !t.After(firstReviewAt) {
+				requestedAt = latest(requestedAt, t)
+			}
+		}
+		if requestedAt.IsZero() {
+			continue
+		}
+
+		total += firstReviewAt.Sub(requestedAt)
+		samples++
+	}
+
+	if samples == 0 {
+		return 0, nil
+	}
+	return total / time.Duration(samples), nil
+}
+
+// filterOverloadedReviewers returns the reviewers whose open review requests have not reached the limit.
+func filterOverloadedReviewers(reviewers sets.String, loads map[string]reviewerLoad, maxOpenReviewRequests int,
+	log *logrus.Entry) sets.String {
+	if maxOpenReviewRequests <= 0 {
+		return reviewers
+	}
+
+	availableReviewers := sets.NewString()
+	for _, reviewer := range reviewers.List() {
+		if loads[reviewer].openRequests >= maxOpenReviewRequests {
+			log.Infof("Skipping %s who already has %d open review requests.", reviewer, loads[reviewer].openRequests)
+			continue
+		}
+		availableReviewers.Insert(reviewer)
+	}
+	return availableReviewers
+}
+
+// loadWeight returns the weight down-weighted by the open review requests and the review latency in days.
+func loadWeight(weight uint, load reviewerLoad) uint {
+	factor := float64(1+load.openRequests) * (1 + load.latency.Hours()/24)
+	w := uint(float64(weight*loadWeightScale) / factor)
+	if w == 0 {
+		return 1
+	}
+	return w
+}
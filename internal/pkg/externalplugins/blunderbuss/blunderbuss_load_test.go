@@ -0,0 +1,322 @@
+package blunderbuss
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+)
+
+func openRequestsQuery(login string) string {
+	return "org:org is:pr is:open user-review-requested:" + login
+}
+
+func resetReviewerLoadCache() {
+	reviewerLoadCache.Lock()
+	reviewerLoadCache.values = make(map[string]cachedLoadValue)
+	reviewerLoadCache.Unlock()
+}
+
+func TestEstimateReviewLatency(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+	createdAt := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	query := "repo:org/repo is:pr reviewed-by:reviewer1 updated:>=2021-05-31"
+	requestedEvent := func(login string, after time.Duration) reviewRequestNode {
+		var node reviewRequestNode
+		node.ReviewRequestedEvent.CreatedAt = githubql.DateTime{Time: createdAt.Add(after)}
+		node.ReviewRequestedEvent.RequestedReviewer.User.Login = githubql.String(login)
+		return node
+	}
+
+	var testcases = []struct {
+		name          string
+		issues        []github.Issue
+		reviews       map[int][]github.Review
+		requests      map[int][]reviewRequestNode
+		expectLatency time.Duration
+	}{
+		{
+			name:          "no recent reviews",
+			expectLatency: 0,
+		},
+		{
+			name: "average from the review requests to the first reviews",
+			issues: []github.Issue{
+				{Number: 1, CreatedAt: createdAt},
+				{Number: 2, CreatedAt: createdAt},
+			},
+			reviews: map[int][]github.Review{
+				1: {
+					{User: github.User{Login: "reviewer1"}, SubmittedAt: createdAt.Add(6 * time.Hour)},
+					{User: github.User{Login: "reviewer1"}, SubmittedAt: createdAt.Add(2 * time.Hour)},
+				},
+				2: {
+					{User: github.User{Login: "reviewer2"}, SubmittedAt: createdAt.Add(time.Hour)},
+					{User: github.User{Login: "Reviewer1"}, SubmittedAt: createdAt.Add(10 * time.Hour)},
+				},
+			},
+			requests: map[int][]reviewRequestNode{
+				1: {requestedEvent("reviewer1", 0)},
+				// The PR is opened as a draft, and the reviewer is requested later.
+				2: {requestedEvent("reviewer2", 0), requestedEvent("reviewer1", 6*time.Hour)},
+			},
+			expectLatency: 3 * time.Hour,
+		},
+		{
+			name: "pull requests without the reviews of the reviewer",
+			issues: []github.Issue{
+				{Number: 1, CreatedAt: createdAt},
+				{Number: 2, CreatedAt: createdAt},
+			},
+			reviews: map[int][]github.Review{
+				1: {
+					{User: github.User{Login: "reviewer2"}, SubmittedAt: createdAt.Add(time.Hour)},
+				},
+				2: {
+					{User: github.User{Login: "reviewer1"}, SubmittedAt: createdAt.Add(4 * time.Hour)},
+				},
+			},
+			requests: map[int][]reviewRequestNode{
+				1: {requestedEvent("reviewer1", 0)},
+				2: {requestedEvent("reviewer1", 0)},
+			},
+			expectLatency: 4 * time.Hour,
+		},
+		{
+			name: "pull requests reviewed without being requested",
+			issues: []github.Issue{
+				{Number: 1, CreatedAt: createdAt},
+				{Number: 2, CreatedAt: createdAt},
+			},
+			reviews: map[int][]github.Review{
+				1: {
+					{User: github.User{Login: "reviewer1"}, SubmittedAt: createdAt.Add(48 * time.Hour)},
+				},
+				2: {
+					{User: github.User{Login: "reviewer1"}, SubmittedAt: createdAt.Add(4 * time.Hour)},
+				},
+			},
+			requests: map[int][]reviewRequestNode{
+				// The reviewer is requested again after the first review.
+				2: {requestedEvent("reviewer1", time.Hour), requestedEvent("reviewer1", 8*time.Hour)},
+			},
+			expectLatency: 3 * time.Hour,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fakeGitHubClient{
+				issues:           map[string][]github.Issue{query: tc.issues},
+				reviews:          tc.reviews,
+				prReviewRequests: tc.requests,
+			}
+
+			latency, err := estimateReviewLatency(fc, "org", "repo", "reviewer1", 30)
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+			if latency != tc.expectLatency {
+				t.Errorf("latency mismatch: got %v, want %v", latency, tc.expectLatency)
+			}
+		})
+	}
+}
+
+func TestLoadWeight(t *testing.T) {
+	var testcases = []struct {
+		name         string
+		weight       uint
+		load         reviewerLoad
+		expectWeight uint
+	}{
+		{
+			name:         "no load",
+			weight:       2,
+			expectWeight: 200,
+		},
+		{
+			name:         "open review requests",
+			weight:       2,
+			load:         reviewerLoad{openRequests: 3},
+			expectWeight: 50,
+		},
+		{
+			name:         "open review requests and latency",
+			weight:       2,
+			load:         reviewerLoad{openRequests: 1, latency: 24 * time.Hour},
+			expectWeight: 50,
+		},
+		{
+			name:         "heavily loaded",
+			weight:       1,
+			load:         reviewerLoad{openRequests: 200, latency: 24 * time.Hour},
+			expectWeight: 1,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			weight := loadWeight(tc.weight, tc.load)
+			if weight != tc.expectWeight {
+				t.Errorf("weight mismatch: got %d, want %d", weight, tc.expectWeight)
+			}
+		})
+	}
+}
+
+func TestHandleWithReviewerLoads(t *testing.T) {
+	var testcases = []struct {
+		name                  string
+		reviewers             []string
+		maxReviewerCount      int
+		maxOpenReviewRequests int
+		loadAware             bool
+		openRequests          map[string]int
+
+		expectReviewers []string
+	}{
+		{
+			name:                  "skip the overloaded reviewers",
+			reviewers:             []string{"reviewer1", "reviewer2", "reviewer3"},
+			maxReviewerCount:      1,
+			maxOpenReviewRequests: 2,
+			openRequests:          map[string]int{"reviewer1": 2, "reviewer2": 5, "reviewer3": 1},
+			expectReviewers:       []string{"reviewer3"},
+		},
+		{
+			name:                  "request fewer reviewers when most of them are overloaded",
+			reviewers:             []string{"reviewer1", "reviewer2", "reviewer3"},
+			maxReviewerCount:      2,
+			maxOpenReviewRequests: 2,
+			loadAware:             true,
+			openRequests:          map[string]int{"reviewer1": 2, "reviewer2": 5, "reviewer3": 1},
+			expectReviewers:       []string{"reviewer3"},
+		},
+		{
+			name:                  "request all reviewers under the limit",
+			reviewers:             []string{"reviewer1", "reviewer2"},
+			maxReviewerCount:      2,
+			maxOpenReviewRequests: 10,
+			loadAware:             true,
+			openRequests:          map[string]int{"reviewer1": 2, "reviewer2": 5},
+			expectReviewers:       []string{"reviewer1", "reviewer2"},
+		},
+		{
+			name:             "no limit",
+			reviewers:        []string{"reviewer1", "reviewer2", "reviewer3"},
+			maxReviewerCount: 3,
+			openRequests:     map[string]int{"reviewer1": 20, "reviewer2": 50, "reviewer3": 10},
+			expectReviewers:  []string{"reviewer1", "reviewer2", "reviewer3"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			resetReviewerLoadCache()
+			pr := &github.PullRequest{Number: 5, User: github.User{Login: "author"}}
+			fc := newFakeGitHubClient(pr, nil, nil)
+			fc.issues = map[string][]github.Issue{}
+			for reviewer, count := range tc.openRequests {
+				fc.issues[openRequestsQuery(reviewer)] = make([]github.Issue, count)
+			}
+			foc := &fakeOwnersClient{reviewers: tc.reviewers}
+			opts := &externalplugins.TiCommunityBlunderbuss{
+				Repos:                 []string{"org/repo"},
+				MaxReviewerCount:      tc.maxReviewerCount,
+				MaxOpenReviewRequests: tc.maxOpenReviewRequests,
+				LoadAware:             tc.loadAware,
+				ReviewLatencyDays:     30,
+			}
+			repo := &github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}
+
+			err := handle(fc, opts, repo, pr, logrus.WithField("plugin", PluginName), foc, nil, "")
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			sort.Strings(fc.requested)
+			if !reflect.DeepEqual(fc.requested, tc.expectReviewers) {
+				t.Errorf("requested reviewers mismatch: got %v, want %v", fc.requested, tc.expectReviewers)
+			}
+		})
+	}
+}
+
+func TestReviewerLoadCache(t *testing.T) {
+	now := time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return now
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+	resetReviewerLoadCache()
+	defer resetReviewerLoadCache()
+
+	reviewers := []string{"reviewer1", "reviewer2", "reviewer3"}
+	pr := &github.PullRequest{Number: 5, User: github.User{Login: "author"}}
+	// Only reviewer1 contributed to the changes.
+	fc := newFakeGitHubClient(pr, []github.PullRequestChange{{Filename: "a.go"}},
+		map[string][]github.RepositoryCommit{"a.go": {{Author: github.User{Login: "reviewer1"}}}})
+	fc.issues = map[string][]github.Issue{openRequestsQuery("reviewer1"): make([]github.Issue, 3)}
+	foc := &fakeOwnersClient{reviewers: reviewers}
+	opts := &externalplugins.TiCommunityBlunderbuss{
+		Repos:             []string{"org/repo"},
+		LoadAware:         true,
+		ReviewLatencyDays: 30,
+	}
+	repo := &github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}
+	log := logrus.WithField("plugin", PluginName)
+
+	// The loads are not needed when all the reviewers are selected.
+	opts.MaxReviewerCount = 3
+	if err := handle(fc, opts, repo, pr, log, foc, nil, ""); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(fc.queries) != 0 {
+		t.Errorf("expected no loads to be fetched, but got the queries %v", fc.queries)
+	}
+
+	// The open requests are fetched for each reviewer, and the latency is only estimated for the contributor.
+	opts.MaxReviewerCount = 1
+	if err := handle(fc, opts, repo, pr, log, foc, nil, ""); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(fc.queries) != len(reviewers)+1 {
+		t.Errorf("expected the open requests of each reviewer and the latency of the contributor to be fetched, "+
+			"but got %v", fc.queries)
+	}
+
+	// The loads are cached within the TTL.
+	fc.queries = nil
+	now = now.Add(reviewerLoadTTL - time.Minute)
+	if err := handle(fc, opts, repo, pr, log, foc, nil, ""); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(fc.queries) != 0 {
+		t.Errorf("expected the loads to be cached, but got the queries %v", fc.queries)
+	}
+
+	// The loads are fetched again after the TTL.
+	now = now.Add(time.Minute)
+	if err := handle(fc, opts, repo, pr, log, foc, nil, ""); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(fc.queries) != len(reviewers)+1 {
+		t.Errorf("expected the loads to be fetched again, but got the queries %v", fc.queries)
+	}
+}
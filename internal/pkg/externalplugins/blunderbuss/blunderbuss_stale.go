@@ -0,0 +1,335 @@
+package blunderbuss
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/ownersclient"
+	"k8s.io/apimachinery/pkg/util/sets"
+	git "k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/labels"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+const (
+	// stalePingMarkerFormat is the hidden marker of the ping comment for each pinged reviewer.
+	stalePingMarkerFormat = "<!-- ti-community-blunderbuss stale review ping: %s -->"
+
+	stalePingMessage = "%s, this PR has been waiting for your review for more than %d hours. " +
+		"Please take a look, or the review will be requested from other reviewers if there is " +
+		"no response in %d hours."
+	staleSwapMessage = "%s did not respond to the review request in time, " +
+		"requesting reviews from %s instead."
+)
+
+// stalePingMarkerRe matches the marker of the ping comment and captures the pinged reviewer.
+var stalePingMarkerRe = regexp.MustCompile(`<!-- ti-community-blunderbuss stale review ping: (\S+) -->`)
+
+// staleExcludeLabels specifies the labels of the PRs whose review requests are not handled.
+var staleExcludeLabels = []string{labels.Hold, labels.WorkInProgress}
+
+// reviewRequestsQuery queries the latest review requests in the timeline of the PR, unlike the issue events
+// of the REST API, the timeline events tell which reviewer is requested.
+type reviewRequestsQuery struct {
+	Repository struct {
+		PullRequest struct {
+			TimelineItems struct {
+				Nodes []reviewRequestNode
+			} `graphql:"timelineItems(last: 100, itemTypes: [REVIEW_REQUESTED_EVENT])"`
+		} `graphql:"pullRequest(number: $number)"`
+	} `graphql:"repository(owner: $owner, name: $name)"`
+}
+
+type reviewRequestNode struct {
+	ReviewRequestedEvent reviewRequestedEvent `graphql:"... on ReviewRequestedEvent"`
+}
+
+type reviewRequestedEvent struct {
+	CreatedAt         githubql.DateTime
+	RequestedReviewer struct {
+		User struct {
+			Login githubql.String
+		} `graphql:"... on User"`
+	}
+}
+
+// HandleStaleReviewRequests checks the open PRs of the repos that enabled the stale review requests handling,
+// pings the requested reviewers who have not responded within the SLA once, and then swaps in other reviewers
+// if they still do not respond within the SLA after the ping.
+func HandleStaleReviewRequests(gc githubClient, cfg *tiexternalplugins.Configuration, ol ownersclient.OwnersLoader,
+	gcf git.ClientFactory, log *logrus.Entry) error {
+	isBot, err := gc.BotUserChecker()
+	if err != nil {
+		return fmt.Errorf("failed to get the bot user: %v", err)
+	}
+
+	handled := sets.NewString()
+	// Do _not_ parallelize this. It will trigger GitHub's abuse detection.
+	for _, blunderbuss := range cfg.TiCommunityBlunderbuss {
+		if blunderbuss.StaleReviewHours <= 0 {
+			continue
+		}
+
+		for _, orgRepo := range blunderbuss.Repos {
+			org := strings.Split(orgRepo, "/")[0]
+			issues, err := gc.FindIssuesWithOrg(org, staleReviewQuery(orgRepo), "", false)
+			if err != nil {
+				log.WithError(err).Errorf("Failed to search the open PRs of %s, "+
+					"but the remaining repositories will be processed anyway.", orgRepo)
+				continue
+			}
+
+			for _, issue := range issues {
+				org, repo, ok := parseIssueRepo(issue.HTMLURL)
+				if !ok || handled.Has(issue.HTMLURL) {
+					continue
+				}
+				handled.Insert(issue.HTMLURL)
+
+				// The repo may be overridden by the more specific config.
+				opts := cfg.BlunderbussFor(org, repo)
+				if opts.StaleReviewHours <= 0 || hasAnyLabel(issue.Labels, staleExcludeLabels) {
+					continue
+				}
+
+				l := log.WithFields(logrus.Fields{"org": org, "repo": repo, "pr": issue.Number})
+				if err := handleStaleReviewRequest(gc, opts, org, repo, issue.Number, isBot, l, ol, gcf); err != nil {
+					l.WithError(err).Error("Failed to handle the stale review requests, " +
+						"but the remaining PRs will be processed anyway.")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// staleReviewQuery returns the query of the open PRs which are not on hold or WIP in the org or repo.
+func staleReviewQuery(orgRepo string) string {
+	var query strings.Builder
+	query.WriteString("is:pr is:open draft:false")
+	for _, label := range staleExcludeLabels {
+		fmt.Fprintf(&query, " -label:\"%s\"", label)
+	}
+	if strings.Contains(orgRepo, "/") {
+		fmt.Fprintf(&query, " repo:\"%s\"", orgRepo)
+	} else {
+		fmt.Fprintf(&query, " org:\"%s\"", orgRepo)
+	}
+	return query.String()
+}
+
+// parseIssueRepo returns the org and repo of the issue from its HTML URL,
+// such as https://github.com/org/repo/pull/1.
+func parseIssueRepo(htmlURL string) (string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(htmlURL, "https://"), "/")
+	if len(parts) < 5 {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func hasAnyLabel(issueLabels []github.Label, names []string) bool {
+	for _, label := range issueLabels {
+		for _, name := range names {
+			if label.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleStaleReviewRequest pings the stale requested reviewers of the PR or swaps them with other reviewers.
+func handleStaleReviewRequest(gc githubClient, opts *tiexternalplugins.TiCommunityBlunderbuss, org, repoName string,
+	number int, isBot func(string) bool, log *logrus.Entry, ol ownersclient.OwnersLoader, gcf git.ClientFactory) error {
+	pr, err := gc.GetPullRequest(org, repoName, number)
+	if err != nil {
+		return fmt.Errorf("error loading PullRequest: %v", err)
+	}
+	if pr.Draft || len(pr.RequestedReviewers) == 0 {
+		return nil
+	}
+
+	requestedAt, err := listReviewRequestTimes(gc, org, repoName, number)
+	if err != nil {
+		return fmt.Errorf("error listing review requests: %v", err)
+	}
+	comments, err := gc.ListIssueComments(org, repoName, number)
+	if err != nil {
+		return fmt.Errorf("error listing issue comments: %v", err)
+	}
+	reviews, err := gc.ListReviews(org, repoName, number)
+	if err != nil {
+		return fmt.Errorf("error listing reviews: %v", err)
+	}
+
+	// The latest responses and pings of the reviewers.
+	responses := make(map[string]time.Time)
+	pings := make(map[string]time.Time)
+	for _, comment := range comments {
+		login := github.NormLogin(comment.User.Login)
+		if isBot(comment.User.Login) {
+			for _, match := range stalePingMarkerRe.FindAllStringSubmatch(comment.Body, -1) {
+				pings[github.NormLogin(match[1])] = latest(pings[github.NormLogin(match[1])], comment.CreatedAt)
+			}
+			continue
+		}
+		responses[login] = latest(responses[login], comment.CreatedAt)
+	}
+	for _, review := range reviews {
+		login := github.NormLogin(review.User.Login)
+		responses[login] = latest(responses[login], review.SubmittedAt)
+	}
+
+	sla := time.Duration(opts.StaleReviewHours) * time.Hour
+	now := timeNow()
+	var pingReviewers, swapReviewers []string
+	for _, reviewer := range pr.RequestedReviewers {
+		login := github.NormLogin(reviewer.Login)
+		// The latest review request of the reviewer is taken as the start.
+		requested, ok := requestedAt[login]
+		if !ok {
+			requested = pr.CreatedAt
+		}
+		responded := responses[login]
+		if responded.After(requested) {
+			continue
+		}
+
+		// Each reviewer is pinged only once until they respond or are requested again,
+		// the pings of the earlier review requests do not count.
+		pinged, ok := pings[login]
+		if !ok || pinged.Before(latest(requested, responded)) {
+			if now.Sub(requested) >= sla {
+				pingReviewers = append(pingReviewers, reviewer.Login)
+			}
+			continue
+		}
+		if now.Sub(pinged) >= sla {
+			swapReviewers = append(swapReviewers, reviewer.Login)
+		}
+	}
+
+	if len(pingReviewers) != 0 {
+		log.Infof("Pinging the stale reviewers %s.", pingReviewers)
+		if err := gc.CreateComment(org, repoName, number,
+			stalePingComment(pingReviewers, opts.StaleReviewHours)); err != nil {
+			return err
+		}
+	}
+
+	if len(swapReviewers) == 0 {
+		return nil
+	}
+	return swapStaleReviewers(gc, opts, org, repoName, pr, swapReviewers, log, ol, gcf)
+}
+
+// listReviewRequestTimes returns the time of the latest review request of each reviewer of the PR.
+func listReviewRequestTimes(gc githubClient, org, repo string, number int) (map[string]time.Time, error) {
+	requests, err := listReviewRequests(gc, org, repo, number)
+	if err != nil {
+		return nil, err
+	}
+	requestedAt := make(map[string]time.Time, len(requests))
+	for login, times := range requests {
+		for _, t := range times {
+			requestedAt[login] = latest(requestedAt[login], t)
+		}
+	}
+	return requestedAt, nil
+}
+
+// listReviewRequests returns the time of each review request of each reviewer of the PR.
+func listReviewRequests(gc githubClient, org, repo string, number int) (map[string][]time.Time, error) {
+	var query reviewRequestsQuery
+	vars := map[string]interface{}{
+		"owner":  githubql.String(org),
+		"name":   githubql.String(repo),
+		"number": githubql.Int(int32(number)), //nolint:gosec
+	}
+	if err := gc.QueryWithGitHubAppsSupport(context.Background(), &query, vars, org); err != nil {
+		return nil, err
+	}
+
+	requests := make(map[string][]time.Time)
+	for _, node := range query.Repository.PullRequest.TimelineItems.Nodes {
+		event := node.ReviewRequestedEvent
+		// The review requests of the teams are ignored.
+		login := github.NormLogin(string(event.RequestedReviewer.User.Login))
+		if login == "" {
+			continue
+		}
+		requests[login] = append(requests[login], event.CreatedAt.Time)
+	}
+	return requests, nil
+}
+
+// swapStaleReviewers removes the review requests of the stale reviewers
+// and requests reviews from the same number of other reviewers.
+func swapStaleReviewers(gc githubClient, opts *tiexternalplugins.TiCommunityBlunderbuss, org, repoName string,
+	pr *github.PullRequest, staleReviewers []string, log *logrus.Entry,
+	ol ownersclient.OwnersLoader, gcf git.ClientFactory) error {
+	repo := &github.Repo{Owner: github.User{Login: org}, Name: repoName}
+	excludedReviewers := make(map[string]string)
+	for _, reviewer := range staleReviewers {
+		excludedReviewers[github.NormLogin(reviewer)] = "did not respond to the review request in time"
+	}
+
+	// Each swap gets a new draw by the stale reviewers.
+	reroll := "stale:" + strings.Join(staleReviewers, ",")
+	selection, err := selectReviewers(gc, opts, repo, pr, len(staleReviewers), excludedReviewers, reroll, log, ol, gcf)
+	if err != nil {
+		return err
+	}
+	reviewers := selection.reviewers
+	// Keep the stale reviewers if there is no one to take over.
+	if len(reviewers) == 0 {
+		log.Infof("No other reviewers can take over the stale reviewers %s.", staleReviewers)
+		return nil
+	}
+
+	log.Infof("Swapping the stale reviewers %s with %s.", staleReviewers, reviewers)
+	if err := gc.UnrequestReview(org, repoName, pr.Number, staleReviewers); err != nil {
+		return err
+	}
+	if err := gc.RequestReview(org, repoName, pr.Number, reviewers); err != nil {
+		return err
+	}
+	comment := fmt.Sprintf(staleSwapMessage, mentions(staleReviewers), mentions(reviewers))
+	if opts.ExplainSelection {
+		comment += "\n\n" + explainSelection(selection)
+	}
+	return gc.CreateComment(org, repoName, pr.Number, comment)
+}
+
+// stalePingComment returns the comment which pings the reviewers with a hidden marker for each of them.
+func stalePingComment(reviewers []string, staleReviewHours int) string {
+	var comment strings.Builder
+	comment.WriteString(fmt.Sprintf(stalePingMessage, mentions(reviewers), staleReviewHours, staleReviewHours))
+	for _, reviewer := range reviewers {
+		comment.WriteString("\n" + fmt.Sprintf(stalePingMarkerFormat, reviewer))
+	}
+	return comment.String()
+}
+
+func mentions(logins []string) string {
+	var mentions []string
+	for _, login := range logins {
+		mentions = append(mentions, "@"+login)
+	}
+	return strings.Join(mentions, ", ")
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,217 @@
+package blunderbuss
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/labels"
+)
+
+func TestHandleStaleReviewRequests(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2021, 6, 10, 0, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+	query := `is:pr is:open draft:false -label:"do-not-merge/hold" ` +
+		`-label:"do-not-merge/work-in-progress" repo:"org/repo"`
+	requestedEvent := func(login string, day int) reviewRequestNode {
+		var node reviewRequestNode
+		node.ReviewRequestedEvent.CreatedAt = githubql.DateTime{Time: time.Date(2021, 6, day, 0, 0, 0, 0, time.UTC)}
+		node.ReviewRequestedEvent.RequestedReviewer.User.Login = githubql.String(login)
+		return node
+	}
+	pingComment := func(day int) github.IssueComment {
+		return github.IssueComment{
+			User:      github.User{Login: "ti-chi-bot"},
+			Body:      stalePingComment([]string{"reviewer1"}, 24),
+			CreatedAt: time.Date(2021, 6, day, 0, 0, 0, 0, time.UTC),
+		}
+	}
+
+	var testcases = []struct {
+		name             string
+		staleReviewHours int
+		labels           []github.Label
+		reviewers        []string
+		events           []reviewRequestNode
+		comments         []github.IssueComment
+		reviews          []github.Review
+
+		expectPinged      bool
+		expectUnrequested []string
+		expectRequested   []string
+	}{
+		{
+			name:             "review request within the SLA",
+			staleReviewHours: 48,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 9)},
+		},
+		{
+			name:             "ping the stale reviewer",
+			staleReviewHours: 24,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5), requestedEvent("reviewer1", 8)},
+			expectPinged:     true,
+		},
+		{
+			name:             "the review request of another reviewer does not reset the SLA",
+			staleReviewHours: 24,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5), requestedEvent("reviewer2", 9)},
+			expectPinged:     true,
+		},
+		{
+			name:             "the review request of the team is ignored",
+			staleReviewHours: 24,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5), requestedEvent("", 9)},
+			expectPinged:     true,
+		},
+		{
+			name:             "reviewer responded by comment",
+			staleReviewHours: 24,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5)},
+			comments: []github.IssueComment{
+				{User: github.User{Login: "Reviewer1"}, CreatedAt: time.Date(2021, 6, 6, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:             "reviewer responded by review",
+			staleReviewHours: 24,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5)},
+			reviews: []github.Review{
+				{User: github.User{Login: "reviewer1"}, SubmittedAt: time.Date(2021, 6, 6, 0, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:             "pinged within the SLA",
+			staleReviewHours: 48,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5)},
+			comments:         []github.IssueComment{pingComment(9)},
+		},
+		{
+			name:              "swap the stale reviewer after the ping",
+			staleReviewHours:  24,
+			reviewers:         []string{"reviewer1", "reviewer2"},
+			events:            []reviewRequestNode{requestedEvent("reviewer1", 5)},
+			comments:          []github.IssueComment{pingComment(8)},
+			expectUnrequested: []string{"reviewer1"},
+			expectRequested:   []string{"reviewer2"},
+		},
+		{
+			name:             "no other reviewers to take over",
+			staleReviewHours: 24,
+			reviewers:        []string{"reviewer1"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5)},
+			comments:         []github.IssueComment{pingComment(8)},
+		},
+		{
+			name:             "ping again after the reviewer responded",
+			staleReviewHours: 24,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5), requestedEvent("reviewer1", 7)},
+			comments: []github.IssueComment{
+				pingComment(4),
+				{User: github.User{Login: "reviewer1"}, CreatedAt: time.Date(2021, 6, 6, 0, 0, 0, 0, time.UTC)},
+			},
+			expectPinged: true,
+		},
+		{
+			name:             "ping again after the reviewer is requested again",
+			staleReviewHours: 24,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5), requestedEvent("reviewer1", 8)},
+			comments:         []github.IssueComment{pingComment(6)},
+			expectPinged:     true,
+		},
+		{
+			name:             "the ping of the earlier review request does not start the swap",
+			staleReviewHours: 48,
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 3), requestedEvent("reviewer1", 9)},
+			comments:         []github.IssueComment{pingComment(4)},
+		},
+		{
+			name:             "skip the PR on hold",
+			staleReviewHours: 24,
+			labels:           []github.Label{{Name: labels.Hold}},
+			reviewers:        []string{"reviewer1", "reviewer2"},
+			events:           []reviewRequestNode{requestedEvent("reviewer1", 5)},
+			comments:         []github.IssueComment{pingComment(8)},
+		},
+		{
+			name:      "stale review requests handling is disabled",
+			reviewers: []string{"reviewer1", "reviewer2"},
+			events:    []reviewRequestNode{requestedEvent("reviewer1", 5)},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			pr := &github.PullRequest{
+				Number:             5,
+				User:               github.User{Login: "author"},
+				CreatedAt:          time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC),
+				RequestedReviewers: []github.User{{Login: "reviewer1"}},
+			}
+			fc := newFakeGitHubClient(pr, nil, nil)
+			fc.issues = map[string][]github.Issue{
+				query: {{Number: 5, HTMLURL: "https://github.com/org/repo/pull/5", Labels: tc.labels}},
+			}
+			fc.reviewRequests = tc.events
+			fc.comments = tc.comments
+			fc.reviews = map[int][]github.Review{5: tc.reviews}
+			foc := &fakeOwnersClient{reviewers: tc.reviewers}
+			cfg := &externalplugins.Configuration{
+				TiCommunityBlunderbuss: []externalplugins.TiCommunityBlunderbuss{
+					{
+						Repos:            []string{"org/repo"},
+						MaxReviewerCount: 1,
+						StaleReviewHours: tc.staleReviewHours,
+					},
+				},
+			}
+
+			err := HandleStaleReviewRequests(fc, cfg, foc, nil, logrus.WithField("plugin", PluginName))
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			pinged := len(fc.createdComments) != 0 &&
+				strings.Contains(fc.createdComments[0], fmt.Sprintf(stalePingMarkerFormat, "reviewer1"))
+			if pinged != tc.expectPinged {
+				t.Errorf("pinged mismatch: got %v, want %v", pinged, tc.expectPinged)
+			}
+			if !reflect.DeepEqual(fc.unrequested, tc.expectUnrequested) {
+				t.Errorf("unrequested reviewers mismatch: got %v, want %v", fc.unrequested, tc.expectUnrequested)
+			}
+			if !reflect.DeepEqual(fc.requested, tc.expectRequested) {
+				t.Errorf("requested reviewers mismatch: got %v, want %v", fc.requested, tc.expectRequested)
+			}
+		})
+	}
+}
+
+func TestParseIssueRepo(t *testing.T) {
+	org, repo, ok := parseIssueRepo("https://github.com/org/repo/pull/5")
+	if !ok || org != "org" || repo != "repo" {
+		t.Errorf("unexpected result: %s, %s, %v", org, repo, ok)
+	}
+	if _, _, ok := parseIssueRepo("https://github.com/org"); ok {
+		t.Errorf("expected the invalid URL to be rejected")
+	}
+}
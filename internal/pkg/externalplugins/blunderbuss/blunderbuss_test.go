@@ -1,16 +1,22 @@
 package blunderbuss
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math/rand"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	githubql "github.com/shurcooL/githubv4"
 	"github.com/sirupsen/logrus"
 	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
 	"github.com/ti-community-infra/tichi/internal/pkg/ownersclient"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
 )
@@ -20,6 +26,19 @@ type fakeGitHubClient struct {
 	prChanges   []github.PullRequestChange
 	fileCommits map[string][]github.RepositoryCommit
 	requested   []string
+	// issues maps the search query to the found issues.
+	issues  map[string][]github.Issue
+	queries []string
+	reviews map[int][]github.Review
+	commits map[string]github.RepositoryCommit
+
+	unrequested     []string
+	reviewRequests  []reviewRequestNode
+	comments        []github.IssueComment
+	createdComments []string
+
+	// prReviewRequests maps the number of the PR to its review requests, which default to reviewRequests.
+	prReviewRequests map[int][]reviewRequestNode
 }
 
 func newFakeGitHubClient(pr *github.PullRequest, prChanges []github.PullRequestChange,
@@ -68,6 +87,67 @@ func (c *fakeGitHubClient) ListFileCommits(_, _, path string) ([]github.Reposito
 	return nil, errors.New("can not get commits of the file path")
 }
 
+func (c *fakeGitHubClient) FindIssuesWithOrg(_, query, _ string, _ bool) ([]github.Issue, error) {
+	c.queries = append(c.queries, query)
+	return c.issues[query], nil
+}
+
+func (c *fakeGitHubClient) ListReviews(_, _ string, number int) ([]github.Review, error) {
+	return c.reviews[number], nil
+}
+
+func (c *fakeGitHubClient) GetSingleCommit(_, _, sha string) (github.RepositoryCommit, error) {
+	commit, ok := c.commits[sha]
+	if !ok {
+		return github.RepositoryCommit{}, errors.New("commit not found")
+	}
+	return commit, nil
+}
+
+func (c *fakeGitHubClient) UnrequestReview(_, _ string, _ int, logins []string) error {
+	c.unrequested = append(c.unrequested, logins...)
+	return nil
+}
+
+func (c *fakeGitHubClient) QueryWithGitHubAppsSupport(_ context.Context, q interface{}, vars map[string]interface{},
+	_ string) error {
+	if query, ok := q.(*reviewRequestsQuery); ok {
+		nodes, ok := c.prReviewRequests[int(vars["number"].(githubql.Int))]
+		if !ok {
+			nodes = c.reviewRequests
+		}
+		query.Repository.PullRequest.TimelineItems.Nodes = nodes
+		return nil
+	}
+
+	// The batched searches of the open review requests.
+	query := reflect.ValueOf(q).Elem()
+	for i := 0; i < query.NumField(); i++ {
+		search, ok := vars[fmt.Sprintf("query%d", i)].(githubql.String)
+		if !ok {
+			return errors.New("unexpected query")
+		}
+		c.queries = append(c.queries, string(search))
+		query.Field(i).Set(reflect.ValueOf(searchCount{IssueCount: githubql.Int(len(c.issues[string(search)]))}))
+	}
+	return nil
+}
+
+func (c *fakeGitHubClient) ListIssueComments(_, _ string, _ int) ([]github.IssueComment, error) {
+	return c.comments, nil
+}
+
+func (c *fakeGitHubClient) CreateComment(_, _ string, _ int, comment string) error {
+	c.createdComments = append(c.createdComments, comment)
+	return nil
+}
+
+func (c *fakeGitHubClient) BotUserChecker() (func(candidate string) bool, error) {
+	return func(candidate string) bool {
+		return candidate == "ti-chi-bot"
+	}, nil
+}
+
 type fakeOwnersClient struct {
 	reviewers []string
 	needsLgtm int
@@ -137,6 +217,24 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 			maxReviewersCount:   1,
 			expectReviewerCount: 1,
 		},
+		{
+			name:                "reroll command in an open PR triggers auto-assignment",
+			action:              github.IssueCommentActionCreated,
+			issueState:          "open",
+			isPR:                true,
+			body:                "/auto-cc reroll",
+			maxReviewersCount:   1,
+			expectReviewerCount: 1,
+		},
+		{
+			name:                "comment with an unknown argument will not trigger auto-assignment",
+			action:              github.IssueCommentActionCreated,
+			issueState:          "open",
+			isPR:                true,
+			body:                "/auto-cc again",
+			maxReviewersCount:   1,
+			expectReviewerCount: 0,
+		},
 		{
 			name:                "commenting in a PR without required SIG label will not trigger auto-assignment",
 			action:              github.IssueCommentActionCreated,
@@ -268,7 +366,7 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 			needsLgtm: 2,
 		}
 
-		if err := HandleIssueCommentEvent(fc, e, cfg, foc, logrus.WithField("plugin", PluginName)); err != nil {
+		if err := HandleIssueCommentEvent(fc, e, cfg, foc, nil, logrus.WithField("plugin", PluginName)); err != nil {
 			t.Errorf("didn't expect error from autoccComment: %v", err)
 			continue
 		}
@@ -504,7 +602,7 @@ func TestHandlePullRequest(t *testing.T) {
 			needsLgtm: 2,
 		}
 
-		if err := HandlePullRequestEvent(fc, e, cfg, foc, logrus.WithField("plugin", PluginName)); err != nil {
+		if err := HandlePullRequestEvent(fc, e, cfg, foc, nil, logrus.WithField("plugin", PluginName)); err != nil {
 			t.Errorf("didn't expect error from autoccComment: %v", err)
 			continue
 		}
@@ -523,6 +621,7 @@ func TestGetReviewers(t *testing.T) {
 		includeReviewers   []string
 		excludeReviewers   []string
 		requestedReviewers []github.User
+		awayReviewers      []string
 
 		expectReviewers []string
 	}{
@@ -590,11 +689,40 @@ func TestGetReviewers(t *testing.T) {
 				"reviewers1", "reviewers3",
 			},
 		},
+		{
+			name:   "away reviewers",
+			author: "author",
+			reviewers: []string{
+				"author", "reviewers1", "Reviewers2", "reviewers3",
+			},
+			awayReviewers: []string{
+				"reviewers2",
+			},
+			expectReviewers: []string{
+				"reviewers1", "reviewers3",
+			},
+		},
+		{
+			name:   "away include reviewers",
+			author: "author",
+			reviewers: []string{
+				"author", "reviewers1", "reviewers2", "reviewers3",
+			},
+			includeReviewers: []string{
+				"reviewers2", "reviewers3",
+			},
+			awayReviewers: []string{
+				"reviewers3",
+			},
+			expectReviewers: []string{
+				"reviewers2",
+			},
+		},
 	}
 
 	for _, tc := range testcases {
 		reviewers := listAvailableReviewers(tc.author, tc.reviewers, tc.includeReviewers, tc.excludeReviewers,
-			tc.requestedReviewers).List()
+			tc.requestedReviewers, sets.NewString(tc.awayReviewers...)).List()
 		sort.Strings(reviewers)
 		sort.Strings(tc.expectReviewers)
 		if !reflect.DeepEqual(reviewers, tc.expectReviewers) {
@@ -691,3 +819,112 @@ func TestContainSigLabels(t *testing.T) {
 		})
 	}
 }
+
+func TestPickReviewers(t *testing.T) {
+	var testcases = []struct {
+		name    string
+		weights map[string]uint
+		count   int
+
+		expectCount int
+	}{
+		{
+			name:        "pick by the weights",
+			weights:     map[string]uint{"reviewer1": 5, "reviewer2": 1, "reviewer3": 2},
+			count:       2,
+			expectCount: 2,
+		},
+		{
+			name:        "fewer weighted reviewers than the count",
+			weights:     map[string]uint{"reviewer1": 5, "reviewer2": 0},
+			count:       2,
+			expectCount: 1,
+		},
+		{
+			name:        "no weighted reviewers",
+			weights:     map[string]uint{"reviewer1": 0},
+			count:       2,
+			expectCount: 0,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			seed := selectionSeed("org", "repo", 5, "", "")
+			reviewers, err := pickReviewers(tc.weights, tc.count, rand.New(rand.NewSource(seed)))
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+			if len(reviewers) != tc.expectCount {
+				t.Fatalf("reviewers count mismatch: got %v, want %v", reviewers, tc.expectCount)
+			}
+
+			// The same seed always picks the same reviewers.
+			for i := 0; i < 10; i++ {
+				again, err := pickReviewers(tc.weights, tc.count, rand.New(rand.NewSource(seed)))
+				if err != nil {
+					t.Fatalf("didn't expect error: %v", err)
+				}
+				if !reflect.DeepEqual(again, reviewers) {
+					t.Fatalf("reviewers mismatch: got %v, want %v", again, reviewers)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleReproducibly(t *testing.T) {
+	reviewers := []string{"reviewer1", "reviewer2", "reviewer3", "reviewer4", "reviewer5", "reviewer6"}
+	request := func(salt, reroll string, requested []string) *fakeGitHubClient {
+		pr := &github.PullRequest{
+			Number:             5,
+			User:               github.User{Login: "author"},
+			RequestedReviewers: mapGithubLoginToGithubUser(requested),
+		}
+		fc := newFakeGitHubClient(pr, nil, nil)
+		foc := &fakeOwnersClient{reviewers: reviewers}
+		opts := &externalplugins.TiCommunityBlunderbuss{
+			Repos:            []string{"org/repo"},
+			MaxReviewerCount: 2,
+			SelectionSalt:    salt,
+		}
+		repo := &github.Repo{Owner: github.User{Login: "org"}, Name: "repo"}
+
+		err := handle(fc, opts, repo, pr, logrus.WithField("plugin", PluginName), foc, nil, reroll)
+		if err != nil {
+			t.Fatalf("didn't expect error: %v", err)
+		}
+		return fc
+	}
+
+	first := request("", "", nil).requested
+	for i := 0; i < 10; i++ {
+		if again := request("", "", nil).requested; !reflect.DeepEqual(again, first) {
+			t.Fatalf("requested reviewers mismatch: got %v, want %v", again, first)
+		}
+	}
+
+	// The reroll or the salt gets a new draw, which is reproducible as well.
+	draws := sets.NewString(strings.Join(first, ","))
+	for i := 0; i < 10; i++ {
+		reroll := request("", strconv.Itoa(i), first)
+		if again := request("", strconv.Itoa(i), first); !reflect.DeepEqual(again.requested, reroll.requested) {
+			t.Fatalf("rerolled reviewers mismatch: got %v, want %v", again.requested, reroll.requested)
+		}
+		draws.Insert(strings.Join(reroll.requested, ","))
+
+		// The previous reviewers who are not drawn again are unrequested.
+		for _, reviewer := range first {
+			if !sets.NewString(reroll.requested...).Has(reviewer) &&
+				!sets.NewString(reroll.unrequested...).Has(reviewer) {
+				t.Errorf("expected %s to be unrequested by the reroll, but got %v", reviewer, reroll.unrequested)
+			}
+		}
+
+		draws.Insert(strings.Join(request(strconv.Itoa(i), "", nil).requested, ","))
+	}
+	if draws.Len() == 1 {
+		t.Errorf("expected the reroll and the salt to get new draws, but always got %v", first)
+	}
+}
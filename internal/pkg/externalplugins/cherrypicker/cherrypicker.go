@@ -61,8 +61,10 @@ The plugin will send an repo collaborator invitation if the requestor is not a c
 	upstreamRemoteName           = "upstream"
 	collaboratorPermission       = "push"
 	cherryPickInviteExample      = "/cherry-pick-invite"
+	cherryPickStatusExample      = "/cherry-pick-status"
 	cherryPickBranchFmt          = "cherry-pick-%d-to-%s"
-	cherryPickTipFmt             = "This is an automated cherry-pick of #%d"
+	crossRepoCherryPickBranchFmt = "cherry-pick-%s-%s-%d-to-%s"
+	cherryPickTipFmt             = "This is an automated cherry-pick of %s"
 	cherryPickInviteNotifyMsgTpl = `@%s Please accept the invitation then you can push to the cherry-pick pull requests.
 	Comment with "%s" if the invitation is expired.
 	%s`
@@ -71,12 +73,14 @@ The plugin will send an repo collaborator invitation if the requestor is not a c
 var (
 	cherryPickRe       = regexp.MustCompile(`(?m)^(?:/cherrypick|/cherry-pick)\s+(.+)$`)
 	cherryPickInviteRe = regexp.MustCompile(`(?m)^(?:/cherrypick|/cherry-pick)-invite\b`)
+	cherryPickStatusRe = regexp.MustCompile(`(?m)^(?:/cherrypick|/cherry-pick)-status\b`)
 )
 
 type GithubClient interface {
 	AddLabels(org, repo string, number int, labels ...string) error
 	AssignIssue(org, repo string, number int, logins []string) error
 	CreateComment(org, repo string, number int, comment string) error
+	EditComment(org, repo string, id int, comment string) error
 	CreateFork(org, repo string) (string, error)
 	CreatePullRequest(org, repo, title, body, head, base string, canModify bool) (int, error)
 	CreateIssue(org, repo, title, body string, milestone int, labels, assignees []string) (int, error)
@@ -88,7 +92,9 @@ type GithubClient interface {
 	GetSingleCommit(org, repo, SHA string) (github.RepositoryCommit, error)
 	IsMember(org, user string) (bool, error)
 	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error)
+	ListPRCommits(org, repo string, number int) ([]github.RepositoryCommit, error)
 	GetIssueLabels(org, repo string, number int) ([]github.Label, error)
+	GetFile(org, repo, filepath, commit string) ([]byte, error)
 	ListOrgMembers(org, role string) ([]github.TeamMember, error)
 	ListRepoInvitations(org, repo string) ([]*gc.RepositoryInvitation, error)
 	IsCollaborator(org, repo, user string) (bool, error)
@@ -134,6 +140,25 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 					"cherrypicker will create the PR with conflicts.</li>")
 			}
 
+			if opts.PreserveAuthorship {
+				configInfoStrings = append(configInfoStrings, "<li>When a patch cannot be applied, "+
+					"the commits are cherry-picked one by one to preserve their authorship.</li>")
+			}
+
+			if maintained := opts.MaintainedBranches(); len(maintained) != 0 || len(opts.TargetBranches) != 0 {
+				validBranches := maintained
+				for _, pattern := range opts.TargetBranches {
+					validBranches = append(validBranches, "branches matching "+pattern)
+				}
+				configInfoStrings = append(configInfoStrings, "<li>The PRs can only be cherry-picked to: "+
+					strings.Join(validBranches, ", ")+".</li>")
+			}
+
+			if len(opts.TargetRepos) != 0 {
+				configInfoStrings = append(configInfoStrings, "<li>The PRs can also be cherry-picked to the branches of: "+
+					strings.Join(opts.TargetRepos, ", ")+".</li>")
+			}
+
 			configInfoStrings = append(configInfoStrings, "</ul>")
 			configInfo[repo.String()] = strings.Join(configInfoStrings, "\n")
 		}
@@ -141,11 +166,15 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 		yamlSnippet, err := plugins.CommentMap.GenYaml(&tiexternalplugins.Configuration{
 			TiCommunityCherrypicker: []tiexternalplugins.TiCommunityCherrypicker{
 				{
-					Repos:             []string{"ti-community-infra/test-dev"},
-					LabelPrefix:       "needs-cherry-pick-",
-					PickedLabelPrefix: "type/cherry-pick-for-",
-					AllowAll:          true,
-					ExcludeLabels:     []string{"status/can-merge"},
+					Repos:              []string{"ti-community-infra/test-dev"},
+					LabelPrefix:        "needs-cherry-pick-",
+					PickedLabelPrefix:  "type/cherry-pick-for-",
+					AllowAll:           true,
+					ExcludeLabels:      []string{"status/can-merge"},
+					TrackingComment:    true,
+					TargetBranches:     []string{`^feature/`},
+					MaintainedVersions: []string{"5.0", "4.0"},
+					TargetRepos:        []string{"ti-community-infra/test-live"},
 				},
 			},
 		})
@@ -164,10 +193,14 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 			Usage: "/cherry-pick [branch]",
 			Description: "Cherrypick a PR to a different branch. " +
 				"This command works both in merged PRs (the cherry-pick PR is opened immediately) " +
-				"and open PRs (the cherry-pick PR opens as soon as the original PR merges).",
+				"and open PRs (the cherry-pick PR opens as soon as the original PR merges). " +
+				"Use `" + allMaintainedAlias + "` as the branch to cherry-pick to the release branches " +
+				"of all maintained versions, or use `org/repo:branch` as the branch to cherry-pick to " +
+				"a branch of the allowed target repo.",
 			Featured:  true,
 			WhoCanUse: "Members of the trusted organization for the repo or anyone(depends on the AllowAll configuration).",
-			Examples:  []string{"/cherrypick release-3.9", "/cherry-pick release-1.15"},
+			Examples: []string{"/cherrypick release-3.9", "/cherry-pick release-1.15",
+				"/cherry-pick " + allMaintainedAlias, "/cherry-pick ti-community-infra/test-live:master"},
 		})
 		pluginHelp.AddCommand(pluginhelp.Command{
 			Usage: cherryPickInviteExample,
@@ -177,6 +210,21 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 			WhoCanUse: "Members of the trusted organization for the repo.",
 			Examples:  []string{cherryPickInviteExample},
 		})
+		pluginHelp.AddCommand(pluginhelp.Command{
+			Usage:       cherryPickStatusExample,
+			Description: "Report the status of the queued, running and finished cherry-pick jobs of the PR.",
+			Featured:    false,
+			WhoCanUse:   "Anyone",
+			Examples:    []string{cherryPickStatusExample},
+		})
+		pluginHelp.AddCommand(pluginhelp.Command{
+			Usage: "/cherry-pick-check [branch...]",
+			Description: "Check whether the PR can be cherry-picked to the branches cleanly " +
+				"and report the conflicting files and hunks, without pushing the branches or creating the PRs.",
+			Featured:  false,
+			WhoCanUse: "Members of the trusted organization for the repo or anyone(depends on the AllowAll configuration).",
+			Examples:  []string{cherryPickCheckExample, "/cherry-pick-check release-5.0 release-4.0"},
+		})
 
 		return pluginHelp, nil
 	}
@@ -201,11 +249,19 @@ type Server struct {
 	PatchURL  string
 	GitHubURL string
 
+	// Queue persists the cherry-pick jobs, the cherry-picks are done immediately if it is nil.
+	Queue *FileJobQueue
+	// jobSignal wakes up the job worker when a job is enqueued.
+	jobSignalOnce sync.Once
+	jobSignal     chan struct{}
+
 	repoLock sync.Mutex
 	Repos    []github.Repo
 
 	mapLock sync.Mutex
 	lockMap map[cherryPickRequest]*sync.Mutex
+
+	trackLock sync.Mutex
 }
 
 type cherryPickRequest struct {
@@ -270,6 +326,14 @@ func (s *Server) handleIssueComment(l *logrus.Entry, ic *github.IssueCommentEven
 		return s.inviteCollaborator(ic)
 	}
 
+	if cherryPickStatusRe.MatchString(ic.Comment.Body) {
+		return s.reportJobStatus(ic)
+	}
+
+	if cherryPickCheckRe.MatchString(ic.Comment.Body) {
+		return s.checkCherryPicks(l, ic)
+	}
+
 	return s.handleIssueCherryPickComment(l, ic)
 }
 
@@ -292,10 +356,19 @@ func (s *Server) handleIssueCherryPickComment(l *logrus.Entry, ic *github.IssueC
 		return nil
 	}
 
-	targetBranchesSet := sets.NewString()
+	var requestedBranches []string
 	for _, match := range cherryPickMatches {
-		targetBranch := strings.TrimSpace(match[1])
-		targetBranchesSet.Insert(targetBranch)
+		requestedBranches = append(requestedBranches, strings.TrimSpace(match[1]))
+	}
+	// Reject the invalid target branches immediately, instead of failing after forking and cloning.
+	targetBranchesSet, rejectedBranches := resolveTargetBranches(opts, requestedBranches)
+	if rejectedBranches.Len() != 0 {
+		resp := rejectedBranchesMessage(opts, rejectedBranches.List())
+		l.Info(resp)
+		err := s.GitHubClient.CreateComment(org, repo, num, tiexternalplugins.FormatICResponse(ic.Comment, resp))
+		if err != nil || targetBranchesSet.Len() == 0 {
+			return err
+		}
 	}
 
 	if ic.Issue.State != "closed" {
@@ -362,7 +435,7 @@ func (s *Server) handleIssueCherryPickComment(l *logrus.Entry, ic *github.IssueC
 			"target_branch": targetBranch,
 		})
 		l.Debug("Cherrypick request.")
-		err := s.handle(l, ic.Comment.User.Login, &ic.Comment, org, repo, targetBranch, pr)
+		err := s.pick(l, ic.Comment.User.Login, &ic.Comment, org, repo, targetBranch, pr)
 		if err != nil {
 			l.WithError(err).Error("Cherrypick failed.")
 		}
@@ -372,6 +445,10 @@ func (s *Server) handleIssueCherryPickComment(l *logrus.Entry, ic *github.IssueC
 }
 
 func (s *Server) handlePullRequest(log *logrus.Entry, pre *github.PullRequestEvent) error {
+	if err := s.trackPullRequestProgress(log, pre); err != nil {
+		log.WithError(err).Warn("Failed to track the progress of the cherry-pick PR.")
+	}
+
 	// Only consider merged PRs.
 	pr := pre.PullRequest
 	if !pr.Merged || pr.MergeSHA == nil {
@@ -385,6 +462,8 @@ func (s *Server) handlePullRequest(log *logrus.Entry, pre *github.PullRequestEve
 	opts := s.ConfigAgent.Config().CherrypickerFor(org, repo)
 	// requestor -> target branch -> issue comment.
 	requestorToComments := make(map[string]map[string]*github.IssueComment)
+	// The target branches of the labels which are not allowed.
+	rejectedBranches := sets.NewString()
 	// NOTICE: This will set the requestor to the author of the PR.
 	if requestorToComments[pr.User.Login] == nil {
 		requestorToComments[pr.User.Login] = make(map[string]*github.IssueComment)
@@ -404,11 +483,14 @@ func (s *Server) handlePullRequest(log *logrus.Entry, pre *github.PullRequestEve
 				c := comments[i]
 				cherryPickMatches := cherryPickRe.FindAllStringSubmatch(c.Body, -1)
 				for _, match := range cherryPickMatches {
-					targetBranch := strings.TrimSpace(match[1])
+					// The invalid target branches of the comments have been rejected when they are commented.
+					targetBranches, _ := resolveTargetBranches(opts, []string{strings.TrimSpace(match[1])})
 					if requestorToComments[c.User.Login] == nil {
 						requestorToComments[c.User.Login] = make(map[string]*github.IssueComment)
 					}
-					requestorToComments[c.User.Login][targetBranch] = &c
+					for _, targetBranch := range targetBranches.List() {
+						requestorToComments[c.User.Login][targetBranch] = &c
+					}
 				}
 			}
 
@@ -422,8 +504,12 @@ func (s *Server) handlePullRequest(log *logrus.Entry, pre *github.PullRequestEve
 			foundCherryPickLabels := false
 			for _, label := range labels {
 				if strings.HasPrefix(label.Name, opts.LabelPrefix) {
-					// leave this nil which indicates a label-initiated cherry-pick.
-					requestorToComments[pr.User.Login][label.Name[len(opts.LabelPrefix):]] = nil
+					targetBranches, rejected := resolveTargetBranches(opts, []string{label.Name[len(opts.LabelPrefix):]})
+					for _, targetBranch := range targetBranches.List() {
+						// leave this nil which indicates a label-initiated cherry-pick.
+						requestorToComments[pr.User.Login][targetBranch] = nil
+					}
+					rejectedBranches = rejectedBranches.Union(rejected)
 					foundCherryPickLabels = true
 				}
 			}
@@ -436,8 +522,12 @@ func (s *Server) handlePullRequest(log *logrus.Entry, pre *github.PullRequestEve
 	case github.PullRequestActionLabeled:
 		{
 			if strings.HasPrefix(pre.Label.Name, opts.LabelPrefix) {
-				// leave this nil which indicates a label-initiated cherry-pick.
-				requestorToComments[pr.User.Login][pre.Label.Name[len(opts.LabelPrefix):]] = nil
+				targetBranches, rejected := resolveTargetBranches(opts, []string{pre.Label.Name[len(opts.LabelPrefix):]})
+				for _, targetBranch := range targetBranches.List() {
+					// leave this nil which indicates a label-initiated cherry-pick.
+					requestorToComments[pr.User.Login][targetBranch] = nil
+				}
+				rejectedBranches = rejectedBranches.Union(rejected)
 			} else {
 				return nil
 			}
@@ -446,6 +536,14 @@ func (s *Server) handlePullRequest(log *logrus.Entry, pre *github.PullRequestEve
 		return nil
 	}
 
+	if rejectedBranches.Len() != 0 {
+		resp := rejectedBranchesMessage(opts, rejectedBranches.List())
+		log.Info(resp)
+		if err := s.createComment(log, org, repo, num, nil, resp); err != nil {
+			log.WithError(err).WithField("response", resp).Error("Failed to create comment.")
+		}
+	}
+
 	// Figure out membership.
 	if !opts.AllowAll {
 		members, err := s.GitHubClient.ListOrgMembers(org, "all")
@@ -496,7 +594,7 @@ func (s *Server) handlePullRequest(log *logrus.Entry, pre *github.PullRequestEve
 				"target_branch": targetBranch,
 			})
 			l.Debug("Cherrypick request.")
-			err := s.handle(l, requestor, ic, org, repo, targetBranch, &pr)
+			err := s.pick(l, requestor, ic, org, repo, targetBranch, &pr)
 			if err != nil {
 				errs = append(errs, fmt.Errorf("failed to create cherrypick: %w", err))
 			}
@@ -529,26 +627,30 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 	defer lock.Unlock()
 
 	opts := s.ConfigAgent.Config().CherrypickerFor(org, repo)
+	// The target branch may be in another repo, the cherry-pick PR is opened in that repo.
+	target := resolveCherryPickTarget(org, repo, targetBranch)
+	// The reference to the original PR in the repo of the cherry-pick PR.
+	originalRef := issueRef(org, repo, num, target.org, target.repo)
 
-	forkName, err := s.ensureForkExists(org, repo)
+	forkName, err := s.ensureForkExists(target.org, target.repo)
 	if err != nil {
 		logger.WithError(err).Warn("Failed to ensure fork exists.")
-		resp := fmt.Sprintf("cannot fork %s/%s: %v.", org, repo, err)
+		resp := fmt.Sprintf("cannot fork %s/%s: %v.", target.org, target.repo, err)
 		return s.createComment(logger, org, repo, num, comment, resp)
 	}
 
 	// Clone the repo, checkout the target branch.
 	startClone := time.Now()
-	r, err := s.GitClient.ClientFor(org, repo)
+	r, err := s.GitClient.ClientFor(target.org, target.repo)
 	if err != nil {
-		return fmt.Errorf("failed to get git client for %s/%s: %w", org, forkName, err)
+		return transient(fmt.Errorf("failed to get git client for %s/%s: %w", target.org, forkName, err))
 	}
 	defer func() {
 		if err := r.Clean(); err != nil {
 			logger.WithError(err).Error("Error cleaning up repo.")
 		}
 	}()
-	if err := r.Checkout(targetBranch); err != nil {
+	if err := r.Checkout(target.branch); err != nil {
 		logger.WithError(err).Warn("Failed to checkout target branch.")
 		resp := fmt.Sprintf("cannot checkout `%s`: %v", targetBranch, err)
 		return s.createComment(logger, org, repo, num, comment, resp)
@@ -558,30 +660,26 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 	// Fetch the patch from GitHub
 	localPath, err := s.getPatch(org, repo, targetBranch, num)
 	if err != nil {
-		return fmt.Errorf("failed to get patch: %w", err)
+		return transient(fmt.Errorf("failed to get patch: %w", err))
 	}
 
 	// Setup git name and email.
-	if err := r.Config("user.name", s.BotUser.Login); err != nil {
-		return fmt.Errorf("failed to configure git user: %w", err)
-	}
-	email := s.Email
-	if email == "" {
-		email = s.BotUser.Email
-	}
-	if err := r.Config("user.email", email); err != nil {
-		return fmt.Errorf("failed to configure git Email: %w", err)
+	if err := s.configureGitUser(r); err != nil {
+		return err
 	}
 
 	// New branch for the cherry-pick.
-	newBranch := fmt.Sprintf(cherryPickBranchFmt, num, targetBranch)
+	newBranch := fmt.Sprintf(cherryPickBranchFmt, num, target.branch)
+	if target.crossRepo(org, repo) {
+		newBranch = fmt.Sprintf(crossRepoCherryPickBranchFmt, org, repo, num, target.branch)
+	}
 
 	// Check if that branch already exists, which means there is already a PR for that cherry-pick.
 	if r.BranchExists(newBranch) {
 		// Find the PR and link to it.
-		prs, err := s.GitHubClient.GetPullRequests(org, repo)
+		prs, err := s.GitHubClient.GetPullRequests(target.org, target.repo)
 		if err != nil {
-			return fmt.Errorf("failed to get pullrequests for %s/%s: %w", org, repo, err)
+			return transient(fmt.Errorf("failed to get pullrequests for %s/%s: %w", target.org, target.repo, err))
 		}
 		for _, pr := range prs {
 			if pr.Head.Ref == fmt.Sprintf("%s:%s", s.BotUser.Login, newBranch) {
@@ -598,7 +696,11 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 	}
 
 	// Title for GitHub issue/PR.
-	title = fmt.Sprintf("%s (#%d)", title, num)
+	title = fmt.Sprintf("%s (%s)", title, originalRef)
+
+	// The conflicts are known from the git operations, they are committed as they are.
+	hasConflict := false
+	var conflicts []conflictFile
 
 	// Try git am --3way localPath.
 	if err := r.Am(localPath); err != nil {
@@ -617,59 +719,47 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 			// Try to fetch upstream.
 			ex := exec.New()
 			dir := r.Directory()
+			errs = append(errs, s.fetchUpstream(logger, dir, pr)...)
 
-			// Warning: Do not output url with authorization information to the log and response.
-			upstreamURL := fmt.Sprintf("%s/%s", s.GitHubURL, pr.Base.Repo.FullName)
-			upstreamURLWithAuth, err := url.Parse(upstreamURL)
-			if err != nil {
-				logger.WithError(err).Errorf("Failed to remote parse url: %s", upstreamURL)
-				errs = append(errs, fmt.Errorf("failed to parse remote url: %s", upstreamURL))
-			}
-			upstreamURLWithAuth.User = url.UserPassword(s.BotUser.Login, string(s.GitHubTokenGenerator()))
-
-			// Add the upstream remote.
-			addUpstreamRemote := ex.Command("git", "remote", "add", upstreamRemoteName, upstreamURLWithAuth.String())
-			addUpstreamRemote.SetDir(dir)
-			out, err := addUpstreamRemote.CombinedOutput()
-			if err != nil {
-				logger.WithError(err).Warnf("Failed to git remote add %s and the output look like: %s.", upstreamURL, out)
-				errs = append(errs, fmt.Errorf("failed to git remote add %s %s", upstreamRemoteName, upstreamURL))
-			}
-
-			// Fetch the upstream remote.
-			fetchUpstreamRemote := ex.Command("git", "fetch", upstreamRemoteName)
-			fetchUpstreamRemote.SetDir(dir)
-			out, err = fetchUpstreamRemote.CombinedOutput()
-			if err != nil {
-				logger.WithError(err).Warnf("Failed to fetch %s remote and the output look like: %s.", upstreamRemoteName, out)
-				errs = append(errs, fmt.Errorf("failed to git fetch %s", upstreamRemoteName))
-			}
-
-			//  Try git cherry-pick.
-			cherrypick := ex.Command("git", "cherry-pick", "-m", "1", "--cleanup=verbatim", *pr.MergeSHA)
-			cherrypick.SetDir(dir)
-			out, err = cherrypick.CombinedOutput()
-			if err != nil {
-				logger.WithError(err).Warnf("Failed to cherrypick and the output look like: %s.", out)
-				// Try git add *.
-				add := ex.Command("git", "add", "*")
-				add.SetDir(dir)
-				out, err = add.CombinedOutput()
+			if opts.PreserveAuthorship {
+				// Try cherry-picking the commits one by one to preserve their authorship.
+				var pickErrs []error
+				conflicts, hasConflict, pickErrs = s.cherryPickCommits(logger, dir, org, repo, pr)
+				errs = append(errs, pickErrs...)
+			} else {
+				//  Try git cherry-pick.
+				cherrypick := ex.Command("git", "cherry-pick", "-m", "1", "--cleanup=verbatim", *pr.MergeSHA)
+				cherrypick.SetDir(dir)
+				out, err := cherrypick.CombinedOutput()
 				if err != nil {
-					logger.WithError(err).Warnf("Failed to git add conflicting files and the output look like: %s.", out)
-					errs = append(errs, fmt.Errorf("failed to git add conflicting files: %w", err))
-				}
+					logger.WithError(err).Warnf("Failed to cherrypick and the output look like: %s.", out)
+					conflicts, err = conflictFiles(dir)
+					if err != nil {
+						logger.WithError(err).Warn("Failed to collect the conflicts.")
+					}
+					findLastTouchedCommits(logger, dir, conflicts)
+					hasConflict = err != nil || len(conflicts) != 0
+
+					// Try git add *.
+					add := ex.Command("git", "add", "*")
+					add.SetDir(dir)
+					out, err = add.CombinedOutput()
+					if err != nil {
+						logger.WithError(err).Warnf("Failed to git add conflicting files and the output look like: %s.", out)
+						errs = append(errs, fmt.Errorf("failed to git add conflicting files: %w", err))
+					}
 
-				// Try commit with sign off.
-				commitMessage := createCherryPickCommitMessage(
-					s.GitHubClient, s.Log, opts.CopyIssueNumbersFromSquashedCommit, org, repo, num, pr.MergeSHA,
-				)
-				commit := ex.Command("git", "commit", "-s", "-m", commitMessage)
-				commit.SetDir(dir)
-				out, err = commit.CombinedOutput()
-				if err != nil {
-					logger.WithError(err).Warnf("Failed to git commit and the output look like: %s", out)
-					errs = append(errs, fmt.Errorf("failed to git commit: %w", err))
+					// Try commit with sign off.
+					commitMessage := createCherryPickCommitMessage(
+						s.GitHubClient, s.Log, opts.CopyIssueNumbersFromSquashedCommit, org, repo, originalRef, pr.MergeSHA,
+					)
+					commit := ex.Command("git", "commit", "-s", "-m", commitMessage)
+					commit.SetDir(dir)
+					out, err = commit.CombinedOutput()
+					if err != nil {
+						logger.WithError(err).Warnf("Failed to git commit and the output look like: %s", out)
+						errs = append(errs, fmt.Errorf("failed to git commit: %w", err))
+					}
 				}
 			}
 		}
@@ -697,9 +787,10 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 	}
 
 	// Open a PR in GitHub.
-	cherryPickBody := createCherryPickBody(num, body)
+	cherryPickBody := createCherryPickBody(originalRef, body)
 	head := fmt.Sprintf("%s:%s", s.BotUser.Login, newBranch)
-	createdNum, err := s.GitHubClient.CreatePullRequest(org, repo, title, cherryPickBody, head, targetBranch, true)
+	createdNum, err := s.GitHubClient.CreatePullRequest(target.org, target.repo, title, cherryPickBody, head,
+		target.branch, true)
 	if err != nil {
 		logger.WithError(err).Warn("failed to create new pull request")
 		resp := fmt.Sprintf("new pull request could not be created: %v", err)
@@ -707,13 +798,8 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 	}
 	*logger = *logger.WithField("new_pull_request_number", createdNum)
 
-	// if there lines match "<<<<<<<" and ">>>>>>>" and "=======" in the pr diff, it means there is a conflict.
-	hasConflict, err := s.isPrHasSoftConflict(org, repo, createdNum)
-	if err != nil {
-		return err
-	}
-
-	resp := fmt.Sprintf("new pull request created to branch `%s`: #%d.", targetBranch, createdNum)
+	resp := fmt.Sprintf("new pull request created to branch `%s`: %s.", targetBranch,
+		issueRef(target.org, target.repo, createdNum, org, repo))
 	if hasConflict {
 		resp += "\nBut this PR has conflicts, please resolve them!"
 	}
@@ -722,8 +808,31 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 		return fmt.Errorf("failed to create comment: %w", err)
 	}
 
+	conflict := conflictStateNone
+	if hasConflict {
+		conflict = conflictStateConflicting
+	}
+	// The commits cherry-picked one by one may conflict in the same files.
+	conflictingFiles := sets.NewString()
+	for _, file := range conflicts {
+		conflictingFiles.Insert(file.path)
+	}
+	s.trackCherryPick(logger, org, repo, num, trackingEntry{
+		branch:    targetBranch,
+		number:    createdNum,
+		conflict:  conflict,
+		state:     trackingStateOpen,
+		requestor: requestor,
+		files:     conflictingFiles.List(),
+	})
+
 	// Copying original pull request labels.
 	excludeLabelsSet := sets.NewString(opts.ExcludeLabels...)
+	// The cherry-picked pull request needs the approval of the release managers of the target branch again.
+	mergeOpts := s.ConfigAgent.Config().MergeFor(target.org, target.repo)
+	if rule := mergeOpts.ReleaseApprovalRuleFor(target.branch); rule != nil {
+		excludeLabelsSet.Insert(tiexternalplugins.CanMergeLabel, rule.ApprovedLabel)
+	}
 	labels := sets.NewString()
 	for _, label := range pr.Labels {
 		if !excludeLabelsSet.Has(label.Name) && !strings.HasPrefix(label.Name, opts.LabelPrefix) {
@@ -733,7 +842,7 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 
 	// Add picked label.
 	if len(opts.PickedLabelPrefix) > 0 {
-		pickedLabel := opts.PickedLabelPrefix + targetBranch
+		pickedLabel := opts.PickedLabelPrefix + target.branch
 		labels.Insert(pickedLabel)
 	}
 
@@ -741,12 +850,20 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 		labels.Insert("do-not-merge/hold")
 	}
 
-	if err := s.GitHubClient.AddLabels(org, repo, createdNum, labels.List()...); err != nil {
+	if err := s.GitHubClient.AddLabels(target.org, target.repo, createdNum, labels.List()...); err != nil {
 		logger.WithError(err).Warnf("Failed to add labels %v", labels.List())
 	}
 
+	// Report the conflicts, so that whoever resolves them knows where to look.
+	if len(conflicts) != 0 {
+		if err := s.GitHubClient.CreateComment(target.org, target.repo, createdNum,
+			conflictReport(originalRef, target.branch, conflicts)); err != nil {
+			logger.WithError(err).Warn("failed to create the conflict report")
+		}
+	}
+
 	// Assign pull request to requestor.
-	if err := s.GitHubClient.AssignIssue(org, repo, createdNum, []string{requestor}); err != nil {
+	if err := s.GitHubClient.AssignIssue(target.org, target.repo, createdNum, []string{requestor}); err != nil {
 		logger.WithError(err).Warn("failed to assign to new PR")
 		// Ignore returning errors on failure to assign as this is most likely
 		// due to users not being members of the org so that they can't be assigned
@@ -757,7 +874,7 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 	// add a comment to ping the requestor when it has conflicts.
 	if hasConflict {
 		// the requestor should solve it or he should ask others to solve it.
-		err := s.GitHubClient.CreateComment(org, repo, createdNum,
+		err := s.GitHubClient.CreateComment(target.org, target.repo, createdNum,
 			fmt.Sprintf("@%s This PR has conflicts, I have hold it.", requestor)+"\n"+
 				"Please resolve them or ask others to resolve them, then comment `/unhold` to remove the hold label.")
 		if err != nil {
@@ -767,6 +884,58 @@ func (s *Server) handle(logger *logrus.Entry, requestor string,
 	return nil
 }
 
+// configureGitUser sets up the git name and email of the bot in the repo.
+func (s *Server) configureGitUser(r git.RepoClient) error {
+	if err := r.Config("user.name", s.BotUser.Login); err != nil {
+		return fmt.Errorf("failed to configure git user: %w", err)
+	}
+	email := s.Email
+	if email == "" {
+		email = s.BotUser.Email
+	}
+	if err := r.Config("user.email", email); err != nil {
+		return fmt.Errorf("failed to configure git Email: %w", err)
+	}
+	return nil
+}
+
+// fetchUpstream adds the upstream remote to the repo in the directory and fetches it,
+// so that the merge commit of the PR can be cherry-picked.
+func (s *Server) fetchUpstream(logger *logrus.Entry, dir string, pr *github.PullRequest, refspecs ...string) []error {
+	ex := exec.New()
+
+	// Warning: Do not output url with authorization information to the log and response.
+	upstreamURL := fmt.Sprintf("%s/%s", s.GitHubURL, pr.Base.Repo.FullName)
+	upstreamURLWithAuth, err := url.Parse(upstreamURL)
+	if err != nil {
+		logger.WithError(err).Errorf("Failed to remote parse url: %s", upstreamURL)
+		return []error{fmt.Errorf("failed to parse remote url: %s", upstreamURL)}
+	}
+	upstreamURLWithAuth.User = url.UserPassword(s.BotUser.Login, string(s.GitHubTokenGenerator()))
+
+	var errs []error
+	// Add the upstream remote.
+	addUpstreamRemote := ex.Command("git", "remote", "add", upstreamRemoteName, upstreamURLWithAuth.String())
+	addUpstreamRemote.SetDir(dir)
+	out, err := addUpstreamRemote.CombinedOutput()
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to git remote add %s and the output look like: %s.", upstreamURL, out)
+		errs = append(errs, fmt.Errorf("failed to git remote add %s %s", upstreamRemoteName, upstreamURL))
+	}
+
+	// Fetch the upstream remote.
+	fetchUpstreamRemote := ex.Command("git", append([]string{"fetch", upstreamRemoteName}, refspecs...)...)
+	fetchUpstreamRemote.SetDir(dir)
+	out, err = fetchUpstreamRemote.CombinedOutput()
+	if err != nil {
+		logger.WithError(err).Warnf("Failed to fetch %s remote and the output look like: %s.", upstreamRemoteName, out)
+		errs = append(errs, fmt.Errorf("failed to git fetch %s", upstreamRemoteName))
+	}
+	return errs
+}
+
+// isPrHasSoftConflict checks whether the conflict markers are still in the PR diff,
+// it is used to find out whether the conflicts are resolved by the new commits.
 func (s *Server) isPrHasSoftConflict(org, repo string, prNum int) (bool, error) {
 	diffBytes, err := s.GitHubClient.GetPullRequestPatch(org, repo, prNum)
 	if err != nil {
@@ -851,20 +1020,20 @@ func normalize(input string) string {
 
 // createCherryPickCommitMessage creates the commit message for the cherry-pick commit.
 func createCherryPickCommitMessage(gc GithubClient, log *logrus.Entry, copyIssueNumbers bool,
-	org, repo string, num int, mergeSHA *string) string {
-	cherryPickCommitMessage := fmt.Sprintf(cherryPickTipFmt, num)
+	org, repo, ref string, mergeSHA *string) string {
+	cherryPickCommitMessage := fmt.Sprintf(cherryPickTipFmt, ref)
 
 	if copyIssueNumbers {
 		sha := ""
 		if mergeSHA == nil {
-			log.Errorf("Failed to get the merge SHA of PR #%d.", num)
+			log.Errorf("Failed to get the merge SHA of PR %s.", ref)
 			return cherryPickCommitMessage
 		}
 		sha = *mergeSHA
 
 		commit, err := gc.GetSingleCommit(org, repo, sha)
 		if err != nil {
-			log.WithError(err).Errorf("Failed to get the squash commit %s of PR #%d.", sha, num)
+			log.WithError(err).Errorf("Failed to get the squash commit %s of PR %s.", sha, ref)
 			return cherryPickCommitMessage
 		}
 		numberValues := utils.NormalizeIssueNumbers(commit.Commit.Message, org, repo)
@@ -883,8 +1052,8 @@ func createCherryPickCommitMessage(gc GithubClient, log *logrus.Entry, copyIssue
 }
 
 // createCherryPickBody creates the body of a cherry-pick PR.
-func createCherryPickBody(num int, note string) string {
-	cherryPickBody := fmt.Sprintf(cherryPickTipFmt, num)
+func createCherryPickBody(ref string, note string) string {
+	cherryPickBody := fmt.Sprintf(cherryPickTipFmt, ref)
 	if len(note) != 0 {
 		cherryPickBody = fmt.Sprintf("%s\n\n%s", cherryPickBody, note)
 	}
@@ -0,0 +1,110 @@
+package cherrypicker
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/utils/exec"
+)
+
+// gitOutput runs the git command in the directory and returns its trimmed output.
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.New().Command("git", args...)
+	cmd.SetDir(dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w, %s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// commitsToPick returns the commits of the merged PR on the base branch in the order of applying.
+// They are the commits of the PR for the merge commit and the rebase merge, or the squashed commit.
+func (s *Server) commitsToPick(logger *logrus.Entry, dir, org, repo string, pr *github.PullRequest) ([]string, error) {
+	mergeSHA := *pr.MergeSHA
+	parents, err := gitOutput(dir, "rev-list", "--parents", "-n", "1", mergeSHA)
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.Fields(parents)) > 2 {
+		// The merge commit, the merge commits of the PR are dropped like the patch of the PR does.
+		out, err := gitOutput(dir, "rev-list", "--reverse", "--no-merges", mergeSHA+"^1.."+mergeSHA)
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(out), nil
+	}
+
+	prCommits, err := s.GitHubClient.ListPRCommits(org, repo, pr.Number)
+	if err != nil {
+		return nil, transient(fmt.Errorf("failed to list the commits of %s/%s#%d: %w", org, repo, pr.Number, err))
+	}
+	var nonMergeCommits []github.RepositoryCommit
+	for _, commit := range prCommits {
+		if len(commit.Parents) <= 1 {
+			nonMergeCommits = append(nonMergeCommits, commit)
+		}
+	}
+	if len(nonMergeCommits) <= 1 {
+		return []string{mergeSHA}, nil
+	}
+
+	// The rebase merge puts the commits of the PR on the base branch as they are, so the last one of them
+	// has the same message as the last commit of the PR, unlike the squashed commit.
+	message, err := gitOutput(dir, "log", "-1", "--format=%B", mergeSHA)
+	if err != nil {
+		return nil, err
+	}
+	if message != strings.TrimSpace(nonMergeCommits[len(nonMergeCommits)-1].Commit.Message) {
+		return []string{mergeSHA}, nil
+	}
+	logger.Infof("The PR is rebase merged with %d commits.", len(nonMergeCommits))
+	out, err := gitOutput(dir, "rev-list", "--reverse", fmt.Sprintf("--max-count=%d", len(nonMergeCommits)), mergeSHA)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// cherryPickCommits cherry-picks the commits of the merged PR one by one, so that the authors, the messages
+// with the co-author trailers and the commit structure are preserved. The conflicting commits are committed
+// with the conflict markers, and the conflicts of all commits are returned.
+func (s *Server) cherryPickCommits(logger *logrus.Entry, dir, org, repo string,
+	pr *github.PullRequest) ([]conflictFile, bool, []error) {
+	commits, err := s.commitsToPick(logger, dir, org, repo, pr)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to find the commits to cherry-pick.")
+		return nil, false, []error{fmt.Errorf("failed to find the commits to cherry-pick: %w", err)}
+	}
+
+	var conflicts []conflictFile
+	hasConflict := false
+	for _, sha := range commits {
+		if _, err := gitOutput(dir, "cherry-pick", "-x", "--allow-empty", "--keep-redundant-commits", sha); err == nil {
+			continue
+		} else {
+			logger.WithError(err).Warnf("Failed to cherrypick %s.", sha)
+		}
+
+		commitConflicts, err := conflictFiles(dir)
+		if err != nil {
+			logger.WithError(err).Warn("Failed to collect the conflicts.")
+		}
+		findLastTouchedCommits(logger, dir, commitConflicts)
+		conflicts = mergeConflictFiles(conflicts, commitConflicts)
+		hasConflict = hasConflict || err != nil || len(commitConflicts) != 0
+
+		if _, err := gitOutput(dir, "add", "*"); err != nil {
+			logger.WithError(err).Warn("Failed to git add conflicting files.")
+			return conflicts, hasConflict, []error{fmt.Errorf("failed to git add conflicting files: %w", err)}
+		}
+		// The author and the message of the conflicting commit are kept by the cherry-pick in progress.
+		if _, err := gitOutput(dir, "commit", "-s", "--no-edit", "--cleanup=strip", "--allow-empty"); err != nil {
+			logger.WithError(err).Warn("Failed to git commit.")
+			return conflicts, hasConflict, []error{fmt.Errorf("failed to git commit: %w", err)}
+		}
+	}
+	return conflicts, hasConflict, nil
+}
@@ -0,0 +1,131 @@
+package cherrypicker
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+)
+
+func TestCherryPickCommits(t *testing.T) {
+	lg, c, _, _ := makeConflictingRepo(t)
+	repoDir := filepath.Join(lg.Dir, "foo", "bar")
+	run := func(dir string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v, %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	// The PR has the commits of two authors, and is merged by a merge commit, a rebase merge or a squashed commit.
+	run(repoDir, "checkout", "-q", "-b", "feature", "master~1")
+	run(repoDir, "commit", "-q", "--allow-empty", "--author", "Alice <alice@example.com>", "-m", "Prepare")
+	run(repoDir, "commit", "-q", "--allow-empty", "--author", "Bob <bob@example.com>",
+		"-m", "Fix a\n\nCo-authored-by: Carol <carol@example.com>")
+	run(repoDir, "cherry-pick", "--allow-empty", "master")
+	run(repoDir, "commit", "-q", "--amend", "--no-edit", "--author", "Bob <bob@example.com>")
+	featureCommits := strings.Fields(run(repoDir, "rev-list", "--reverse", "master~1..feature"))
+
+	run(repoDir, "checkout", "-q", "-b", "merged", "master~1")
+	run(repoDir, "merge", "-q", "--no-ff", "-m", "Merge pull request #2", "feature")
+	mergeSHA := run(repoDir, "rev-parse", "HEAD")
+	run(repoDir, "checkout", "-q", "-b", "rebased", "master~1")
+	run(repoDir, "cherry-pick", "--allow-empty", "master~1..feature")
+	rebasedCommits := strings.Fields(run(repoDir, "rev-list", "--reverse", "master~1..rebased"))
+	run(repoDir, "checkout", "-q", "-b", "squashed", "master~1")
+	run(repoDir, "merge", "-q", "--squash", "feature")
+	run(repoDir, "commit", "-q", "--allow-empty", "-m", "Fix a (#2)")
+	squashSHA := run(repoDir, "rev-parse", "HEAD")
+	run(repoDir, "checkout", "-q", "master")
+
+	var prCommits []github.RepositoryCommit
+	for _, sha := range featureCommits {
+		prCommits = append(prCommits, github.RepositoryCommit{
+			SHA:     sha,
+			Commit:  github.GitCommit{Message: run(repoDir, "log", "-1", "--format=%B", sha) + "\n"},
+			Parents: []github.GitCommit{{}},
+		})
+	}
+	ghc := &fghc{prCommits: prCommits}
+	s := &Server{
+		BotUser:      &github.UserData{Login: "ci-robot", Email: "ci-robot@users.noreply.github.com"},
+		GitClient:    c,
+		GitHubClient: ghc,
+		Log:          logrus.StandardLogger().WithField("client", "cherrypicker"),
+	}
+	l := logrus.NewEntry(logrus.StandardLogger())
+
+	r, err := c.ClientFor("foo", "bar")
+	if err != nil {
+		t.Fatalf("Cloning the repo: %v", err)
+	}
+	defer func() {
+		if err := r.Clean(); err != nil {
+			t.Errorf("Cleaning up repo: %v", err)
+		}
+	}()
+	if err := r.Checkout("release-conflict"); err != nil {
+		t.Fatalf("Checking out the target branch: %v", err)
+	}
+	if err := s.configureGitUser(r); err != nil {
+		t.Fatalf("Configuring git user: %v", err)
+	}
+	dir := r.Directory()
+
+	for _, tc := range []struct {
+		name     string
+		mergeSHA string
+		expected []string
+	}{
+		{name: "merge commit", mergeSHA: mergeSHA, expected: featureCommits},
+		{name: "rebase merge", mergeSHA: rebasedCommits[len(rebasedCommits)-1], expected: rebasedCommits},
+		{name: "squashed commit", mergeSHA: squashSHA, expected: []string{squashSHA}},
+	} {
+		sha := tc.mergeSHA
+		commits, err := s.commitsToPick(l, dir, "foo", "bar", &github.PullRequest{Number: 2, MergeSHA: &sha})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if !reflect.DeepEqual(commits, tc.expected) {
+			t.Errorf("%s: commits mismatch: got %v, want %v", tc.name, commits, tc.expected)
+		}
+	}
+
+	conflicts, hasConflict, errs := s.cherryPickCommits(l, dir, "foo", "bar",
+		&github.PullRequest{Number: 2, MergeSHA: &mergeSHA})
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if !hasConflict || len(conflicts) != 2 || conflicts[0].path != "a.txt" || conflicts[1].path != "b.txt" {
+		t.Errorf("expected the conflicts of a.txt and b.txt, but got %+v", conflicts)
+	}
+
+	// The authors, the messages and the structure of the commits are preserved.
+	log := run(dir, "log", "--reverse", "--format=%an <%ae>|%B", "origin/release-conflict..HEAD")
+	entries := strings.Split(log, "(cherry picked from commit ")
+	if len(entries) != 4 {
+		t.Fatalf("expected three commits, but got %s", log)
+	}
+	for i, expected := range []string{"Alice <alice@example.com>|Prepare",
+		"Bob <bob@example.com>|Fix a\n\nCo-authored-by: Carol <carol@example.com>",
+		"Bob <bob@example.com>|"} {
+		entry := strings.TrimSpace(entries[i])
+		if i > 0 {
+			entry = strings.TrimSpace(entry[strings.Index(entry, ")")+1:])
+		}
+		if !strings.HasPrefix(entry, expected) {
+			t.Errorf("commit %d mismatch: got %q, want the prefix %q", i, entry, expected)
+		}
+	}
+	if out := run(dir, "show", "HEAD:a.txt"); !strings.Contains(out, conflictOursMarker) {
+		t.Errorf("expected the conflict markers to be committed, but got %s", out)
+	}
+}
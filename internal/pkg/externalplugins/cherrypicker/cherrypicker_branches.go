@@ -0,0 +1,98 @@
+package cherrypicker
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+// allMaintainedAlias is the alias of the release branches of all maintained versions.
+const allMaintainedAlias = "all-maintained"
+
+// resolveTargetBranches expands the aliases in the requested branches,
+// and splits them into the allowed branches and the rejected ones.
+// The branches of other repos of the form org/repo:branch are allowed if their repos are the target repos.
+func resolveTargetBranches(opts *tiexternalplugins.TiCommunityCherrypicker,
+	requested []string) (allowed, rejected sets.String) {
+	allowed = sets.NewString()
+	rejected = sets.NewString()
+	for _, branch := range requested {
+		if branch == allMaintainedAlias {
+			maintained := opts.MaintainedBranches()
+			if len(maintained) == 0 {
+				rejected.Insert(branch)
+			}
+			allowed.Insert(maintained...)
+			continue
+		}
+		if strings.Contains(branch, ":") {
+			if target, ok := parseCrossRepoTarget(branch); ok && opts.IsAllowedTargetRepo(target.org+"/"+target.repo) {
+				allowed.Insert(branch)
+			} else {
+				rejected.Insert(branch)
+			}
+			continue
+		}
+		if opts.IsAllowedTargetBranch(branch) {
+			allowed.Insert(branch)
+		} else {
+			rejected.Insert(branch)
+		}
+	}
+	return allowed, rejected
+}
+
+// rejectedBranchesMessage returns the response to the rejected branches, which lists the valid target branches.
+func rejectedBranchesMessage(opts *tiexternalplugins.TiCommunityCherrypicker, rejected []string) string {
+	var b strings.Builder
+	quoted := make([]string, 0, len(rejected))
+	for _, branch := range rejected {
+		quoted = append(quoted, fmt.Sprintf("`%s`", branch))
+	}
+	fmt.Fprintf(&b, "cannot cherry-pick to %s, which are not the valid target branches.\n\n",
+		strings.Join(quoted, ", "))
+
+	maintained := opts.MaintainedBranches()
+	unrestricted := len(maintained) == 0 && len(opts.TargetBranches) == 0
+	if unrestricted && len(opts.TargetRepos) == 0 {
+		// Only the alias and the branches of other repos can be rejected.
+		var notes []string
+		for _, branch := range rejected {
+			if branch == allMaintainedAlias {
+				notes = append(notes, "No maintained version is configured, so the alias `"+allMaintainedAlias+
+					"` is not available.")
+				break
+			}
+		}
+		for _, branch := range rejected {
+			if strings.Contains(branch, ":") {
+				notes = append(notes, "No target repo is configured, so the branches of other repos are not available.")
+				break
+			}
+		}
+		b.WriteString(strings.Join(notes, "\n"))
+		return b.String()
+	}
+
+	b.WriteString("The valid target branches are:\n")
+	if unrestricted {
+		b.WriteString("- any branch of this repo\n")
+	}
+	for _, branch := range maintained {
+		fmt.Fprintf(&b, "- `%s`\n", branch)
+	}
+	for _, pattern := range opts.TargetBranches {
+		fmt.Fprintf(&b, "- the branches matching `%s`\n", pattern)
+	}
+	for _, repo := range opts.TargetRepos {
+		fmt.Fprintf(&b, "- the branches of `%s` of the form `%s:branch`\n", repo, repo)
+	}
+	if len(maintained) != 0 {
+		fmt.Fprintf(&b, "\nComment `/cherry-pick %s` to cherry-pick to the release branches of all maintained versions.",
+			allMaintainedAlias)
+	}
+	return b.String()
+}
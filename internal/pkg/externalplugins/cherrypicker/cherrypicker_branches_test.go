@@ -0,0 +1,165 @@
+package cherrypicker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+func TestResolveTargetBranches(t *testing.T) {
+	testcases := []struct {
+		name               string
+		targetBranches     []string
+		maintainedVersions []string
+		targetRepos        []string
+		requested          []string
+
+		expectAllowed  []string
+		expectRejected []string
+	}{
+		{
+			name:          "not restricted",
+			requested:     []string{"release-2.0", "feature/x"},
+			expectAllowed: []string{"feature/x", "release-2.0"},
+		},
+		{
+			name:               "reject the eol branches",
+			targetBranches:     []string{"^feature/"},
+			maintainedVersions: []string{"5.0", "4.0"},
+			requested:          []string{"release-2.0", "release-4.0", "feature/x"},
+			expectAllowed:      []string{"feature/x", "release-4.0"},
+			expectRejected:     []string{"release-2.0"},
+		},
+		{
+			name:               "expand the alias",
+			maintainedVersions: []string{"5.0", "4.0"},
+			requested:          []string{allMaintainedAlias, "release-5.0"},
+			expectAllowed:      []string{"release-4.0", "release-5.0"},
+		},
+		{
+			name:           "alias without maintained versions",
+			requested:      []string{allMaintainedAlias, "release-5.0"},
+			expectAllowed:  []string{"release-5.0"},
+			expectRejected: []string{allMaintainedAlias},
+		},
+		{
+			name:               "branches of other repos",
+			maintainedVersions: []string{"5.0"},
+			targetRepos:        []string{"foo/docs"},
+			requested:          []string{"foo/docs:release-2.0", "foo/other:master", "docs:master"},
+			expectAllowed:      []string{"foo/docs:release-2.0"},
+			expectRejected:     []string{"docs:master", "foo/other:master"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			opts := &externalplugins.TiCommunityCherrypicker{
+				TargetBranches:     tc.targetBranches,
+				MaintainedVersions: tc.maintainedVersions,
+				TargetRepos:        tc.targetRepos,
+			}
+			allowed, rejected := resolveTargetBranches(opts, tc.requested)
+			if !allowed.Equal(sets.NewString(tc.expectAllowed...)) {
+				t.Errorf("allowed branches mismatch: got %v, want %v", allowed.List(), tc.expectAllowed)
+			}
+			if !rejected.Equal(sets.NewString(tc.expectRejected...)) {
+				t.Errorf("rejected branches mismatch: got %v, want %v", rejected.List(), tc.expectRejected)
+			}
+		})
+	}
+}
+
+func TestRejectInvalidTargetBranches(t *testing.T) {
+	cfg := &externalplugins.Configuration{}
+	cfg.TiCommunityCherrypicker = []externalplugins.TiCommunityCherrypicker{
+		{
+			Repos:              []string{"foo/bar"},
+			LabelPrefix:        "cherrypick/",
+			AllowAll:           true,
+			TargetBranches:     []string{"^feature/"},
+			MaintainedVersions: []string{"1.6", "1.5"},
+		},
+	}
+	ca := &externalplugins.ConfigAgent{}
+	ca.Set(cfg)
+
+	validBranches := "The valid target branches are:\n- `release-1.6`\n- `release-1.5`\n" +
+		"- the branches matching `^feature/`\n"
+
+	t.Run("comment", func(t *testing.T) {
+		ghc := &fghc{}
+		s := &Server{
+			BotUser:      &github.UserData{Login: "ci-robot"},
+			ConfigAgent:  ca,
+			GitHubClient: ghc,
+			Log:          logrus.StandardLogger().WithField("client", "cherrypicker"),
+		}
+		ic := &github.IssueCommentEvent{
+			Action: github.IssueCommentActionCreated,
+			Repo: github.Repo{
+				Owner: github.User{Login: "foo"},
+				Name:  "bar",
+			},
+			Issue: github.Issue{Number: 2, State: "open", PullRequest: &struct{}{}},
+			Comment: github.IssueComment{
+				User: github.User{Login: "wiseguy"},
+				Body: "/cherry-pick release-2.0\r\n/cherry-pick all-maintained",
+			},
+		}
+		if err := s.handleIssueComment(logrus.NewEntry(logrus.StandardLogger()), ic); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(ghc.comments) != 2 {
+			t.Fatalf("expected two comments, but got %v", ghc.comments)
+		}
+		if !strings.Contains(ghc.comments[0], "cannot cherry-pick to `release-2.0`") ||
+			!strings.Contains(ghc.comments[0], validBranches) {
+			t.Errorf("unexpected rejection: %s", ghc.comments[0])
+		}
+		if !strings.Contains(ghc.comments[1], "I will cherry-pick it on top of release-1.5/release-1.6") {
+			t.Errorf("unexpected response: %s", ghc.comments[1])
+		}
+	})
+
+	t.Run("label", func(t *testing.T) {
+		ghc := &fghc{}
+		s := &Server{
+			BotUser:      &github.UserData{Login: "ci-robot"},
+			ConfigAgent:  ca,
+			GitHubClient: ghc,
+			Log:          logrus.StandardLogger().WithField("client", "cherrypicker"),
+		}
+		mergeSHA := "sha"
+		pre := &github.PullRequestEvent{
+			Action: github.PullRequestActionLabeled,
+			PullRequest: github.PullRequest{
+				Base: github.PullRequestBranch{
+					Ref:  "master",
+					Repo: github.Repo{Owner: github.User{Login: "foo"}, Name: "bar"},
+				},
+				Number:   2,
+				Merged:   true,
+				MergeSHA: &mergeSHA,
+				User:     github.User{Login: "developer"},
+			},
+			Label: github.Label{Name: "cherrypick/release-2.0"},
+		}
+		if err := s.handlePullRequest(logrus.NewEntry(logrus.StandardLogger()), pre); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(ghc.comments) != 1 || !strings.Contains(ghc.comments[0],
+			"In response to a cherrypick label: cannot cherry-pick to `release-2.0`") {
+			t.Fatalf("unexpected comments: %v", ghc.comments)
+		}
+		if len(ghc.prs) != 0 {
+			t.Errorf("expected no PR to be created, but got %v", ghc.prs)
+		}
+	})
+}
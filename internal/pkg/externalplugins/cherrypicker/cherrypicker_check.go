@@ -0,0 +1,234 @@
+package cherrypicker
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/utils/exec"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+const (
+	cherryPickCheckExample = "/cherry-pick-check release-5.0"
+
+	checkMethodAm                = "git am --3way"
+	checkMethodCherryPick        = "git cherry-pick"
+	checkMethodCherryPickCommits = "git cherry-pick -x <each commit>"
+)
+
+var cherryPickCheckRe = regexp.MustCompile(`(?m)^(?:/cherrypick|/cherry-pick)-check\s+(.+)$`)
+
+// checkResult records whether the PR can be cherry-picked to the target branch.
+type checkResult struct {
+	branch string
+	// method is the git operation which applies the PR, or the last one tried if it can not be applied.
+	method    string
+	clean     bool
+	conflicts []conflictFile
+	// err is the error which prevents the check from completing.
+	err error
+}
+
+// checkCherryPicks checks whether the PR can be cherry-picked to the requested branches in scratch clones,
+// nothing is pushed and no PR is created.
+func (s *Server) checkCherryPicks(l *logrus.Entry, ic *github.IssueCommentEvent) error {
+	org := ic.Repo.Owner.Login
+	repo := ic.Repo.Name
+	num := ic.Issue.Number
+	opts := s.ConfigAgent.Config().CherrypickerFor(org, repo)
+
+	*l = *l.WithFields(logrus.Fields{
+		github.OrgLogField:  org,
+		github.RepoLogField: repo,
+		github.PrLogField:   num,
+	})
+
+	var requestedBranches []string
+	for _, match := range cherryPickCheckRe.FindAllStringSubmatch(ic.Comment.Body, -1) {
+		requestedBranches = append(requestedBranches, strings.Fields(match[1])...)
+	}
+	if len(requestedBranches) == 0 {
+		return nil
+	}
+	branches, rejectedBranches := resolveTargetBranches(opts, requestedBranches)
+
+	if !opts.AllowAll {
+		ok, err := s.GitHubClient.IsMember(org, ic.Comment.User.Login)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			resp := fmt.Sprintf("only [%s](https://github.com/orgs/%s/people) org members may check cherry-picks.",
+				org, org)
+			l.Info(resp)
+			return s.GitHubClient.CreateComment(org, repo, num, tiexternalplugins.FormatICResponse(ic.Comment, resp))
+		}
+	}
+
+	pr, err := s.GitHubClient.GetPullRequest(org, repo, num)
+	if err != nil {
+		return fmt.Errorf("failed to get pull request %s/%s#%d: %w", org, repo, num, err)
+	}
+	patch, err := s.GitHubClient.GetPullRequestPatch(org, repo, num)
+	if err != nil {
+		return fmt.Errorf("failed to get patch: %w", err)
+	}
+	patchFile, err := os.CreateTemp("", fmt.Sprintf("%s_%s_%d_*.patch", org, repo, num))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(patchFile.Name())
+	if _, err := patchFile.Write(patch); err != nil {
+		_ = patchFile.Close()
+		return err
+	}
+	if err := patchFile.Close(); err != nil {
+		return err
+	}
+
+	var results []checkResult
+	for _, branch := range branches.Union(rejectedBranches).List() {
+		if rejectedBranches.Has(branch) {
+			results = append(results, checkResult{
+				branch: branch,
+				err:    fmt.Errorf("%s is not a valid target branch", branch),
+			})
+			continue
+		}
+		if branch == pr.Base.Ref {
+			results = append(results, checkResult{
+				branch: branch,
+				err:    fmt.Errorf("base branch (%s) needs to differ from target branch (%s)", pr.Base.Ref, branch),
+			})
+			continue
+		}
+		result := s.checkCherryPick(l.WithField("target_branch", branch), opts, org, repo, branch,
+			patchFile.Name(), pr)
+		results = append(results, result)
+	}
+
+	resp := checkMessage(results)
+	return s.GitHubClient.CreateComment(org, repo, num, tiexternalplugins.FormatICResponse(ic.Comment, resp))
+}
+
+// checkCherryPick applies the patch of the PR to the target branch in a scratch clone, it falls back to
+// cherry-pick the merge commit of the PR, or the commits of the PR one by one if the authorship is preserved,
+// like the cherry-pick does, and collects the conflicts if both fail.
+func (s *Server) checkCherryPick(logger *logrus.Entry, opts *tiexternalplugins.TiCommunityCherrypicker,
+	org, repo, targetBranch, patchPath string, pr *github.PullRequest) checkResult {
+	result := checkResult{branch: targetBranch, method: checkMethodAm}
+	target := resolveCherryPickTarget(org, repo, targetBranch)
+
+	r, err := s.GitClient.ClientFor(target.org, target.repo)
+	if err != nil {
+		result.err = fmt.Errorf("failed to get git client for %s/%s: %w", target.org, target.repo, err)
+		return result
+	}
+	defer func() {
+		if err := r.Clean(); err != nil {
+			logger.WithError(err).Error("Error cleaning up repo.")
+		}
+	}()
+	if err := r.Checkout(target.branch); err != nil {
+		result.err = fmt.Errorf("cannot checkout `%s`: %w", targetBranch, err)
+		return result
+	}
+	if err := s.configureGitUser(r); err != nil {
+		result.err = err
+		return result
+	}
+
+	if err := r.Am(patchPath); err == nil {
+		result.clean = true
+		return result
+	}
+	logger.Info("Failed to apply the patch, falling back to cherry-pick the merge commit.")
+
+	result.method = checkMethodCherryPick
+	if pr.MergeSHA == nil {
+		result.err = fmt.Errorf("the patch can not be applied and the merge commit of #%d is unknown", pr.Number)
+		return result
+	}
+	dir := r.Directory()
+	var refspecs []string
+	if !pr.Merged {
+		// The test merge commit of the open PR is only reachable from its merge ref.
+		refspecs = append(refspecs, fmt.Sprintf("pull/%d/merge", pr.Number))
+	}
+	if errs := s.fetchUpstream(logger, dir, pr, refspecs...); len(errs) != 0 {
+		result.err = errs[0]
+		return result
+	}
+
+	if opts.PreserveAuthorship {
+		result.method = checkMethodCherryPickCommits
+		conflicts, hasConflict, errs := s.cherryPickCommits(logger, dir, org, repo, pr)
+		if len(errs) != 0 {
+			result.err = errs[0]
+			return result
+		}
+		result.clean = !hasConflict
+		result.conflicts = conflicts
+		return result
+	}
+
+	ex := exec.New()
+	cherrypick := ex.Command("git", "cherry-pick", "-m", "1", "--no-commit", *pr.MergeSHA)
+	cherrypick.SetDir(dir)
+	out, err := cherrypick.CombinedOutput()
+	if err == nil {
+		result.clean = true
+		return result
+	}
+	logger.WithError(err).Infof("Failed to cherrypick and the output look like: %s.", out)
+
+	conflicts, err := conflictFiles(dir)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	if len(conflicts) == 0 {
+		result.err = fmt.Errorf("failed to cherry-pick: %s", strings.TrimSpace(string(out)))
+	}
+	result.conflicts = conflicts
+	return result
+}
+
+// checkMessage returns the report of the cherry-pick checks.
+func checkMessage(results []checkResult) string {
+	var b strings.Builder
+	b.WriteString("the results of the cherry-pick check, nothing is pushed and no PR is created:\n\n")
+	b.WriteString("| Target Branch | Result | Conflicting Files |\n")
+	b.WriteString("| --- | --- | --- |\n")
+	for i := range results {
+		result := &results[i]
+		var outcome string
+		switch {
+		case result.err != nil:
+			outcome = "cannot check: " + strings.ReplaceAll(strings.ReplaceAll(result.err.Error(), "\n", " "), "|", "\\|")
+		case result.clean:
+			outcome = fmt.Sprintf("applies cleanly with `%s`", result.method)
+		default:
+			outcome = fmt.Sprintf("conflicts with `%s`", result.method)
+		}
+
+		var files []string
+		for _, conflict := range result.conflicts {
+			switch len(conflict.hunks) {
+			case 0:
+				files = append(files, fmt.Sprintf("`%s`", conflict.path))
+			case 1:
+				files = append(files, fmt.Sprintf("`%s` (1 hunk)", conflict.path))
+			default:
+				files = append(files, fmt.Sprintf("`%s` (%d hunks)", conflict.path, len(conflict.hunks)))
+			}
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s |\n", result.branch, outcome, strings.Join(files, "<br>"))
+	}
+	return b.String()
+}
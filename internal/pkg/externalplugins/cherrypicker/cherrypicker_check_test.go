@@ -0,0 +1,181 @@
+package cherrypicker
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/git/localgit"
+	git "k8s.io/test-infra/prow/git/v2"
+	"k8s.io/test-infra/prow/github"
+
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+// makeConflictingRepo makes the repo foo/bar, whose master has a commit conflicting with the branch
+// release-conflict and applying cleanly to the branch release-clean. It returns the SHA and the patch of the commit.
+func makeConflictingRepo(t *testing.T) (*localgit.LocalGit, git.ClientFactory, string, []byte) {
+	t.Helper()
+	lg, c, err := localgit.NewV2()
+	if err != nil {
+		t.Fatalf("Making localgit: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := lg.Clean(); err != nil {
+			t.Errorf("Cleaning up localgit: %v", err)
+		}
+		if err := c.Clean(); err != nil {
+			t.Errorf("Cleaning up client: %v", err)
+		}
+	})
+	lg.InitialBranch = "master"
+	if err := lg.MakeFakeRepo("foo", "bar"); err != nil {
+		t.Fatalf("Making fake repo: %v", err)
+	}
+	lines := func(replaces map[int]string) []byte {
+		var ls []string
+		for i := 1; i <= 20; i++ {
+			l, ok := replaces[i]
+			if !ok {
+				l = strings.Repeat("line ", i)
+			}
+			ls = append(ls, l)
+		}
+		return []byte(strings.Join(ls, "\n") + "\n")
+	}
+	if err := lg.AddCommit("foo", "bar", map[string][]byte{"a.txt": lines(nil), "b.txt": lines(nil)}); err != nil {
+		t.Fatalf("Adding initial commit: %v", err)
+	}
+	if err := lg.CheckoutNewBranch("foo", "bar", "release-clean"); err != nil {
+		t.Fatalf("Checking out branch: %v", err)
+	}
+	if err := lg.CheckoutNewBranch("foo", "bar", "release-conflict"); err != nil {
+		t.Fatalf("Checking out branch: %v", err)
+	}
+	if err := lg.AddCommit("foo", "bar", map[string][]byte{
+		"a.txt": lines(map[int]string{2: "release", 18: "release"}),
+		"b.txt": lines(map[int]string{10: "release"}),
+	}); err != nil {
+		t.Fatalf("Adding commit: %v", err)
+	}
+	if err := lg.Checkout("foo", "bar", "master"); err != nil {
+		t.Fatalf("Checking out master: %v", err)
+	}
+	if err := lg.AddCommit("foo", "bar", map[string][]byte{
+		"a.txt": lines(map[int]string{2: "master", 18: "master"}),
+		"b.txt": lines(map[int]string{10: "master"}),
+	}); err != nil {
+		t.Fatalf("Adding commit: %v", err)
+	}
+	mergeSHA, err := lg.RevParse("foo", "bar", "HEAD")
+	if err != nil {
+		t.Fatalf("Getting the merge commit: %v", err)
+	}
+	formatPatch := exec.Command("git", "format-patch", "-1", "--stdout", mergeSHA)
+	formatPatch.Dir = filepath.Join(lg.Dir, "foo", "bar")
+	patch, err := formatPatch.Output()
+	if err != nil {
+		t.Fatalf("Formatting the patch: %v", err)
+	}
+	return lg, c, mergeSHA, patch
+}
+
+func TestCheckCherryPicks(t *testing.T) {
+	testcases := []struct {
+		name               string
+		preserveAuthorship bool
+		expectConflictRow  string
+	}{
+		{
+			name: "cherry-pick the merge commit",
+			expectConflictRow: "| `release-conflict` | conflicts with `git cherry-pick` | " +
+				"`a.txt` (2 hunks)<br>`b.txt` (1 hunk) |",
+		},
+		{
+			name:               "cherry-pick the commits to preserve the authorship",
+			preserveAuthorship: true,
+			expectConflictRow: "| `release-conflict` | conflicts with `git cherry-pick -x <each commit>` | " +
+				"`a.txt` (2 hunks)<br>`b.txt` (1 hunk) |",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			lg, c, mergeSHA, patch := makeConflictingRepo(t)
+
+			ghc := &fghc{
+				pr: &github.PullRequest{
+					Base: github.PullRequestBranch{
+						Ref:  "master",
+						Repo: github.Repo{FullName: "foo/bar"},
+					},
+					Number:   2,
+					Merged:   true,
+					MergeSHA: &mergeSHA,
+				},
+				isMember:  true,
+				patch:     patch,
+				prCommits: []github.RepositoryCommit{{SHA: mergeSHA, Parents: []github.GitCommit{{}}}},
+			}
+
+			cfg := &externalplugins.Configuration{}
+			cfg.TiCommunityCherrypicker = []externalplugins.TiCommunityCherrypicker{
+				{Repos: []string{"foo/bar"}, PreserveAuthorship: tc.preserveAuthorship},
+			}
+			ca := &externalplugins.ConfigAgent{}
+			ca.Set(cfg)
+
+			s := &Server{
+				BotUser:              &github.UserData{Login: "ci-robot", Email: "ci-robot@users.noreply.github.com"},
+				GitClient:            c,
+				ConfigAgent:          ca,
+				Push:                 func(_, _ string, _ bool) error { return nil },
+				GitHubClient:         ghc,
+				GitHubTokenGenerator: func() []byte { return []byte("token") },
+				GitHubURL:            "file://" + lg.Dir,
+				Log:                  logrus.StandardLogger().WithField("client", "cherrypicker"),
+			}
+
+			ic := &github.IssueCommentEvent{
+				Action: github.IssueCommentActionCreated,
+				Repo: github.Repo{
+					Owner:    github.User{Login: "foo"},
+					Name:     "bar",
+					FullName: "foo/bar",
+				},
+				Issue: github.Issue{
+					Number:      2,
+					State:       "closed",
+					PullRequest: &struct{}{},
+				},
+				Comment: github.IssueComment{
+					User: github.User{Login: "wiseguy"},
+					Body: "/cherry-pick-check release-clean release-conflict\r\n/cherry-pick-check master release-missing",
+				},
+			}
+			if err := s.handleIssueComment(logrus.NewEntry(logrus.StandardLogger()), ic); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(ghc.comments) != 1 {
+				t.Fatalf("expected one comment, but got %v", ghc.comments)
+			}
+			for _, row := range []string{
+				"| `master` | cannot check: base branch (master) needs to differ from target branch (master) |  |",
+				"| `release-clean` | applies cleanly with `git am --3way` |  |",
+				tc.expectConflictRow,
+				"| `release-missing` | cannot check: cannot checkout `release-missing`",
+			} {
+				if !strings.Contains(ghc.comments[0], row) {
+					t.Errorf("expected the report to contain %q, but got %s", row, ghc.comments[0])
+				}
+			}
+			if len(ghc.prs) != 0 {
+				t.Errorf("expected no PR to be created, but got %v", ghc.prs)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package cherrypicker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/utils/exec"
+)
+
+const (
+	// Markers of the conflicting hunks left by git.
+	conflictOursMarker   = "<<<<<<<"
+	conflictBaseMarker   = "|||||||"
+	conflictSplitMarker  = "======="
+	conflictTheirsMarker = ">>>>>>>"
+
+	// conflictContextLines is the number of the lines shown around the conflicting hunks.
+	conflictContextLines = 3
+	// maxConflictHunkLines is the max number of the lines shown for a conflicting hunk.
+	maxConflictHunkLines = 40
+	// maxLastTouchedCommits is the max number of the commits shown for a conflicting hunk.
+	maxLastTouchedCommits = 5
+	// maxConflictReportLength keeps the report under the limit of the GitHub comment length.
+	maxConflictReportLength = 60000
+)
+
+// conflictHunk records a conflicting hunk in the file.
+type conflictHunk struct {
+	// startLine is the line number of the conflict marker in the conflicting file.
+	startLine int
+	// lines are the lines of the hunk with the markers and the context around.
+	lines []string
+	// ours are the lines of the target branch in the hunk.
+	ours []string
+	// commits are the commits on the target branch which last touched the lines of the hunk.
+	commits []string
+}
+
+// conflictFile records a file conflicting in the cherry-pick.
+type conflictFile struct {
+	path  string
+	hunks []conflictHunk
+}
+
+// conflictFiles returns the unmerged files in the repo directory and their conflicting hunks.
+func conflictFiles(dir string) ([]conflictFile, error) {
+	diff := exec.New().Command("git", "diff", "--name-only", "--diff-filter=U")
+	diff.SetDir(dir)
+	out, err := diff.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the conflicting files: %w", err)
+	}
+
+	var conflicts []conflictFile
+	for _, path := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if len(path) == 0 {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, path))
+		// The file deleted by one side has no hunk.
+		if os.IsNotExist(err) {
+			conflicts = append(conflicts, conflictFile{path: path})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, conflictFile{path: path, hunks: parseConflictHunks(string(content))})
+	}
+	return conflicts, nil
+}
+
+// parseConflictHunks parses the conflicting hunks between the conflict markers in the file content.
+func parseConflictHunks(content string) []conflictHunk {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+
+	var hunks []conflictHunk
+	start := -1
+	inOurs := false
+	var ours []string
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, conflictOursMarker) && start < 0:
+			start = i
+			inOurs = true
+			ours = nil
+		case start < 0:
+		case strings.HasPrefix(line, conflictBaseMarker), strings.HasPrefix(line, conflictSplitMarker):
+			inOurs = false
+		case strings.HasPrefix(line, conflictTheirsMarker):
+			from := start - conflictContextLines
+			if from < 0 {
+				from = 0
+			}
+			to := i + 1 + conflictContextLines
+			if to > len(lines) {
+				to = len(lines)
+			}
+			hunkLines := append([]string(nil), lines[from:to]...)
+			if len(hunkLines) > maxConflictHunkLines {
+				hunkLines = append(hunkLines[:maxConflictHunkLines], "...")
+			}
+			hunks = append(hunks, conflictHunk{startLine: start + 1, lines: hunkLines, ours: ours})
+			start = -1
+		case inOurs:
+			ours = append(ours, line)
+		}
+	}
+	return hunks
+}
+
+// findLastTouchedCommits finds the commits on the checked out target branch which last touched
+// the lines of the target branch in the conflicting hunks, they are the likely causes of the conflicts.
+func findLastTouchedCommits(logger *logrus.Entry, dir string, conflicts []conflictFile) {
+	ex := exec.New()
+	for i := range conflicts {
+		conflict := &conflicts[i]
+		if len(conflict.hunks) == 0 {
+			continue
+		}
+		show := ex.Command("git", "show", "HEAD:"+conflict.path)
+		show.SetDir(dir)
+		out, err := show.Output()
+		if err != nil {
+			logger.WithError(err).Debugf("Failed to show %s on the target branch.", conflict.path)
+			continue
+		}
+		headLines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+
+		from := 0
+		for j := range conflict.hunks {
+			hunk := &conflict.hunks[j]
+			// The hunk deleted by the target branch has no line to blame.
+			if len(hunk.ours) == 0 {
+				continue
+			}
+			at := findLines(headLines, hunk.ours, from)
+			if at < 0 {
+				continue
+			}
+			from = at + len(hunk.ours)
+
+			blame := ex.Command("git", "blame", "--porcelain",
+				"-L", fmt.Sprintf("%d,%d", at+1, at+len(hunk.ours)), "HEAD", "--", conflict.path)
+			blame.SetDir(dir)
+			out, err := blame.Output()
+			if err != nil {
+				logger.WithError(err).Debugf("Failed to blame %s on the target branch.", conflict.path)
+				continue
+			}
+			hunk.commits = parseBlameCommits(string(out))
+		}
+	}
+}
+
+// findLines returns the index of the first occurrence of the lines in the content from the index,
+// it returns -1 if the lines are not found.
+func findLines(content, lines []string, from int) int {
+	for i := from; i+len(lines) <= len(content); i++ {
+		matched := true
+		for j := range lines {
+			if content[i+j] != lines[j] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return i
+		}
+	}
+	return -1
+}
+
+// parseBlameCommits returns the distinct commits in the porcelain output of git blame,
+// each commit is formatted as the short SHA and the summary.
+func parseBlameCommits(out string) []string {
+	var shas []string
+	summaries := make(map[string]string)
+	current := ""
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && len(fields[0]) == 40 && strings.Trim(fields[0], "0123456789abcdef") == "" {
+			current = fields[0]
+			if _, ok := summaries[current]; !ok {
+				summaries[current] = ""
+				shas = append(shas, current)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "summary ") && len(current) != 0 {
+			summaries[current] = strings.TrimPrefix(line, "summary ")
+		}
+	}
+
+	var commits []string
+	for _, sha := range shas {
+		if len(commits) == maxLastTouchedCommits {
+			break
+		}
+		commits = append(commits, fmt.Sprintf("%s %s", sha[:7], summaries[sha]))
+	}
+	return commits
+}
+
+// mergeConflictFiles merges the conflicts of a commit into the conflicts of the earlier commits by path.
+// The conflict markers of the earlier commits are committed, so the same hunks may be parsed again
+// from the later commits, they are reported once at the line in the later commit.
+func mergeConflictFiles(conflicts, commitConflicts []conflictFile) []conflictFile {
+	for _, conflict := range commitConflicts {
+		i := 0
+		for ; i < len(conflicts); i++ {
+			if conflicts[i].path == conflict.path {
+				break
+			}
+		}
+		if i == len(conflicts) {
+			conflicts = append(conflicts, conflict)
+			continue
+		}
+
+		merged := &conflicts[i]
+		for _, hunk := range conflict.hunks {
+			j := 0
+			for ; j < len(merged.hunks); j++ {
+				if reflect.DeepEqual(merged.hunks[j].lines, hunk.lines) {
+					break
+				}
+			}
+			if j == len(merged.hunks) {
+				merged.hunks = append(merged.hunks, hunk)
+				continue
+			}
+			merged.hunks[j].startLine = hunk.startLine
+		}
+	}
+	return conflicts
+}
+
+// codeFence returns the fence of the code block for the content, which is longer than
+// the longest run of the backticks in the content, so that the code block is not closed early.
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, c := range content {
+		if c != '`' {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// conflictReport returns the report of the conflicts committed to the cherry-pick PR.
+func conflictReport(ref, targetBranch string, conflicts []conflictFile) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The cherry-pick of %s conflicts with `%s` in %d files, "+
+		"the conflict markers are committed as they are.\n", ref, targetBranch, len(conflicts))
+
+	for i, conflict := range conflicts {
+		var section strings.Builder
+		fmt.Fprintf(&section, "\n#### `%s`\n\n", conflict.path)
+		if len(conflict.hunks) == 0 {
+			section.WriteString("The file has no conflict markers, it may be deleted or binary on one side.\n")
+		}
+		for _, hunk := range conflict.hunks {
+			content := strings.Join(hunk.lines, "\n")
+			fence := codeFence(content)
+			fmt.Fprintf(&section, "Hunk at line %d:\n\n%s\n%s\n%s\n\n", hunk.startLine, fence, content, fence)
+			if len(hunk.commits) != 0 {
+				fmt.Fprintf(&section, "The commits on `%s` which last touched these lines:\n\n", targetBranch)
+				for _, commit := range hunk.commits {
+					fmt.Fprintf(&section, "- %s\n", commit)
+				}
+				section.WriteString("\n")
+			}
+		}
+
+		if b.Len()+section.Len() > maxConflictReportLength {
+			fmt.Fprintf(&b, "\nThe report of the other %d files is omitted for the length limit.\n", len(conflicts)-i)
+			break
+		}
+		b.WriteString(section.String())
+	}
+	return b.String()
+}
@@ -0,0 +1,178 @@
+package cherrypicker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+func TestParseConflictHunks(t *testing.T) {
+	content := strings.Join([]string{
+		"a", "b", "c", "d",
+		"<<<<<<< HEAD", "ours 1", "ours 2", "||||||| base", "base", "=======", "theirs", ">>>>>>> 1234567",
+		"e", "f", "g", "h",
+		"<<<<<<< HEAD", "=======", "theirs", ">>>>>>> 1234567",
+	}, "\n") + "\n"
+
+	expected := []conflictHunk{
+		{
+			startLine: 5,
+			lines: []string{"b", "c", "d", "<<<<<<< HEAD", "ours 1", "ours 2", "||||||| base", "base", "=======",
+				"theirs", ">>>>>>> 1234567", "e", "f", "g"},
+			ours: []string{"ours 1", "ours 2"},
+		},
+		{
+			startLine: 17,
+			lines:     []string{"f", "g", "h", "<<<<<<< HEAD", "=======", "theirs", ">>>>>>> 1234567"},
+		},
+	}
+	if hunks := parseConflictHunks(content); !reflect.DeepEqual(hunks, expected) {
+		t.Errorf("hunks mismatch: got %+v, want %+v", hunks, expected)
+	}
+}
+
+func TestMergeConflictFiles(t *testing.T) {
+	first := conflictHunk{startLine: 2, lines: []string{"<<<<<<< HEAD", "a", "=======", "b", ">>>>>>> 1234567"},
+		commits: []string{"1234567 first"}}
+	second := conflictHunk{startLine: 10, lines: []string{"<<<<<<< HEAD", "c", "=======", "d", ">>>>>>> 89abcde"}}
+	moved := first
+	moved.startLine = 5
+	moved.commits = nil
+
+	conflicts := mergeConflictFiles(nil, []conflictFile{{path: "a.txt", hunks: []conflictHunk{first}}})
+	conflicts = mergeConflictFiles(conflicts, []conflictFile{
+		{path: "a.txt", hunks: []conflictHunk{moved, second}},
+		{path: "b.txt"},
+	})
+
+	movedFirst := first
+	movedFirst.startLine = 5
+	expected := []conflictFile{
+		{path: "a.txt", hunks: []conflictHunk{movedFirst, second}},
+		{path: "b.txt"},
+	}
+	if !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("conflicts mismatch: got %+v, want %+v", conflicts, expected)
+	}
+}
+
+func TestCodeFence(t *testing.T) {
+	testcases := []struct {
+		content string
+		expect  string
+	}{
+		{content: "a := 1", expect: "```"},
+		{content: "`a` and ``b``", expect: "```"},
+		{content: "```go\na := 1\n```", expect: "````"},
+		{content: "`````", expect: "``````"},
+	}
+	for _, tc := range testcases {
+		if fence := codeFence(tc.content); fence != tc.expect {
+			t.Errorf("fence of %q mismatch: got %s, want %s", tc.content, fence, tc.expect)
+		}
+	}
+}
+
+func TestCherryPickConflictReport(t *testing.T) {
+	lg, c, mergeSHA, patch := makeConflictingRepo(t)
+	releaseSHA, err := lg.RevParse("foo", "bar", "release-conflict")
+	if err != nil {
+		t.Fatalf("Getting the release commit: %v", err)
+	}
+
+	ghc := &fghc{
+		pr: &github.PullRequest{
+			Base: github.PullRequestBranch{
+				Ref:  "master",
+				Repo: github.Repo{FullName: "foo/bar"},
+			},
+			Number:   2,
+			Merged:   true,
+			MergeSHA: &mergeSHA,
+			Title:    "This is a fix for X",
+		},
+		isMember: true,
+		patch:    patch,
+	}
+
+	cfg := &externalplugins.Configuration{}
+	cfg.TiCommunityCherrypicker = []externalplugins.TiCommunityCherrypicker{
+		{Repos: []string{"foo/bar"}},
+	}
+	ca := &externalplugins.ConfigAgent{}
+	ca.Set(cfg)
+
+	s := &Server{
+		BotUser:              &github.UserData{Login: "ci-robot", Email: "ci-robot@users.noreply.github.com"},
+		GitClient:            c,
+		ConfigAgent:          ca,
+		Push:                 func(_, _ string, _ bool) error { return nil },
+		GitHubClient:         ghc,
+		GitHubTokenGenerator: func() []byte { return []byte("token") },
+		GitHubURL:            "file://" + lg.Dir,
+		Log:                  logrus.StandardLogger().WithField("client", "cherrypicker"),
+		Repos:                []github.Repo{{Fork: true, FullName: "ci-robot/bar"}},
+	}
+
+	ic := &github.IssueCommentEvent{
+		Action: github.IssueCommentActionCreated,
+		Repo: github.Repo{
+			Owner:    github.User{Login: "foo"},
+			Name:     "bar",
+			FullName: "foo/bar",
+		},
+		Issue: github.Issue{
+			Number:      2,
+			State:       "closed",
+			PullRequest: &struct{}{},
+		},
+		Comment: github.IssueComment{
+			User: github.User{Login: "wiseguy"},
+			Body: "/cherry-pick release-conflict\r\n/cherry-pick release-clean",
+		},
+	}
+	if err := s.handleIssueCherryPickComment(logrus.NewEntry(logrus.StandardLogger()), ic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ghc.prs) != 2 {
+		t.Fatalf("expected two PRs to be created, but got %v", ghc.prs)
+	}
+	var reports []string
+	for _, comment := range ghc.comments {
+		if strings.Contains(comment, "conflicts with") {
+			reports = append(reports, comment)
+		}
+	}
+	if len(reports) != 1 {
+		t.Fatalf("expected one conflict report, but got %v", reports)
+	}
+	report := reports[0]
+	for _, expected := range []string{
+		"foo/bar#2 The cherry-pick of #2 conflicts with `release-conflict` in 2 files",
+		"#### `a.txt`",
+		"Hunk at line 2:",
+		"<<<<<<< HEAD\nrelease\n=======\nmaster\n>>>>>>>",
+		"#### `b.txt`",
+		"Hunk at line 10:",
+		"The commits on `release-conflict` which last touched these lines:\n\n- " + releaseSHA[:7],
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("expected the report to contain %q, but got %s", expected, report)
+		}
+	}
+	for _, pr := range ghc.prs {
+		held := false
+		for _, label := range pr.Labels {
+			held = held || label.Name == "do-not-merge/hold"
+		}
+		if held != (pr.Base.Ref == "release-conflict") {
+			t.Errorf("expected only the conflicting PR to be held, but got labels %v of %s", pr.Labels, pr.Base.Ref)
+		}
+	}
+}
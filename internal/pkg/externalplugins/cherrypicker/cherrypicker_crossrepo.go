@@ -0,0 +1,48 @@
+package cherrypicker
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// crossRepoTargetRe matches the target branch of another repo, which is of the form org/repo:branch.
+var crossRepoTargetRe = regexp.MustCompile(`^([\w.-]+)/([\w.-]+):(\S+)$`)
+
+// cherryPickTarget is the repo and the branch which the PR is cherry-picked to.
+type cherryPickTarget struct {
+	org    string
+	repo   string
+	branch string
+}
+
+// parseCrossRepoTarget parses the target of the form org/repo:branch, it returns false if the target
+// is not of the form.
+func parseCrossRepoTarget(target string) (cherryPickTarget, bool) {
+	match := crossRepoTargetRe.FindStringSubmatch(target)
+	if match == nil {
+		return cherryPickTarget{}, false
+	}
+	return cherryPickTarget{org: match[1], repo: match[2], branch: match[3]}, true
+}
+
+// resolveCherryPickTarget returns the repo and the branch of the requested target,
+// the target without a repo is the branch of the repo of the PR.
+func resolveCherryPickTarget(org, repo, target string) cherryPickTarget {
+	if t, ok := parseCrossRepoTarget(target); ok {
+		return t
+	}
+	return cherryPickTarget{org: org, repo: repo, branch: target}
+}
+
+// crossRepo returns true if the target is not in the repo org/repo.
+func (t cherryPickTarget) crossRepo(org, repo string) bool {
+	return t.org != org || t.repo != repo
+}
+
+// issueRef returns the reference to the issue or the PR org/repo#num in the repo inOrg/inRepo.
+func issueRef(org, repo string, num int, inOrg, inRepo string) string {
+	if org == inOrg && repo == inRepo {
+		return fmt.Sprintf("#%d", num)
+	}
+	return fmt.Sprintf("%s/%s#%d", org, repo, num)
+}
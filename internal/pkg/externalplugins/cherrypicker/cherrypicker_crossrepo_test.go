@@ -0,0 +1,139 @@
+package cherrypicker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/git/localgit"
+	"k8s.io/test-infra/prow/github"
+
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+func TestParseCrossRepoTarget(t *testing.T) {
+	testcases := []struct {
+		target   string
+		expected cherryPickTarget
+		ok       bool
+	}{
+		{target: "pingcap/docs-cn:release-5.0", expected: cherryPickTarget{"pingcap", "docs-cn", "release-5.0"}, ok: true},
+		{target: "pingcap/docs:feature/x", expected: cherryPickTarget{"pingcap", "docs", "feature/x"}, ok: true},
+		{target: "release-5.0"},
+		{target: "feature/x"},
+		{target: "docs:release-5.0"},
+		{target: "pingcap/docs:"},
+	}
+
+	for _, tc := range testcases {
+		target, ok := parseCrossRepoTarget(tc.target)
+		if ok != tc.ok || target != tc.expected {
+			t.Errorf("%s: got %+v %t, want %+v %t", tc.target, target, ok, tc.expected, tc.ok)
+		}
+	}
+}
+
+func TestCrossRepoCherryPick(t *testing.T) {
+	lg, c, err := localgit.NewV2()
+	if err != nil {
+		t.Fatalf("Making localgit: %v", err)
+	}
+	defer func() {
+		if err := lg.Clean(); err != nil {
+			t.Errorf("Cleaning up localgit: %v", err)
+		}
+		if err := c.Clean(); err != nil {
+			t.Errorf("Cleaning up client: %v", err)
+		}
+	}()
+	for _, repo := range []string{"bar", "docs"} {
+		if err := lg.MakeFakeRepo("foo", repo); err != nil {
+			t.Fatalf("Making fake repo: %v", err)
+		}
+		if err := lg.AddCommit("foo", repo, initialFiles); err != nil {
+			t.Fatalf("Adding initial commit: %v", err)
+		}
+	}
+	if err := lg.CheckoutNewBranch("foo", "docs", "stage"); err != nil {
+		t.Fatalf("Checking out pull branch: %v", err)
+	}
+
+	ghc := &fghc{
+		pr: &github.PullRequest{
+			Base:   github.PullRequestBranch{Ref: "master"},
+			Number: 2,
+			Merged: true,
+			Title:  "This is a fix for X",
+			Body:   body,
+			Labels: []github.Label{{Name: "type/bug"}},
+		},
+		isMember: true,
+		patch:    patch,
+	}
+	ic := &github.IssueCommentEvent{
+		Action: github.IssueCommentActionCreated,
+		Repo: github.Repo{
+			Owner:    github.User{Login: "foo"},
+			Name:     "bar",
+			FullName: "foo/bar",
+		},
+		Issue: github.Issue{Number: 2, State: "closed", PullRequest: &struct{}{}},
+		Comment: github.IssueComment{
+			User: github.User{Login: "wiseguy"},
+			Body: "/cherrypick foo/docs:stage\r\n/cherrypick foo/other:stage",
+		},
+	}
+
+	cfg := &externalplugins.Configuration{}
+	cfg.TiCommunityCherrypicker = []externalplugins.TiCommunityCherrypicker{
+		{
+			Repos:             []string{"foo/bar"},
+			LabelPrefix:       "cherrypick/",
+			PickedLabelPrefix: "type/cherrypick-for-",
+			TrackingComment:   true,
+			TargetRepos:       []string{"foo/docs"},
+		},
+	}
+	ca := &externalplugins.ConfigAgent{}
+	ca.Set(cfg)
+
+	s := &Server{
+		BotUser:              &github.UserData{Login: "ci-robot", Email: "ci-robot@users.noreply.github.com"},
+		GitClient:            c,
+		ConfigAgent:          ca,
+		Push:                 func(_, _ string, _ bool) error { return nil },
+		GitHubClient:         ghc,
+		GitHubTokenGenerator: func() []byte { return []byte("token") },
+		Log:                  logrus.StandardLogger().WithField("client", "cherrypicker"),
+	}
+
+	if err := s.handleIssueCherryPickComment(logrus.NewEntry(logrus.StandardLogger()), ic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(ghc.prs) != 1 {
+		t.Fatalf("expected one PR to be created, but got %v", ghc.prs)
+	}
+	expectedPR := fmt.Sprintf(prFormat, "This is a fix for X (foo/bar#2)",
+		"This is an automated cherry-pick of foo/bar#2\n\n"+body, "ci-robot:cherry-pick-foo-bar-2-to-stage",
+		"stage", []string{"type/bug", "type/cherrypick-for-stage"}, []string{"wiseguy"})
+	if pr := prToString(ghc.prs[0]); pr != expectedPR {
+		t.Errorf("unexpected PR:\n%s\nwant:\n%s", pr, expectedPR)
+	}
+	if repo := ghc.prs[0].Base.Repo.FullName; repo != "foo/docs" {
+		t.Errorf("expected the PR to be created in foo/docs, but got %s", repo)
+	}
+
+	comments := strings.Join(ghc.comments, "\n")
+	for _, expected := range []string{
+		"foo/bar#2 @wiseguy: cannot cherry-pick to `foo/other:stage`",
+		"- the branches of `foo/docs` of the form `foo/docs:branch`",
+		"new pull request created to branch `foo/docs:stage`: foo/docs#1.",
+		"| `foo/docs:stage` | foo/docs#1 | none | open | @wiseguy |",
+	} {
+		if !strings.Contains(comments, expected) {
+			t.Errorf("expected the comments to contain %q, but got %s", expected, comments)
+		}
+	}
+}
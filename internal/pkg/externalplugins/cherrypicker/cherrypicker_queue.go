@@ -0,0 +1,407 @@
+package cherrypicker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+// Possible states of the cherry-pick job.
+const (
+	JobStateQueued    = "queued"
+	JobStateRunning   = "running"
+	JobStateSucceeded = "succeeded"
+	JobStateFailed    = "failed"
+)
+
+const (
+	// maxJobAttempts is the max number of the attempts of a job failed by the transient errors.
+	maxJobAttempts = 5
+	// jobRetryBackoff is the delay before the first retry, which is doubled for each subsequent retry.
+	jobRetryBackoff = time.Minute
+	// finishedJobRetention is how long the finished jobs are kept for the status report.
+	finishedJobRetention = 7 * 24 * time.Hour
+)
+
+var timeNow = time.Now
+
+// transientError marks the error caused by the git or GitHub failures which may succeed after retrying.
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e *transientError) Unwrap() error {
+	return e.err
+}
+
+// transient marks the error as transient.
+func transient(err error) error {
+	return &transientError{err: err}
+}
+
+// isTransient returns true if the error is transient.
+func isTransient(err error) bool {
+	var te *transientError
+	return errors.As(err, &te)
+}
+
+// Job is a request to cherry-pick a PR to the target branch.
+type Job struct {
+	Org          string `json:"org"`
+	Repo         string `json:"repo"`
+	Number       int    `json:"number"`
+	TargetBranch string `json:"target_branch"`
+	Requestor    string `json:"requestor"`
+	// Comment is the comment requesting the cherry-pick, it is nil for the label-initiated cherry-pick.
+	Comment *github.IssueComment `json:"comment,omitempty"`
+
+	State     string `json:"state"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+	// NextAttempt is the earliest time to run the queued job.
+	NextAttempt time.Time `json:"next_attempt"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// key identifies the cherry-pick request of the job.
+func (j *Job) key() string {
+	return fmt.Sprintf("%s/%s#%d:%s", j.Org, j.Repo, j.Number, j.TargetBranch)
+}
+
+// finished returns true if the job will not be run anymore.
+func (j *Job) finished() bool {
+	return j.State == JobStateSucceeded || j.State == JobStateFailed
+}
+
+// FileJobQueue is a durable cherry-pick job queue that saves the jobs in a JSON file,
+// so that the jobs survive the restarts.
+type FileJobQueue struct {
+	path string
+	lock sync.Mutex
+	jobs map[string]*Job
+}
+
+// NewFileJobQueue returns a job queue which saves the jobs in the file and restores the jobs from it.
+// The jobs interrupted by the restart are queued again.
+func NewFileJobQueue(path string) (*FileJobQueue, error) {
+	q := &FileJobQueue{path: path, jobs: make(map[string]*Job)}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("broken job queue file %s: %w", path, err)
+	}
+	for _, job := range jobs {
+		if job.State == JobStateRunning {
+			job.State = JobStateQueued
+		}
+		q.jobs[job.key()] = job
+	}
+	return q, nil
+}
+
+// Enqueue adds the job to the queue, it returns false if the same cherry-pick is already queued or running.
+func (q *FileJobQueue) Enqueue(job *Job) (bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	key := job.key()
+	if existing, ok := q.jobs[key]; ok && !existing.finished() {
+		return false, nil
+	}
+	now := timeNow()
+	job.State = JobStateQueued
+	job.Attempts = 0
+	job.LastError = ""
+	job.NextAttempt = now
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	q.jobs[key] = job
+	return true, q.save()
+}
+
+// claim marks the earliest due job as running and returns it, it returns nil if there is no due job.
+func (q *FileJobQueue) claim() (*Job, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := timeNow()
+	var due *Job
+	for _, job := range q.jobs {
+		if job.State != JobStateQueued || job.NextAttempt.After(now) {
+			continue
+		}
+		if due == nil || job.NextAttempt.Before(due.NextAttempt) ||
+			(job.NextAttempt.Equal(due.NextAttempt) && job.key() < due.key()) {
+			due = job
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+	due.State = JobStateRunning
+	due.Attempts++
+	due.UpdatedAt = now
+	claimed := *due
+	return &claimed, q.save()
+}
+
+// finish records the result of the job. The job failed by the transient error is queued again with backoff
+// until it reaches the max attempts, it returns true if the job is finished.
+func (q *FileJobQueue) finish(job *Job, err error) (bool, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := timeNow()
+	current, ok := q.jobs[job.key()]
+	if !ok {
+		current = job
+		q.jobs[job.key()] = current
+	}
+	current.UpdatedAt = now
+	switch {
+	case err == nil:
+		current.State = JobStateSucceeded
+		current.LastError = ""
+	case isTransient(err) && current.Attempts < maxJobAttempts:
+		current.State = JobStateQueued
+		current.LastError = err.Error()
+		current.NextAttempt = now.Add(jobRetryBackoff << (current.Attempts - 1))
+	default:
+		current.State = JobStateFailed
+		current.LastError = err.Error()
+	}
+	return current.finished(), q.save()
+}
+
+// JobsFor returns the jobs of the PR in the order of the target branches.
+func (q *FileJobQueue) JobsFor(org, repo string, number int) []Job {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var jobs []Job
+	for _, job := range q.jobs {
+		if job.Org == org && job.Repo == repo && job.Number == number {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].TargetBranch < jobs[j].TargetBranch
+	})
+	return jobs
+}
+
+// save writes all the jobs to the file, the finished jobs out of the retention are dropped.
+// The file is replaced atomically, so that it is not broken by the restart during writing.
+func (q *FileJobQueue) save() error {
+	now := timeNow()
+	jobs := make([]*Job, 0, len(q.jobs))
+	for key, job := range q.jobs {
+		if job.finished() && now.Sub(job.UpdatedAt) > finishedJobRetention {
+			delete(q.jobs, key)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].key() < jobs[j].key()
+	})
+
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path)
+}
+
+// pick cherry-picks the PR to the target branch, or enqueues the cherry-pick job if the job queue is enabled.
+func (s *Server) pick(log *logrus.Entry, requestor string, comment *github.IssueComment,
+	org, repo, targetBranch string, pr *github.PullRequest) error {
+	if s.Queue == nil {
+		return s.handle(log, requestor, comment, org, repo, targetBranch, pr)
+	}
+
+	enqueued, err := s.Queue.Enqueue(&Job{
+		Org:          org,
+		Repo:         repo,
+		Number:       pr.Number,
+		TargetBranch: targetBranch,
+		Requestor:    requestor,
+		Comment:      comment,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enqueue the cherry-pick job: %w", err)
+	}
+	if !enqueued {
+		log.Info("The cherry-pick job is already queued or running.")
+		return nil
+	}
+	log.Info("Enqueued the cherry-pick job.")
+	s.signalJobs()
+	return nil
+}
+
+// jobSignals returns the channel which wakes up the job worker, it is buffered by one,
+// so that the signals sent while the worker is busy are merged.
+func (s *Server) jobSignals() chan struct{} {
+	s.jobSignalOnce.Do(func() {
+		s.jobSignal = make(chan struct{}, 1)
+	})
+	return s.jobSignal
+}
+
+// signalJobs wakes up the job worker without waiting for the jobs to run.
+func (s *Server) signalJobs() {
+	select {
+	case s.jobSignals() <- struct{}{}:
+	default:
+	}
+}
+
+// RunJobWorker runs the due cherry-pick jobs one by one until the context is done, the jobs are checked
+// when a job is enqueued and in the period for the retried and restored jobs.
+func (s *Server) RunJobWorker(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		s.ProcessJobs()
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.jobSignals():
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessJobs runs the due cherry-pick jobs in the queue until there is no due job,
+// it should only be called by the job worker so that the jobs are not run concurrently.
+func (s *Server) ProcessJobs() {
+	if s.Queue == nil {
+		return
+	}
+	for {
+		job, err := s.Queue.claim()
+		if err != nil {
+			s.Log.WithError(err).Error("Failed to claim the cherry-pick job.")
+			return
+		}
+		if job == nil {
+			return
+		}
+		s.runJob(job)
+	}
+}
+
+// runJob runs the cherry-pick job and records the result.
+func (s *Server) runJob(job *Job) {
+	l := s.Log.WithFields(logrus.Fields{
+		github.OrgLogField:  job.Org,
+		github.RepoLogField: job.Repo,
+		github.PrLogField:   job.Number,
+		"requestor":         job.Requestor,
+		"target_branch":     job.TargetBranch,
+		"attempts":          job.Attempts,
+	})
+	l.Info("Running the cherry-pick job.")
+
+	err := func() error {
+		pr, err := s.GitHubClient.GetPullRequest(job.Org, job.Repo, job.Number)
+		if err != nil {
+			return transient(fmt.Errorf("failed to get pull request %s/%s#%d: %w", job.Org, job.Repo, job.Number, err))
+		}
+		return s.handle(l, job.Requestor, job.Comment, job.Org, job.Repo, job.TargetBranch, pr)
+	}()
+	if err != nil {
+		l.WithError(err).Warn("The cherry-pick job failed.")
+	}
+
+	finished, saveErr := s.Queue.finish(job, err)
+	if saveErr != nil {
+		l.WithError(saveErr).Error("Failed to save the result of the cherry-pick job.")
+	}
+	if finished && isTransient(err) {
+		resp := fmt.Sprintf("failed to cherry-pick #%d to `%s` after %d attempts: %v",
+			job.Number, job.TargetBranch, job.Attempts, err)
+		if err := s.createComment(l, job.Org, job.Repo, job.Number, job.Comment, resp); err != nil {
+			l.WithError(err).Warn("Failed to notify the failure of the cherry-pick job.")
+		}
+	}
+}
+
+// reportJobStatus replies with the status of the cherry-pick jobs of the PR.
+func (s *Server) reportJobStatus(ic *github.IssueCommentEvent) error {
+	org := ic.Repo.Owner.Login
+	repo := ic.Repo.Name
+	num := ic.Issue.Number
+
+	if s.Queue == nil {
+		resp := "the cherry-pick job queue is not enabled, the cherry-picks are done immediately."
+		return s.GitHubClient.CreateComment(org, repo, num, tiexternalplugins.FormatICResponse(ic.Comment, resp))
+	}
+
+	jobs := s.Queue.JobsFor(org, repo, num)
+	outstanding := 0
+	for i := range jobs {
+		if !jobs[i].finished() {
+			outstanding++
+		}
+	}
+	if len(jobs) == 0 {
+		resp := "there is no cherry-pick job of this PR."
+		return s.GitHubClient.CreateComment(org, repo, num, tiexternalplugins.FormatICResponse(ic.Comment, resp))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "the cherry-pick jobs of this PR, %d of them are outstanding:\n\n", outstanding)
+	b.WriteString("| Target Branch | State | Attempts | Requestor | Last Error |\n")
+	b.WriteString("| --- | --- | --- | --- | --- |\n")
+	for i := range jobs {
+		job := &jobs[i]
+		state := job.State
+		if job.State == JobStateQueued && job.Attempts != 0 {
+			state = fmt.Sprintf("%s (retry after %s)", state, job.NextAttempt.UTC().Format(time.RFC3339))
+		}
+		lastError := strings.ReplaceAll(job.LastError, "\n", " ")
+		lastError = strings.ReplaceAll(lastError, "|", "\\|")
+		fmt.Fprintf(&b, "| `%s` | %s | %d | %s | %s |\n",
+			job.TargetBranch, state, job.Attempts, job.Requestor, lastError)
+	}
+	return s.GitHubClient.CreateComment(org, repo, num, tiexternalplugins.FormatICResponse(ic.Comment, b.String()))
+}
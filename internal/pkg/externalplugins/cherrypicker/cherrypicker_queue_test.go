@@ -0,0 +1,299 @@
+package cherrypicker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/git/localgit"
+	"k8s.io/test-infra/prow/github"
+
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+func TestFileJobQueue(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q, err := NewFileJobQueue(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	job := &Job{Org: "org", Repo: "repo", Number: 1, TargetBranch: "release-5.0", Requestor: "user"}
+	if enqueued, err := q.Enqueue(job); err != nil || !enqueued {
+		t.Fatalf("expected the job to be enqueued, got %v, %v", enqueued, err)
+	}
+	duplicated := &Job{Org: "org", Repo: "repo", Number: 1, TargetBranch: "release-5.0", Requestor: "other"}
+	if enqueued, err := q.Enqueue(duplicated); err != nil || enqueued {
+		t.Fatalf("expected the duplicated job not to be enqueued, got %v, %v", enqueued, err)
+	}
+
+	// The running job is queued again after the restart.
+	claimed, err := q.claim()
+	if err != nil || claimed == nil || claimed.State != JobStateRunning || claimed.Attempts != 1 {
+		t.Fatalf("expected the job to be claimed, got %+v, %v", claimed, err)
+	}
+	if claimed, err := q.claim(); err != nil || claimed != nil {
+		t.Fatalf("expected no due job, got %+v, %v", claimed, err)
+	}
+	q, err = NewFileJobQueue(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jobs := q.JobsFor("org", "repo", 1)
+	if len(jobs) != 1 || jobs[0].State != JobStateQueued || jobs[0].Requestor != "user" {
+		t.Fatalf("expected the job to be restored as queued, got %+v", jobs)
+	}
+
+	// The job failed by the transient errors is retried with backoff until the max attempts,
+	// the attempt interrupted by the restart is counted.
+	transientErr := transient(errors.New("connection reset"))
+	for attempts := 2; attempts <= maxJobAttempts; attempts++ {
+		claimed, err := q.claim()
+		if err != nil || claimed == nil {
+			t.Fatalf("expected the job to be due at the attempt %d, got %+v, %v", attempts, claimed, err)
+		}
+		if claimed.Attempts != attempts {
+			t.Errorf("attempts mismatch: got %d, want %d", claimed.Attempts, attempts)
+		}
+		finished, err := q.finish(claimed, transientErr)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if finished != (attempts == maxJobAttempts) {
+			t.Errorf("finished mismatch at the attempt %d: got %v", attempts, finished)
+		}
+		if finished {
+			break
+		}
+
+		backoff := jobRetryBackoff << (attempts - 1)
+		now = now.Add(backoff - time.Second)
+		if claimed, err := q.claim(); err != nil || claimed != nil {
+			t.Fatalf("expected no due job before the backoff, got %+v, %v", claimed, err)
+		}
+		now = now.Add(time.Second)
+	}
+	jobs = q.JobsFor("org", "repo", 1)
+	if len(jobs) != 1 || jobs[0].State != JobStateFailed || jobs[0].LastError != "connection reset" {
+		t.Fatalf("expected the job to fail, got %+v", jobs)
+	}
+
+	// The job failed by other errors is not retried.
+	other := &Job{Org: "org", Repo: "repo", Number: 1, TargetBranch: "release-4.0", Requestor: "user"}
+	if _, err := q.Enqueue(other); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claimed, err = q.claim()
+	if err != nil || claimed == nil {
+		t.Fatalf("expected the job to be claimed, got %+v, %v", claimed, err)
+	}
+	if finished, err := q.finish(claimed, errors.New("failed to configure git user")); err != nil || !finished {
+		t.Fatalf("expected the job to be finished, got %v, %v", finished, err)
+	}
+
+	// The finished jobs can be requested again, and are dropped after the retention.
+	if enqueued, err := q.Enqueue(duplicated); err != nil || !enqueued {
+		t.Fatalf("expected the failed job to be enqueued again, got %v, %v", enqueued, err)
+	}
+	now = now.Add(finishedJobRetention + time.Second)
+	if err := q.save(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	q, err = NewFileJobQueue(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	jobs = q.JobsFor("org", "repo", 1)
+	if len(jobs) != 1 || jobs[0].TargetBranch != "release-5.0" || jobs[0].Requestor != "other" {
+		t.Errorf("expected only the queued job to be kept, got %+v", jobs)
+	}
+
+	if err := os.WriteFile(path, []byte("broken"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := NewFileJobQueue(path); err == nil {
+		t.Error("expected error for the broken job queue file")
+	}
+}
+
+// flakyFGHC fails to get the pull request at the specified calls.
+type flakyFGHC struct {
+	*fghc
+	calls       int
+	failedCalls sets.Int
+}
+
+func (f *flakyFGHC) GetPullRequest(org, repo string, number int) (*github.PullRequest, error) {
+	f.calls++
+	if f.failedCalls.Has(f.calls) {
+		return nil, errors.New("502 bad gateway")
+	}
+	return f.fghc.GetPullRequest(org, repo, number)
+}
+
+func TestCherryPickWithQueue(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	lg, c, err := localgit.NewV2()
+	if err != nil {
+		t.Fatalf("Making localgit: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := lg.Clean(); err != nil {
+			t.Errorf("Cleaning up localgit: %v", err)
+		}
+		if err := c.Clean(); err != nil {
+			t.Errorf("Cleaning up client: %v", err)
+		}
+	})
+	if err := lg.MakeFakeRepo("foo", "bar"); err != nil {
+		t.Fatalf("Making fake repo: %v", err)
+	}
+	if err := lg.AddCommit("foo", "bar", initialFiles); err != nil {
+		t.Fatalf("Adding initial commit: %v", err)
+	}
+	if err := lg.CheckoutNewBranch("foo", "bar", "stage"); err != nil {
+		t.Fatalf("Checking out pull branch: %v", err)
+	}
+
+	ghc := &fghc{
+		pr: &github.PullRequest{
+			Base:   github.PullRequestBranch{Ref: "master"},
+			Number: 2,
+			Merged: true,
+			Title:  "This is a fix for X",
+			Body:   body,
+		},
+		isMember: true,
+		patch:    patch,
+	}
+	// The PR is got when the cherry-pick is requested and when the job runs.
+	flaky := &flakyFGHC{fghc: ghc, failedCalls: sets.NewInt(2)}
+
+	cfg := &externalplugins.Configuration{}
+	cfg.TiCommunityCherrypicker = []externalplugins.TiCommunityCherrypicker{
+		{
+			Repos:             []string{"foo/bar"},
+			LabelPrefix:       "cherrypick/",
+			PickedLabelPrefix: "type/cherrypick-for-",
+		},
+	}
+	ca := &externalplugins.ConfigAgent{}
+	ca.Set(cfg)
+
+	queue, err := NewFileJobQueue(filepath.Join(t.TempDir(), "jobs.json"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := &Server{
+		BotUser:              &github.UserData{Login: "ci-robot", Email: "ci-robot@users.noreply.github.com"},
+		GitClient:            c,
+		ConfigAgent:          ca,
+		Push:                 func(_, _ string, _ bool) error { return nil },
+		GitHubClient:         flaky,
+		GitHubTokenGenerator: func() []byte { return []byte("token") },
+		Log:                  logrus.StandardLogger().WithField("client", "cherrypicker"),
+		Repos:                []github.Repo{{Fork: true, FullName: "ci-robot/bar"}},
+		Queue:                queue,
+	}
+
+	newComment := func(body string) *github.IssueCommentEvent {
+		return &github.IssueCommentEvent{
+			Action: github.IssueCommentActionCreated,
+			Repo: github.Repo{
+				Owner:    github.User{Login: "foo"},
+				Name:     "bar",
+				FullName: "foo/bar",
+			},
+			Issue: github.Issue{
+				Number:      2,
+				State:       "closed",
+				PullRequest: &struct{}{},
+			},
+			Comment: github.IssueComment{
+				User: github.User{Login: "wiseguy"},
+				Body: body,
+			},
+		}
+	}
+
+	// The job is run by the job worker instead of the webhook handler.
+	l := logrus.NewEntry(logrus.StandardLogger())
+	if err := s.handleIssueComment(l, newComment("/cherry-pick stage")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-s.jobSignals():
+	default:
+		t.Fatal("expected the job worker to be signaled")
+	}
+	jobs := queue.JobsFor("foo", "bar", 2)
+	if len(jobs) != 1 || jobs[0].State != JobStateQueued || jobs[0].Attempts != 0 {
+		t.Fatalf("expected the job to be queued, got %+v", jobs)
+	}
+
+	// The first attempt fails to get the PR, and the job is retried later.
+	s.ProcessJobs()
+	if len(ghc.prs) != 0 {
+		t.Fatalf("expected no PR before the retry, got %v", ghc.prs)
+	}
+	jobs = queue.JobsFor("foo", "bar", 2)
+	if len(jobs) != 1 || jobs[0].State != JobStateQueued || jobs[0].Attempts != 1 {
+		t.Fatalf("expected the job to be queued for the retry, got %+v", jobs)
+	}
+
+	if err := s.handleIssueComment(l, newComment("/cherry-pick-status")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ghc.comments) != 1 || !strings.Contains(ghc.comments[0], "1 of them are outstanding") ||
+		!strings.Contains(ghc.comments[0], "| `stage` | queued (retry after 2021-06-01T00:01:00Z) | 1 | wiseguy |") {
+		t.Fatalf("unexpected status report: %v", ghc.comments)
+	}
+
+	now = now.Add(jobRetryBackoff)
+	s.ProcessJobs()
+	if len(ghc.prs) != 1 || ghc.prs[0].Base.Ref != "stage" {
+		t.Fatalf("expected the cherry-pick PR to be created by the retry, got %v", ghc.prs)
+	}
+	jobs = queue.JobsFor("foo", "bar", 2)
+	if len(jobs) != 1 || jobs[0].State != JobStateSucceeded || jobs[0].Attempts != 2 {
+		t.Errorf("expected the job to succeed, got %+v", jobs)
+	}
+}
+
+func TestReportJobStatusWithoutQueue(t *testing.T) {
+	ghc := &fghc{}
+	s := &Server{
+		GitHubClient: ghc,
+		Log:          logrus.StandardLogger().WithField("client", "cherrypicker"),
+	}
+	ic := &github.IssueCommentEvent{
+		Action: github.IssueCommentActionCreated,
+		Repo: github.Repo{
+			Owner: github.User{Login: "foo"},
+			Name:  "bar",
+		},
+		Issue: github.Issue{Number: 2, PullRequest: &struct{}{}},
+		Comment: github.IssueComment{
+			User: github.User{Login: "wiseguy"},
+			Body: "/cherry-pick-status",
+		},
+	}
+	if err := s.handleIssueComment(logrus.NewEntry(logrus.StandardLogger()), ic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ghc.comments) != 1 || !strings.Contains(ghc.comments[0], "the cherry-pick job queue is not enabled") {
+		t.Errorf("unexpected status report: %v", ghc.comments)
+	}
+}
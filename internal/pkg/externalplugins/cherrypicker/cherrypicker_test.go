@@ -101,12 +101,14 @@ type fghc struct {
 	comments        []string
 	prs             []github.PullRequest
 	prComments      []github.IssueComment
+	prCommits       []github.RepositoryCommit
 	prLabels        []github.Label
 	orgMembers      []github.TeamMember
 	repoInvitations []*gc.RepositoryInvitation
 	issues          []github.Issue
 	commits         map[string]github.RepositoryCommit
 	collaborators   []string
+	files           map[string][]byte
 }
 
 func (f *fghc) GetSingleCommit(_, _, sha string) (github.RepositoryCommit, error) {
@@ -115,6 +117,16 @@ func (f *fghc) GetSingleCommit(_, _, sha string) (github.RepositoryCommit, error
 	return f.commits[sha], nil
 }
 
+func (f *fghc) GetFile(_, _, filepath, _ string) ([]byte, error) {
+	f.Lock()
+	defer f.Unlock()
+	content, ok := f.files[filepath]
+	if !ok {
+		return nil, &github.FileNotFound{}
+	}
+	return content, nil
+}
+
 func (f *fghc) AddLabels(_, _ string, number int, labels ...string) error {
 	f.Lock()
 	defer f.Unlock()
@@ -172,6 +184,18 @@ func (f *fghc) CreateComment(org, repo string, number int, comment string) error
 	return nil
 }
 
+func (f *fghc) EditComment(_, _ string, id int, comment string) error {
+	f.Lock()
+	defer f.Unlock()
+	for i := range f.prComments {
+		if f.prComments[i].ID == id {
+			f.prComments[i].Body = comment
+			return nil
+		}
+	}
+	return fmt.Errorf("comment %d not found", id)
+}
+
 func (f *fghc) GetRepo(_, _ string) (github.FullRepo, error) {
 	f.Lock()
 	defer f.Unlock()
@@ -262,7 +286,7 @@ func (f *fghc) CreateIssue(_, _, title, body string, _ int, labels, assignees []
 	return num, nil
 }
 
-func (f *fghc) CreatePullRequest(_, _, title, body, head, base string, _ bool) (int, error) {
+func (f *fghc) CreatePullRequest(org, repo, title, body, head, base string, _ bool) (int, error) {
 	f.Lock()
 	defer f.Unlock()
 	num := len(f.prs) + 1
@@ -271,11 +295,20 @@ func (f *fghc) CreatePullRequest(_, _, title, body, head, base string, _ bool) (
 		Body:   body,
 		Number: num,
 		Head:   github.PullRequestBranch{Ref: head},
-		Base:   github.PullRequestBranch{Ref: base},
+		Base: github.PullRequestBranch{
+			Ref:  base,
+			Repo: github.Repo{Owner: github.User{Login: org}, Name: repo, FullName: org + "/" + repo},
+		},
 	})
 	return num, nil
 }
 
+func (f *fghc) ListPRCommits(_, _ string, _ int) ([]github.RepositoryCommit, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.prCommits, nil
+}
+
 func (f *fghc) ListIssueComments(_, _ string, _ int) ([]github.IssueComment, error) {
 	f.Lock()
 	defer f.Unlock()
@@ -526,10 +559,12 @@ func testCherryPickPRWithLabels(clients localgit.Clients, t *testing.T) {
 	}
 
 	testCases := []struct {
-		name        string
-		labelPrefix string
-		prLabels    []github.Label
-		prComments  []github.IssueComment
+		name           string
+		labelPrefix    string
+		prLabels       []github.Label
+		prComments     []github.IssueComment
+		mergeConfig    []externalplugins.TiCommunityMerge
+		excludedLabels []string
 	}{
 		{
 			name:        "Default label prefix",
@@ -555,6 +590,40 @@ func testCherryPickPRWithLabels(clients localgit.Clients, t *testing.T) {
 				},
 			},
 		},
+		{
+			name:        "Release approval required on the target branches",
+			labelPrefix: externalplugins.DefaultCherryPickLabelPrefix,
+			prLabels: []github.Label{
+				{
+					Name: "cherrypick/release-1.5",
+				},
+				{
+					Name: "cherrypick/release-1.6",
+				},
+				{
+					Name: "type/bugfix",
+				},
+				{
+					Name: externalplugins.CanMergeLabel,
+				},
+				{
+					Name: externalplugins.ReleaseApprovedLabel,
+				},
+			},
+			mergeConfig: []externalplugins.TiCommunityMerge{
+				{
+					Repos: []string{"foo/bar"},
+					ReleaseApprovalRules: []externalplugins.ReleaseApprovalRule{
+						{
+							Branches:        []string{`^release-`},
+							ReleaseManagers: []string{"release-manager"},
+							ApprovedLabel:   externalplugins.ReleaseApprovedLabel,
+						},
+					},
+				},
+			},
+			excludedLabels: []string{externalplugins.CanMergeLabel, externalplugins.ReleaseApprovedLabel},
+		},
 	}
 
 	for _, test := range testCases {
@@ -593,6 +662,7 @@ func testCherryPickPRWithLabels(clients localgit.Clients, t *testing.T) {
 					PickedLabelPrefix: "type/cherrypick-for-",
 				},
 			}
+			cfg.TiCommunityMerge = tc.mergeConfig
 			ca := &externalplugins.ConfigAgent{}
 			ca.Set(cfg)
 
@@ -608,7 +678,9 @@ func testCherryPickPRWithLabels(clients localgit.Clients, t *testing.T) {
 				Repos:                  []github.Repo{{Fork: true, FullName: "ci-robot/bar"}},
 			}
 
-			if err := s.handlePullRequest(logrus.NewEntry(logrus.StandardLogger()), &pr); err != nil {
+			event := pr
+			event.PullRequest.Labels = tc.prLabels
+			if err := s.handlePullRequest(logrus.NewEntry(logrus.StandardLogger()), &event); err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
 
@@ -617,8 +689,9 @@ func testCherryPickPRWithLabels(clients localgit.Clients, t *testing.T) {
 				expectedBody := "This is an automated cherry-pick of #2"
 				expectedHead := fmt.Sprintf(botUser.Login+":"+cherryPickBranchFmt, 2, branch)
 				var expectedLabels []string
-				for _, label := range pr.PullRequest.Labels {
-					if !strings.HasPrefix(label.Name, tc.labelPrefix) {
+				excludedLabels := sets.NewString(tc.excludedLabels...)
+				for _, label := range event.PullRequest.Labels {
+					if !strings.HasPrefix(label.Name, tc.labelPrefix) && !excludedLabels.Has(label.Name) {
 						expectedLabels = append(expectedLabels, label.Name)
 					}
 				}
@@ -1346,7 +1419,7 @@ func TestCreateCherryPickCommitMessage(t *testing.T) {
 		sha := "sha"
 
 		actualCommitMessage := createCherryPickCommitMessage(
-			fc, log, tc.copyIssueNumbers, "org", "repo", 1, &sha,
+			fc, log, tc.copyIssueNumbers, "org", "repo", "#1", &sha,
 		)
 
 		if tc.expectCommitMessage != actualCommitMessage {
@@ -1674,7 +1747,40 @@ func TestHelpProvider(t *testing.T) {
 				"For this repository, cherry-pick is available to all.",
 				"When a cherry-pick PR conflicts, an issue will be created to track it."},
 			configInfoExcludes: []string{"For this repository, only organization members are allowed to do cherry-pick.",
-				"When a cherry-pick PR conflicts, cherrypicker will create the PR with conflicts."},
+				"When a cherry-pick PR conflicts, cherrypicker will create the PR with conflicts.",
+				"The PRs can only be cherry-picked to: "},
+		},
+		{
+			name: "Target branches restricted",
+			config: &externalplugins.Configuration{
+				TiCommunityCherrypicker: []externalplugins.TiCommunityCherrypicker{
+					{
+						Repos:              []string{"org2/repo"},
+						TargetBranches:     []string{"^feature/"},
+						MaintainedVersions: []string{"5.0"},
+					},
+				},
+			},
+			enabledRepos: enabledRepos,
+			configInfoIncludes: []string{
+				"The PRs can only be cherry-picked to: release-5.0, branches matching ^feature/.",
+			},
+		},
+		{
+			name: "Target repos allowed",
+			config: &externalplugins.Configuration{
+				TiCommunityCherrypicker: []externalplugins.TiCommunityCherrypicker{
+					{
+						Repos:       []string{"org2/repo"},
+						TargetRepos: []string{"org2/docs", "org3/repo"},
+					},
+				},
+			},
+			enabledRepos: enabledRepos,
+			configInfoIncludes: []string{
+				"The PRs can also be cherry-picked to the branches of: org2/docs, org3/repo.",
+			},
+			configInfoExcludes: []string{"The PRs can only be cherry-picked to: "},
 		},
 	}
 	for _, testcase := range cases {
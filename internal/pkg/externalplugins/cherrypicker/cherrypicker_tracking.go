@@ -0,0 +1,333 @@
+package cherrypicker
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+)
+
+const (
+	// TrackerName defines the name used in the title for the cherry-pick tracking comment.
+	TrackerName = "Cherry-Pick Tracker"
+	// TrackerIdentifier defines the identifier for the cherry-pick tracking comment.
+	TrackerIdentifier = "Cherry-Pick Tracker Identifier"
+)
+
+// Possible states of the cherry-pick PR.
+const (
+	trackingStateOpen   = "open"
+	trackingStateMerged = "merged"
+	trackingStateClosed = "closed"
+)
+
+// Possible conflict states of the cherry-pick PR.
+const (
+	conflictStateNone        = "none"
+	conflictStateConflicting = "conflicting"
+	conflictStateResolved    = "resolved"
+)
+
+var (
+	// trackingEntryRe is the regex that matches the entries of the tracking comment.
+	trackingEntryRe = regexp.MustCompile(
+		"<!--" + TrackerIdentifier + ` branch=(\S+) pr=(\d+) conflict=(\w+) state=(\w+) requestor=(\S+)(?: files=(\S+))?-->`)
+	// cherryPickBranchRe matches the head branch of the cherry-pick PRs.
+	cherryPickBranchRe = regexp.MustCompile(`^cherry-pick-(\d+)-to-(.+)$`)
+	// crossRepoCherryPickBranchRe matches the head branch of the cherry-pick PRs in other repos
+	// without the target branch suffix.
+	crossRepoCherryPickBranchRe = regexp.MustCompile(`^cherry-pick-([\w.-]+)-(\d+)$`)
+)
+
+// trackingEntry records the cherry-pick PR of a target branch.
+type trackingEntry struct {
+	branch    string
+	number    int
+	conflict  string
+	state     string
+	requestor string
+	// files are the conflicting files of the cherry-pick PR when it is created.
+	files []string
+}
+
+// ref returns the reference to the cherry-pick PR in the repo of the original PR.
+func (e *trackingEntry) ref() string {
+	if target, ok := parseCrossRepoTarget(e.branch); ok {
+		return fmt.Sprintf("%s/%s#%d", target.org, target.repo, e.number)
+	}
+	return fmt.Sprintf("#%d", e.number)
+}
+
+// trackingMessage returns the body of the tracking comment.
+func trackingMessage(entries []trackingEntry) string {
+	var b strings.Builder
+	b.WriteString("[" + strings.ToUpper(TrackerName) + "]\n\n")
+	b.WriteString("The cherry-picks of this pull request:\n\n")
+	b.WriteString("| Target Branch | Cherry-Pick PR | Conflicts | State | Requestor |\n")
+	b.WriteString("| ------------- | -------------- | --------- | ----- | --------- |\n")
+	for i := range entries {
+		e := &entries[i]
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s | @%s |\n", e.branch, e.ref(), e.conflict, e.state, e.requestor)
+	}
+	b.WriteString("\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "\n<!--%s branch=%s pr=%d conflict=%s state=%s requestor=%s",
+			TrackerIdentifier, e.branch, e.number, e.conflict, e.state, e.requestor)
+		if len(e.files) != 0 {
+			// Escape the paths so that they contain neither the spaces nor the separators.
+			files := make([]string, 0, len(e.files))
+			for _, file := range e.files {
+				files = append(files, url.QueryEscape(file))
+			}
+			fmt.Fprintf(&b, " files=%s", strings.Join(files, ","))
+		}
+		b.WriteString("-->")
+	}
+	return b.String()
+}
+
+// parseTrackingEntries parses the entries from the tracking comment.
+func parseTrackingEntries(body string) []trackingEntry {
+	var entries []trackingEntry
+	for _, match := range trackingEntryRe.FindAllStringSubmatch(body, -1) {
+		number, err := strconv.Atoi(match[2])
+		if err != nil {
+			continue
+		}
+		var files []string
+		if len(match[6]) != 0 {
+			for _, file := range strings.Split(match[6], ",") {
+				if unescaped, err := url.QueryUnescape(file); err == nil {
+					files = append(files, unescaped)
+				}
+			}
+		}
+		entries = append(entries, trackingEntry{
+			branch:    match[1],
+			number:    number,
+			conflict:  match[3],
+			state:     match[4],
+			requestor: match[5],
+			files:     files,
+		})
+	}
+	return entries
+}
+
+// updateTracking updates the entries of the tracking comment on the PR, the comment is created if it does not exist.
+func (s *Server) updateTracking(org, repo string, num int,
+	update func(entries []trackingEntry) []trackingEntry) error {
+	s.trackLock.Lock()
+	defer s.trackLock.Unlock()
+
+	comments, err := s.GitHubClient.ListIssueComments(org, repo, num)
+	if err != nil {
+		return fmt.Errorf("failed to list comments: %w", err)
+	}
+	var tracking *github.IssueComment
+	for i := range comments {
+		comment := comments[i]
+		if comment.User.Login == s.BotUser.Login && strings.Contains(comment.Body, TrackerIdentifier) {
+			tracking = &comment
+		}
+	}
+
+	var entries []trackingEntry
+	if tracking != nil {
+		entries = parseTrackingEntries(tracking.Body)
+	}
+	entries = update(entries)
+	if len(entries) == 0 {
+		return nil
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].branch < entries[j].branch
+	})
+
+	msg := trackingMessage(entries)
+	if tracking == nil {
+		return s.GitHubClient.CreateComment(org, repo, num, msg)
+	}
+	if tracking.Body == msg {
+		return nil
+	}
+	return s.GitHubClient.EditComment(org, repo, tracking.ID, msg)
+}
+
+// trackCherryPick records the created cherry-pick PR in the tracking comment on the original PR.
+func (s *Server) trackCherryPick(log *logrus.Entry, org, repo string, num int, entry trackingEntry) {
+	if !s.ConfigAgent.Config().CherrypickerFor(org, repo).TrackingComment {
+		return
+	}
+	err := s.updateTracking(org, repo, num, func(entries []trackingEntry) []trackingEntry {
+		for i := range entries {
+			if entries[i].branch == entry.branch {
+				entries[i] = entry
+				return entries
+			}
+		}
+		return append(entries, entry)
+	})
+	if err != nil {
+		log.WithError(err).Warn("Failed to update the cherry-pick tracking comment.")
+	}
+}
+
+// trackPullRequestProgress updates the tracking comment on the original PR as the cherry-pick PR progresses,
+// such as it is merged, closed, reopened or its conflicts are resolved.
+func (s *Server) trackPullRequestProgress(log *logrus.Entry, pre *github.PullRequestEvent) error {
+	pr := &pre.PullRequest
+	if s.BotUser == nil || pr.User.Login != s.BotUser.Login {
+		return nil
+	}
+	source, ok := s.trackedSourceOf(pr)
+	if !ok {
+		return nil
+	}
+
+	var state string
+	checkConflicts := false
+	switch pre.Action {
+	case github.PullRequestActionClosed:
+		state = trackingStateClosed
+		if pr.Merged {
+			state = trackingStateMerged
+		}
+	case github.PullRequestActionReopened:
+		state = trackingStateOpen
+	case github.PullRequestActionSynchronize:
+		checkConflicts = true
+	default:
+		return nil
+	}
+
+	log.WithFields(logrus.Fields{
+		"cherry_pick_pull_request_number": pr.Number,
+		"original_pull_request":           issueRef(source.org, source.repo, source.number, "", ""),
+	}).Info("Updating the cherry-pick tracking comment.")
+	return s.updateTracking(source.org, source.repo, source.number, func(entries []trackingEntry) []trackingEntry {
+		for i := range entries {
+			e := &entries[i]
+			// The cherry-pick PRs in different repos may have the same numbers.
+			if e.number != pr.Number || e.branch != source.branch {
+				continue
+			}
+			if len(state) != 0 {
+				e.state = state
+			}
+			if checkConflicts && e.conflict == conflictStateConflicting {
+				hasConflict, err := s.hasConflictMarkers(pr, e.files)
+				if err != nil {
+					log.WithError(err).Warn("Failed to check the conflicts of the cherry-pick PR.")
+				} else if !hasConflict {
+					e.conflict = conflictStateResolved
+				}
+			}
+		}
+		return entries
+	})
+}
+
+// trackedSource is the original PR tracking the cherry-pick PR.
+type trackedSource struct {
+	org    string
+	repo   string
+	number int
+	// branch is the target branch of the tracking entry, which is of the form org/repo:branch
+	// for the cherry-pick PRs in other repos.
+	branch string
+}
+
+// trackedSourceOf returns the original PR of the cherry-pick PR according to its head branch, if the original PR
+// tracks its cherry-picks. The cherry-pick PRs in other repos are mapped back to the source repos which allow
+// the repo of the cherry-pick PR as a target repo.
+func (s *Server) trackedSourceOf(pr *github.PullRequest) (trackedSource, bool) {
+	config := s.ConfigAgent.Config()
+	org := pr.Base.Repo.Owner.Login
+	repo := pr.Base.Repo.Name
+
+	if match := cherryPickBranchRe.FindStringSubmatch(pr.Head.Ref); match != nil {
+		num, err := strconv.Atoi(match[1])
+		if err != nil || !config.CherrypickerFor(org, repo).TrackingComment {
+			return trackedSource{}, false
+		}
+		return trackedSource{org: org, repo: repo, number: num, branch: pr.Base.Ref}, true
+	}
+
+	// The org and the repo in the head branch are joined by the hyphen, which may also be in their names.
+	suffix := "-to-" + pr.Base.Ref
+	if !strings.HasSuffix(pr.Head.Ref, suffix) {
+		return trackedSource{}, false
+	}
+	match := crossRepoCherryPickBranchRe.FindStringSubmatch(strings.TrimSuffix(pr.Head.Ref, suffix))
+	if match == nil {
+		return trackedSource{}, false
+	}
+	num, err := strconv.Atoi(match[2])
+	if err != nil {
+		return trackedSource{}, false
+	}
+	fullName := org + "/" + repo
+	for i, c := range match[1] {
+		if c != '-' {
+			continue
+		}
+		sourceOrg, sourceRepo := match[1][:i], match[1][i+1:]
+		opts := config.CherrypickerFor(sourceOrg, sourceRepo)
+		if opts.TrackingComment && opts.IsAllowedTargetRepo(fullName) {
+			return trackedSource{
+				org:    sourceOrg,
+				repo:   sourceRepo,
+				number: num,
+				branch: fullName + ":" + pr.Base.Ref,
+			}, true
+		}
+	}
+	return trackedSource{}, false
+}
+
+// hasConflictMarkers checks whether the known conflicting files of the cherry-pick PR still have the conflict markers
+// at its head, the deleted files are resolved. The tracking comments which did not record the conflicting files fall
+// back to searching the conflict markers in the patch of the PR.
+func (s *Server) hasConflictMarkers(pr *github.PullRequest, files []string) (bool, error) {
+	if len(files) == 0 {
+		return s.isPrHasSoftConflict(pr.Base.Repo.Owner.Login, pr.Base.Repo.Name, pr.Number)
+	}
+	for _, file := range files {
+		content, err := s.GitHubClient.GetFile(pr.Head.Repo.Owner.Login, pr.Head.Repo.Name, file, pr.Head.SHA)
+		if err != nil {
+			var notFound *github.FileNotFound
+			if errors.As(err, &notFound) {
+				continue
+			}
+			return false, fmt.Errorf("failed to get file %s: %w", file, err)
+		}
+		if containsConflictMarkers(content) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// containsConflictMarkers checks whether the content has all the conflict markers left by git at the line starts.
+func containsConflictMarkers(content []byte) bool {
+	var ours, base, theirs bool
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case strings.HasPrefix(line, "<<<<<<< "):
+			ours = true
+		case line == "=======":
+			base = true
+		case strings.HasPrefix(line, ">>>>>>> "):
+			theirs = true
+		}
+	}
+	return ours && base && theirs
+}
@@ -0,0 +1,322 @@
+package cherrypicker
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/git/localgit"
+	"k8s.io/test-infra/prow/github"
+
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+// trackingFGHC keeps the comments created by the bot, so that they can be listed and edited.
+type trackingFGHC struct {
+	*fghc
+	botLogin string
+}
+
+func (f *trackingFGHC) CreateComment(org, repo string, number int, comment string) error {
+	if err := f.fghc.CreateComment(org, repo, number, comment); err != nil {
+		return err
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.prComments = append(f.prComments, github.IssueComment{
+		ID:   len(f.prComments) + 1,
+		User: github.User{Login: f.botLogin},
+		Body: comment,
+	})
+	return nil
+}
+
+// trackingComments returns the bodies of the tracking comments.
+func (f *trackingFGHC) trackingComments() []string {
+	f.Lock()
+	defer f.Unlock()
+	var bodies []string
+	for _, comment := range f.prComments {
+		if strings.Contains(comment.Body, TrackerIdentifier) {
+			bodies = append(bodies, comment.Body)
+		}
+	}
+	return bodies
+}
+
+func TestTrackingMessage(t *testing.T) {
+	entries := []trackingEntry{
+		{branch: "release-5.0", number: 3, conflict: conflictStateNone, state: trackingStateMerged, requestor: "user"},
+		{branch: "release-4.0", number: 4, conflict: conflictStateConflicting, state: trackingStateOpen,
+			requestor: "other", files: []string{"a.txt", "docs/a b,c.md"}},
+	}
+	msg := trackingMessage(entries)
+	for _, row := range []string{
+		"| `release-5.0` | #3 | none | merged | @user |",
+		"| `release-4.0` | #4 | conflicting | open | @other |",
+	} {
+		if !strings.Contains(msg, row) {
+			t.Errorf("expected the message to contain %q, but got %s", row, msg)
+		}
+	}
+	if parsed := parseTrackingEntries(msg); !reflect.DeepEqual(parsed, entries) {
+		t.Errorf("entries mismatch: got %+v, want %+v", parsed, entries)
+	}
+}
+
+func TestTrackCherryPicks(t *testing.T) {
+	lg, c, err := localgit.NewV2()
+	if err != nil {
+		t.Fatalf("Making localgit: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := lg.Clean(); err != nil {
+			t.Errorf("Cleaning up localgit: %v", err)
+		}
+		if err := c.Clean(); err != nil {
+			t.Errorf("Cleaning up client: %v", err)
+		}
+	})
+	if err := lg.MakeFakeRepo("foo", "bar"); err != nil {
+		t.Fatalf("Making fake repo: %v", err)
+	}
+	if err := lg.AddCommit("foo", "bar", initialFiles); err != nil {
+		t.Fatalf("Adding initial commit: %v", err)
+	}
+	for _, branch := range []string{"stage", "release-1.5"} {
+		if err := lg.CheckoutNewBranch("foo", "bar", branch); err != nil {
+			t.Fatalf("Checking out pull branch: %v", err)
+		}
+	}
+
+	botUser := &github.UserData{Login: "ci-robot", Email: "ci-robot@users.noreply.github.com"}
+	ghc := &trackingFGHC{
+		fghc: &fghc{
+			pr: &github.PullRequest{
+				Base:   github.PullRequestBranch{Ref: "master"},
+				Number: 2,
+				Merged: true,
+				Title:  "This is a fix for X",
+				Body:   body,
+			},
+			isMember: true,
+			patch:    patch,
+		},
+		botLogin: botUser.Login,
+	}
+
+	cfg := &externalplugins.Configuration{}
+	cfg.TiCommunityCherrypicker = []externalplugins.TiCommunityCherrypicker{
+		{
+			Repos:           []string{"foo/bar"},
+			LabelPrefix:     "cherrypick/",
+			TrackingComment: true,
+		},
+	}
+	ca := &externalplugins.ConfigAgent{}
+	ca.Set(cfg)
+
+	s := &Server{
+		BotUser:              botUser,
+		GitClient:            c,
+		ConfigAgent:          ca,
+		Push:                 func(_, _ string, _ bool) error { return nil },
+		GitHubClient:         ghc,
+		GitHubTokenGenerator: func() []byte { return []byte("token") },
+		Log:                  logrus.StandardLogger().WithField("client", "cherrypicker"),
+		Repos:                []github.Repo{{Fork: true, FullName: "ci-robot/bar"}},
+	}
+
+	ic := &github.IssueCommentEvent{
+		Action: github.IssueCommentActionCreated,
+		Repo: github.Repo{
+			Owner:    github.User{Login: "foo"},
+			Name:     "bar",
+			FullName: "foo/bar",
+		},
+		Issue: github.Issue{
+			Number:      2,
+			State:       "closed",
+			PullRequest: &struct{}{},
+		},
+		Comment: github.IssueComment{
+			User: github.User{Login: "wiseguy"},
+			Body: "/cherry-pick stage\r\n/cherry-pick release-1.5",
+		},
+	}
+	if err := s.handleIssueCherryPickComment(logrus.NewEntry(logrus.StandardLogger()), ic); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	checkEntries := func(expected []trackingEntry) {
+		t.Helper()
+		comments := ghc.trackingComments()
+		if len(comments) != 1 {
+			t.Fatalf("expected one tracking comment, but got %v", comments)
+		}
+		if entries := parseTrackingEntries(comments[0]); !reflect.DeepEqual(entries, expected) {
+			t.Errorf("entries mismatch: got %+v, want %+v", entries, expected)
+		}
+	}
+	checkEntries([]trackingEntry{
+		{branch: "release-1.5", number: 1, conflict: conflictStateNone, state: trackingStateOpen, requestor: "wiseguy"},
+		{branch: "stage", number: 2, conflict: conflictStateNone, state: trackingStateOpen, requestor: "wiseguy"},
+	})
+
+	newEvent := func(action github.PullRequestEventAction, number int, branch string,
+		merged bool) *github.PullRequestEvent {
+		pr := github.PullRequest{
+			Number: number,
+			Merged: merged,
+			User:   github.User{Login: botUser.Login},
+			Head: github.PullRequestBranch{
+				Ref:  fmt.Sprintf(cherryPickBranchFmt, 2, branch),
+				SHA:  "head-sha",
+				Repo: github.Repo{Owner: github.User{Login: botUser.Login}, Name: "bar"},
+			},
+			Base: github.PullRequestBranch{
+				Ref:  branch,
+				Repo: github.Repo{Owner: github.User{Login: "foo"}, Name: "bar"},
+			},
+		}
+		return &github.PullRequestEvent{Action: action, Number: number, PullRequest: pr}
+	}
+
+	// The cherry-pick PR to stage is merged.
+	if err := s.handlePullRequest(logrus.NewEntry(logrus.StandardLogger()),
+		newEvent(github.PullRequestActionClosed, 2, "stage", true)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// The cherry-pick PR to release-1.5 is closed and reopened.
+	for _, action := range []github.PullRequestEventAction{github.PullRequestActionClosed,
+		github.PullRequestActionReopened} {
+		if err := s.handlePullRequest(logrus.NewEntry(logrus.StandardLogger()),
+			newEvent(action, 1, "release-1.5", false)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	checkEntries([]trackingEntry{
+		{branch: "release-1.5", number: 1, conflict: conflictStateNone, state: trackingStateOpen, requestor: "wiseguy"},
+		{branch: "stage", number: 2, conflict: conflictStateNone, state: trackingStateMerged, requestor: "wiseguy"},
+	})
+
+	// The conflicts are partially resolved by the new commits.
+	ghc.Lock()
+	for i := range ghc.prComments {
+		if strings.Contains(ghc.prComments[i].Body, TrackerIdentifier) {
+			ghc.prComments[i].Body = trackingMessage([]trackingEntry{
+				{branch: "release-1.5", number: 1, conflict: conflictStateConflicting, state: trackingStateOpen,
+					requestor: "wiseguy", files: []string{"a.txt", "b.txt", "c.txt"}},
+			})
+		}
+	}
+	ghc.files = map[string][]byte{
+		"a.txt": []byte("resolved\n=======\n"),
+		"b.txt": []byte("<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> 1234567 (Fix X)\n"),
+	}
+	ghc.Unlock()
+	if err := s.handlePullRequest(logrus.NewEntry(logrus.StandardLogger()),
+		newEvent(github.PullRequestActionSynchronize, 1, "release-1.5", false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkEntries([]trackingEntry{
+		{branch: "release-1.5", number: 1, conflict: conflictStateConflicting, state: trackingStateOpen,
+			requestor: "wiseguy", files: []string{"a.txt", "b.txt", "c.txt"}},
+	})
+
+	// The conflicts are resolved by the new commits, and the deleted files are resolved.
+	ghc.Lock()
+	ghc.files["b.txt"] = []byte("ours\ntheirs\n")
+	ghc.Unlock()
+	if err := s.handlePullRequest(logrus.NewEntry(logrus.StandardLogger()),
+		newEvent(github.PullRequestActionSynchronize, 1, "release-1.5", false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resolved := []trackingEntry{
+		{branch: "release-1.5", number: 1, conflict: conflictStateResolved, state: trackingStateOpen,
+			requestor: "wiseguy", files: []string{"a.txt", "b.txt", "c.txt"}},
+	}
+	checkEntries(resolved)
+
+	// The PRs not created by the bot are ignored.
+	event := newEvent(github.PullRequestActionClosed, 1, "release-1.5", true)
+	event.PullRequest.User.Login = "wiseguy"
+	if err := s.handlePullRequest(logrus.NewEntry(logrus.StandardLogger()), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkEntries(resolved)
+}
+
+func TestTrackCrossRepoCherryPicks(t *testing.T) {
+	botUser := &github.UserData{Login: "ci-robot", Email: "ci-robot@users.noreply.github.com"}
+	ghc := &trackingFGHC{fghc: &fghc{}, botLogin: botUser.Login}
+
+	cfg := &externalplugins.Configuration{}
+	cfg.TiCommunityCherrypicker = []externalplugins.TiCommunityCherrypicker{
+		{
+			Repos:           []string{"foo/bar"},
+			TargetRepos:     []string{"foo/baz-tools"},
+			TrackingComment: true,
+		},
+	}
+	ca := &externalplugins.ConfigAgent{}
+	ca.Set(cfg)
+
+	s := &Server{
+		BotUser:      botUser,
+		ConfigAgent:  ca,
+		GitHubClient: ghc,
+		Log:          logrus.StandardLogger().WithField("client", "cherrypicker"),
+	}
+	if err := ghc.CreateComment("foo", "bar", 2, trackingMessage([]trackingEntry{
+		{branch: "foo/baz-tools:stage", number: 7, conflict: conflictStateNone, state: trackingStateOpen,
+			requestor: "wiseguy"},
+		{branch: "stage", number: 7, conflict: conflictStateNone, state: trackingStateOpen, requestor: "wiseguy"},
+	})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	newEvent := func(org, repo, source string) *github.PullRequestEvent {
+		pr := github.PullRequest{
+			Number: 7,
+			Merged: true,
+			User:   github.User{Login: botUser.Login},
+			Head:   github.PullRequestBranch{Ref: fmt.Sprintf(crossRepoCherryPickBranchFmt, "foo", source, 2, "stage")},
+			Base: github.PullRequestBranch{
+				Ref:  "stage",
+				Repo: github.Repo{Owner: github.User{Login: org}, Name: repo},
+			},
+		}
+		return &github.PullRequestEvent{Action: github.PullRequestActionClosed, Number: 7, PullRequest: pr}
+	}
+
+	// The cherry-pick PRs in the repos which are not the allowed target repos are ignored.
+	for _, event := range []*github.PullRequestEvent{
+		newEvent("foo", "other", "bar"),
+		newEvent("foo", "baz-tools", "unknown"),
+	} {
+		if err := s.trackPullRequestProgress(logrus.NewEntry(logrus.StandardLogger()), event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	// The cherry-pick PR in the target repo is merged.
+	if err := s.trackPullRequestProgress(logrus.NewEntry(logrus.StandardLogger()),
+		newEvent("foo", "baz-tools", "bar")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	comments := ghc.trackingComments()
+	if len(comments) != 1 {
+		t.Fatalf("expected one tracking comment, but got %v", comments)
+	}
+	expected := []trackingEntry{
+		{branch: "foo/baz-tools:stage", number: 7, conflict: conflictStateNone, state: trackingStateMerged,
+			requestor: "wiseguy"},
+		{branch: "stage", number: 7, conflict: conflictStateNone, state: trackingStateOpen, requestor: "wiseguy"},
+	}
+	if entries := parseTrackingEntries(comments[0]); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("entries mismatch: got %+v, want %+v", entries, expected)
+	}
+}
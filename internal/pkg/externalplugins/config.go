@@ -17,8 +17,18 @@ const (
 	// defaultGracePeriodDuration define the time for blunderbuss plugin to wait
 	// before requesting a review (default five seconds).
 	defaultGracePeriodDuration = 5
+	// defaultReviewLatencyDays defines the number of days of the recent reviews used by the blunderbuss plugin
+	// to estimate the review latency of the reviewers.
+	defaultReviewLatencyDays = 30
+	// defaultBlameHalfLifeDays defines the number of days in which the weight of a blamed line halves
+	// for the blunderbuss plugin.
+	defaultBlameHalfLifeDays = 180
 	// defaultLogLevel defines the default log level of all ti community plugins.
 	defaultLogLevel = logrus.InfoLevel
+	// MergeFreezeTimeLayout defines the layout of the start and end time of the merge freeze window.
+	MergeFreezeTimeLayout = "2006-01-02 15:04"
+	// DefaultReleaseBranchFormat defines the default format of the release branch of a version.
+	DefaultReleaseBranchFormat = "release-%s"
 )
 
 // Allowed value of the action configuration of the label blocker plugin.
@@ -27,6 +37,12 @@ const (
 	UnlabeledAction = "unlabeled"
 )
 
+// Allowed value of the update method configuration of the tars plugin.
+const (
+	MergeUpdateMethod  = "merge"
+	RebaseUpdateMethod = "rebase"
+)
+
 // Configuration is the top-level serialization target for external plugin Configuration.
 type Configuration struct {
 	TichiWebURL     string `json:"tichi_web_url,omitempty"`
@@ -66,6 +82,19 @@ type TiCommunityLgtm struct {
 	PullOwnersEndpoint string `json:"pull_owners_endpoint,omitempty"`
 	// IgnoreInvalidReviewPrompt specifies no prompt when review is invalid, default is `false`.
 	IgnoreInvalidReviewPrompt bool `json:"ignore_invalid_review_prompt"`
+	// Affiliations specifies the team or company that the reviewers belong to, the key is the
+	// GitHub login of the reviewer and the value is the name of the affiliation.
+	Affiliations map[string]string `json:"affiliations,omitempty"`
+	// AffiliationTeams specifies the GitHub teams whose members are affiliated to the team,
+	// the configuration of Affiliations takes precedence over it.
+	AffiliationTeams []string `json:"affiliation_teams,omitempty"`
+	// RequiredAffiliationCount specifies the minimum number of different affiliations the approvals
+	// must come from before the pull request acquires the required number of LGTMs, defaults to 0
+	// meaning no limit. Reviewers without an affiliation are treated as an affiliation of their own.
+	RequiredAffiliationCount int `json:"required_affiliation_count,omitempty"`
+	// CountAuthorAffiliationOnce specifies that the approvals from the members of the same affiliation
+	// as the PR author are counted at most once.
+	CountAuthorAffiliationOnce bool `json:"count_author_affiliation_once,omitempty"`
 }
 
 // TiCommunityMerge specifies a configuration for a single merge.
@@ -79,6 +108,74 @@ type TiCommunityMerge struct {
 	StoreTreeHash bool `json:"store_tree_hash,omitempty"`
 	// PullOwnersEndpoint specifies the URL of the reviewer of pull request.
 	PullOwnersEndpoint string `json:"pull_owners_endpoint,omitempty"`
+	// RequiredContexts specifies the status or check run contexts that must pass before `/merge`
+	// adds the 'status/can-merge' label, the label is added immediately if it is empty.
+	RequiredContexts []string `json:"required_contexts,omitempty"`
+	// FreezeWindows specifies the windows during which `/merge` is rejected.
+	FreezeWindows []MergeFreezeWindow `json:"freeze_windows,omitempty"`
+	// ReleaseApprovalRules specifies the branches on which `/merge` requires the approval of the release managers.
+	ReleaseApprovalRules []ReleaseApprovalRule `json:"release_approval_rules,omitempty"`
+}
+
+// setDefaults will set the default value for the config of merge plugin.
+func (c *TiCommunityMerge) setDefaults() {
+	for i := range c.ReleaseApprovalRules {
+		if len(c.ReleaseApprovalRules[i].ApprovedLabel) == 0 {
+			c.ReleaseApprovalRules[i].ApprovedLabel = ReleaseApprovedLabel
+		}
+	}
+}
+
+// ReleaseApprovalRuleFor finds the release approval rule of the branch, it returns nil if no rule matches.
+func (c *TiCommunityMerge) ReleaseApprovalRuleFor(branch string) *ReleaseApprovalRule {
+	for i, rule := range c.ReleaseApprovalRules {
+		for _, pattern := range rule.Branches {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				continue
+			}
+			if re.MatchString(branch) {
+				return &c.ReleaseApprovalRules[i]
+			}
+		}
+	}
+	return nil
+}
+
+// ReleaseApprovalRule is the config for the approval of the release managers on the release branches.
+type ReleaseApprovalRule struct {
+	// Branches specifies the regular expressions of the release branches.
+	Branches []string `json:"branches,omitempty"`
+	// ReleaseManagerTeams specifies the GitHub teams of the release managers.
+	ReleaseManagerTeams []string `json:"release_manager_teams,omitempty"`
+	// ReleaseManagers specifies the GitHub logins of the release managers.
+	ReleaseManagers []string `json:"release_managers,omitempty"`
+	// ApprovedLabel specifies the label that indicates the approval of the release managers,
+	// defaults to 'status/release-approved'.
+	ApprovedLabel string `json:"approved_label,omitempty"`
+}
+
+// MergeFreezeWindow is the config for a window during which `/merge` is rejected on the matched branches.
+type MergeFreezeWindow struct {
+	// Branches specifies the regular expressions of the frozen branches, empty means all branches.
+	Branches []string `json:"branches,omitempty"`
+	// TimeZone specifies the time zone of the start, end and weekdays, such as "Asia/Shanghai", defaults to UTC.
+	TimeZone string `json:"time_zone,omitempty"`
+	// Start specifies when the freeze starts, such as "2021-06-01 00:00", empty means it has started.
+	Start string `json:"start,omitempty"`
+	// End specifies when the freeze ends, such as "2021-06-15 00:00", empty means it lasts until the
+	// window is removed from the configuration.
+	End string `json:"end,omitempty"`
+	// Weekdays specifies the days of the week on which the freeze takes effect, such as "Saturday",
+	// empty means every day.
+	Weekdays []string `json:"weekdays,omitempty"`
+	// Reason specifies the reason of the freeze.
+	Reason string `json:"reason,omitempty"`
+	// ExemptTeams specifies the GitHub teams whose members can still use `/merge` during the freeze.
+	ExemptTeams []string `json:"exempt_teams,omitempty"`
+	// RemoveCanMergeLabel specifies whether to remove the existing 'status/can-merge' labels of the pull
+	// requests on the frozen branches when the freeze starts.
+	RemoveCanMergeLabel bool `json:"remove_can_merge_label,omitempty"`
 }
 
 // TiCommunityOwners specifies a configuration for a single ti community owners plugin.
@@ -177,6 +274,35 @@ type TiCommunityBlunderbuss struct {
 	GracePeriodDuration int `json:"grace_period_duration,omitempty"`
 	// RequireSigLabel specifies whether the PR is required to have a sig label before requesting reviewers.
 	RequireSigLabel bool `json:"require_sig_label,omitempty"`
+	// MaxOpenReviewRequests specifies the maximum number of the open review requests a reviewer can have
+	// in the org, the reviewers who reach it are not requested. The cap is the same for every reviewer,
+	// there are no per-reviewer overrides. Defaults to 0 meaning no limit.
+	MaxOpenReviewRequests int `json:"max_open_review_requests,omitempty"`
+	// LoadAware specifies whether to down-weight the reviewers who have more open review requests
+	// or review slower recently.
+	LoadAware bool `json:"load_aware,omitempty"`
+	// ReviewLatencyDays specifies the number of days of the recent reviews used to estimate
+	// the review latency of the reviewers, defaults to 30.
+	ReviewLatencyDays int `json:"review_latency_days,omitempty"`
+	// AvailabilityFile specifies the path of the YAML or iCalendar (.ics) file that lists the absences
+	// of the reviewers, the reviewers who are away are not requested.
+	AvailabilityFile string `json:"availability_file,omitempty"`
+	// BlameExpertise specifies whether to weight the reviewers by git blame of the lines modified by the PR
+	// in a local clone instead of the commits of the changed files, it falls back to the commits
+	// when the clone is unavailable.
+	BlameExpertise bool `json:"blame_expertise,omitempty"`
+	// BlameHalfLifeDays specifies the number of days in which the weight of a blamed line halves, defaults to 180.
+	BlameHalfLifeDays int `json:"blame_half_life_days,omitempty"`
+	// StaleReviewHours specifies the hours after which the requested reviewers who have not responded are pinged,
+	// and they are swapped with other reviewers if they still do not respond in the same hours after the ping.
+	// Defaults to 0 meaning the stale review requests are not handled.
+	StaleReviewHours int `json:"stale_review_hours,omitempty"`
+	// ExplainSelection specifies whether to explain the candidates, the weights, the exclusions
+	// and the picks of the reviewer selection in a collapsible comment.
+	ExplainSelection bool `json:"explain_selection,omitempty"`
+	// SelectionSalt specifies the salt of the seed of the reviewer selection, the selection is seeded
+	// by the org, repo and number of the PR with the salt, so the same PR always gets the same reviewers.
+	SelectionSalt string `json:"selection_salt,omitempty"`
 }
 
 // setDefaults will set the default value for the config of blunderbuss plugin.
@@ -184,6 +310,12 @@ func (c *TiCommunityBlunderbuss) setDefaults() {
 	if c.GracePeriodDuration == 0 {
 		c.GracePeriodDuration = defaultGracePeriodDuration
 	}
+	if c.ReviewLatencyDays == 0 {
+		c.ReviewLatencyDays = defaultReviewLatencyDays
+	}
+	if c.BlameHalfLifeDays == 0 {
+		c.BlameHalfLifeDays = defaultBlameHalfLifeDays
+	}
 }
 
 // TiCommunityTars is the config for the tars plugin.
@@ -196,6 +328,47 @@ type TiCommunityTars struct {
 	OnlyWhenLabel string `json:"only_when_label,omitempty"`
 	// ExcludeLabels specifies that the automatic update are not triggered when the PR has these labels.
 	ExcludeLabels []string `json:"exclude_labels,omitempty"`
+	// PriorityOrder specifies the priorities of the PRs to be updated in order, the PRs matching the earlier
+	// priority are updated first. The PRs with the same priority are updated in the order of the time since
+	// the only_when_label was applied, the earliest first.
+	PriorityOrder []TarsPriority `json:"priority_order,omitempty"`
+	// UpdateMethod specifies how the out-of-date PRs are updated, either merge or rebase, default is merge.
+	UpdateMethod string `json:"update_method,omitempty"`
+	// FallbackToMerge specifies that the PRs which cannot be rebased are updated by merge instead,
+	// otherwise they are left for the authors to rebase manually.
+	FallbackToMerge bool `json:"fallback_to_merge,omitempty"`
+	// MaxConcurrentUpdates specifies the maximum number of the PRs of each base branch updated at a time,
+	// default is 1.
+	MaxConcurrentUpdates int `json:"max_concurrent_updates,omitempty"`
+	// MaxPendingJobs specifies that the PRs of the base branch are not updated when the number of the pending
+	// CI jobs of its up-to-date PRs reaches it, 0 means no limit.
+	MaxPendingJobs int `json:"max_pending_jobs,omitempty"`
+	// Branches specifies the branch level configuration that will override the repository
+	// level configuration.
+	Branches map[string]TiCommunityTarsBranchConfig `json:"branches,omitempty"`
+	// BaseRequiredContexts specifies the CI contexts of the base branch head, the updates of the PRs are postponed
+	// when any of them fails on the base branch head.
+	BaseRequiredContexts []string `json:"base_required_contexts,omitempty"`
+	// BaseRedTimeoutMinutes specifies that the PRs are updated anyway when the failing base branch head
+	// has been committed for such minutes, 0 means postponing the updates until the base branch is green.
+	BaseRedTimeoutMinutes int `json:"base_red_timeout_minutes,omitempty"`
+}
+
+// TiCommunityTarsBranchConfig is the branch level configuration of the tars plugin.
+type TiCommunityTarsBranchConfig struct {
+	// MaxConcurrentUpdates specifies the maximum number of the PRs of the branch updated at a time.
+	MaxConcurrentUpdates int `json:"max_concurrent_updates,omitempty"`
+	// MaxPendingJobs specifies that the PRs of the branch are not updated when the number of the pending
+	// CI jobs of its up-to-date PRs reaches it.
+	MaxPendingJobs int `json:"max_pending_jobs,omitempty"`
+}
+
+// TarsPriority specifies which PRs have the priority to be updated.
+type TarsPriority struct {
+	// Labels specifies that the PRs with any of these labels have the priority.
+	Labels []string `json:"labels,omitempty"`
+	// CherryPick specifies that the cherry-pick PRs created by the cherrypicker have the priority.
+	CherryPick bool `json:"cherry_pick,omitempty"`
 }
 
 // setDefaults will set the default label for the config of tars plugin.
@@ -212,6 +385,14 @@ func (c *TiCommunityTars) setDefaults() {
 		// Label: do-not-merge/work-in-progress.
 		c.ExcludeLabels = append(c.ExcludeLabels, labels.WorkInProgress)
 	}
+
+	if len(c.UpdateMethod) == 0 {
+		c.UpdateMethod = MergeUpdateMethod
+	}
+
+	if c.MaxConcurrentUpdates == 0 {
+		c.MaxConcurrentUpdates = 1
+	}
 }
 
 // TiCommunityLabelBlocker is the config for the label blocker plugin.
@@ -260,6 +441,21 @@ type TiCommunityCherrypicker struct {
 	ExcludeLabels []string `json:"excludeLabels,omitempty"`
 	// CopyIssueNumbersFromSquashedCommit specifies whether to copy the issue numbers from the squashed commit message.
 	CopyIssueNumbersFromSquashedCommit bool `json:"copy_issue_numbers_from_squashed_commit"`
+	// TrackingComment specifies whether to maintain a comment on the original PR to track its cherry-pick PRs.
+	TrackingComment bool `json:"tracking_comment,omitempty"`
+	// TargetBranches specifies the regular expressions of the branches allowed to cherry-pick to,
+	// all branches are allowed if neither it nor the maintained versions is set.
+	TargetBranches []string `json:"target_branches,omitempty"`
+	// MaintainedVersions specifies the maintained versions, whose release branches are allowed to cherry-pick to.
+	MaintainedVersions []string `json:"maintained_versions,omitempty"`
+	// ReleaseBranchFormat specifies the format of the release branch of a version, defaults to 'release-%s'.
+	ReleaseBranchFormat string `json:"release_branch_format,omitempty"`
+	// PreserveAuthorship specifies whether to cherry-pick the commits one by one when the patch cannot be applied
+	// directly, which preserves the authors, the co-author trailers and the commits of the non-squash merges.
+	PreserveAuthorship bool `json:"preserve_authorship,omitempty"`
+	// TargetRepos specifies the repos of the form org/repo other than the repo of the PR,
+	// which the PRs can be cherry-picked to with the target of the form org/repo:branch.
+	TargetRepos []string `json:"target_repos,omitempty"`
 }
 
 // setDefaults will set the default value for the config of blunderbuss plugin.
@@ -267,6 +463,55 @@ func (c *TiCommunityCherrypicker) setDefaults() {
 	if len(c.LabelPrefix) == 0 {
 		c.LabelPrefix = DefaultCherryPickLabelPrefix
 	}
+	if len(c.ReleaseBranchFormat) == 0 {
+		c.ReleaseBranchFormat = DefaultReleaseBranchFormat
+	}
+}
+
+// MaintainedBranches returns the release branches of the maintained versions.
+func (c *TiCommunityCherrypicker) MaintainedBranches() []string {
+	format := c.ReleaseBranchFormat
+	if len(format) == 0 {
+		format = DefaultReleaseBranchFormat
+	}
+	branches := make([]string, 0, len(c.MaintainedVersions))
+	for _, version := range c.MaintainedVersions {
+		branches = append(branches, fmt.Sprintf(format, version))
+	}
+	return branches
+}
+
+// IsAllowedTargetBranch returns true if the branch is the release branch of a maintained version
+// or matches the target branches, all branches are allowed if neither of them is set.
+func (c *TiCommunityCherrypicker) IsAllowedTargetBranch(branch string) bool {
+	if len(c.TargetBranches) == 0 && len(c.MaintainedVersions) == 0 {
+		return true
+	}
+	for _, maintained := range c.MaintainedBranches() {
+		if branch == maintained {
+			return true
+		}
+	}
+	for _, pattern := range c.TargetBranches {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(branch) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAllowedTargetRepo returns true if the PRs can be cherry-picked to the repo of the form org/repo.
+func (c *TiCommunityCherrypicker) IsAllowedTargetRepo(fullName string) bool {
+	for _, repo := range c.TargetRepos {
+		if repo == fullName {
+			return true
+		}
+	}
+	return false
 }
 
 // TiCommunityFormatChecker is the config for the format-checker plugin.
@@ -588,6 +833,10 @@ func (c *Configuration) setDefaults() {
 		c.TiCommunityCherrypicker[i].setDefaults()
 	}
 
+	for i := range c.TiCommunityMerge {
+		c.TiCommunityMerge[i].setDefaults()
+	}
+
 	for i := range c.TiCommunityTars {
 		c.TiCommunityTars[i].setDefaults()
 	}
@@ -649,6 +898,10 @@ func (c *Configuration) Validate() error {
 		return err
 	}
 
+	if err := validateCherrypicker(c.TiCommunityCherrypicker); err != nil {
+		return err
+	}
+
 	return validateTars(c.TiCommunityTars)
 }
 
@@ -662,25 +915,104 @@ func validateLogLevel(logLevel string) error {
 	return nil
 }
 
-// validateLgtm will return an error if the URL configured by lgtm is invalid.
+// validateLgtm will return an error if the URL or the approval diversity rules configured by lgtm is invalid.
 func validateLgtm(lgtms []TiCommunityLgtm) error {
 	for _, lgtm := range lgtms {
 		_, err := url.ParseRequestURI(lgtm.PullOwnersEndpoint)
 		if err != nil {
 			return err
 		}
+		if lgtm.RequiredAffiliationCount < 0 {
+			return errors.New("required affiliation count must not less than 0")
+		}
+		if (lgtm.RequiredAffiliationCount > 0 || lgtm.CountAuthorAffiliationOnce) &&
+			len(lgtm.Affiliations) == 0 && len(lgtm.AffiliationTeams) == 0 {
+			return errors.New("affiliations or affiliation_teams must be set when approval diversity rules are enabled")
+		}
 	}
 
 	return nil
 }
 
-// validateMerge will return an error if the URL configured by merge is invalid.
+// validateMerge will return an error if the URL, the freeze windows or the release approval rules
+// configured by merge is invalid.
 func validateMerge(merges []TiCommunityMerge) error {
 	for _, merge := range merges {
 		_, err := url.ParseRequestURI(merge.PullOwnersEndpoint)
 		if err != nil {
 			return err
 		}
+
+		for _, window := range merge.FreezeWindows {
+			if err := validateMergeFreezeWindow(window); err != nil {
+				return err
+			}
+		}
+
+		for _, rule := range merge.ReleaseApprovalRules {
+			if err := validateReleaseApprovalRule(rule); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateReleaseApprovalRule will return an error if the branches or the release managers is invalid.
+func validateReleaseApprovalRule(rule ReleaseApprovalRule) error {
+	if len(rule.Branches) == 0 {
+		return fmt.Errorf("branches of the release approval rule must be set")
+	}
+	for _, branch := range rule.Branches {
+		if _, err := regexp.Compile(branch); err != nil {
+			return fmt.Errorf("the regex of release branch is broken: %v", err)
+		}
+	}
+
+	if len(rule.ReleaseManagerTeams) == 0 && len(rule.ReleaseManagers) == 0 {
+		return fmt.Errorf("release_manager_teams or release_managers of the release approval rule must be set")
+	}
+
+	return nil
+}
+
+// validateMergeFreezeWindow will return an error if the branches, time zone, time or weekdays is invalid.
+func validateMergeFreezeWindow(window MergeFreezeWindow) error {
+	for _, branch := range window.Branches {
+		if _, err := regexp.Compile(branch); err != nil {
+			return fmt.Errorf("the regex of freeze branch is broken: %v", err)
+		}
+	}
+
+	location, err := time.LoadLocation(window.TimeZone)
+	if err != nil {
+		return fmt.Errorf("invalid freeze time zone %s: %v", window.TimeZone, err)
+	}
+
+	var start, end time.Time
+	if window.Start != "" {
+		if start, err = time.ParseInLocation(MergeFreezeTimeLayout, window.Start, location); err != nil {
+			return fmt.Errorf("invalid freeze start time %s: %v", window.Start, err)
+		}
+	}
+	if window.End != "" {
+		if end, err = time.ParseInLocation(MergeFreezeTimeLayout, window.End, location); err != nil {
+			return fmt.Errorf("invalid freeze end time %s: %v", window.End, err)
+		}
+	}
+	if window.Start != "" && window.End != "" && !start.Before(end) {
+		return fmt.Errorf("freeze start time %s must be before the end time %s", window.Start, window.End)
+	}
+
+	weekdays := sets.NewString()
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		weekdays.Insert(strings.ToLower(day.String()))
+	}
+	for _, weekday := range window.Weekdays {
+		if !weekdays.Has(strings.ToLower(weekday)) {
+			return fmt.Errorf("invalid freeze weekday %s", weekday)
+		}
 	}
 
 	return nil
@@ -725,6 +1057,18 @@ func validateBlunderbuss(blunderbusses []TiCommunityBlunderbuss) error {
 		if blunderbuss.GracePeriodDuration < 0 {
 			return errors.New("grace period duration must not less than 0")
 		}
+		if blunderbuss.MaxOpenReviewRequests < 0 {
+			return errors.New("max open review requests must not less than 0")
+		}
+		if blunderbuss.ReviewLatencyDays < 0 {
+			return errors.New("review latency days must not less than 0")
+		}
+		if blunderbuss.BlameHalfLifeDays < 0 {
+			return errors.New("blame half life days must not less than 0")
+		}
+		if blunderbuss.StaleReviewHours < 0 {
+			return errors.New("stale review hours must not less than 0")
+		}
 		if len(blunderbuss.IncludeReviewers) != 0 && len(blunderbuss.ExcludeReviewers) != 0 {
 			return errors.New("cannot set both include_reviewers and exclude_reviewers configurations")
 		}
@@ -780,11 +1124,58 @@ func validateTars(tars []TiCommunityTars) error {
 				return fmt.Errorf("found repo %s that was not in org/repo format", repo)
 			}
 		}
+		for _, priority := range tar.PriorityOrder {
+			if len(priority.Labels) == 0 && !priority.CherryPick {
+				return errors.New("priority must have labels or cherry_pick")
+			}
+		}
+		if len(tar.UpdateMethod) != 0 && tar.UpdateMethod != MergeUpdateMethod &&
+			tar.UpdateMethod != RebaseUpdateMethod {
+			return fmt.Errorf("update method %s is not one of %s, %s", tar.UpdateMethod,
+				MergeUpdateMethod, RebaseUpdateMethod)
+		}
+		if tar.MaxConcurrentUpdates < 0 {
+			return errors.New("max concurrent updates must not less than 0")
+		}
+		if tar.MaxPendingJobs < 0 {
+			return errors.New("max pending jobs must not less than 0")
+		}
+		if tar.BaseRedTimeoutMinutes < 0 {
+			return errors.New("base red timeout minutes must not less than 0")
+		}
+		for _, branch := range tar.Branches {
+			if branch.MaxConcurrentUpdates < 0 {
+				return errors.New("max concurrent updates must not less than 0")
+			}
+			if branch.MaxPendingJobs < 0 {
+				return errors.New("max pending jobs must not less than 0")
+			}
+		}
 	}
 
 	return nil
 }
 
+// validateCherrypicker will return an error if the target branches or the release branch format is invalid.
+func validateCherrypicker(cherrypickers []TiCommunityCherrypicker) error {
+	for _, cherrypicker := range cherrypickers {
+		for _, branch := range cherrypicker.TargetBranches {
+			if _, err := regexp.Compile(branch); err != nil {
+				return fmt.Errorf("the regex of target branch is broken: %v", err)
+			}
+		}
+		if len(cherrypicker.ReleaseBranchFormat) != 0 && strings.Count(cherrypicker.ReleaseBranchFormat, "%s") != 1 {
+			return fmt.Errorf("release branch format %s must contain exactly one %%s", cherrypicker.ReleaseBranchFormat)
+		}
+		for _, repo := range cherrypicker.TargetRepos {
+			if slashSplit := strings.Split(repo, "/"); len(slashSplit) != 2 || slashSplit[0] == "" || slashSplit[1] == "" {
+				return fmt.Errorf("found target repo %s that was not in org/repo format", repo)
+			}
+		}
+	}
+	return nil
+}
+
 // validateFormatBlocker will return an error if the regex cannot compile or actions is illegal.
 func validateFormatBlocker(formatCheckers []TiCommunityFormatChecker) error {
 	for _, formatChecker := range formatCheckers {
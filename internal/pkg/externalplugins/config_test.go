@@ -4,6 +4,7 @@ package externalplugins
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"gotest.tools/assert"
@@ -1708,17 +1709,25 @@ func TestSetBlunderbussDefaults(t *testing.T) {
 	testcases := []struct {
 		name                      string
 		gracePeriodDuration       int
+		reviewLatencyDays         int
 		expectGracePeriodDuration int
+		expectReviewLatencyDays   int
+		expectBlameHalfLifeDays   int
 	}{
 		{
 			name:                      "default",
 			gracePeriodDuration:       0,
 			expectGracePeriodDuration: 5,
+			expectReviewLatencyDays:   30,
+			expectBlameHalfLifeDays:   180,
 		},
 		{
 			name:                      "overwrite",
 			gracePeriodDuration:       3,
+			reviewLatencyDays:         7,
 			expectGracePeriodDuration: 3,
+			expectReviewLatencyDays:   7,
+			expectBlameHalfLifeDays:   180,
 		},
 	}
 
@@ -1729,6 +1738,7 @@ func TestSetBlunderbussDefaults(t *testing.T) {
 				TiCommunityBlunderbuss: []TiCommunityBlunderbuss{
 					{
 						GracePeriodDuration: tc.gracePeriodDuration,
+						ReviewLatencyDays:   tc.reviewLatencyDays,
 					},
 				},
 			}
@@ -1740,6 +1750,14 @@ func TestSetBlunderbussDefaults(t *testing.T) {
 					t.Errorf("unexpected grace_period_duration: %v, expected: %v",
 						blunderbuss.GracePeriodDuration, tc.expectGracePeriodDuration)
 				}
+				if blunderbuss.ReviewLatencyDays != tc.expectReviewLatencyDays {
+					t.Errorf("unexpected review_latency_days: %v, expected: %v",
+						blunderbuss.ReviewLatencyDays, tc.expectReviewLatencyDays)
+				}
+				if blunderbuss.BlameHalfLifeDays != tc.expectBlameHalfLifeDays {
+					t.Errorf("unexpected blame_half_life_days: %v, expected: %v",
+						blunderbuss.BlameHalfLifeDays, tc.expectBlameHalfLifeDays)
+				}
 			}
 		})
 	}
@@ -1927,19 +1945,24 @@ func TestCherrypickerFor(t *testing.T) {
 
 func TestSetCherrypickerDefaults(t *testing.T) {
 	testcases := []struct {
-		name              string
-		labelPrefix       string
-		expectLabelPrefix string
+		name                      string
+		labelPrefix               string
+		releaseBranchFormat       string
+		expectLabelPrefix         string
+		expectReleaseBranchFormat string
 	}{
 		{
-			name:              "default",
-			labelPrefix:       "",
-			expectLabelPrefix: "cherrypick/",
+			name:                      "default",
+			labelPrefix:               "",
+			expectLabelPrefix:         "cherrypick/",
+			expectReleaseBranchFormat: "release-%s",
 		},
 		{
-			name:              "overwrite",
-			labelPrefix:       "needs-cherry-pick-",
-			expectLabelPrefix: "needs-cherry-pick-",
+			name:                      "overwrite",
+			labelPrefix:               "needs-cherry-pick-",
+			releaseBranchFormat:       "release/v%s",
+			expectLabelPrefix:         "needs-cherry-pick-",
+			expectReleaseBranchFormat: "release/v%s",
 		},
 	}
 
@@ -1949,7 +1972,8 @@ func TestSetCherrypickerDefaults(t *testing.T) {
 			c := &Configuration{
 				TiCommunityCherrypicker: []TiCommunityCherrypicker{
 					{
-						LabelPrefix: tc.labelPrefix,
+						LabelPrefix:         tc.labelPrefix,
+						ReleaseBranchFormat: tc.releaseBranchFormat,
 					},
 				},
 			}
@@ -1961,6 +1985,116 @@ func TestSetCherrypickerDefaults(t *testing.T) {
 					t.Errorf("unexpected labelPrefix: %v, expected: %v",
 						cherrypicker.LabelPrefix, tc.expectLabelPrefix)
 				}
+				if cherrypicker.ReleaseBranchFormat != tc.expectReleaseBranchFormat {
+					t.Errorf("unexpected releaseBranchFormat: %v, expected: %v",
+						cherrypicker.ReleaseBranchFormat, tc.expectReleaseBranchFormat)
+				}
+			}
+		})
+	}
+}
+
+func TestIsAllowedTargetBranch(t *testing.T) {
+	testcases := []struct {
+		name               string
+		targetBranches     []string
+		maintainedVersions []string
+		branch             string
+		expectAllowed      bool
+	}{
+		{
+			name:          "not restricted",
+			branch:        "release-2.0",
+			expectAllowed: true,
+		},
+		{
+			name:               "maintained branch",
+			targetBranches:     []string{`^feature/`},
+			maintainedVersions: []string{"5.0", "4.0"},
+			branch:             "release-4.0",
+			expectAllowed:      true,
+		},
+		{
+			name:               "matched branch",
+			targetBranches:     []string{`^feature/`},
+			maintainedVersions: []string{"5.0", "4.0"},
+			branch:             "feature/x",
+			expectAllowed:      true,
+		},
+		{
+			name:               "eol branch",
+			targetBranches:     []string{`^feature/`},
+			maintainedVersions: []string{"5.0", "4.0"},
+			branch:             "release-2.0",
+			expectAllowed:      false,
+		},
+		{
+			name:           "unmatched branch",
+			targetBranches: []string{`^release-\d+\.\d+$`},
+			branch:         "master2",
+			expectAllowed:  false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			cherrypicker := &TiCommunityCherrypicker{
+				TargetBranches:     tc.targetBranches,
+				MaintainedVersions: tc.maintainedVersions,
+			}
+			if allowed := cherrypicker.IsAllowedTargetBranch(tc.branch); allowed != tc.expectAllowed {
+				t.Errorf("unexpected allowed: %v, expected: %v", allowed, tc.expectAllowed)
+			}
+		})
+	}
+}
+
+func TestValidateCherrypicker(t *testing.T) {
+	testcases := []struct {
+		name         string
+		cherrypicker TiCommunityCherrypicker
+		expected     string
+	}{
+		{
+			name: "valid",
+			cherrypicker: TiCommunityCherrypicker{
+				TargetBranches:      []string{`^release-`},
+				MaintainedVersions:  []string{"5.0"},
+				ReleaseBranchFormat: "release/v%s",
+				TargetRepos:         []string{"pingcap/docs"},
+			},
+		},
+		{
+			name:         "invalid target branch regex",
+			cherrypicker: TiCommunityCherrypicker{TargetBranches: []string{"release-(5.0"}},
+			expected:     "the regex of target branch is broken",
+		},
+		{
+			name:         "invalid release branch format",
+			cherrypicker: TiCommunityCherrypicker{ReleaseBranchFormat: "release"},
+			expected:     "release branch format release must contain exactly one %s",
+		},
+		{
+			name:         "invalid target repo",
+			cherrypicker: TiCommunityCherrypicker{TargetRepos: []string{"pingcap"}},
+			expected:     "found target repo pingcap that was not in org/repo format",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			actual := validateCherrypicker([]TiCommunityCherrypicker{tc.cherrypicker})
+
+			if tc.expected == "" && actual != nil {
+				t.Errorf("unexpected error: '%v'", actual)
+			}
+			if tc.expected != "" && actual == nil {
+				t.Errorf("expected error '%v', but it is nil", tc.expected)
+			}
+			if tc.expected != "" && actual != nil && !strings.HasPrefix(actual.Error(), tc.expected) {
+				t.Errorf("expected error '%v', but it is '%v'", tc.expected, actual)
 			}
 		})
 	}
@@ -2097,26 +2231,38 @@ func TestSetTarsDefaults(t *testing.T) {
 		name                string
 		onlyWhenLabel       string
 		excludeLabels       []string
+		updateMethod        string
 		expectOnlyWhenLabel string
 		expectExcludeLabels []string
+		expectUpdateMethod  string
 	}{
 		{
 			name:                "default",
 			onlyWhenLabel:       "",
 			expectOnlyWhenLabel: "status/can-merge",
 			expectExcludeLabels: []string{"needs-rebase", "do-not-merge/hold", "do-not-merge/work-in-progress"},
+			expectUpdateMethod:  "merge",
 		},
 		{
 			name:                "overwrite onlyWhenLabel",
 			onlyWhenLabel:       "lgtm",
 			expectOnlyWhenLabel: "lgtm",
 			expectExcludeLabels: []string{"needs-rebase", "do-not-merge/hold", "do-not-merge/work-in-progress"},
+			expectUpdateMethod:  "merge",
 		},
 		{
 			name:                "overwrite excludeLabels",
 			excludeLabels:       []string{"label1", "label2", "label3"},
 			expectOnlyWhenLabel: "status/can-merge",
 			expectExcludeLabels: []string{"label1", "label2", "label3"},
+			expectUpdateMethod:  "merge",
+		},
+		{
+			name:                "overwrite updateMethod",
+			updateMethod:        "rebase",
+			expectOnlyWhenLabel: "status/can-merge",
+			expectExcludeLabels: []string{"needs-rebase", "do-not-merge/hold", "do-not-merge/work-in-progress"},
+			expectUpdateMethod:  "rebase",
 		},
 	}
 
@@ -2128,6 +2274,7 @@ func TestSetTarsDefaults(t *testing.T) {
 					{
 						OnlyWhenLabel: tc.onlyWhenLabel,
 						ExcludeLabels: tc.excludeLabels,
+						UpdateMethod:  tc.updateMethod,
 					},
 				},
 			}
@@ -2144,6 +2291,357 @@ func TestSetTarsDefaults(t *testing.T) {
 					t.Errorf("unexpected excludeLabels: %v, expected: %v",
 						tars.ExcludeLabels, tc.expectExcludeLabels)
 				}
+
+				if tars.UpdateMethod != tc.expectUpdateMethod {
+					t.Errorf("unexpected updateMethod: %v, expected: %v",
+						tars.UpdateMethod, tc.expectUpdateMethod)
+				}
+
+				if tars.MaxConcurrentUpdates != 1 {
+					t.Errorf("unexpected maxConcurrentUpdates: %v, expected: %v", tars.MaxConcurrentUpdates, 1)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateLgtm(t *testing.T) {
+	testcases := []struct {
+		name     string
+		lgtm     TiCommunityLgtm
+		expected error
+	}{
+		{
+			name: "no approval diversity rules",
+			lgtm: TiCommunityLgtm{
+				PullOwnersEndpoint: "https://bots.tidb.io/ti-community-bot",
+			},
+		},
+		{
+			name: "approval diversity rules with affiliations",
+			lgtm: TiCommunityLgtm{
+				PullOwnersEndpoint:         "https://bots.tidb.io/ti-community-bot",
+				Affiliations:               map[string]string{"a": "company-a"},
+				RequiredAffiliationCount:   2,
+				CountAuthorAffiliationOnce: true,
+			},
+		},
+		{
+			name: "approval diversity rules with affiliation teams",
+			lgtm: TiCommunityLgtm{
+				PullOwnersEndpoint:       "https://bots.tidb.io/ti-community-bot",
+				AffiliationTeams:         []string{"team-a"},
+				RequiredAffiliationCount: 2,
+			},
+		},
+		{
+			name: "negative required affiliation count",
+			lgtm: TiCommunityLgtm{
+				PullOwnersEndpoint:       "https://bots.tidb.io/ti-community-bot",
+				AffiliationTeams:         []string{"team-a"},
+				RequiredAffiliationCount: -1,
+			},
+			expected: fmt.Errorf("required affiliation count must not less than 0"),
+		},
+		{
+			name: "approval diversity rules without affiliations",
+			lgtm: TiCommunityLgtm{
+				PullOwnersEndpoint:         "https://bots.tidb.io/ti-community-bot",
+				CountAuthorAffiliationOnce: true,
+			},
+			expected: fmt.Errorf("affiliations or affiliation_teams must be set when approval diversity rules are enabled"),
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			actual := validateLgtm([]TiCommunityLgtm{tc.lgtm})
+
+			if tc.expected == nil && actual != nil {
+				t.Errorf("unexpected error: '%v'", actual)
+			}
+			if tc.expected != nil && actual == nil {
+				t.Errorf("expected error '%v', but it is nil", tc.expected)
+			}
+			if tc.expected != nil && actual != nil && tc.expected.Error() != actual.Error() {
+				t.Errorf("expected error '%v', but it is '%v'", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateMerge(t *testing.T) {
+	testcases := []struct {
+		name     string
+		window   MergeFreezeWindow
+		expected string
+	}{
+		{
+			name: "valid freeze window",
+			window: MergeFreezeWindow{
+				Branches: []string{`^release-5\.0$`},
+				TimeZone: "Asia/Shanghai",
+				Start:    "2021-06-01 00:00",
+				End:      "2021-06-15 00:00",
+				Weekdays: []string{"Saturday", "sunday"},
+			},
+		},
+		{
+			name:   "ad-hoc freeze window",
+			window: MergeFreezeWindow{},
+		},
+		{
+			name:     "invalid branch regex",
+			window:   MergeFreezeWindow{Branches: []string{"release-(5.0"}},
+			expected: "the regex of freeze branch is broken",
+		},
+		{
+			name:     "invalid time zone",
+			window:   MergeFreezeWindow{TimeZone: "Mars/Base"},
+			expected: "invalid freeze time zone Mars/Base",
+		},
+		{
+			name:     "invalid start time",
+			window:   MergeFreezeWindow{Start: "2021-06-01"},
+			expected: "invalid freeze start time 2021-06-01",
+		},
+		{
+			name:     "invalid end time",
+			window:   MergeFreezeWindow{End: "2021/06/15 00:00"},
+			expected: "invalid freeze end time 2021/06/15 00:00",
+		},
+		{
+			name:     "start time after end time",
+			window:   MergeFreezeWindow{Start: "2021-06-15 00:00", End: "2021-06-01 00:00"},
+			expected: "freeze start time 2021-06-15 00:00 must be before the end time 2021-06-01 00:00",
+		},
+		{
+			name:     "invalid weekday",
+			window:   MergeFreezeWindow{Weekdays: []string{"Funday"}},
+			expected: "invalid freeze weekday Funday",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			actual := validateMerge([]TiCommunityMerge{
+				{
+					PullOwnersEndpoint: "https://bots.tidb.io/ti-community-bot",
+					FreezeWindows:      []MergeFreezeWindow{tc.window},
+				},
+			})
+
+			if tc.expected == "" && actual != nil {
+				t.Errorf("unexpected error: '%v'", actual)
+			}
+			if tc.expected != "" && actual == nil {
+				t.Errorf("expected error '%v', but it is nil", tc.expected)
+			}
+			if tc.expected != "" && actual != nil && !strings.HasPrefix(actual.Error(), tc.expected) {
+				t.Errorf("expected error '%v', but it is '%v'", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateMergeReleaseApprovalRules(t *testing.T) {
+	testcases := []struct {
+		name     string
+		rule     ReleaseApprovalRule
+		expected string
+	}{
+		{
+			name: "valid rule",
+			rule: ReleaseApprovalRule{
+				Branches:            []string{`^release-`},
+				ReleaseManagerTeams: []string{"release-managers"},
+			},
+		},
+		{
+			name:     "no branches",
+			rule:     ReleaseApprovalRule{ReleaseManagers: []string{"manager1"}},
+			expected: "branches of the release approval rule must be set",
+		},
+		{
+			name: "invalid branch regex",
+			rule: ReleaseApprovalRule{
+				Branches:        []string{"release-(5.0"},
+				ReleaseManagers: []string{"manager1"},
+			},
+			expected: "the regex of release branch is broken",
+		},
+		{
+			name:     "no release managers",
+			rule:     ReleaseApprovalRule{Branches: []string{`^release-`}},
+			expected: "release_manager_teams or release_managers of the release approval rule must be set",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			actual := validateMerge([]TiCommunityMerge{
+				{
+					PullOwnersEndpoint:   "https://bots.tidb.io/ti-community-bot",
+					ReleaseApprovalRules: []ReleaseApprovalRule{tc.rule},
+				},
+			})
+
+			if tc.expected == "" && actual != nil {
+				t.Errorf("unexpected error: '%v'", actual)
+			}
+			if tc.expected != "" && actual == nil {
+				t.Errorf("expected error '%v', but it is nil", tc.expected)
+			}
+			if tc.expected != "" && actual != nil && !strings.HasPrefix(actual.Error(), tc.expected) {
+				t.Errorf("expected error '%v', but it is '%v'", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateTarsPriorityOrder(t *testing.T) {
+	testcases := []struct {
+		name     string
+		priority TarsPriority
+		expected string
+	}{
+		{
+			name:     "labels priority",
+			priority: TarsPriority{Labels: []string{"priority/critical"}},
+		},
+		{
+			name:     "cherry-pick priority",
+			priority: TarsPriority{CherryPick: true},
+		},
+		{
+			name:     "empty priority",
+			priority: TarsPriority{},
+			expected: "priority must have labels or cherry_pick",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			actual := validateTars([]TiCommunityTars{
+				{
+					Repos:         []string{"ti-community-infra/test-dev"},
+					PriorityOrder: []TarsPriority{tc.priority},
+				},
+			})
+
+			if tc.expected == "" && actual != nil {
+				t.Errorf("unexpected error: '%v'", actual)
+			}
+			if tc.expected != "" && (actual == nil || actual.Error() != tc.expected) {
+				t.Errorf("expected error '%v', but it is '%v'", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateTarsUpdateMethod(t *testing.T) {
+	testcases := []struct {
+		name         string
+		updateMethod string
+		expected     string
+	}{
+		{
+			name:         "merge",
+			updateMethod: "merge",
+		},
+		{
+			name:         "rebase",
+			updateMethod: "rebase",
+		},
+		{
+			name:         "invalid update method",
+			updateMethod: "squash",
+			expected:     "update method squash is not one of merge, rebase",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			actual := validateTars([]TiCommunityTars{
+				{
+					Repos:        []string{"ti-community-infra/test-dev"},
+					UpdateMethod: tc.updateMethod,
+				},
+			})
+
+			if tc.expected == "" && actual != nil {
+				t.Errorf("unexpected error: '%v'", actual)
+			}
+			if tc.expected != "" && (actual == nil || actual.Error() != tc.expected) {
+				t.Errorf("expected error '%v', but it is '%v'", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestValidateTarsConcurrency(t *testing.T) {
+	testcases := []struct {
+		name     string
+		tars     TiCommunityTars
+		expected string
+	}{
+		{
+			name: "valid concurrency",
+			tars: TiCommunityTars{
+				MaxConcurrentUpdates: 2,
+				MaxPendingJobs:       10,
+				Branches: map[string]TiCommunityTarsBranchConfig{
+					"master": {MaxConcurrentUpdates: 3, MaxPendingJobs: 20},
+				},
+			},
+		},
+		{
+			name:     "invalid max concurrent updates",
+			tars:     TiCommunityTars{MaxConcurrentUpdates: -1},
+			expected: "max concurrent updates must not less than 0",
+		},
+		{
+			name:     "invalid max pending jobs",
+			tars:     TiCommunityTars{MaxPendingJobs: -1},
+			expected: "max pending jobs must not less than 0",
+		},
+		{
+			name:     "invalid base red timeout minutes",
+			tars:     TiCommunityTars{BaseRedTimeoutMinutes: -1},
+			expected: "base red timeout minutes must not less than 0",
+		},
+		{
+			name: "invalid branch max concurrent updates",
+			tars: TiCommunityTars{
+				Branches: map[string]TiCommunityTarsBranchConfig{"master": {MaxConcurrentUpdates: -1}},
+			},
+			expected: "max concurrent updates must not less than 0",
+		},
+		{
+			name: "invalid branch max pending jobs",
+			tars: TiCommunityTars{
+				Branches: map[string]TiCommunityTarsBranchConfig{"master": {MaxPendingJobs: -1}},
+			},
+			expected: "max pending jobs must not less than 0",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			tc.tars.Repos = []string{"ti-community-infra/test-dev"}
+			actual := validateTars([]TiCommunityTars{tc.tars})
+
+			if tc.expected == "" && actual != nil {
+				t.Errorf("unexpected error: '%v'", actual)
+			}
+			if tc.expected != "" && (actual == nil || actual.Error() != tc.expected) {
+				t.Errorf("expected error '%v', but it is '%v'", tc.expected, actual)
 			}
 		})
 	}
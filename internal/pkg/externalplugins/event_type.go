@@ -14,5 +14,6 @@ const (
 
 	PushEvent EventType = "push"
 
-	StatusEvent EventType = "status"
+	StatusEvent   EventType = "status"
+	CheckRunEvent EventType = "check_run"
 )
@@ -5,6 +5,9 @@ import "fmt"
 const (
 	// CanMergeLabel is the name of the merge label applied by the merge plugin.
 	CanMergeLabel = "status/can-merge"
+	// ReleaseApprovedLabel is the name of the default label applied by the merge plugin
+	// when the release managers approve the PR.
+	ReleaseApprovedLabel = "status/release-approved"
 )
 
 const (
@@ -80,6 +80,7 @@ type githubClient interface {
 	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error)
 	DeleteComment(org, repo string, ID int) error
 	BotUserChecker() (func(candidate string) bool, error)
+	ListTeamMembersBySlug(org, teamSlug, role string) ([]github.TeamMember, error)
 }
 
 // reviewCtx contains information about each review event.
@@ -261,6 +262,21 @@ func handle(wantLGTM bool, config *tiexternalplugins.Configuration, rc reviewCtx
 			return nil
 		}
 
+		// Check the approval diversity rules before the approval is counted.
+		rejectReason := ""
+		if opts.RequiredAffiliationCount > 0 || opts.CountAuthorAffiliationOnce {
+			affiliations := loadAffiliations(opts, org, gc, log)
+			rejectReason = checkApprovalDiversity(opts, affiliations, rc.issueAuthor, currentReviewer,
+				reviewedReviewers, nextLabel, reviewersAndNeedsLGTM.NeedsLgtm)
+		}
+		// The rejected approval is not counted, so the reviewer is not recorded in the notification,
+		// and the reviewer can approve again once the rules can be satisfied.
+		if rejectReason != "" {
+			log.Infof("Reply approve pull request in comment: \"%s\"", rejectReason)
+			return gc.CreateComment(org, repo, number,
+				tiexternalplugins.FormatResponseRaw(body, htmlURL, currentReviewer, rejectReason))
+		}
+
 		// Add currentReviewer as reviewers and create new notification.
 		reviewedReviewers.Insert(currentReviewer)
 		newMsg, err := getMessage(reviewedReviewers.List(), config.CommandHelpLink, config.PRProcessLink, tichiURL, org, repo)
@@ -326,6 +342,76 @@ func updateLabels(gc githubClient, log *logrus.Entry, org, repo string, number i
 	return gc.AddLabel(org, repo, number, nextLabel)
 }
 
+// loadAffiliations returns the affiliations of the reviewers, the key is the normalized GitHub login.
+func loadAffiliations(opts *tiexternalplugins.TiCommunityLgtm, org string,
+	gc githubClient, log *logrus.Entry) map[string]string {
+	affiliations := make(map[string]string)
+
+	for _, slug := range opts.AffiliationTeams {
+		members, err := gc.ListTeamMembersBySlug(org, slug, github.RoleAll)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to list the members of team %s.", slug)
+			continue
+		}
+
+		for _, member := range members {
+			login := github.NormLogin(member.Login)
+			if _, ok := affiliations[login]; !ok {
+				affiliations[login] = slug
+			}
+		}
+	}
+
+	// The explicit affiliations take precedence over the team membership.
+	for login, affiliation := range opts.Affiliations {
+		affiliations[github.NormLogin(login)] = affiliation
+	}
+
+	return affiliations
+}
+
+// checkApprovalDiversity returns the reason why the approval of the current reviewer cannot be counted,
+// it returns an empty string if the approval satisfies the approval diversity rules.
+func checkApprovalDiversity(opts *tiexternalplugins.TiCommunityLgtm, affiliations map[string]string,
+	issueAuthor, currentReviewer string, reviewedReviewers sets.String, nextLabel string, needsLgtm int) string {
+	affiliationOf := func(login string) string {
+		if affiliation, ok := affiliations[github.NormLogin(login)]; ok {
+			return affiliation
+		}
+		// Reviewers without an affiliation are treated as an affiliation of their own.
+		return github.NormLogin(login)
+	}
+
+	if opts.CountAuthorAffiliationOnce {
+		authorAffiliation, ok := affiliations[github.NormLogin(issueAuthor)]
+		if ok && affiliationOf(currentReviewer) == authorAffiliation {
+			for _, reviewer := range reviewedReviewers.List() {
+				if affiliationOf(reviewer) == authorAffiliation {
+					return fmt.Sprintf("Thanks for your review. The approvals from the members of `%s`, "+
+						"which the PR author belongs to, are only counted once.", authorAffiliation)
+				}
+			}
+		}
+	}
+
+	nextLgtmNumber, _ := strconv.Atoi(strings.TrimPrefix(nextLabel, tiexternalplugins.LgtmLabelPrefix))
+	if opts.RequiredAffiliationCount > 0 && nextLgtmNumber >= needsLgtm {
+		approvedAffiliations := sets.NewString(affiliationOf(currentReviewer))
+		for _, reviewer := range reviewedReviewers.List() {
+			approvedAffiliations.Insert(affiliationOf(reviewer))
+		}
+
+		if approvedAffiliations.Len() < opts.RequiredAffiliationCount {
+			return fmt.Sprintf("Thanks for your review. The approvals of this pull request must come from "+
+				"at least %d different teams or companies, but currently only from %d (%s).",
+				opts.RequiredAffiliationCount, approvedAffiliations.Len(),
+				strings.Join(approvedAffiliations.List(), ", "))
+		}
+	}
+
+	return ""
+}
+
 // getReviewersFromNotification get the reviewers from latest notification.
 func getReviewersFromNotification(latestNotification *github.IssueComment) sets.String {
 	result := sets.String{}
@@ -3,6 +3,7 @@ package lgtm
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
 	"sync"
@@ -55,6 +56,8 @@ type fakeGithubClient struct {
 
 	PullRequests  map[int]*github.PullRequest
 	Collaborators []string
+	// team slug -> members
+	TeamMembers map[string][]github.TeamMember
 
 	// lock to be thread safe
 	lock sync.RWMutex
@@ -183,6 +186,17 @@ func (f *fakeGithubClient) BotUserChecker() (func(candidate string) bool, error)
 	}, nil
 }
 
+// ListTeamMembersBySlug lists the members of the team.
+func (f *fakeGithubClient) ListTeamMembersBySlug(_, teamSlug, _ string) ([]github.TeamMember, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	members, ok := f.TeamMembers[teamSlug]
+	if !ok {
+		return nil, fmt.Errorf("team %s not found", teamSlug)
+	}
+	return members, nil
+}
+
 func getNotificationMessage(reviewers []string) string {
 	ownersLink := fmt.Sprintf(ownersclient.OwnersURLFmt, "https://prow-dev.tidb.net/tichi", "org", "repo", 5)
 	message, err := getMessage(reviewers,
@@ -513,6 +527,178 @@ func TestLGTMFromApproveReview(t *testing.T) {
 	}
 }
 
+func TestLGTMWithApprovalDiversity(t *testing.T) {
+	var testcases = []struct {
+		name                       string
+		reviewedReviewers          []string
+		reviewer                   string
+		currentLabel               string
+		requiredAffiliationCount   int
+		countAuthorAffiliationOnce bool
+
+		expectLabelsAdded   []string
+		expectLabelsRemoved []string
+		expectReviewers     []string
+		expectReplyContains string
+	}{
+		{
+			name:                       "First approval from the author's team",
+			reviewer:                   "pingcap1",
+			countAuthorAffiliationOnce: true,
+			expectLabelsAdded:          []string{"org/repo#5:" + lgtmOne},
+			expectReviewers:            []string{"pingcap1"},
+		},
+		{
+			name:                       "Second approval from the author's team",
+			reviewedReviewers:          []string{"pingcap1"},
+			reviewer:                   "pingcap2",
+			currentLabel:               lgtmOne,
+			countAuthorAffiliationOnce: true,
+			expectReviewers:            []string{"pingcap1"},
+			expectReplyContains: "The approvals from the members of `pingcap`, which the PR author belongs to, " +
+				"are only counted once.",
+		},
+		{
+			name:                       "Second approval from another team",
+			reviewedReviewers:          []string{"pingcap1"},
+			reviewer:                   "other1",
+			currentLabel:               lgtmOne,
+			countAuthorAffiliationOnce: true,
+			expectLabelsAdded:          []string{"org/repo#5:" + lgtmTwo},
+			expectLabelsRemoved:        []string{"org/repo#5:" + lgtmOne},
+			expectReviewers:            []string{"other1", "pingcap1"},
+		},
+		{
+			name:                     "Final approval from the same team",
+			reviewedReviewers:        []string{"other1"},
+			reviewer:                 "other2",
+			currentLabel:             lgtmOne,
+			requiredAffiliationCount: 2,
+			expectReviewers:          []string{"other1"},
+			expectReplyContains: "must come from at least 2 different teams or companies, " +
+				"but currently only from 1 (other-company).",
+		},
+		{
+			name:                     "Final approval from the different team",
+			reviewedReviewers:        []string{"other1"},
+			reviewer:                 "pingcap1",
+			currentLabel:             lgtmOne,
+			requiredAffiliationCount: 2,
+			expectLabelsAdded:        []string{"org/repo#5:" + lgtmTwo},
+			expectLabelsRemoved:      []string{"org/repo#5:" + lgtmOne},
+			expectReviewers:          []string{"other1", "pingcap1"},
+		},
+		{
+			name:                     "Final approval from the reviewer without affiliation",
+			reviewedReviewers:        []string{"other1"},
+			reviewer:                 "individual",
+			currentLabel:             lgtmOne,
+			requiredAffiliationCount: 2,
+			expectLabelsAdded:        []string{"org/repo#5:" + lgtmTwo},
+			expectLabelsRemoved:      []string{"org/repo#5:" + lgtmOne},
+			expectReviewers:          []string{"individual", "other1"},
+		},
+		{
+			name:                     "First approval is not limited by the required affiliation count",
+			reviewer:                 "other1",
+			requiredAffiliationCount: 2,
+			expectLabelsAdded:        []string{"org/repo#5:" + lgtmOne},
+			expectReviewers:          []string{"other1"},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			var comments []github.IssueComment
+			if len(tc.reviewedReviewers) != 0 {
+				comments = append(comments, github.IssueComment{
+					ID:   1000,
+					User: github.User{Login: botName},
+					Body: getNotificationMessage(tc.reviewedReviewers),
+				})
+			}
+			fc := &fakeGithubClient{
+				IssueComments: map[int][]github.IssueComment{
+					5: comments,
+				},
+				IssueLabelsExisting: []string{},
+				IssueLabelsAdded:    []string{},
+				IssueLabelsRemoved:  []string{},
+				TeamMembers: map[string][]github.TeamMember{
+					"pingcap": {{Login: "author"}, {Login: "pingcap1"}, {Login: "Pingcap2"}},
+				},
+			}
+			if tc.currentLabel != "" {
+				fc.IssueLabelsExisting = append(fc.IssueLabelsExisting, "org/repo#5:"+tc.currentLabel)
+			}
+			e := &github.ReviewEvent{
+				Action: github.ReviewActionSubmitted,
+				Review: github.Review{
+					State:   github.ReviewStateApproved,
+					HTMLURL: "<url>",
+					User:    github.User{Login: tc.reviewer},
+				},
+				PullRequest: github.PullRequest{
+					User:   github.User{Login: "author"},
+					Number: 5,
+				},
+				Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+
+			cfg := &externalplugins.Configuration{}
+			cfg.CommandHelpLink = "https://prow-dev.tidb.net/command-help"
+			cfg.PRProcessLink = "https://book.prow.tidb.net/#/en/workflows/pr"
+			cfg.TichiWebURL = "https://prow-dev.tidb.net/tichi"
+			cfg.TiCommunityLgtm = []externalplugins.TiCommunityLgtm{
+				{
+					Repos:              []string{"org/repo"},
+					PullOwnersEndpoint: "https://fake/ti-community-bot",
+					Affiliations: map[string]string{
+						"other1": "other-company",
+						"other2": "other-company",
+					},
+					AffiliationTeams:           []string{"pingcap"},
+					RequiredAffiliationCount:   tc.requiredAffiliationCount,
+					CountAuthorAffiliationOnce: tc.countAuthorAffiliationOnce,
+				},
+			}
+
+			foc := &fakeOwnersClient{
+				reviewers: []string{"pingcap1", "pingcap2", "other1", "other2", "individual"},
+				needsLgtm: 2,
+			}
+
+			if err := HandlePullReviewEvent(fc, e, cfg, foc, logrus.WithField("plugin", PluginName)); err != nil {
+				t.Fatalf("didn't expect error from pull request review: %v", err)
+			}
+
+			if !reflect.DeepEqual(fc.IssueLabelsAdded, append([]string{}, tc.expectLabelsAdded...)) {
+				t.Errorf("labels added mismatch: got %v, want %v", fc.IssueLabelsAdded, tc.expectLabelsAdded)
+			}
+			if !reflect.DeepEqual(fc.IssueLabelsRemoved, append([]string{}, tc.expectLabelsRemoved...)) {
+				t.Errorf("labels removed mismatch: got %v, want %v", fc.IssueLabelsRemoved, tc.expectLabelsRemoved)
+			}
+
+			notification := fc.IssueComments[5][0]
+			if notification.Body != getNotificationMessage(tc.expectReviewers) {
+				t.Errorf("notification mismatch: got %q, want reviewers %v", notification.Body, tc.expectReviewers)
+			}
+
+			var reply string
+			if len(fc.IssueComments[5]) > 1 {
+				reply = fc.IssueComments[5][1].Body
+			}
+			if tc.expectReplyContains == "" && reply != "" {
+				t.Errorf("unexpected reply %q", reply)
+			}
+			if !strings.Contains(reply, tc.expectReplyContains) {
+				t.Errorf("reply mismatch: got %q, want it contains %q", reply, tc.expectReplyContains)
+			}
+		})
+	}
+}
+
 func TestHandlePullRequest(t *testing.T) {
 	SHA := "0bd3ed50c88cd53a09316bf7a298f900e9371652"
 
@@ -2,10 +2,13 @@
 package merge
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/sirupsen/logrus"
 	"github.com/ti-community-infra/tichi/internal/pkg/ownersclient"
@@ -22,19 +25,28 @@ import (
 // PluginName will register into prow.
 const PluginName = "ti-community-merge"
 
-const githubUpdateCommitter = "web-flow"
-
 var (
 	addCanMergeLabelNotification = "This pull request has been accepted and is ready to merge. " +
 		"<details>Commit hash: %s</details>"
 	addCanMergeLabelNotificationRe = regexp.MustCompile(fmt.Sprintf(addCanMergeLabelNotification, "(.*)"))
-	configInfoStoreTreeHash        = `Commits that generated by Github will not remove the 'can-merge' label.`
+	// canMergeStateMarker is the hidden marker in the notification that stores the state of the approved code.
+	canMergeStateMarker     = "<!--Can Merge State sha=%s patch-id=%s-->"
+	canMergeStateMarkerRe   = regexp.MustCompile(`<!--Can Merge State sha=(\w+) patch-id=(\w+)-->`)
+	configInfoStoreTreeHash = `New commits that do not change the code of the pull request, ` +
+		`such as updating the base branch, will not remove the 'can-merge' label.`
+	configInfoRequiredContexts = `The 'can-merge' label will be added after the required contexts pass: %s.`
+	configInfoFreezeWindows    = "`/merge` is rejected during the merge freezes:"
+	configInfoReleaseApproval  = "`/merge` on the branches matching `%s` requires the approval " +
+		"of the release managers: %s."
 
 	// CanMergeRe is the regex that matches merge comments
 	CanMergeRe = regexp.MustCompile(`(?mi)^/merge\s*$`)
 	// CanMergeCancelRe is the regex that matches merge cancel comments
 	CanMergeCancelRe        = regexp.MustCompile(`(?mi)^/merge cancel\s*$`)
 	removeCanMergeLabelNoti = "Merge canceled because a new commit is pushed."
+
+	removeReleaseApprovedLabelNoti = "The approval of the release managers is canceled because a new commit " +
+		"is pushed, please ask them to approve it again by `/approve-release`."
 )
 
 // HelpProvider constructs the PluginHelp for this plugin that takes into account enabled repositories.
@@ -52,6 +64,25 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 				configInfoStrings = append(configInfoStrings, "<li>"+configInfoStoreTreeHash+"</li>")
 				isConfigured = true
 			}
+			if len(opts.RequiredContexts) != 0 {
+				configInfoStrings = append(configInfoStrings, "<li>"+fmt.Sprintf(configInfoRequiredContexts,
+					strings.Join(opts.RequiredContexts, ", "))+"</li>")
+				isConfigured = true
+			}
+			if len(opts.FreezeWindows) != 0 {
+				configInfoStrings = append(configInfoStrings, "<li>"+configInfoFreezeWindows+"<ul>")
+				for _, window := range opts.FreezeWindows {
+					configInfoStrings = append(configInfoStrings, "<li>"+describeFreezeWindow(window)+"</li>")
+				}
+				configInfoStrings = append(configInfoStrings, "</ul></li>")
+				isConfigured = true
+			}
+			for i := range opts.ReleaseApprovalRules {
+				rule := &opts.ReleaseApprovalRules[i]
+				configInfoStrings = append(configInfoStrings, "<li>"+fmt.Sprintf(configInfoReleaseApproval,
+					strings.Join(rule.Branches, "`, `"), describeReleaseManagers(repo.Org, rule))+"</li>")
+				isConfigured = true
+			}
 			configInfoStrings = append(configInfoStrings, "</ul>")
 			if isConfigured {
 				configInfo[repo.String()] = strings.Join(configInfoStrings, "\n")
@@ -78,6 +109,8 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 				tiexternalplugins.IssueCommentEvent,
 				tiexternalplugins.PullRequestReviewCommentEvent,
 				tiexternalplugins.PullRequestEvent,
+				tiexternalplugins.StatusEvent,
+				tiexternalplugins.CheckRunEvent,
 			},
 		}
 
@@ -90,6 +123,22 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 				"/merge",
 				"/merge cancel"},
 		})
+		pluginHelp.AddCommand(pluginhelp.Command{
+			Usage:       "/freeze-status",
+			Description: "Show the active merge freezes and whether the base branch of the PR is frozen.",
+			Featured:    false,
+			WhoCanUse:   "Anyone can use it.",
+			Examples:    []string{"/freeze-status"},
+		})
+		pluginHelp.AddCommand(pluginhelp.Command{
+			Usage:       "/approve-release [cancel]",
+			Description: "Approve or cancel the approval of the merge into the release branch.",
+			Featured:    false,
+			WhoCanUse:   "The release managers of the base branch.",
+			Examples: []string{
+				"/approve-release",
+				"/approve-release cancel"},
+		})
 		return pluginHelp, nil
 	}
 }
@@ -103,7 +152,13 @@ type githubClient interface {
 	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error)
 	DeleteComment(org, repo string, ID int) error
 	ListPRCommits(org, repo string, number int) ([]github.RepositoryCommit, error)
+	GetPullRequestChanges(org, repo string, number int) ([]github.PullRequestChange, error)
 	BotUserChecker() (func(candidate string) bool, error)
+	EditComment(org, repo string, id int, comment string) error
+	GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error)
+	ListCheckRuns(org, repo, ref string) (*github.CheckRunList, error)
+	FindIssuesWithOrg(org, query, sort string, asc bool) ([]github.Issue, error)
+	TeamBySlugHasMember(org string, teamSlug string, memberLogin string) (bool, error)
 }
 
 // reviewCtx contains information about each review event.
@@ -121,7 +176,7 @@ type commentPruner interface {
 // HandleIssueCommentEvent handles a GitHub issue comment event and adds or removes a
 // "status/can-merge" label.
 func HandleIssueCommentEvent(gc githubClient, ice *github.IssueCommentEvent, cfg *tiexternalplugins.Configuration,
-	ol ownersclient.OwnersLoader, cp commentPruner, log *logrus.Entry) error {
+	ol ownersclient.OwnersLoader, cp commentPruner, al AuditLogger, log *logrus.Entry) error {
 	// Only consider open PRs and new comments.
 	if !ice.Issue.IsPullRequest() || ice.Issue.State != "open" || ice.Action != github.IssueCommentActionCreated {
 		return nil
@@ -136,6 +191,14 @@ func HandleIssueCommentEvent(gc githubClient, ice *github.IssueCommentEvent, cfg
 		number:      ice.Issue.Number,
 	}
 
+	if FreezeStatusRe.MatchString(rc.body) {
+		return handleFreezeStatus(gc, cfg.MergeFor(rc.repo.Owner.Login, rc.repo.Name), rc, log)
+	}
+	if ApproveReleaseRe.MatchString(rc.body) || ApproveReleaseCancelRe.MatchString(rc.body) {
+		return handleApproveRelease(ApproveReleaseRe.MatchString(rc.body), gc,
+			cfg.MergeFor(rc.repo.Owner.Login, rc.repo.Name), rc, al, log)
+	}
+
 	// If we create an "/merge" comment, add status/can-merge if necessary.
 	// If we create a "/merge cancel" comment, remove status/can-merge if necessary.
 	wantMerge := false
@@ -148,11 +211,12 @@ func HandleIssueCommentEvent(gc githubClient, ice *github.IssueCommentEvent, cfg
 	}
 
 	// Use common handler to do the rest.
-	return handle(wantMerge, cfg, rc, gc, ol, cp, log)
+	return handle(wantMerge, cfg, rc, gc, ol, cp, al, log)
 }
 
 func HandlePullReviewCommentEvent(gc githubClient, pullReviewCommentEvent *github.ReviewCommentEvent,
-	cfg *tiexternalplugins.Configuration, ol ownersclient.OwnersLoader, cp commentPruner, log *logrus.Entry) error {
+	cfg *tiexternalplugins.Configuration, ol ownersclient.OwnersLoader, cp commentPruner, al AuditLogger,
+	log *logrus.Entry) error {
 	// Only consider open PRs and new comments.
 	if pullReviewCommentEvent.PullRequest.State != "open" ||
 		pullReviewCommentEvent.Action != github.ReviewCommentActionCreated {
@@ -168,6 +232,14 @@ func HandlePullReviewCommentEvent(gc githubClient, pullReviewCommentEvent *githu
 		number:      pullReviewCommentEvent.PullRequest.Number,
 	}
 
+	if FreezeStatusRe.MatchString(rc.body) {
+		return handleFreezeStatus(gc, cfg.MergeFor(rc.repo.Owner.Login, rc.repo.Name), rc, log)
+	}
+	if ApproveReleaseRe.MatchString(rc.body) || ApproveReleaseCancelRe.MatchString(rc.body) {
+		return handleApproveRelease(ApproveReleaseRe.MatchString(rc.body), gc,
+			cfg.MergeFor(rc.repo.Owner.Login, rc.repo.Name), rc, al, log)
+	}
+
 	// If we create an "/merge" comment, add status/can-merge if necessary.
 	// If we create a "/merge cancel" comment, remove status/can-merge if necessary.
 	wantMerge := false
@@ -180,87 +252,102 @@ func HandlePullReviewCommentEvent(gc githubClient, pullReviewCommentEvent *githu
 	}
 
 	// Use common handler to do the rest.
-	return handle(wantMerge, cfg, rc, gc, ol, cp, log)
+	return handle(wantMerge, cfg, rc, gc, ol, cp, al, log)
 }
 
 func HandlePullRequestEvent(gc githubClient, pe *github.PullRequestEvent,
-	cfg *tiexternalplugins.Configuration, log *logrus.Entry) error {
+	cfg *tiexternalplugins.Configuration, al AuditLogger, log *logrus.Entry) error {
 	if pe.PullRequest.Merged {
 		return nil
 	}
 
-	if pe.Action != github.PullRequestActionSynchronize {
-		return nil
-	}
-
 	org := pe.PullRequest.Base.Repo.Owner.Login
 	repo := pe.PullRequest.Base.Repo.Name
 	number := pe.PullRequest.Number
 
 	opts := cfg.MergeFor(org, repo)
 
-	// If we don't have the 'status/can-merge' label, we don't need to check anything.
+	if pe.Action == github.PullRequestActionLabeled && len(opts.ReleaseApprovalRules) != 0 {
+		return handleReleaseApprovedLabeled(gc, pe, opts, log)
+	}
+
+	if pe.Action != github.PullRequestActionSynchronize {
+		return nil
+	}
+
+	// Cancel the merge request which is waiting for the required contexts of the old commits.
+	if len(opts.RequiredContexts) != 0 {
+		gate, err := cancelMergeGate(gc, org, repo, number, "canceled because a new commit is pushed", log)
+		if err != nil {
+			log.WithError(err).Error("Failed to cancel the merge gate.")
+		}
+		if gate != nil {
+			recordAudit(al, gc, &AuditRecord{
+				Action: AuditActionAutoRemoval, Actor: pe.Sender.Login, Org: org, Repo: repo, Number: number,
+				SHA: pe.PullRequest.Head.SHA, Reason: gate.reason,
+			}, log)
+		}
+	}
+
+	// If we don't have the 'status/can-merge' label or the release approved label, we don't need to check anything.
 	labels, err := gc.GetIssueLabels(org, repo, number)
 	if err != nil {
 		log.WithError(err).Error("Failed to get labels.")
 	}
-	hasCanMerge := false
-	for _, label := range labels {
-		if label.Name == tiexternalplugins.CanMergeLabel {
-			hasCanMerge = true
-		}
+	hasCanMerge := hasLabel(labels, tiexternalplugins.CanMergeLabel)
+	// The release managers approve the code, so the approval is also canceled when the code is changed.
+	var releaseApprovedLabel string
+	if rule := opts.ReleaseApprovalRuleFor(pe.PullRequest.Base.Ref); rule != nil && hasLabel(labels, rule.ApprovedLabel) {
+		releaseApprovedLabel = rule.ApprovedLabel
 	}
-	if !hasCanMerge {
+	if !hasCanMerge && releaseApprovedLabel == "" {
 		return nil
 	}
 
 	if opts.StoreTreeHash {
-		// Check if we have a tree-hash comment.
-		var lastCanMergeTreeHash string
-		botUserChecker, err := gc.BotUserChecker()
-		if err != nil {
-			return err
-		}
-		comments, err := gc.ListIssueComments(org, repo, number)
+		unchanged, err := isCodeUnchanged(gc, org, repo, number, pe.PullRequest.Head.SHA, log)
 		if err != nil {
-			log.WithError(err).Error("Failed to get issue comments.")
+			log.WithError(err).Error("Failed to check if the code of the pull request is changed.")
 		}
-		// Older comments are still present
-		// iterate backwards to find the last 'can-merge' tree-hash.
-		for i := len(comments) - 1; i >= 0; i-- {
-			comment := comments[i]
-			m := addCanMergeLabelNotificationRe.FindStringSubmatch(comment.Body)
-			if botUserChecker(comment.User.Login) && m != nil && comment.UpdatedAt.Equal(comment.CreatedAt) {
-				lastCanMergeTreeHash = m[1]
-				break
-			}
+		// Don't remove the label, PR code hasn't changed.
+		if unchanged {
+			return nil
 		}
-		if lastCanMergeTreeHash != "" {
-			prCommits, err := gc.ListPRCommits(org, repo, number)
-			if err != nil {
-				log.WithField("sha", pe.PullRequest.Head.SHA).WithError(err).Error("Failed to get PR's commits.")
-			}
+	}
 
-			// Don't remove the label, PR code hasn't changed.
-			if isAllGuaranteed(prCommits, lastCanMergeTreeHash, log) {
-				return nil
-			}
+	var notifications []string
+	if hasCanMerge {
+		if err := gc.RemoveLabel(org, repo, number, tiexternalplugins.CanMergeLabel); err != nil {
+			return fmt.Errorf("failed to remove 'can-merge' label: %v", err)
 		}
+		recordAudit(al, gc, &AuditRecord{
+			Action: AuditActionAutoRemoval, Actor: pe.Sender.Login, Org: org, Repo: repo, Number: number,
+			SHA: pe.PullRequest.Head.SHA, Reason: "a new commit is pushed",
+		}, log)
+		notifications = append(notifications, removeCanMergeLabelNoti)
 	}
-
-	if err := gc.RemoveLabel(org, repo, number, tiexternalplugins.CanMergeLabel); err != nil {
-		return fmt.Errorf("failed to remove 'can-merge' label: %v", err)
+	if releaseApprovedLabel != "" {
+		log.Info("Removing '" + releaseApprovedLabel + "' label.")
+		if err := gc.RemoveLabel(org, repo, number, releaseApprovedLabel); err != nil {
+			return fmt.Errorf("failed to remove '%s' label: %v", releaseApprovedLabel, err)
+		}
+		recordAudit(al, gc, &AuditRecord{
+			Action: AuditActionAutoRemoval, Actor: pe.Sender.Login, Org: org, Repo: repo, Number: number,
+			SHA: pe.PullRequest.Head.SHA, Reason: "the release approval is canceled because a new commit is pushed",
+		}, log)
+		notifications = append(notifications, removeReleaseApprovedLabelNoti)
 	}
 
-	// Create a comment to inform participants that 'can-merge' label is removed due to new
+	// Create a comment to inform participants that the labels are removed due to new
 	// pull request changes.
-	log.Infof("Commenting a 'can-merge' removal notification to %s/%s#%d and with the message: %s",
-		org, repo, number, removeCanMergeLabelNoti)
-	return gc.CreateComment(org, repo, number, removeCanMergeLabelNoti)
+	msg := strings.Join(notifications, " ")
+	log.Infof("Commenting a label removal notification to %s/%s#%d and with the message: %s",
+		org, repo, number, msg)
+	return gc.CreateComment(org, repo, number, msg)
 }
 
 func handle(wantMerge bool, config *tiexternalplugins.Configuration, rc reviewCtx,
-	gc githubClient, ol ownersclient.OwnersLoader, cp commentPruner, log *logrus.Entry) error {
+	gc githubClient, ol ownersclient.OwnersLoader, cp commentPruner, al AuditLogger, log *logrus.Entry) error {
 	author := rc.author
 	issueAuthor := rc.issueAuthor
 	number := rc.number
@@ -289,6 +376,10 @@ func handle(wantMerge bool, config *tiexternalplugins.Configuration, rc reviewCt
 		resp += "you can assign this pull request to the committer in [list](" + tichiURL + ") "
 		resp += "by filling `/assign @committer` in the comment to help merge this pull request."
 		log.Infof("Reply /merge request in comment: \"%s\"", resp)
+		recordAudit(al, gc, &AuditRecord{
+			Action: AuditActionRejection, Actor: author, Org: org, Repo: repoName, Number: number,
+			Reason: "`/merge` is only allowed for the committers", Owners: owners,
+		}, log)
 		return gc.CreateComment(org, repoName, number, tiexternalplugins.FormatResponseRaw(body, htmlURL, author, resp))
 	}
 
@@ -296,6 +387,10 @@ func handle(wantMerge bool, config *tiexternalplugins.Configuration, rc reviewCt
 	if !committers.Has(author) && !isAuthor && !wantMerge {
 		resp := "`/merge cancel` is only allowed for the PR author and the committers in [list](" + tichiURL + ")."
 		log.Infof("Reply /merge cancel request with comment: \"%s\"", resp)
+		recordAudit(al, gc, &AuditRecord{
+			Action: AuditActionRejection, Actor: author, Org: org, Repo: repoName, Number: number,
+			Reason: "`/merge cancel` is only allowed for the PR author and the committers", Owners: owners,
+		}, log)
 		return gc.CreateComment(org, repoName, number, tiexternalplugins.FormatResponseRaw(body, htmlURL, author, resp))
 	}
 
@@ -314,40 +409,85 @@ func handle(wantMerge bool, config *tiexternalplugins.Configuration, rc reviewCt
 
 	isSatisfy := isLGTMSatisfy(tiexternalplugins.LgtmLabelPrefix, labels, owners.NeedsLgtm)
 
+	// Cancel the merge request which is waiting for the required contexts.
+	if !wantMerge && len(opts.RequiredContexts) != 0 {
+		gate, err := cancelMergeGate(gc, org, repoName, number, fmt.Sprintf("canceled by @%s", author), log)
+		if err != nil {
+			return err
+		}
+		if gate != nil && !hasCanMerge {
+			recordAudit(al, gc, &AuditRecord{
+				Action: AuditActionCancel, Actor: author, Org: org, Repo: repoName, Number: number,
+				SHA: gate.sha, Reason: "the waiting merge request is canceled", Owners: owners,
+			}, log)
+		}
+	}
+
 	// Remove the label if necessary, we're done after this.
 	if hasCanMerge && !wantMerge {
 		log.Info("Removing '" + tiexternalplugins.CanMergeLabel + "' label.")
 		if err := gc.RemoveLabel(org, repoName, number, tiexternalplugins.CanMergeLabel); err != nil {
 			return err
 		}
+		recordAudit(al, gc, &AuditRecord{
+			Action: AuditActionCancel, Actor: author, Org: org, Repo: repoName, Number: number,
+			Reason: "the '" + tiexternalplugins.CanMergeLabel + "' label is removed", Owners: owners,
+		}, log)
 		if opts.StoreTreeHash {
 			cp.PruneComments(func(comment github.IssueComment) bool {
 				return addCanMergeLabelNotificationRe.MatchString(comment.Body)
 			})
 		}
 	} else if !hasCanMerge && wantMerge {
+		var pr *github.PullRequest
+		if len(opts.FreezeWindows) != 0 || len(opts.ReleaseApprovalRules) != 0 {
+			pr, err = gc.GetPullRequest(org, repoName, number)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Reject the merge request if the base branch is frozen.
+		if len(opts.FreezeWindows) != 0 {
+			if windows := listFreezeWindows(gc, opts, org, pr.Base.Ref, author, timeNow(), log); len(windows) != 0 {
+				resp := fmt.Sprintf("`/merge` is rejected because the `%s` branch is frozen:\n\n%s",
+					pr.Base.Ref, describeFreezeWindows(windows))
+				log.Infof("Reply /merge request with comment: \"%s\"", resp)
+				recordAudit(al, gc, &AuditRecord{
+					Action: AuditActionRejection, Actor: author, Org: org, Repo: repoName, Number: number,
+					SHA: pr.Head.SHA, Reason: fmt.Sprintf("the `%s` branch is frozen", pr.Base.Ref), Owners: owners,
+				}, log)
+				return gc.CreateComment(org, repoName, number, tiexternalplugins.FormatResponseRaw(body, htmlURL, author, resp))
+			}
+		}
+
+		// Reject the merge request if the release managers have not approved it.
+		if len(opts.ReleaseApprovalRules) != 0 {
+			if rule := opts.ReleaseApprovalRuleFor(pr.Base.Ref); rule != nil && !hasLabel(labels, rule.ApprovedLabel) {
+				resp := fmt.Sprintf("`/merge` on the `%s` branch requires the approval of the release managers: %s, "+
+					"please ask them to approve it by `/approve-release`.", pr.Base.Ref, describeReleaseManagers(org, rule))
+				log.Infof("Reply /merge request with comment: \"%s\"", resp)
+				recordAudit(al, gc, &AuditRecord{
+					Action: AuditActionRejection, Actor: author, Org: org, Repo: repoName, Number: number,
+					SHA: pr.Head.SHA, Reason: "the release managers have not approved it", Owners: owners,
+				}, log)
+				return gc.CreateComment(org, repoName, number, tiexternalplugins.FormatResponseRaw(body, htmlURL, author, resp))
+			}
+		}
+
 		if isSatisfy {
-			// Store the tree hash.
-			if opts.StoreTreeHash {
-				pr, err := gc.GetPullRequest(org, repoName, number)
-				if err != nil {
-					log.WithError(err).Error("Failed to get pull request.")
-				}
-				prCommits, err := gc.ListPRCommits(org, repoName, number)
-				if err != nil {
-					log.WithField("sha", pr.Head.SHA).WithError(err).Error("Failed to get commit.")
-				}
-				// Store the last commit hash.
-				treeHash := prCommits[len(prCommits)-1].SHA
-				log.WithField("tree", treeHash).Info("Adding comment to store tree-hash.")
-				if err := gc.CreateComment(org, repoName, number, fmt.Sprintf(addCanMergeLabelNotification, treeHash)); err != nil {
-					log.WithError(err).Error("Failed to add comment.")
-				}
+			// Wait for the required contexts to pass before adding the label.
+			if len(opts.RequiredContexts) != 0 {
+				return requestMergeGate(gc, opts, al, owners, org, repoName, number, author, log)
 			}
-			log.Info("Adding '" + tiexternalplugins.CanMergeLabel + "' label.")
-			if err := gc.AddLabel(org, repoName, number, tiexternalplugins.CanMergeLabel); err != nil {
+
+			if _, err := addCanMergeLabel(gc, opts, org, repoName, number, "", log); err != nil {
 				return err
 			}
+			recordAudit(al, gc, &AuditRecord{
+				Action: AuditActionMerge, Actor: author, Org: org, Repo: repoName, Number: number,
+				Reason: fmt.Sprintf("approved with the required %d approval(s)", owners.NeedsLgtm), Owners: owners,
+			}, log)
 			// Delete the 'status/can-merge' removed noti after the 'status/can-merge' label is added.
 			cp.PruneComments(func(comment github.IssueComment) bool {
 				return strings.Contains(comment.Body, removeCanMergeLabelNoti)
@@ -355,6 +495,10 @@ func handle(wantMerge bool, config *tiexternalplugins.Configuration, rc reviewCt
 		} else {
 			resp := fmt.Sprintf("`/merge` in this pull request requires %d approval(s).", owners.NeedsLgtm)
 			log.Infof("Reply /merge request with comment: \"%s\"", resp)
+			recordAudit(al, gc, &AuditRecord{
+				Action: AuditActionRejection, Actor: author, Org: org, Repo: repoName, Number: number,
+				Reason: fmt.Sprintf("the required %d approval(s) are not satisfied", owners.NeedsLgtm), Owners: owners,
+			}, log)
 			return gc.CreateComment(org, repoName, number, tiexternalplugins.FormatResponseRaw(body, htmlURL, author, resp))
 		}
 	}
@@ -362,6 +506,40 @@ func handle(wantMerge bool, config *tiexternalplugins.Configuration, rc reviewCt
 	return nil
 }
 
+// addCanMergeLabel adds the 'status/can-merge' label, the tree hash will be stored before adding if necessary.
+// If sha is not empty, the label is only added when the head of the pull request is still the commit,
+// it returns false if the label is not added because new commits are pushed.
+func addCanMergeLabel(gc githubClient, opts *tiexternalplugins.TiCommunityMerge, org, repo string, number int,
+	sha string, log *logrus.Entry) (bool, error) {
+	var pr *github.PullRequest
+	if sha != "" || opts.StoreTreeHash {
+		var err error
+		pr, err = gc.GetPullRequest(org, repo, number)
+		if err != nil {
+			return false, err
+		}
+	}
+	if sha != "" && pr.Head.SHA != sha {
+		log.WithField("sha", sha).Infof("Skipping adding the label, the head is changed to %s.", pr.Head.SHA)
+		return false, nil
+	}
+
+	// Store the state of the approved code.
+	if opts.StoreTreeHash {
+		changes, err := gc.GetPullRequestChanges(org, repo, number)
+		if err != nil {
+			return false, err
+		}
+		state := canMergeState{sha: pr.Head.SHA, patchID: computePatchID(changes)}
+		log.WithField("sha", state.sha).WithField("patch-id", state.patchID).Info("Adding comment to store code state.")
+		if err := gc.CreateComment(org, repo, number, state.notification()); err != nil {
+			log.WithError(err).Error("Failed to add comment.")
+		}
+	}
+	log.Info("Adding '" + tiexternalplugins.CanMergeLabel + "' label.")
+	return true, gc.AddLabel(org, repo, number, tiexternalplugins.CanMergeLabel)
+}
+
 // isLGTMSatisfy returns pull request current label number.
 func isLGTMSatisfy(prefix string, labels []github.Label, needsLgtm int) bool {
 	currentLgtmNumber := 0
@@ -374,26 +552,109 @@ func isLGTMSatisfy(prefix string, labels []github.Label, needsLgtm int) bool {
 	return currentLgtmNumber >= needsLgtm
 }
 
-func isAllGuaranteed(prCommits []github.RepositoryCommit, lastCanMergeTreeHash string, log *logrus.Entry) bool {
-	guaranteed := true
+// canMergeState records the state of the code when the 'status/can-merge' label is added.
+type canMergeState struct {
+	sha     string
+	patchID string
+}
+
+// notification returns the body of the notification which stores the state.
+func (s *canMergeState) notification() string {
+	return fmt.Sprintf(addCanMergeLabelNotification, s.sha) + "\n" +
+		fmt.Sprintf(canMergeStateMarker, s.sha, s.patchID)
+}
 
-	// NOTICE: We use -1 here because it is possible that the user recommitted all commits.
-	lastGuaranteedIndex := -1
-	for i, commit := range prCommits {
-		if commit.SHA == lastCanMergeTreeHash {
-			lastGuaranteedIndex = i
+// findCanMergeState returns the state stored in the last notification, the patch id of the state
+// is empty if it is stored by the legacy notification which only contains the commit hash.
+func findCanMergeState(comments []github.IssueComment, botUserChecker func(candidate string) bool) *canMergeState {
+	// Older comments are still present
+	// iterate backwards to find the last stored state.
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := comments[i]
+		// The stored state can not be verified, anyone who can edit the comment can also forge it,
+		// so it is ignored once the comment is edited.
+		if !botUserChecker(comment.User.Login) || !comment.UpdatedAt.Equal(comment.CreatedAt) {
+			continue
+		}
+
+		if m := canMergeStateMarkerRe.FindStringSubmatch(comment.Body); m != nil {
+			return &canMergeState{sha: m[1], patchID: m[2]}
+		}
+		if m := addCanMergeLabelNotificationRe.FindStringSubmatch(comment.Body); m != nil {
+			return &canMergeState{sha: m[1]}
 		}
 	}
+	return nil
+}
 
-	unCheckCommits := prCommits[lastGuaranteedIndex+1:]
+// isCodeUnchanged returns true if the code of the pull request is the same as the code
+// when the 'status/can-merge' label was added.
+func isCodeUnchanged(gc githubClient, org, repo string, number int, headSHA string, log *logrus.Entry) (bool, error) {
+	botUserChecker, err := gc.BotUserChecker()
+	if err != nil {
+		return false, err
+	}
+	comments, err := gc.ListIssueComments(org, repo, number)
+	if err != nil {
+		return false, err
+	}
+	state := findCanMergeState(comments, botUserChecker)
+	if state == nil {
+		return false, nil
+	}
 
-	for _, commit := range unCheckCommits {
-		if commit.Committer.Login != githubUpdateCommitter {
-			guaranteed = false
-		} else {
-			log.Infof("Remove 'can-merge' label; the tree-hash is: %s", commit.SHA)
+	if state.sha == headSHA {
+		return true, nil
+	}
+
+	// The legacy notification only guarantees the commit itself.
+	if state.patchID == "" {
+		prCommits, err := gc.ListPRCommits(org, repo, number)
+		if err != nil {
+			return false, err
 		}
+		return len(prCommits) != 0 && prCommits[len(prCommits)-1].SHA == state.sha, nil
+	}
+
+	changes, err := gc.GetPullRequestChanges(org, repo, number)
+	if err != nil {
+		return false, err
+	}
+	patchID := computePatchID(changes)
+	if patchID != state.patchID {
+		log.Infof("The code is changed since %s, the patch id changes from %s to %s.", state.sha, state.patchID, patchID)
+		return false, nil
 	}
 
-	return guaranteed
+	log.Infof("The code is unchanged since %s, the patch id is %s.", state.sha, patchID)
+	return true, nil
+}
+
+// computePatchID returns the fingerprint of the changes of the pull request like `git patch-id --stable`,
+// the line numbers, context lines and trailing whitespaces are ignored so that updating the base branch or
+// rebasing without conflicts will not change it. The other whitespaces are significant in some languages,
+// so the changed lines are hashed verbatim.
+func computePatchID(changes []github.PullRequestChange) string {
+	sortedChanges := make([]github.PullRequestChange, len(changes))
+	copy(sortedChanges, changes)
+	sort.SliceStable(sortedChanges, func(i, j int) bool {
+		return sortedChanges[i].Filename < sortedChanges[j].Filename
+	})
+
+	h := sha256.New()
+	for _, change := range sortedChanges {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00", change.PreviousFilename, change.Filename, change.Status)
+		// The patch of the binary file or the large file is not returned, use the blob sha instead.
+		if change.Patch == "" {
+			fmt.Fprintf(h, "%s\x00", change.SHA)
+			continue
+		}
+		for _, line := range strings.Split(change.Patch, "\n") {
+			if !strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "-") {
+				continue
+			}
+			fmt.Fprintf(h, "%s\x00", strings.TrimRightFunc(line, unicode.IsSpace))
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
 }
@@ -0,0 +1,260 @@
+package merge
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/ownersclient"
+)
+
+// Possible actions of the audit record.
+const (
+	// AuditActionMerge means the 'status/can-merge' label is added.
+	AuditActionMerge = "merge"
+	// AuditActionMergeRequest means `/merge` is accepted and waits for the required contexts.
+	AuditActionMergeRequest = "merge_request"
+	// AuditActionCancel means the merge is canceled by `/merge cancel`.
+	AuditActionCancel = "cancel"
+	// AuditActionAutoRemoval means the merge is canceled by the bot, such as new commits are pushed.
+	AuditActionAutoRemoval = "auto_removal"
+	// AuditActionRejection means `/merge` or `/merge cancel` is rejected.
+	AuditActionRejection = "rejection"
+	// AuditActionReleaseApproval means the release managers approve or cancel the approval of the merge.
+	AuditActionReleaseApproval = "release_approval"
+)
+
+// maxAuditRecordSize is the max size of a line in the audit log file.
+const maxAuditRecordSize = 1024 * 1024
+
+// AuditRecord records an action on the merge process of a pull request.
+type AuditRecord struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Actor is the user who triggers the action, it is empty if the action is triggered by the bot.
+	Actor  string `json:"actor,omitempty"`
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	SHA    string `json:"sha,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Owners is the snapshot of the owners of the pull request when the action happens.
+	Owners *ownersclient.Owners `json:"owners,omitempty"`
+}
+
+// AuditQuery specifies the conditions to query the audit records, the empty fields are ignored.
+type AuditQuery struct {
+	Org    string
+	Repo   string
+	Number int
+	Actor  string
+	Action string
+	Since  time.Time
+	Until  time.Time
+	// Limit specifies the max number of the latest records returned.
+	Limit int
+}
+
+// match returns true if the record meets the conditions of the query.
+func (q *AuditQuery) match(record *AuditRecord) bool {
+	if q.Org != "" && q.Org != record.Org {
+		return false
+	}
+	if q.Repo != "" && q.Repo != record.Repo {
+		return false
+	}
+	if q.Number != 0 && q.Number != record.Number {
+		return false
+	}
+	if q.Actor != "" && q.Actor != record.Actor {
+		return false
+	}
+	if q.Action != "" && q.Action != record.Action {
+		return false
+	}
+	if !q.Since.IsZero() && record.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !record.Time.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// AuditLogger records the audit records.
+type AuditLogger interface {
+	Record(record *AuditRecord) error
+}
+
+// FileAuditStore is an append-only audit store that saves the records in a JSON lines file.
+type FileAuditStore struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewFileAuditStore returns an audit store which saves the records in the file.
+func NewFileAuditStore(path string) *FileAuditStore {
+	return &FileAuditStore{path: path}
+}
+
+// Record appends the record to the file.
+func (s *FileAuditStore) Record(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Query returns the records that meet the conditions in chronological order.
+func (s *FileAuditStore) Query(query *AuditQuery) ([]AuditRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	records := []AuditRecord{}
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxAuditRecordSize)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("broken audit record %q: %v", scanner.Text(), err)
+		}
+		if query.match(&record) {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if query.Limit > 0 && len(records) > query.Limit {
+		records = records[len(records)-query.Limit:]
+	}
+	return records, nil
+}
+
+// AuditResponse specifies the response to the request to query the audit records.
+type AuditResponse struct {
+	Data    []AuditRecord `json:"data,omitempty"`
+	Message string        `json:"message,omitempty"`
+}
+
+// AuditHandler serves the HTTP API to query the audit records, such as
+// GET /audit?org=ti-community-infra&repo=tichi&number=1&action=merge.
+type AuditHandler struct {
+	Store *FileAuditStore
+	Log   *logrus.Entry
+}
+
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeResponse(w, http.StatusMethodNotAllowed, &AuditResponse{Message: "Only GET is allowed."})
+		return
+	}
+
+	query, err := parseAuditQuery(r)
+	if err != nil {
+		h.writeResponse(w, http.StatusBadRequest, &AuditResponse{Message: err.Error()})
+		return
+	}
+
+	records, err := h.Store.Query(query)
+	if err != nil {
+		h.Log.WithError(err).Error("Failed to query the audit records.")
+		h.writeResponse(w, http.StatusInternalServerError, &AuditResponse{Message: "Failed to query the audit records."})
+		return
+	}
+	h.writeResponse(w, http.StatusOK, &AuditResponse{Data: records})
+}
+
+// writeResponse writes the response in JSON.
+func (h *AuditHandler) writeResponse(w http.ResponseWriter, code int, resp *AuditResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.Log.WithError(err).Error("Failed to write the audit response.")
+	}
+}
+
+// parseAuditQuery parses the query parameters of the request.
+func parseAuditQuery(r *http.Request) (*AuditQuery, error) {
+	values := r.URL.Query()
+	query := &AuditQuery{
+		Org:    values.Get("org"),
+		Repo:   values.Get("repo"),
+		Actor:  values.Get("actor"),
+		Action: values.Get("action"),
+	}
+
+	var err error
+	if number := values.Get("number"); number != "" {
+		if query.Number, err = strconv.Atoi(number); err != nil {
+			return nil, fmt.Errorf("invalid number %s", number)
+		}
+	}
+	if limit := values.Get("limit"); limit != "" {
+		if query.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, fmt.Errorf("invalid limit %s", limit)
+		}
+	}
+	if since := values.Get("since"); since != "" {
+		if query.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return nil, fmt.Errorf("invalid since %s, it should be in RFC 3339 format", since)
+		}
+	}
+	if until := values.Get("until"); until != "" {
+		if query.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return nil, fmt.Errorf("invalid until %s, it should be in RFC 3339 format", until)
+		}
+	}
+	return query, nil
+}
+
+// recordAudit records the action, the head SHA of the pull request is filled if it is missing.
+// The failure of recording is only logged, so it will not block the merge process.
+func recordAudit(al AuditLogger, gc githubClient, record *AuditRecord, log *logrus.Entry) {
+	if al == nil {
+		return
+	}
+
+	record.Time = timeNow()
+	if record.SHA == "" {
+		pr, err := gc.GetPullRequest(record.Org, record.Repo, record.Number)
+		if err != nil {
+			log.WithError(err).Warn("Failed to get the head SHA for the audit record.")
+		} else {
+			record.SHA = pr.Head.SHA
+		}
+	}
+
+	if err := al.Record(record); err != nil {
+		log.WithError(err).Error("Failed to record the audit record.")
+	}
+}
@@ -0,0 +1,321 @@
+package merge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"github.com/ti-community-infra/tichi/internal/pkg/ownersclient"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+)
+
+type fakeAuditLogger struct {
+	records []AuditRecord
+}
+
+func (f *fakeAuditLogger) Record(record *AuditRecord) error {
+	f.records = append(f.records, *record)
+	return nil
+}
+
+func auditRecords() []AuditRecord {
+	return []AuditRecord{
+		{
+			Time:   time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC),
+			Action: AuditActionRejection,
+			Actor:  "contributor",
+			Org:    "org",
+			Repo:   "repo",
+			Number: 1,
+			SHA:    "sha1",
+			Reason: "`/merge` is only allowed for the committers",
+		},
+		{
+			Time:   time.Date(2021, 6, 2, 10, 0, 0, 0, time.UTC),
+			Action: AuditActionMerge,
+			Actor:  "collab1",
+			Org:    "org",
+			Repo:   "repo",
+			Number: 1,
+			SHA:    "sha1",
+			Owners: &ownersclient.Owners{Committers: []string{"collab1"}, NeedsLgtm: 2},
+		},
+		{
+			Time:   time.Date(2021, 6, 3, 10, 0, 0, 0, time.UTC),
+			Action: AuditActionMerge,
+			Actor:  "collab2",
+			Org:    "org",
+			Repo:   "repo",
+			Number: 2,
+			SHA:    "sha2",
+		},
+	}
+}
+
+func TestFileAuditStore(t *testing.T) {
+	store := NewFileAuditStore(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+	records, err := store.Query(&AuditQuery{})
+	if err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(records) != 0 {
+		t.Fatalf("expected no records before recording, but got %v", records)
+	}
+
+	for _, record := range auditRecords() {
+		r := record
+		if err := store.Record(&r); err != nil {
+			t.Fatalf("didn't expect error: %v", err)
+		}
+	}
+
+	all := auditRecords()
+	var testcases = []struct {
+		name   string
+		query  AuditQuery
+		expect []AuditRecord
+	}{
+		{
+			name:   "all records",
+			query:  AuditQuery{},
+			expect: all,
+		},
+		{
+			name:   "records of a pull request",
+			query:  AuditQuery{Org: "org", Repo: "repo", Number: 1},
+			expect: all[:2],
+		},
+		{
+			name:   "records of an action",
+			query:  AuditQuery{Action: AuditActionMerge},
+			expect: all[1:],
+		},
+		{
+			name:   "records of an actor",
+			query:  AuditQuery{Actor: "collab2"},
+			expect: all[2:],
+		},
+		{
+			name: "records in a period",
+			query: AuditQuery{
+				Since: time.Date(2021, 6, 2, 10, 0, 0, 0, time.UTC),
+				Until: time.Date(2021, 6, 3, 10, 0, 0, 0, time.UTC),
+			},
+			expect: all[1:2],
+		},
+		{
+			name:   "latest records",
+			query:  AuditQuery{Limit: 1},
+			expect: all[2:],
+		},
+		{
+			name:   "no matched records",
+			query:  AuditQuery{Repo: "other"},
+			expect: []AuditRecord{},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			records, err := store.Query(&tc.query)
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+			if !reflect.DeepEqual(records, tc.expect) {
+				t.Errorf("records mismatch: got %v, want %v", records, tc.expect)
+			}
+		})
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	store := NewFileAuditStore(filepath.Join(t.TempDir(), "audit.jsonl"))
+	for _, record := range auditRecords() {
+		r := record
+		if err := store.Record(&r); err != nil {
+			t.Fatalf("didn't expect error: %v", err)
+		}
+	}
+	handler := &AuditHandler{Store: store, Log: logrus.WithField("plugin", PluginName)}
+
+	var testcases = []struct {
+		name         string
+		method       string
+		url          string
+		expectCode   int
+		expectNumber int
+	}{
+		{
+			name:         "query the records of a pull request",
+			method:       http.MethodGet,
+			url:          "/audit?org=org&repo=repo&number=2",
+			expectCode:   http.StatusOK,
+			expectNumber: 1,
+		},
+		{
+			name:         "query the records since a time",
+			method:       http.MethodGet,
+			url:          "/audit?since=2021-06-02T00:00:00Z",
+			expectCode:   http.StatusOK,
+			expectNumber: 2,
+		},
+		{
+			name:       "invalid number",
+			method:     http.MethodGet,
+			url:        "/audit?number=abc",
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid time",
+			method:     http.MethodGet,
+			url:        "/audit?until=2021-06-02",
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid method",
+			method:     http.MethodPost,
+			url:        "/audit",
+			expectCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.url, nil))
+
+			if w.Code != tc.expectCode {
+				t.Fatalf("status code mismatch: got %d, want %d", w.Code, tc.expectCode)
+			}
+			var resp AuditResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal the response: %v", err)
+			}
+			if len(resp.Data) != tc.expectNumber {
+				t.Errorf("records number mismatch: got %d, want %d", len(resp.Data), tc.expectNumber)
+			}
+		})
+	}
+}
+
+func TestMergeAudit(t *testing.T) {
+	SHA := "0bd3ed50c88cd53a09316bf7a298f900e9371652"
+
+	var testcases = []struct {
+		name         string
+		body         string
+		commenter    string
+		labels       []string
+		expectAction string
+		expectReason string
+	}{
+		{
+			name:         "merge",
+			body:         "/merge",
+			commenter:    "collab1",
+			labels:       []string{lgtmTwo},
+			expectAction: AuditActionMerge,
+			expectReason: "approved with the required 2 approval(s)",
+		},
+		{
+			name:         "merge without enough approvals",
+			body:         "/merge",
+			commenter:    "collab1",
+			labels:       []string{lgtmOne},
+			expectAction: AuditActionRejection,
+			expectReason: "the required 2 approval(s) are not satisfied",
+		},
+		{
+			name:         "merge by non-committer",
+			body:         "/merge",
+			commenter:    "contributor",
+			labels:       []string{lgtmTwo},
+			expectAction: AuditActionRejection,
+			expectReason: "`/merge` is only allowed for the committers",
+		},
+		{
+			name:         "cancel",
+			body:         "/merge cancel",
+			commenter:    "author",
+			labels:       []string{lgtmTwo, externalplugins.CanMergeLabel},
+			expectAction: AuditActionCancel,
+			expectReason: "the '" + externalplugins.CanMergeLabel + "' label is removed",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fakegithub.FakeClient{
+				IssueComments: map[int][]github.IssueComment{},
+				PullRequests: map[int]*github.PullRequest{
+					5: {
+						Number: 5,
+						Head:   github.PullRequestBranch{SHA: SHA},
+					},
+				},
+			}
+			for _, label := range tc.labels {
+				fc.IssueLabelsExisting = append(fc.IssueLabelsExisting, "org/repo#5:"+label)
+			}
+			cfg := &externalplugins.Configuration{}
+			cfg.TiCommunityMerge = []externalplugins.TiCommunityMerge{
+				{
+					Repos:              []string{"org/repo"},
+					PullOwnersEndpoint: "https://fake/ti-community-bot",
+				},
+			}
+			e := &github.IssueCommentEvent{
+				Action: github.IssueCommentActionCreated,
+				Comment: github.IssueComment{
+					Body: tc.body,
+					User: github.User{Login: tc.commenter},
+				},
+				Issue: github.Issue{
+					User:        github.User{Login: "author"},
+					Number:      5,
+					State:       "open",
+					PullRequest: &struct{}{},
+				},
+				Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+			foc := &fakeOwnersClient{
+				committers: []string{"collab1"},
+				needsLgtm:  2,
+			}
+			al := &fakeAuditLogger{}
+
+			err := HandleIssueCommentEvent(&fakeGithubClient{FakeClient: fc}, e, cfg, foc, &fakePruner{GitHubClient: fc},
+				al, logrus.WithField("plugin", PluginName))
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			if len(al.records) != 1 {
+				t.Fatalf("expected one audit record, but got %v", al.records)
+			}
+			record := al.records[0]
+			if record.Action != tc.expectAction || record.Reason != tc.expectReason {
+				t.Errorf("audit record mismatch: got %s %q, want %s %q",
+					record.Action, record.Reason, tc.expectAction, tc.expectReason)
+			}
+			if record.Actor != tc.commenter || record.Org != "org" || record.Repo != "repo" ||
+				record.Number != 5 || record.SHA != SHA {
+				t.Errorf("unexpected audit record: %+v", record)
+			}
+			if record.Owners == nil || !reflect.DeepEqual(record.Owners.Committers, []string{"collab1"}) {
+				t.Errorf("expected the owners snapshot, but got %+v", record.Owners)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package merge
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+// FreezeStatusRe is the regex that matches freeze status comments.
+var FreezeStatusRe = regexp.MustCompile(`(?mi)^/freeze-status\s*$`)
+
+// timeNow returns the current time, it is replaced in the tests.
+var timeNow = time.Now
+
+// isFreezeWindowInTime returns true if the freeze window takes effect at the time.
+func isFreezeWindowInTime(window tiexternalplugins.MergeFreezeWindow, t time.Time) bool {
+	location, err := time.LoadLocation(window.TimeZone)
+	if err != nil {
+		return false
+	}
+	local := t.In(location)
+
+	if window.Start != "" {
+		start, err := time.ParseInLocation(tiexternalplugins.MergeFreezeTimeLayout, window.Start, location)
+		if err != nil || local.Before(start) {
+			return false
+		}
+	}
+	if window.End != "" {
+		end, err := time.ParseInLocation(tiexternalplugins.MergeFreezeTimeLayout, window.End, location)
+		if err != nil || !local.Before(end) {
+			return false
+		}
+	}
+
+	if len(window.Weekdays) == 0 {
+		return true
+	}
+	for _, weekday := range window.Weekdays {
+		if strings.EqualFold(weekday, local.Weekday().String()) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFreezeWindowMatchBranch returns true if the branch is frozen by the freeze window.
+func isFreezeWindowMatchBranch(window tiexternalplugins.MergeFreezeWindow, branch string) bool {
+	if len(window.Branches) == 0 {
+		return true
+	}
+	for _, pattern := range window.Branches {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(branch) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFreezeExempt returns true if the user is a member of the exempt teams of the freeze window.
+func isFreezeExempt(gc githubClient, org string, window tiexternalplugins.MergeFreezeWindow,
+	login string, log *logrus.Entry) bool {
+	for _, team := range window.ExemptTeams {
+		isMember, err := gc.TeamBySlugHasMember(org, team, login)
+		if err != nil {
+			log.WithError(err).Warnf("Failed to check if %s is a member of team %s.", login, team)
+			continue
+		}
+		if isMember {
+			return true
+		}
+	}
+	return false
+}
+
+// listFreezeWindows returns the freeze windows that freeze the branch for the user at the time,
+// the exempt teams are ignored if the login is empty.
+func listFreezeWindows(gc githubClient, opts *tiexternalplugins.TiCommunityMerge, org, branch, login string,
+	t time.Time, log *logrus.Entry) []tiexternalplugins.MergeFreezeWindow {
+	var windows []tiexternalplugins.MergeFreezeWindow
+	for _, window := range opts.FreezeWindows {
+		if !isFreezeWindowMatchBranch(window, branch) || !isFreezeWindowInTime(window, t) {
+			continue
+		}
+		if login != "" && isFreezeExempt(gc, org, window, login, log) {
+			continue
+		}
+		windows = append(windows, window)
+	}
+	return windows
+}
+
+// describeFreezeWindow returns a human-readable description of the freeze window.
+func describeFreezeWindow(window tiexternalplugins.MergeFreezeWindow) string {
+	reason := window.Reason
+	if reason == "" {
+		reason = "No reason provided"
+	}
+
+	timeZone := window.TimeZone
+	if timeZone == "" {
+		timeZone = "UTC"
+	}
+
+	var details []string
+	if len(window.Branches) == 0 {
+		details = append(details, "branches: all")
+	} else {
+		details = append(details, fmt.Sprintf("branches: `%s`", strings.Join(window.Branches, "`, `")))
+	}
+	switch {
+	case window.Start != "" && window.End != "":
+		details = append(details, fmt.Sprintf("from %s to %s %s", window.Start, window.End, timeZone))
+	case window.Start != "":
+		details = append(details, fmt.Sprintf("since %s %s", window.Start, timeZone))
+	case window.End != "":
+		details = append(details, fmt.Sprintf("until %s %s", window.End, timeZone))
+	}
+	if len(window.Weekdays) != 0 {
+		details = append(details, fmt.Sprintf("on %s (%s)", strings.Join(window.Weekdays, ", "), timeZone))
+	}
+	if len(window.ExemptTeams) != 0 {
+		details = append(details, fmt.Sprintf("exempt teams: %s", strings.Join(window.ExemptTeams, ", ")))
+	}
+
+	return fmt.Sprintf("%s (%s)", reason, strings.Join(details, "; "))
+}
+
+// describeFreezeWindows returns a markdown list of the freeze windows.
+func describeFreezeWindows(windows []tiexternalplugins.MergeFreezeWindow) string {
+	var lines []string
+	for _, window := range windows {
+		lines = append(lines, "- "+describeFreezeWindow(window))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// handleFreezeStatus replies with the active freeze windows of the repository and
+// whether the base branch of the pull request is frozen.
+func handleFreezeStatus(gc githubClient, opts *tiexternalplugins.TiCommunityMerge, rc reviewCtx,
+	log *logrus.Entry) error {
+	org := rc.repo.Owner.Login
+	repoName := rc.repo.Name
+	now := timeNow()
+
+	var activeWindows []tiexternalplugins.MergeFreezeWindow
+	for _, window := range opts.FreezeWindows {
+		if isFreezeWindowInTime(window, now) {
+			activeWindows = append(activeWindows, window)
+		}
+	}
+
+	var resp string
+	if len(activeWindows) == 0 {
+		resp = "There is no active merge freeze in this repository."
+	} else {
+		resp = "The active merge freezes in this repository:\n\n" + describeFreezeWindows(activeWindows)
+	}
+
+	pr, err := gc.GetPullRequest(org, repoName, rc.number)
+	if err != nil {
+		return err
+	}
+	branch := pr.Base.Ref
+	if windows := listFreezeWindows(gc, opts, org, branch, "", now, log); len(windows) != 0 {
+		resp += fmt.Sprintf("\n\nThe base branch `%s` of this pull request is frozen.", branch)
+	} else {
+		resp += fmt.Sprintf("\n\nThe base branch `%s` of this pull request is not frozen.", branch)
+	}
+
+	log.Infof("Reply /freeze-status request with comment: \"%s\"", resp)
+	return gc.CreateComment(org, repoName, rc.number,
+		tiexternalplugins.FormatResponseRaw(rc.body, rc.htmlURL, rc.author, resp))
+}
+
+// FreezeWatcher removes the 'status/can-merge' label of the pull requests on the frozen branches
+// when the freeze starts.
+type FreezeWatcher struct {
+	lock sync.Mutex
+	// active records the freeze windows that were active in the last sync.
+	active sets.String
+}
+
+// Sync removes the 'status/can-merge' label of the pull requests on the branches of the freeze windows
+// that become active since the last sync. The removal is idempotent, so the first sync also removes
+// the labels of the freeze windows that are already active, e.g. the ones without the start time.
+func (w *FreezeWatcher) Sync(gc githubClient, cfg *tiexternalplugins.Configuration, al AuditLogger,
+	now time.Time, log *logrus.Entry) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	active := sets.NewString()
+	var errs []string
+	for _, merge := range cfg.TiCommunityMerge {
+		for _, orgRepo := range merge.Repos {
+			for _, window := range merge.FreezeWindows {
+				if !window.RemoveCanMergeLabel || !isFreezeWindowInTime(window, now) {
+					continue
+				}
+
+				key := fmt.Sprintf("%s:%v", orgRepo, window)
+				active.Insert(key)
+				if w.active.Has(key) {
+					continue
+				}
+
+				if err := removeFrozenCanMergeLabels(gc, cfg, al, orgRepo, window, log); err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+		}
+	}
+	w.active = active
+
+	if len(errs) != 0 {
+		return fmt.Errorf("failed to remove the labels of the frozen pull requests: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// removeFrozenCanMergeLabels removes the 'status/can-merge' label of the open pull requests
+// on the branches of the freeze window.
+func removeFrozenCanMergeLabels(gc githubClient, cfg *tiexternalplugins.Configuration, al AuditLogger,
+	orgRepo string, window tiexternalplugins.MergeFreezeWindow, log *logrus.Entry) error {
+	org, repo := orgRepo, ""
+	query := fmt.Sprintf("org:%s", org)
+	if parts := strings.SplitN(orgRepo, "/", 2); len(parts) == 2 {
+		org, repo = parts[0], parts[1]
+		query = fmt.Sprintf("repo:%s", orgRepo)
+	}
+	query += fmt.Sprintf(" is:pr is:open label:\"%s\"", tiexternalplugins.CanMergeLabel)
+
+	issues, err := gc.FindIssuesWithOrg(org, query, "", false)
+	if err != nil {
+		return err
+	}
+
+	for _, issue := range issues {
+		prRepo := repo
+		if prRepo == "" {
+			// The repository of the pull request can only be known by its URL when searching in the org.
+			prRepo = parseRepoFromHTMLURL(issue.HTMLURL)
+			// Skip the repository that has its own configuration.
+			if prRepo == "" || !sets.NewString(cfg.MergeFor(org, prRepo).Repos...).Has(org) {
+				continue
+			}
+		}
+		l := log.WithField("pr", fmt.Sprintf("%s/%s#%d", org, prRepo, issue.Number))
+
+		pr, err := gc.GetPullRequest(org, prRepo, issue.Number)
+		if err != nil {
+			l.WithError(err).Error("Failed to get pull request.")
+			continue
+		}
+		if pr.State != github.PullRequestStateOpen || !isFreezeWindowMatchBranch(window, pr.Base.Ref) {
+			continue
+		}
+
+		labels, err := gc.GetIssueLabels(org, prRepo, issue.Number)
+		if err != nil {
+			l.WithError(err).Error("Failed to get issue labels.")
+			continue
+		}
+		hasCanMerge := false
+		for _, label := range labels {
+			if label.Name == tiexternalplugins.CanMergeLabel {
+				hasCanMerge = true
+			}
+		}
+		if !hasCanMerge {
+			continue
+		}
+
+		l.Info("Removing '" + tiexternalplugins.CanMergeLabel + "' label because the branch is frozen.")
+		if err := gc.RemoveLabel(org, prRepo, issue.Number, tiexternalplugins.CanMergeLabel); err != nil {
+			l.WithError(err).Error("Failed to remove 'can-merge' label.")
+			continue
+		}
+		recordAudit(al, gc, &AuditRecord{
+			Action: AuditActionAutoRemoval, Org: org, Repo: prRepo, Number: issue.Number,
+			SHA: pr.Head.SHA, Reason: fmt.Sprintf("the `%s` branch is frozen", pr.Base.Ref),
+		}, l)
+		msg := fmt.Sprintf("Merge canceled because the `%s` branch is frozen:\n\n%s\n\n"+
+			"Please use `/merge` again after the freeze ends.", pr.Base.Ref, describeFreezeWindow(window))
+		if err := gc.CreateComment(org, prRepo, issue.Number, msg); err != nil {
+			l.WithError(err).Error("Failed to create comment.")
+		}
+	}
+
+	return nil
+}
+
+// parseRepoFromHTMLURL returns the repository name from the URL like https://github.com/org/repo/pull/1.
+func parseRepoFromHTMLURL(htmlURL string) string {
+	parts := strings.Split(strings.TrimPrefix(htmlURL, "https://"), "/")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[2]
+}
@@ -0,0 +1,292 @@
+package merge
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+)
+
+func TestIsFreezeWindowInTime(t *testing.T) {
+	// 2021-06-05 is Saturday.
+	now := time.Date(2021, 6, 5, 10, 0, 0, 0, time.UTC)
+
+	var testcases = []struct {
+		name   string
+		window externalplugins.MergeFreezeWindow
+		expect bool
+	}{
+		{
+			name:   "ad-hoc freeze",
+			window: externalplugins.MergeFreezeWindow{},
+			expect: true,
+		},
+		{
+			name:   "in the window",
+			window: externalplugins.MergeFreezeWindow{Start: "2021-06-01 00:00", End: "2021-06-15 00:00"},
+			expect: true,
+		},
+		{
+			name:   "before the window",
+			window: externalplugins.MergeFreezeWindow{Start: "2021-06-05 10:01"},
+			expect: false,
+		},
+		{
+			name:   "after the window",
+			window: externalplugins.MergeFreezeWindow{End: "2021-06-05 10:00"},
+			expect: false,
+		},
+		{
+			name: "in the window of another time zone",
+			window: externalplugins.MergeFreezeWindow{
+				TimeZone: "Asia/Shanghai",
+				Start:    "2021-06-05 18:00",
+			},
+			expect: true,
+		},
+		{
+			name: "before the window of another time zone",
+			window: externalplugins.MergeFreezeWindow{
+				TimeZone: "Asia/Shanghai",
+				Start:    "2021-06-05 18:01",
+			},
+			expect: false,
+		},
+		{
+			name:   "on the weekdays",
+			window: externalplugins.MergeFreezeWindow{Weekdays: []string{"saturday", "Sunday"}},
+			expect: true,
+		},
+		{
+			name:   "not on the weekdays",
+			window: externalplugins.MergeFreezeWindow{Weekdays: []string{"Friday"}},
+			expect: false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isFreezeWindowInTime(tc.window, now); got != tc.expect {
+				t.Errorf("expected %v, but got %v", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestMergeWithFreezeWindows(t *testing.T) {
+	timeNow = func() time.Time {
+		return time.Date(2021, 6, 5, 10, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	var testcases = []struct {
+		name        string
+		body        string
+		commenter   string
+		baseRef     string
+		expectAdd   bool
+		expectReply string
+	}{
+		{
+			name:      "merge on the frozen branch",
+			body:      "/merge",
+			commenter: "collab1",
+			baseRef:   "release-5.0",
+			expectReply: "`/merge` is rejected because the `release-5.0` branch is frozen:\n\n" +
+				"- Release 5.0 (branches: `^release-5\\.0$`; until 2021-06-15 00:00 UTC; exempt teams: release-managers)",
+		},
+		{
+			name:      "merge on the frozen branch by the exempt team member",
+			body:      "/merge",
+			commenter: "collab2",
+			baseRef:   "release-5.0",
+			expectAdd: true,
+		},
+		{
+			name:      "merge on the other branch",
+			body:      "/merge",
+			commenter: "collab1",
+			baseRef:   "master",
+			expectAdd: true,
+		},
+		{
+			name:        "freeze status of the frozen branch",
+			body:        "/freeze-status",
+			commenter:   "contributor",
+			baseRef:     "release-5.0",
+			expectReply: "The base branch `release-5.0` of this pull request is frozen.",
+		},
+		{
+			name:        "freeze status of the other branch",
+			body:        "/freeze-status",
+			commenter:   "contributor",
+			baseRef:     "master",
+			expectReply: "The active merge freezes in this repository:\n\n- Release 5.0",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fakegithub.FakeClient{
+				IssueComments: map[int][]github.IssueComment{},
+				PullRequests: map[int]*github.PullRequest{
+					5: {
+						Number: 5,
+						Base:   github.PullRequestBranch{Ref: tc.baseRef},
+						State:  "open",
+					},
+				},
+				IssueLabelsExisting: []string{"org/repo#5:" + lgtmTwo},
+				Teams: map[string]map[string]fakegithub.TeamWithMembers{
+					"org": {
+						"release-managers": {Members: sets.NewString("collab2")},
+					},
+				},
+			}
+			cfg := &externalplugins.Configuration{}
+			cfg.TiCommunityMerge = []externalplugins.TiCommunityMerge{
+				{
+					Repos:              []string{"org/repo"},
+					PullOwnersEndpoint: "https://fake/ti-community-bot",
+					FreezeWindows: []externalplugins.MergeFreezeWindow{
+						{
+							Branches:    []string{`^release-5\.0$`},
+							End:         "2021-06-15 00:00",
+							Reason:      "Release 5.0",
+							ExemptTeams: []string{"release-managers"},
+						},
+					},
+				},
+			}
+			e := &github.IssueCommentEvent{
+				Action: github.IssueCommentActionCreated,
+				Comment: github.IssueComment{
+					Body:    tc.body,
+					User:    github.User{Login: tc.commenter},
+					HTMLURL: "<url>",
+				},
+				Issue: github.Issue{
+					User:        github.User{Login: "author"},
+					Number:      5,
+					State:       "open",
+					PullRequest: &struct{}{},
+				},
+				Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+			foc := &fakeOwnersClient{
+				committers: []string{"collab1", "collab2"},
+				needsLgtm:  2,
+			}
+
+			err := HandleIssueCommentEvent(&fakeGithubClient{FakeClient: fc}, e, cfg, foc, &fakePruner{GitHubClient: fc}, nil,
+				logrus.WithField("plugin", PluginName))
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			added := len(fc.IssueLabelsAdded) != 0
+			if added != tc.expectAdd {
+				t.Errorf("label added mismatch: got %v, want %v", fc.IssueLabelsAdded, tc.expectAdd)
+			}
+			if tc.expectReply == "" {
+				if len(fc.IssueCommentsAdded) != 0 {
+					t.Errorf("unexpected comments: %v", fc.IssueCommentsAdded)
+				}
+				return
+			}
+			if len(fc.IssueCommentsAdded) != 1 {
+				t.Fatalf("expected one reply, but got %v", fc.IssueCommentsAdded)
+			}
+			if !strings.Contains(fc.IssueCommentsAdded[0], tc.expectReply) {
+				t.Errorf("expected the reply contains %q, but got %q", tc.expectReply, fc.IssueCommentsAdded[0])
+			}
+		})
+	}
+}
+
+func TestFreezeWatcherSync(t *testing.T) {
+	fc := &fakegithub.FakeClient{
+		IssueComments: map[int][]github.IssueComment{},
+		PullRequests: map[int]*github.PullRequest{
+			1: {
+				Number: 1,
+				Base:   github.PullRequestBranch{Ref: "release-5.0"},
+				State:  "open",
+			},
+			2: {
+				Number: 2,
+				Base:   github.PullRequestBranch{Ref: "master"},
+				State:  "open",
+			},
+		},
+		IssueLabelsExisting: []string{
+			"org/repo#1:" + externalplugins.CanMergeLabel,
+			"org/repo#2:" + externalplugins.CanMergeLabel,
+		},
+	}
+	cfg := &externalplugins.Configuration{}
+	cfg.TiCommunityMerge = []externalplugins.TiCommunityMerge{
+		{
+			Repos:              []string{"org/repo"},
+			PullOwnersEndpoint: "https://fake/ti-community-bot",
+			FreezeWindows: []externalplugins.MergeFreezeWindow{
+				{
+					Branches:            []string{`^release-5\.0$`},
+					Start:               "2021-06-01 00:00",
+					Reason:              "Release 5.0",
+					RemoveCanMergeLabel: true,
+				},
+			},
+		},
+	}
+	gc := &fakeGithubClient{FakeClient: fc}
+	watcher := &FreezeWatcher{}
+	log := logrus.WithField("plugin", PluginName)
+
+	// The first sync removes the labels of the freeze that is already active.
+	if err := watcher.Sync(gc, cfg, nil, time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), log); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	expectRemoved := []string{"org/repo#1:" + externalplugins.CanMergeLabel}
+	if !sets.NewString(fc.IssueLabelsRemoved...).Equal(sets.NewString(expectRemoved...)) {
+		t.Errorf("expected removed labels %v, but got %v", expectRemoved, fc.IssueLabelsRemoved)
+	}
+	if len(fc.IssueCommentsAdded) != 1 ||
+		!strings.Contains(fc.IssueCommentsAdded[0], "Merge canceled because the `release-5.0` branch is frozen") {
+		t.Errorf("expected a removal notification, but got %v", fc.IssueCommentsAdded)
+	}
+
+	// The labels will not be removed again while the freeze is active.
+	if err := watcher.Sync(gc, cfg, nil, time.Date(2021, 6, 1, 10, 1, 0, 0, time.UTC), log); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(fc.IssueLabelsRemoved) != 1 {
+		t.Errorf("expected the labels not to be removed again, but got %v", fc.IssueLabelsRemoved)
+	}
+
+	// The freeze restarts after the start time is moved.
+	fc.IssueLabelsRemoved = nil
+	cfg.TiCommunityMerge[0].FreezeWindows[0].Start = "2021-06-02 00:00"
+	if err := watcher.Sync(gc, cfg, nil, time.Date(2021, 6, 1, 23, 59, 0, 0, time.UTC), log); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(fc.IssueLabelsRemoved) != 0 {
+		t.Errorf("expected the labels not to be removed before the freeze, but got %v", fc.IssueLabelsRemoved)
+	}
+	if err := watcher.Sync(gc, cfg, nil, time.Date(2021, 6, 2, 0, 0, 0, 0, time.UTC), log); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if !sets.NewString(fc.IssueLabelsRemoved...).Equal(sets.NewString(expectRemoved...)) ||
+		len(fc.IssueCommentsAdded) != 2 {
+		t.Errorf("expected the labels to be removed when the freeze restarts, but got %v", fc.IssueLabelsRemoved)
+	}
+}
@@ -0,0 +1,465 @@
+package merge
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/ownersclient"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+const (
+	// MergeGateName defines the name used in the title for the merge gate comment.
+	MergeGateName = "Merge Gate"
+	// MergeGateIdentifier defines the identifier for the merge gate comment.
+	MergeGateIdentifier = "Merge Gate Identifier"
+)
+
+// Possible states of the merge gate.
+const (
+	mergeGateWaiting  = "waiting"
+	mergeGateFailed   = "failed"
+	mergeGatePassed   = "passed"
+	mergeGateCanceled = "canceled"
+)
+
+// Possible status and conclusion of the check run.
+const (
+	checkRunStatusCompleted   = "completed"
+	checkRunConclusionSuccess = "success"
+	checkRunConclusionNeutral = "neutral"
+	checkRunConclusionSkipped = "skipped"
+)
+
+// mergeGateRe is the regex that matches the merge gate comment.
+var mergeGateRe = regexp.MustCompile(
+	"<!--" + MergeGateIdentifier + ` sha=(\w+) requester=(\S+) state=(\w+)-->`)
+
+// CheckRunEvent is what GitHub sends us when a check run is created, completed or re-requested.
+type CheckRunEvent struct {
+	Action   string          `json:"action"`
+	CheckRun github.CheckRun `json:"check_run"`
+	Repo     github.Repo     `json:"repository"`
+}
+
+// gateGithubClient is the GitHub client which can also find the pull requests of a commit.
+type gateGithubClient interface {
+	githubClient
+	QueryWithGitHubAppsSupport(ctx context.Context, q interface{}, vars map[string]interface{}, org string) error
+}
+
+// commitPullRequestsQuery finds the pull requests associated with the commit, it is the GraphQL version of
+// `GET /repos/{owner}/{repo}/commits/{sha}/pulls`, which does not consume the rate limit of the search API.
+// See: https://docs.github.com/en/graphql/reference/objects#commit.
+type commitPullRequestsQuery struct {
+	Repository struct {
+		Object struct {
+			Commit struct {
+				AssociatedPullRequests struct {
+					Nodes []struct {
+						Number githubql.Int
+						State  githubql.PullRequestState
+					}
+				} `graphql:"associatedPullRequests(first: 10)"`
+			} `graphql:"... on Commit"`
+		} `graphql:"object(oid: $sha)"`
+	} `graphql:"repository(owner: $owner, name: $name)"`
+}
+
+// contextState contains the state of a required context.
+type contextState struct {
+	context, state, description, targetURL string
+}
+
+// mergeGate records a merge request that is waiting for the required contexts to pass.
+type mergeGate struct {
+	sha, requester, state, reason string
+	contexts                      []contextState
+}
+
+// isActive returns true if the merge gate is still waiting for the required contexts.
+func (g *mergeGate) isActive() bool {
+	return g.state == mergeGateWaiting || g.state == mergeGateFailed
+}
+
+// message returns the body of the merge gate comment.
+func (g *mergeGate) message() string {
+	var b strings.Builder
+	b.WriteString("[" + strings.ToUpper(MergeGateName) + "]\n\n")
+
+	switch g.state {
+	case mergeGateWaiting:
+		fmt.Fprintf(&b, "@%s requested to merge this pull request at commit %s, "+
+			"the '%s' label will be added after all the required checks pass.",
+			g.requester, g.sha, tiexternalplugins.CanMergeLabel)
+	case mergeGateFailed:
+		fmt.Fprintf(&b, "Some required checks failed at commit %s, "+
+			"the '%s' label will be added after they are re-run and pass.",
+			g.sha, tiexternalplugins.CanMergeLabel)
+	case mergeGatePassed:
+		fmt.Fprintf(&b, "All the required checks passed at commit %s, the '%s' label has been added.",
+			g.sha, tiexternalplugins.CanMergeLabel)
+	case mergeGateCanceled:
+		fmt.Fprintf(&b, "The merge request from @%s at commit %s has been %s.", g.requester, g.sha, g.reason)
+	}
+
+	if len(g.contexts) != 0 && g.state != mergeGateCanceled {
+		b.WriteString("\n\n| Context | State | Description |\n| ------- | ----- | ----------- |\n")
+		for _, c := range g.contexts {
+			name := c.context
+			if c.targetURL != "" {
+				name = fmt.Sprintf("[%s](%s)", c.context, c.targetURL)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s |\n", name, c.state, c.description)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n\n<!--%s sha=%s requester=%s state=%s-->",
+		MergeGateIdentifier, g.sha, g.requester, g.state)
+	return b.String()
+}
+
+// HandleStatusEvent handles a GitHub status event and adds the "status/can-merge" label
+// once all the required contexts pass.
+func HandleStatusEvent(gc gateGithubClient, se *github.StatusEvent, cfg *tiexternalplugins.Configuration,
+	ol ownersclient.OwnersLoader, al AuditLogger, log *logrus.Entry) error {
+	// The pending status cannot change the merge gate.
+	if se.State == github.StatusPending {
+		return nil
+	}
+	return handleContextUpdate(gc, cfg, ol, al, se.Repo.Owner.Login, se.Repo.Name, se.SHA, se.Context, log)
+}
+
+// HandleCheckRunEvent handles a GitHub check run event and adds the "status/can-merge" label
+// once all the required contexts pass.
+func HandleCheckRunEvent(gc gateGithubClient, cre *CheckRunEvent, cfg *tiexternalplugins.Configuration,
+	ol ownersclient.OwnersLoader, al AuditLogger, log *logrus.Entry) error {
+	// The queued or in progress check run cannot change the merge gate.
+	if cre.CheckRun.Status != checkRunStatusCompleted {
+		return nil
+	}
+	return handleContextUpdate(gc, cfg, ol, al, cre.Repo.Owner.Login, cre.Repo.Name,
+		cre.CheckRun.HeadSHA, cre.CheckRun.Name, log)
+}
+
+// handleContextUpdate refreshes the merge gates of the pull requests whose head commit is the sha.
+func handleContextUpdate(gc gateGithubClient, cfg *tiexternalplugins.Configuration, ol ownersclient.OwnersLoader,
+	al AuditLogger, org, repo, sha, contextName string, log *logrus.Entry) error {
+	opts := cfg.MergeFor(org, repo)
+	if !sets.NewString(opts.RequiredContexts...).Has(contextName) {
+		return nil
+	}
+
+	vars := map[string]interface{}{
+		"owner": githubql.String(org),
+		"name":  githubql.String(repo),
+		"sha":   githubql.GitObjectID(sha),
+	}
+	var q commitPullRequestsQuery
+	if err := gc.QueryWithGitHubAppsSupport(context.Background(), &q, vars, org); err != nil {
+		return fmt.Errorf("failed to find pull requests of %s: %v", sha, err)
+	}
+
+	for _, node := range q.Repository.Object.Commit.AssociatedPullRequests.Nodes {
+		if node.State != githubql.PullRequestStateOpen {
+			continue
+		}
+		number := int(node.Number)
+		l := log.WithField("number", number)
+		if err := refreshPullRequestMergeGate(gc, opts, ol, al, org, repo, number, sha, l); err != nil {
+			l.WithError(err).Error("Failed to refresh the merge gate.")
+		}
+	}
+
+	return nil
+}
+
+// refreshPullRequestMergeGate refreshes the merge gate of the pull request if it is waiting for the sha.
+func refreshPullRequestMergeGate(gc githubClient, opts *tiexternalplugins.TiCommunityMerge,
+	ol ownersclient.OwnersLoader, al AuditLogger, org, repo string, number int, sha string, log *logrus.Entry) error {
+	botUserChecker, err := gc.BotUserChecker()
+	if err != nil {
+		return err
+	}
+	comments, err := gc.ListIssueComments(org, repo, number)
+	if err != nil {
+		return err
+	}
+	comment, gate := findMergeGate(comments, botUserChecker)
+	if gate == nil || !gate.isActive() || gate.sha != sha {
+		return nil
+	}
+
+	labels, err := gc.GetIssueLabels(org, repo, number)
+	if err != nil {
+		return err
+	}
+	for _, label := range labels {
+		if label.Name == tiexternalplugins.CanMergeLabel {
+			return nil
+		}
+	}
+
+	// The approvals may be canceled while waiting for the required contexts.
+	owners, err := ol.LoadOwners(opts.PullOwnersEndpoint, org, repo, number)
+	if err != nil {
+		return err
+	}
+	if !isLGTMSatisfy(tiexternalplugins.LgtmLabelPrefix, labels, owners.NeedsLgtm) {
+		gate.state = mergeGateCanceled
+		gate.reason = fmt.Sprintf("canceled because it no longer has the required %d approval(s)", owners.NeedsLgtm)
+		recordAudit(al, gc, &AuditRecord{
+			Action: AuditActionAutoRemoval, Org: org, Repo: repo, Number: number,
+			SHA: gate.sha, Reason: gate.reason, Owners: owners,
+		}, log)
+		return gc.EditComment(org, repo, comment.ID, gate.message())
+	}
+
+	var pr *github.PullRequest
+	if len(opts.FreezeWindows) != 0 || len(opts.ReleaseApprovalRules) != 0 {
+		pr, err = gc.GetPullRequest(org, repo, number)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The base branch may be frozen while waiting for the required contexts.
+	if len(opts.FreezeWindows) != 0 {
+		if windows := listFreezeWindows(gc, opts, org, pr.Base.Ref, gate.requester, timeNow(), log); len(windows) != 0 {
+			gate.state = mergeGateCanceled
+			gate.reason = fmt.Sprintf("canceled because the `%s` branch is frozen", pr.Base.Ref)
+			recordAudit(al, gc, &AuditRecord{
+				Action: AuditActionAutoRemoval, Org: org, Repo: repo, Number: number,
+				SHA: gate.sha, Reason: gate.reason, Owners: owners,
+			}, log)
+			return gc.EditComment(org, repo, comment.ID, gate.message())
+		}
+	}
+
+	// The approval of the release managers may be canceled while waiting for the required contexts.
+	if len(opts.ReleaseApprovalRules) != 0 {
+		if rule := opts.ReleaseApprovalRuleFor(pr.Base.Ref); rule != nil && !hasLabel(labels, rule.ApprovedLabel) {
+			gate.state = mergeGateCanceled
+			gate.reason = "canceled because the approval of the release managers is canceled"
+			recordAudit(al, gc, &AuditRecord{
+				Action: AuditActionAutoRemoval, Org: org, Repo: repo, Number: number,
+				SHA: gate.sha, Reason: gate.reason, Owners: owners,
+			}, log)
+			return gc.EditComment(org, repo, comment.ID, gate.message())
+		}
+	}
+
+	return refreshMergeGate(gc, opts, al, owners, org, repo, number, gate, comment, comments, botUserChecker, log)
+}
+
+// requestMergeGate registers a merge request that waits for the required contexts of the head commit to pass.
+func requestMergeGate(gc githubClient, opts *tiexternalplugins.TiCommunityMerge, al AuditLogger,
+	owners *ownersclient.Owners, org, repo string, number int, requester string, log *logrus.Entry) error {
+	pr, err := gc.GetPullRequest(org, repo, number)
+	if err != nil {
+		return err
+	}
+	botUserChecker, err := gc.BotUserChecker()
+	if err != nil {
+		return err
+	}
+	comments, err := gc.ListIssueComments(org, repo, number)
+	if err != nil {
+		return err
+	}
+
+	comment, _ := findMergeGate(comments, botUserChecker)
+	gate := &mergeGate{
+		sha:       pr.Head.SHA,
+		requester: requester,
+		state:     mergeGateWaiting,
+	}
+	log.WithField("sha", gate.sha).Info("Registering the merge request.")
+	recordAudit(al, gc, &AuditRecord{
+		Action: AuditActionMergeRequest, Actor: requester, Org: org, Repo: repo, Number: number,
+		SHA: gate.sha, Reason: "waiting for the required contexts", Owners: owners,
+	}, log)
+	return refreshMergeGate(gc, opts, al, owners, org, repo, number, gate, comment, comments, botUserChecker, log)
+}
+
+// refreshMergeGate checks the required contexts, adds the 'status/can-merge' label once all of them pass
+// and creates or updates the merge gate comment.
+func refreshMergeGate(gc githubClient, opts *tiexternalplugins.TiCommunityMerge, al AuditLogger,
+	owners *ownersclient.Owners, org, repo string, number int, gate *mergeGate, comment *github.IssueComment,
+	comments []github.IssueComment, isBot func(candidate string) bool, log *logrus.Entry) error {
+	contexts, err := listRequiredContexts(gc, org, repo, gate.sha, opts.RequiredContexts)
+	if err != nil {
+		return err
+	}
+	gate.contexts = contexts
+	gate.state = summarizeContexts(contexts)
+
+	if gate.state == mergeGatePassed {
+		// The contexts are checked for the sha, so the label must not be added to the newer commits.
+		added, err := addCanMergeLabel(gc, opts, org, repo, number, gate.sha, log)
+		if err != nil {
+			return err
+		}
+		if !added {
+			gate.state = mergeGateCanceled
+			gate.reason = "canceled because a new commit is pushed"
+			recordAudit(al, gc, &AuditRecord{
+				Action: AuditActionAutoRemoval, Org: org, Repo: repo, Number: number,
+				SHA: gate.sha, Reason: gate.reason, Owners: owners,
+			}, log)
+		} else {
+			recordAudit(al, gc, &AuditRecord{
+				Action: AuditActionMerge, Actor: gate.requester, Org: org, Repo: repo, Number: number,
+				SHA: gate.sha, Reason: "all the required contexts passed", Owners: owners,
+			}, log)
+			// Delete the 'status/can-merge' removed noti after the 'status/can-merge' label is added.
+			for _, c := range comments {
+				if isBot(c.User.Login) && strings.Contains(c.Body, removeCanMergeLabelNoti) {
+					if err := gc.DeleteComment(org, repo, c.ID); err != nil {
+						log.WithError(err).Errorf("Failed to delete comment %d.", c.ID)
+					}
+				}
+			}
+		}
+	}
+
+	msg := gate.message()
+	if comment == nil {
+		return gc.CreateComment(org, repo, number, msg)
+	}
+	if comment.Body == msg {
+		return nil
+	}
+	return gc.EditComment(org, repo, comment.ID, msg)
+}
+
+// cancelMergeGate cancels the merge request that is waiting for the required contexts,
+// it returns the canceled merge gate or nil if there is no waiting merge request.
+func cancelMergeGate(gc githubClient, org, repo string, number int, reason string,
+	log *logrus.Entry) (*mergeGate, error) {
+	botUserChecker, err := gc.BotUserChecker()
+	if err != nil {
+		return nil, err
+	}
+	comments, err := gc.ListIssueComments(org, repo, number)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, gate := findMergeGate(comments, botUserChecker)
+	if gate == nil || !gate.isActive() {
+		return nil, nil
+	}
+
+	gate.state = mergeGateCanceled
+	gate.reason = reason
+	log.WithField("sha", gate.sha).Infof("Merge request %s.", reason)
+	return gate, gc.EditComment(org, repo, comment.ID, gate.message())
+}
+
+// findMergeGate returns the latest merge gate comment and the merge gate recorded in it.
+func findMergeGate(comments []github.IssueComment,
+	isBot func(candidate string) bool) (*github.IssueComment, *mergeGate) {
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := comments[i]
+		if !isBot(comment.User.Login) {
+			continue
+		}
+		m := mergeGateRe.FindStringSubmatch(comment.Body)
+		if m == nil {
+			continue
+		}
+		return &comment, &mergeGate{sha: m[1], requester: m[2], state: m[3]}
+	}
+	return nil, nil
+}
+
+// listRequiredContexts returns the states of the required contexts from the statuses and check runs of the sha.
+func listRequiredContexts(gc githubClient, org, repo, sha string, requiredContexts []string) ([]contextState, error) {
+	states := make(map[string]contextState)
+
+	combinedStatus, err := gc.GetCombinedStatus(org, repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the combined status of %s: %v", sha, err)
+	}
+	if combinedStatus != nil {
+		for _, status := range combinedStatus.Statuses {
+			state := github.StatusPending
+			switch status.State {
+			case github.StatusSuccess:
+				state = github.StatusSuccess
+			case github.StatusFailure, github.StatusError:
+				state = github.StatusFailure
+			}
+			states[status.Context] = contextState{
+				context:     status.Context,
+				state:       state,
+				description: status.Description,
+				targetURL:   status.TargetURL,
+			}
+		}
+	}
+
+	checkRuns, err := gc.ListCheckRuns(org, repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the check runs of %s: %v", sha, err)
+	}
+	if checkRuns != nil {
+		for _, run := range checkRuns.CheckRuns {
+			state := github.StatusPending
+			if run.Status == checkRunStatusCompleted {
+				switch run.Conclusion {
+				case checkRunConclusionSuccess, checkRunConclusionNeutral, checkRunConclusionSkipped:
+					state = github.StatusSuccess
+				default:
+					state = github.StatusFailure
+				}
+			}
+			states[run.Name] = contextState{
+				context:     run.Name,
+				state:       state,
+				description: run.Output.Title,
+				targetURL:   run.HTMLURL,
+			}
+		}
+	}
+
+	contexts := make([]contextState, 0, len(requiredContexts))
+	for _, requiredContext := range requiredContexts {
+		state, ok := states[requiredContext]
+		if !ok {
+			state = contextState{
+				context:     requiredContext,
+				state:       github.StatusPending,
+				description: "Waiting for the status to be reported.",
+			}
+		}
+		contexts = append(contexts, state)
+	}
+	return contexts, nil
+}
+
+// summarizeContexts returns the state of the merge gate according to the states of the required contexts.
+func summarizeContexts(contexts []contextState) string {
+	passed := true
+	for _, c := range contexts {
+		if c.state == github.StatusFailure {
+			return mergeGateFailed
+		}
+		if c.state != github.StatusSuccess {
+			passed = false
+		}
+	}
+
+	if passed {
+		return mergeGatePassed
+	}
+	return mergeGateWaiting
+}
@@ -0,0 +1,461 @@
+package merge
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+)
+
+const gateSHA = "0bd3ed50c88cd53a09316bf7a298f900e9371652"
+
+func gateComment(id int, state string) github.IssueComment {
+	return github.IssueComment{
+		ID:   id,
+		User: github.User{Login: fakegithub.Bot},
+		Body: (&mergeGate{sha: gateSHA, requester: "collab1", state: state}).message(),
+	}
+}
+
+func newGateGithubClient(comments []github.IssueComment, labels []string) *fakeGithubClient {
+	fc := &fakegithub.FakeClient{
+		IssueComments: map[int][]github.IssueComment{
+			5: comments,
+		},
+		IssueCommentID: 100,
+		PullRequests: map[int]*github.PullRequest{
+			5: {
+				Number: 5,
+				User:   github.User{Login: "author"},
+				Head:   github.PullRequestBranch{SHA: gateSHA},
+				State:  "open",
+			},
+		},
+		CombinedStatuses: map[string]*github.CombinedStatus{},
+	}
+	for _, label := range labels {
+		fc.IssueLabelsExisting = append(fc.IssueLabelsExisting, "org/repo#5:"+label)
+	}
+	return &fakeGithubClient{
+		FakeClient: fc,
+		CheckRuns:  map[string]*github.CheckRunList{},
+	}
+}
+
+func gateConfig() *externalplugins.Configuration {
+	cfg := &externalplugins.Configuration{}
+	cfg.TiCommunityMerge = []externalplugins.TiCommunityMerge{
+		{
+			Repos:              []string{"org/repo"},
+			PullOwnersEndpoint: "https://fake/ti-community-bot",
+			RequiredContexts:   []string{"ci/unit-test", "ci/lint"},
+		},
+	}
+	return cfg
+}
+
+func TestMergeWithRequiredContexts(t *testing.T) {
+	var testcases = []struct {
+		name       string
+		comments   []github.IssueComment
+		statuses   []github.Status
+		checkRuns  []github.CheckRun
+		expectAdd  bool
+		expectBody []string
+		expectEdit bool
+	}{
+		{
+			name: "required contexts are not reported",
+			expectBody: []string{
+				"@collab1 requested to merge this pull request at commit " + gateSHA,
+				"| ci/unit-test | pending | Waiting for the status to be reported. |",
+				"state=waiting-->",
+			},
+		},
+		{
+			name: "required contexts passed",
+			statuses: []github.Status{
+				{Context: "ci/unit-test", State: github.StatusSuccess, TargetURL: "https://ci/1"},
+			},
+			checkRuns: []github.CheckRun{
+				{Name: "ci/lint", Status: checkRunStatusCompleted, Conclusion: checkRunConclusionSuccess},
+			},
+			expectAdd: true,
+			expectBody: []string{
+				"All the required checks passed at commit " + gateSHA,
+				"| [ci/unit-test](https://ci/1) | success |  |",
+				"state=passed-->",
+			},
+		},
+		{
+			name: "required context failed",
+			statuses: []github.Status{
+				{Context: "ci/unit-test", State: github.StatusError, Description: "Job failed."},
+			},
+			checkRuns: []github.CheckRun{
+				{Name: "ci/lint", Status: "in_progress"},
+			},
+			expectBody: []string{
+				"Some required checks failed at commit " + gateSHA,
+				"| ci/unit-test | failure | Job failed. |",
+				"| ci/lint | pending |  |",
+				"state=failed-->",
+			},
+		},
+		{
+			name:     "required context is pending and the gate comment exists",
+			comments: []github.IssueComment{gateComment(1, mergeGateCanceled)},
+			statuses: []github.Status{
+				{Context: "ci/unit-test", State: github.StatusPending},
+			},
+			expectEdit: true,
+			expectBody: []string{
+				"| ci/unit-test | pending |  |",
+				"state=waiting-->",
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			fc := newGateGithubClient(tc.comments, []string{lgtmTwo})
+			fc.CombinedStatuses[gateSHA] = &github.CombinedStatus{Statuses: tc.statuses}
+			fc.CheckRuns[gateSHA] = &github.CheckRunList{CheckRuns: tc.checkRuns}
+
+			e := &github.IssueCommentEvent{
+				Action: github.IssueCommentActionCreated,
+				Comment: github.IssueComment{
+					Body:    "/merge",
+					User:    github.User{Login: "collab1"},
+					HTMLURL: "<url>",
+				},
+				Issue: github.Issue{
+					User:        github.User{Login: "author"},
+					Number:      5,
+					State:       "open",
+					PullRequest: &struct{}{},
+				},
+				Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+			foc := &fakeOwnersClient{
+				committers: []string{"collab1"},
+				needsLgtm:  2,
+			}
+
+			err := HandleIssueCommentEvent(fc, e, gateConfig(), foc, &fakePruner{GitHubClient: fc.FakeClient}, nil,
+				logrus.WithField("plugin", PluginName))
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			added := false
+			for _, label := range fc.IssueLabelsAdded {
+				if label == "org/repo#5:"+externalplugins.CanMergeLabel {
+					added = true
+				}
+			}
+			if added != tc.expectAdd {
+				t.Errorf("label added mismatch: got %v, want %v", added, tc.expectAdd)
+			}
+
+			var body string
+			if tc.expectEdit {
+				if len(fc.IssueCommentsEdited) != 1 || len(fc.IssueCommentsAdded) != 0 {
+					t.Fatalf("expected the gate comment to be edited, edited: %v, added: %v",
+						fc.IssueCommentsEdited, fc.IssueCommentsAdded)
+				}
+				body = fc.IssueCommentsEdited[0]
+			} else {
+				if len(fc.IssueCommentsAdded) != 1 || len(fc.IssueCommentsEdited) != 0 {
+					t.Fatalf("expected the gate comment to be created, edited: %v, added: %v",
+						fc.IssueCommentsEdited, fc.IssueCommentsAdded)
+				}
+				body = fc.IssueCommentsAdded[0]
+			}
+			for _, expect := range tc.expectBody {
+				if !strings.Contains(body, expect) {
+					t.Errorf("expected the gate comment contains %q, but got %q", expect, body)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleStatusEvent(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		context       string
+		sha           string
+		state         string
+		prState       string
+		prHeadSHA     string
+		comments      []github.IssueComment
+		labels        []string
+		statuses      []github.Status
+		expectAdd     bool
+		expectEdit    bool
+		expectContain string
+	}{
+		{
+			name:     "not a required context",
+			context:  "ci/other",
+			sha:      gateSHA,
+			comments: []github.IssueComment{gateComment(1, mergeGateWaiting)},
+			labels:   []string{lgtmTwo},
+		},
+		{
+			name:    "no merge gate",
+			context: "ci/unit-test",
+			sha:     gateSHA,
+			labels:  []string{lgtmTwo},
+		},
+		{
+			name:     "merge gate is canceled",
+			context:  "ci/unit-test",
+			sha:      gateSHA,
+			comments: []github.IssueComment{gateComment(1, mergeGateCanceled)},
+			labels:   []string{lgtmTwo},
+		},
+		{
+			name:     "merge gate waits for another commit",
+			context:  "ci/unit-test",
+			sha:      "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+			comments: []github.IssueComment{gateComment(1, mergeGateWaiting)},
+			labels:   []string{lgtmTwo},
+		},
+		{
+			name:     "all required contexts passed",
+			context:  "ci/unit-test",
+			sha:      gateSHA,
+			comments: []github.IssueComment{gateComment(1, mergeGateFailed)},
+			labels:   []string{lgtmTwo},
+			statuses: []github.Status{
+				{Context: "ci/unit-test", State: github.StatusSuccess},
+				{Context: "ci/lint", State: github.StatusSuccess},
+			},
+			expectAdd:     true,
+			expectEdit:    true,
+			expectContain: "state=passed-->",
+		},
+		{
+			name:      "new commit is pushed after the required contexts passed",
+			context:   "ci/unit-test",
+			sha:       gateSHA,
+			prHeadSHA: "6dcb09b5b57875f334f61aebed695e2e4193db5e",
+			comments:  []github.IssueComment{gateComment(1, mergeGateWaiting)},
+			labels:    []string{lgtmTwo},
+			statuses: []github.Status{
+				{Context: "ci/unit-test", State: github.StatusSuccess},
+				{Context: "ci/lint", State: github.StatusSuccess},
+			},
+			expectEdit:    true,
+			expectContain: "has been canceled because a new commit is pushed.",
+		},
+		{
+			name:     "some required contexts are pending",
+			context:  "ci/unit-test",
+			sha:      gateSHA,
+			comments: []github.IssueComment{gateComment(1, mergeGateWaiting)},
+			labels:   []string{lgtmTwo},
+			statuses: []github.Status{
+				{Context: "ci/unit-test", State: github.StatusSuccess},
+			},
+			expectEdit:    true,
+			expectContain: "| ci/unit-test | success |  |",
+		},
+		{
+			name:     "pending status is ignored",
+			context:  "ci/unit-test",
+			sha:      gateSHA,
+			state:    github.StatusPending,
+			comments: []github.IssueComment{gateComment(1, mergeGateWaiting)},
+			labels:   []string{lgtmTwo},
+			statuses: []github.Status{
+				{Context: "ci/unit-test", State: github.StatusSuccess},
+				{Context: "ci/lint", State: github.StatusSuccess},
+			},
+		},
+		{
+			name:     "closed pull request is ignored",
+			context:  "ci/unit-test",
+			sha:      gateSHA,
+			prState:  "closed",
+			comments: []github.IssueComment{gateComment(1, mergeGateWaiting)},
+			labels:   []string{lgtmTwo},
+			statuses: []github.Status{
+				{Context: "ci/unit-test", State: github.StatusSuccess},
+				{Context: "ci/lint", State: github.StatusSuccess},
+			},
+		},
+		{
+			name:     "approvals are canceled",
+			context:  "ci/unit-test",
+			sha:      gateSHA,
+			comments: []github.IssueComment{gateComment(1, mergeGateWaiting)},
+			labels:   []string{lgtmOne},
+			statuses: []github.Status{
+				{Context: "ci/unit-test", State: github.StatusSuccess},
+				{Context: "ci/lint", State: github.StatusSuccess},
+			},
+			expectEdit:    true,
+			expectContain: "has been canceled because it no longer has the required 2 approval(s).",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			fc := newGateGithubClient(tc.comments, tc.labels)
+			fc.CombinedStatuses[gateSHA] = &github.CombinedStatus{Statuses: tc.statuses}
+			if tc.prState != "" {
+				fc.PullRequests[5].State = tc.prState
+			}
+			if tc.prHeadSHA != "" {
+				fc.PullRequests[5].Head.SHA = tc.prHeadSHA
+				fc.Commits = map[int][]string{5: {gateSHA}}
+			}
+			state := tc.state
+			if state == "" {
+				state = github.StatusSuccess
+			}
+
+			se := &github.StatusEvent{
+				SHA:     tc.sha,
+				Context: tc.context,
+				State:   state,
+				Repo:    github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+			foc := &fakeOwnersClient{
+				committers: []string{"collab1"},
+				needsLgtm:  2,
+			}
+
+			if err := HandleStatusEvent(fc, se, gateConfig(), foc, nil, logrus.WithField("plugin", PluginName)); err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			added := len(fc.IssueLabelsAdded) != 0
+			if added != tc.expectAdd {
+				t.Errorf("label added mismatch: got %v, want %v", fc.IssueLabelsAdded, tc.expectAdd)
+			}
+			if !tc.expectEdit {
+				if len(fc.IssueCommentsEdited) != 0 {
+					t.Errorf("unexpected edited comments: %v", fc.IssueCommentsEdited)
+				}
+				return
+			}
+			if len(fc.IssueCommentsEdited) != 1 {
+				t.Fatalf("expected the gate comment to be edited, but got %v", fc.IssueCommentsEdited)
+			}
+			if !strings.Contains(fc.IssueCommentsEdited[0], tc.expectContain) {
+				t.Errorf("expected the gate comment contains %q, but got %q", tc.expectContain, fc.IssueCommentsEdited[0])
+			}
+		})
+	}
+}
+
+func TestHandleCheckRunEvent(t *testing.T) {
+	var testcases = []struct {
+		name      string
+		status    string
+		expectAdd bool
+	}{
+		{name: "check run in progress is ignored", status: "in_progress"},
+		{name: "completed check run passes the gate", status: checkRunStatusCompleted, expectAdd: true},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			fc := newGateGithubClient([]github.IssueComment{gateComment(1, mergeGateWaiting)}, []string{lgtmTwo})
+			fc.CheckRuns[gateSHA] = &github.CheckRunList{CheckRuns: []github.CheckRun{
+				{Name: "ci/unit-test", Status: checkRunStatusCompleted, Conclusion: checkRunConclusionSuccess},
+				{Name: "ci/lint", Status: checkRunStatusCompleted, Conclusion: checkRunConclusionSuccess},
+			}}
+
+			cre := &CheckRunEvent{
+				Action:   "completed",
+				CheckRun: github.CheckRun{Name: "ci/lint", HeadSHA: gateSHA, Status: tc.status},
+				Repo:     github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+			foc := &fakeOwnersClient{committers: []string{"collab1"}, needsLgtm: 2}
+
+			if err := HandleCheckRunEvent(fc, cre, gateConfig(), foc, nil, logrus.WithField("plugin", PluginName)); err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+			if added := len(fc.IssueLabelsAdded) != 0; added != tc.expectAdd {
+				t.Errorf("label added mismatch: got %v, want %v", fc.IssueLabelsAdded, tc.expectAdd)
+			}
+		})
+	}
+}
+
+func TestCancelMergeGate(t *testing.T) {
+	foc := &fakeOwnersClient{
+		committers: []string{"collab1"},
+		needsLgtm:  2,
+	}
+	canceledByAuthor := fmt.Sprintf("org/repo#1:%s",
+		(&mergeGate{sha: gateSHA, requester: "collab1", state: mergeGateCanceled,
+			reason: "canceled by @author"}).message())
+	canceledByPush := fmt.Sprintf("org/repo#1:%s",
+		(&mergeGate{sha: gateSHA, requester: "collab1", state: mergeGateCanceled,
+			reason: "canceled because a new commit is pushed"}).message())
+
+	// Cancel by the /merge cancel command.
+	fc := newGateGithubClient([]github.IssueComment{gateComment(1, mergeGateWaiting)}, []string{lgtmTwo})
+	e := &github.IssueCommentEvent{
+		Action: github.IssueCommentActionCreated,
+		Comment: github.IssueComment{
+			Body: "/merge cancel",
+			User: github.User{Login: "author"},
+		},
+		Issue: github.Issue{
+			User:        github.User{Login: "author"},
+			Number:      5,
+			State:       "open",
+			PullRequest: &struct{}{},
+		},
+		Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+	}
+	err := HandleIssueCommentEvent(fc, e, gateConfig(), foc, &fakePruner{GitHubClient: fc.FakeClient}, nil,
+		logrus.WithField("plugin", PluginName))
+	if err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(fc.IssueCommentsEdited) != 1 || fc.IssueCommentsEdited[0] != canceledByAuthor {
+		t.Errorf("expected the gate comment to be canceled, but got %v", fc.IssueCommentsEdited)
+	}
+
+	// Cancel by pushing new commits.
+	fc = newGateGithubClient([]github.IssueComment{gateComment(1, mergeGateFailed)}, []string{lgtmTwo})
+	pe := &github.PullRequestEvent{
+		Action: github.PullRequestActionSynchronize,
+		PullRequest: github.PullRequest{
+			Number: 5,
+			Base: github.PullRequestBranch{
+				Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			},
+		},
+	}
+	if err := HandlePullRequestEvent(fc, pe, gateConfig(), nil, logrus.WithField("plugin", PluginName)); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(fc.IssueCommentsEdited) != 1 || fc.IssueCommentsEdited[0] != canceledByPush {
+		t.Errorf("expected the gate comment to be canceled, but got %v", fc.IssueCommentsEdited)
+	}
+
+	// The finished merge gate will not be canceled.
+	fc = newGateGithubClient([]github.IssueComment{gateComment(1, mergeGatePassed)}, []string{lgtmTwo})
+	if err := HandlePullRequestEvent(fc, pe, gateConfig(), nil, logrus.WithField("plugin", PluginName)); err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if len(fc.IssueCommentsEdited) != 0 {
+		t.Errorf("unexpected edited comments: %v", fc.IssueCommentsEdited)
+	}
+}
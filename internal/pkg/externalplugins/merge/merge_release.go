@@ -0,0 +1,163 @@
+package merge
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+var (
+	// ApproveReleaseRe is the regex that matches release approval comments.
+	ApproveReleaseRe = regexp.MustCompile(`(?mi)^/approve-release\s*$`)
+	// ApproveReleaseCancelRe is the regex that matches release approval cancel comments.
+	ApproveReleaseCancelRe = regexp.MustCompile(`(?mi)^/approve-release cancel\s*$`)
+)
+
+// isReleaseManager returns true if the user is one of the release managers of the rule.
+func isReleaseManager(gc githubClient, org string, rule *tiexternalplugins.ReleaseApprovalRule,
+	login string, log *logrus.Entry) bool {
+	for _, manager := range rule.ReleaseManagers {
+		if github.NormLogin(manager) == github.NormLogin(login) {
+			return true
+		}
+	}
+	for _, team := range rule.ReleaseManagerTeams {
+		isMember, err := gc.TeamBySlugHasMember(org, team, login)
+		if err != nil {
+			log.WithError(err).Warnf("Failed to check if %s is a member of team %s.", login, team)
+			continue
+		}
+		if isMember {
+			return true
+		}
+	}
+	return false
+}
+
+// describeReleaseManagers returns the release managers and the release manager teams of the rule.
+func describeReleaseManagers(org string, rule *tiexternalplugins.ReleaseApprovalRule) string {
+	var managers []string
+	for _, manager := range rule.ReleaseManagers {
+		managers = append(managers, "`"+manager+"`")
+	}
+	for _, team := range rule.ReleaseManagerTeams {
+		managers = append(managers, fmt.Sprintf("the members of `%s/%s`", org, team))
+	}
+	return strings.Join(managers, ", ")
+}
+
+// hasLabel returns true if the label is in the labels.
+func hasLabel(labels []github.Label, name string) bool {
+	for _, label := range labels {
+		if label.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handleApproveRelease adds or removes the release approved label on behalf of the release managers.
+func handleApproveRelease(approve bool, gc githubClient, opts *tiexternalplugins.TiCommunityMerge, rc reviewCtx,
+	al AuditLogger, log *logrus.Entry) error {
+	org := rc.repo.Owner.Login
+	repoName := rc.repo.Name
+	number := rc.number
+	command := "/approve-release"
+	if !approve {
+		command = "/approve-release cancel"
+	}
+
+	pr, err := gc.GetPullRequest(org, repoName, number)
+	if err != nil {
+		return err
+	}
+
+	rule := opts.ReleaseApprovalRuleFor(pr.Base.Ref)
+	if rule == nil {
+		resp := fmt.Sprintf("`%s` is not needed because the `%s` branch does not require the approval "+
+			"of the release managers.", command, pr.Base.Ref)
+		log.Infof("Reply %s request with comment: \"%s\"", command, resp)
+		return gc.CreateComment(org, repoName, number,
+			tiexternalplugins.FormatResponseRaw(rc.body, rc.htmlURL, rc.author, resp))
+	}
+
+	if !isReleaseManager(gc, org, rule, rc.author, log) {
+		resp := fmt.Sprintf("`%s` is only allowed for the release managers: %s.", command,
+			describeReleaseManagers(org, rule))
+		log.Infof("Reply %s request with comment: \"%s\"", command, resp)
+		return gc.CreateComment(org, repoName, number,
+			tiexternalplugins.FormatResponseRaw(rc.body, rc.htmlURL, rc.author, resp))
+	}
+
+	labels, err := gc.GetIssueLabels(org, repoName, number)
+	if err != nil {
+		return err
+	}
+	approved := hasLabel(labels, rule.ApprovedLabel)
+
+	if approve && !approved {
+		log.Info("Adding '" + rule.ApprovedLabel + "' label.")
+		if err := gc.AddLabel(org, repoName, number, rule.ApprovedLabel); err != nil {
+			return err
+		}
+		recordAudit(al, gc, &AuditRecord{
+			Action: AuditActionReleaseApproval, Actor: rc.author, Org: org, Repo: repoName, Number: number,
+			SHA: pr.Head.SHA, Reason: fmt.Sprintf("approved the merge into the `%s` branch", pr.Base.Ref),
+		}, log)
+	} else if !approve && approved {
+		log.Info("Removing '" + rule.ApprovedLabel + "' label.")
+		if err := gc.RemoveLabel(org, repoName, number, rule.ApprovedLabel); err != nil {
+			return err
+		}
+		recordAudit(al, gc, &AuditRecord{
+			Action: AuditActionReleaseApproval, Actor: rc.author, Org: org, Repo: repoName, Number: number,
+			SHA: pr.Head.SHA, Reason: fmt.Sprintf("canceled the approval of the merge into the `%s` branch",
+				pr.Base.Ref),
+		}, log)
+
+		// The merge can not go on without the approval.
+		if hasLabel(labels, tiexternalplugins.CanMergeLabel) {
+			log.Info("Removing '" + tiexternalplugins.CanMergeLabel + "' label.")
+			if err := gc.RemoveLabel(org, repoName, number, tiexternalplugins.CanMergeLabel); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// handleReleaseApprovedLabeled removes the release approved label if it is not added by the release managers.
+func handleReleaseApprovedLabeled(gc githubClient, pe *github.PullRequestEvent,
+	opts *tiexternalplugins.TiCommunityMerge, log *logrus.Entry) error {
+	org := pe.PullRequest.Base.Repo.Owner.Login
+	repo := pe.PullRequest.Base.Repo.Name
+	number := pe.PullRequest.Number
+
+	rule := opts.ReleaseApprovalRuleFor(pe.PullRequest.Base.Ref)
+	if rule == nil || pe.Label.Name != rule.ApprovedLabel {
+		return nil
+	}
+
+	botUserChecker, err := gc.BotUserChecker()
+	if err != nil {
+		return err
+	}
+	if botUserChecker(pe.Sender.Login) || isReleaseManager(gc, org, rule, pe.Sender.Login, log) {
+		return nil
+	}
+
+	log.Infof("Removing '%s' label added by %s who is not a release manager.", rule.ApprovedLabel, pe.Sender.Login)
+	if err := gc.RemoveLabel(org, repo, number, rule.ApprovedLabel); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("@%s The '%s' label can only be added by the release managers: %s, "+
+		"please ask them to approve it by `/approve-release`.", pe.Sender.Login, rule.ApprovedLabel,
+		describeReleaseManagers(org, rule))
+	return gc.CreateComment(org, repo, number, msg)
+}
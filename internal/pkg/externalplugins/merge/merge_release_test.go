@@ -0,0 +1,355 @@
+package merge
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/github/fakegithub"
+)
+
+func releaseApprovalConfig() *externalplugins.Configuration {
+	cfg := &externalplugins.Configuration{}
+	cfg.TiCommunityMerge = []externalplugins.TiCommunityMerge{
+		{
+			Repos:              []string{"org/repo"},
+			PullOwnersEndpoint: "https://fake/ti-community-bot",
+			ReleaseApprovalRules: []externalplugins.ReleaseApprovalRule{
+				{
+					Branches:            []string{`^release-`},
+					ReleaseManagerTeams: []string{"release-managers"},
+					ReleaseManagers:     []string{"manager1"},
+					ApprovedLabel:       externalplugins.ReleaseApprovedLabel,
+				},
+			},
+		},
+	}
+	return cfg
+}
+
+func TestMergeWithReleaseApproval(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		body          string
+		commenter     string
+		baseRef       string
+		labels        []string
+		expectAdded   []string
+		expectRemoved []string
+		expectReply   string
+	}{
+		{
+			name:        "merge on the release branch without the approval",
+			body:        "/merge",
+			commenter:   "collab1",
+			baseRef:     "release-5.0",
+			labels:      []string{lgtmTwo},
+			expectReply: "`/merge` on the `release-5.0` branch requires the approval of the release managers",
+		},
+		{
+			name:        "merge on the release branch with the approval",
+			body:        "/merge",
+			commenter:   "collab1",
+			baseRef:     "release-5.0",
+			labels:      []string{lgtmTwo, externalplugins.ReleaseApprovedLabel},
+			expectAdded: []string{"org/repo#5:" + externalplugins.CanMergeLabel},
+		},
+		{
+			name:        "merge on the other branch",
+			body:        "/merge",
+			commenter:   "collab1",
+			baseRef:     "master",
+			labels:      []string{lgtmTwo},
+			expectAdded: []string{"org/repo#5:" + externalplugins.CanMergeLabel},
+		},
+		{
+			name:        "approve by the release manager",
+			body:        "/approve-release",
+			commenter:   "manager1",
+			baseRef:     "release-5.0",
+			expectAdded: []string{"org/repo#5:" + externalplugins.ReleaseApprovedLabel},
+		},
+		{
+			name:        "approve by the member of the release manager team",
+			body:        "/approve-release",
+			commenter:   "manager2",
+			baseRef:     "release-5.0",
+			expectAdded: []string{"org/repo#5:" + externalplugins.ReleaseApprovedLabel},
+		},
+		{
+			name:      "approve by the non-release manager",
+			body:      "/approve-release",
+			commenter: "collab1",
+			baseRef:   "release-5.0",
+			expectReply: "`/approve-release` is only allowed for the release managers: `manager1`, " +
+				"the members of `org/release-managers`.",
+		},
+		{
+			name:        "approve on the other branch",
+			body:        "/approve-release",
+			commenter:   "manager1",
+			baseRef:     "master",
+			expectReply: "`/approve-release` is not needed because the `master` branch does not require the approval",
+		},
+		{
+			name:      "cancel the approval",
+			body:      "/approve-release cancel",
+			commenter: "manager1",
+			baseRef:   "release-5.0",
+			labels:    []string{lgtmTwo, externalplugins.ReleaseApprovedLabel, externalplugins.CanMergeLabel},
+			expectRemoved: []string{
+				"org/repo#5:" + externalplugins.ReleaseApprovedLabel,
+				"org/repo#5:" + externalplugins.CanMergeLabel,
+			},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fakegithub.FakeClient{
+				IssueComments: map[int][]github.IssueComment{},
+				PullRequests: map[int]*github.PullRequest{
+					5: {
+						Number: 5,
+						Base:   github.PullRequestBranch{Ref: tc.baseRef},
+						State:  "open",
+					},
+				},
+				Teams: map[string]map[string]fakegithub.TeamWithMembers{
+					"org": {
+						"release-managers": {Members: sets.NewString("manager2")},
+					},
+				},
+			}
+			for _, label := range tc.labels {
+				fc.IssueLabelsExisting = append(fc.IssueLabelsExisting, "org/repo#5:"+label)
+			}
+			e := &github.IssueCommentEvent{
+				Action: github.IssueCommentActionCreated,
+				Comment: github.IssueComment{
+					Body:    tc.body,
+					User:    github.User{Login: tc.commenter},
+					HTMLURL: "<url>",
+				},
+				Issue: github.Issue{
+					User:        github.User{Login: "author"},
+					Number:      5,
+					State:       "open",
+					PullRequest: &struct{}{},
+				},
+				Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+			foc := &fakeOwnersClient{
+				committers: []string{"collab1"},
+				needsLgtm:  2,
+			}
+
+			err := HandleIssueCommentEvent(&fakeGithubClient{FakeClient: fc}, e, releaseApprovalConfig(), foc,
+				&fakePruner{GitHubClient: fc}, nil, logrus.WithField("plugin", PluginName))
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			if !reflect.DeepEqual(fc.IssueLabelsAdded, tc.expectAdded) {
+				t.Errorf("labels added mismatch: got %v, want %v", fc.IssueLabelsAdded, tc.expectAdded)
+			}
+			if !reflect.DeepEqual(fc.IssueLabelsRemoved, tc.expectRemoved) {
+				t.Errorf("labels removed mismatch: got %v, want %v", fc.IssueLabelsRemoved, tc.expectRemoved)
+			}
+			if tc.expectReply == "" {
+				if len(fc.IssueCommentsAdded) != 0 {
+					t.Errorf("unexpected comments: %v", fc.IssueCommentsAdded)
+				}
+				return
+			}
+			if len(fc.IssueCommentsAdded) != 1 {
+				t.Fatalf("expected one reply, but got %v", fc.IssueCommentsAdded)
+			}
+			if !strings.Contains(fc.IssueCommentsAdded[0], tc.expectReply) {
+				t.Errorf("expected the reply contains %q, but got %q", tc.expectReply, fc.IssueCommentsAdded[0])
+			}
+		})
+	}
+}
+
+func TestReleaseApprovedLabeled(t *testing.T) {
+	var testcases = []struct {
+		name          string
+		sender        string
+		label         string
+		baseRef       string
+		expectRemoved []string
+		expectComment bool
+	}{
+		{
+			name:    "labeled by the release manager",
+			sender:  "manager1",
+			label:   externalplugins.ReleaseApprovedLabel,
+			baseRef: "release-5.0",
+		},
+		{
+			name:    "labeled by the bot",
+			sender:  fakegithub.Bot,
+			label:   externalplugins.ReleaseApprovedLabel,
+			baseRef: "release-5.0",
+		},
+		{
+			name:          "labeled by the non-release manager",
+			sender:        "collab1",
+			label:         externalplugins.ReleaseApprovedLabel,
+			baseRef:       "release-5.0",
+			expectRemoved: []string{"org/repo#5:" + externalplugins.ReleaseApprovedLabel},
+			expectComment: true,
+		},
+		{
+			name:    "other label",
+			sender:  "collab1",
+			label:   "type/bugfix",
+			baseRef: "release-5.0",
+		},
+		{
+			name:    "labeled on the other branch",
+			sender:  "collab1",
+			label:   externalplugins.ReleaseApprovedLabel,
+			baseRef: "master",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			fc := &fakegithub.FakeClient{
+				IssueComments:       map[int][]github.IssueComment{},
+				IssueLabelsExisting: []string{"org/repo#5:" + tc.label},
+			}
+			e := &github.PullRequestEvent{
+				Action: github.PullRequestActionLabeled,
+				Label:  github.Label{Name: tc.label},
+				Sender: github.User{Login: tc.sender},
+				PullRequest: github.PullRequest{
+					Number: 5,
+					Base: github.PullRequestBranch{
+						Ref:  tc.baseRef,
+						Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+					},
+				},
+			}
+
+			err := HandlePullRequestEvent(&fakeGithubClient{FakeClient: fc}, e, releaseApprovalConfig(), nil,
+				logrus.WithField("plugin", PluginName))
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			if !reflect.DeepEqual(fc.IssueLabelsRemoved, tc.expectRemoved) {
+				t.Errorf("labels removed mismatch: got %v, want %v", fc.IssueLabelsRemoved, tc.expectRemoved)
+			}
+			if commented := len(fc.IssueCommentsAdded) != 0; commented != tc.expectComment {
+				t.Errorf("comment mismatch: got %v, want %v", fc.IssueCommentsAdded, tc.expectComment)
+			}
+		})
+	}
+}
+
+func TestReleaseApprovalSynchronize(t *testing.T) {
+	changes := []github.PullRequestChange{
+		{Filename: "a.go", Status: "modified", Patch: "@@ -5,2 +5,2 @@\n-a\n+b"},
+	}
+	storedState := &canMergeState{sha: "6dcb09b5b57875f334f61aebed695e2e4193db5e", patchID: computePatchID(changes)}
+
+	var testcases = []struct {
+		name          string
+		baseRef       string
+		labels        []string
+		changes       []github.PullRequestChange
+		expectRemoved []string
+		expectComment string
+	}{
+		{
+			name:          "approved before merge and code changed",
+			baseRef:       "release-5.0",
+			labels:        []string{externalplugins.ReleaseApprovedLabel},
+			changes:       []github.PullRequestChange{{Filename: "a.go", Status: "modified", Patch: "@@ -5,2 +5,2 @@\n-a\n+c"}},
+			expectRemoved: []string{"org/repo#5:" + externalplugins.ReleaseApprovedLabel},
+			expectComment: removeReleaseApprovedLabelNoti,
+		},
+		{
+			name:    "approved and code unchanged",
+			baseRef: "release-5.0",
+			labels:  []string{externalplugins.ReleaseApprovedLabel, externalplugins.CanMergeLabel},
+			changes: changes,
+		},
+		{
+			name:    "merge approved and code changed",
+			baseRef: "release-5.0",
+			labels:  []string{externalplugins.ReleaseApprovedLabel, externalplugins.CanMergeLabel},
+			changes: []github.PullRequestChange{{Filename: "a.go", Status: "modified", Patch: "@@ -5,2 +5,2 @@\n-a\n+c"}},
+			expectRemoved: []string{
+				"org/repo#5:" + externalplugins.CanMergeLabel,
+				"org/repo#5:" + externalplugins.ReleaseApprovedLabel,
+			},
+			expectComment: removeCanMergeLabelNoti + " " + removeReleaseApprovedLabelNoti,
+		},
+		{
+			name:    "approved label on the other branch",
+			baseRef: "master",
+			labels:  []string{externalplugins.ReleaseApprovedLabel},
+			changes: []github.PullRequestChange{{Filename: "a.go", Status: "modified", Patch: "@@ -5,2 +5,2 @@\n-a\n+c"}},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			var labels []string
+			for _, label := range tc.labels {
+				labels = append(labels, "org/repo#5:"+label)
+			}
+			fc := &fakegithub.FakeClient{
+				IssueComments: map[int][]github.IssueComment{
+					5: {{User: github.User{Login: fakegithub.Bot}, Body: storedState.notification()}},
+				},
+				IssueLabelsExisting: labels,
+				PullRequestChanges:  map[int][]github.PullRequestChange{5: tc.changes},
+			}
+			e := &github.PullRequestEvent{
+				Action: github.PullRequestActionSynchronize,
+				Sender: github.User{Login: "author"},
+				PullRequest: github.PullRequest{
+					Number: 5,
+					Base: github.PullRequestBranch{
+						Ref:  tc.baseRef,
+						Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+					},
+					Head: github.PullRequestBranch{SHA: "e6d3e4ae1c4c08c1b6e7a2d8f3b40c2b1e5f4a0d"},
+				},
+			}
+			cfg := releaseApprovalConfig()
+			cfg.TiCommunityMerge[0].StoreTreeHash = true
+
+			err := HandlePullRequestEvent(&fakeGithubClient{FakeClient: fc}, e, cfg, nil,
+				logrus.WithField("plugin", PluginName))
+			if err != nil {
+				t.Fatalf("didn't expect error: %v", err)
+			}
+
+			if !reflect.DeepEqual(fc.IssueLabelsRemoved, tc.expectRemoved) {
+				t.Errorf("labels removed mismatch: got %v, want %v", fc.IssueLabelsRemoved, tc.expectRemoved)
+			}
+			if tc.expectComment == "" {
+				if len(fc.IssueCommentsAdded) != 0 {
+					t.Errorf("unexpected comments: %v", fc.IssueCommentsAdded)
+				}
+				return
+			}
+			if len(fc.IssueCommentsAdded) != 1 || !strings.Contains(fc.IssueCommentsAdded[0], tc.expectComment) {
+				t.Errorf("expected the comment %q, but got %v", tc.expectComment, fc.IssueCommentsAdded)
+			}
+		})
+	}
+}
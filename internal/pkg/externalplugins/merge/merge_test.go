@@ -1,15 +1,19 @@
 package merge
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
+	githubql "github.com/shurcooL/githubv4"
 	"github.com/sirupsen/logrus"
 	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
 	"github.com/ti-community-infra/tichi/internal/pkg/ownersclient"
 	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/test-infra/prow/config"
 	"k8s.io/test-infra/prow/github"
 	"k8s.io/test-infra/prow/github/fakegithub"
@@ -34,6 +38,45 @@ func (f *fakeOwnersClient) LoadOwners(_ string,
 	}, nil
 }
 
+// fakeGithubClient extends the fake client with the check runs.
+type fakeGithubClient struct {
+	*fakegithub.FakeClient
+	// ref -> check runs
+	CheckRuns map[string]*github.CheckRunList
+	// number -> the earlier commits of the pull request
+	Commits map[int][]string
+}
+
+// ListCheckRuns lists the check runs of the ref.
+func (f *fakeGithubClient) ListCheckRuns(_, _, ref string) (*github.CheckRunList, error) {
+	return f.CheckRuns[ref], nil
+}
+
+// QueryWithGitHubAppsSupport finds the pull requests which contain the sha.
+func (f *fakeGithubClient) QueryWithGitHubAppsSupport(_ context.Context, q interface{},
+	vars map[string]interface{}, _ string) error {
+	query, ok := q.(*commitPullRequestsQuery)
+	if !ok {
+		return fmt.Errorf("unexpected query %T", q)
+	}
+	sha := string(vars["sha"].(githubql.GitObjectID))
+	nodes := &query.Repository.Object.Commit.AssociatedPullRequests.Nodes
+	for _, pr := range f.PullRequests {
+		if pr.Head.SHA != sha && !sets.NewString(f.Commits[pr.Number]...).Has(sha) {
+			continue
+		}
+		state := githubql.PullRequestStateOpen
+		if pr.State != "open" {
+			state = githubql.PullRequestStateClosed
+		}
+		*nodes = append(*nodes, struct {
+			Number githubql.Int
+			State  githubql.PullRequestState
+		}{Number: githubql.Int(pr.Number), State: state})
+	}
+	return nil
+}
+
 type fakePruner struct {
 	GitHubClient  *fakegithub.FakeClient
 	IssueComments []github.IssueComment
@@ -284,7 +327,9 @@ func TestMergeIssueAndReviewComment(t *testing.T) {
 				IssueComments: fc.IssueComments[5],
 			}
 
-			if err := HandleIssueCommentEvent(fc, e, cfg, foc, cp, logrus.WithField("plugin", PluginName)); err != nil {
+			err := HandleIssueCommentEvent(&fakeGithubClient{FakeClient: fc}, e, cfg, foc, cp, nil,
+				logrus.WithField("plugin", PluginName))
+			if err != nil {
 				t.Errorf("didn't expect error from lgtmComment: %v", err)
 				continue
 			}
@@ -381,7 +426,9 @@ func TestMergeIssueAndReviewComment(t *testing.T) {
 				IssueComments: fc.IssueComments[5],
 			}
 
-			if err := HandlePullReviewCommentEvent(fc, e, cfg, foc, cp, logrus.WithField("plugin", PluginName)); err != nil {
+			err := HandlePullReviewCommentEvent(&fakeGithubClient{FakeClient: fc}, e, cfg, foc, cp, nil,
+				logrus.WithField("plugin", PluginName))
+			if err != nil {
 				t.Errorf("didn't expect error from lgtmComment: %v", err)
 				continue
 			}
@@ -538,7 +585,9 @@ func TestMergeReviewCommentWithMergeNoti(t *testing.T) {
 			IssueComments: fc.IssueComments[5],
 		}
 
-		if err := HandlePullReviewCommentEvent(fc, e, cfg, foc, cp, logrus.WithField("plugin", PluginName)); err != nil {
+		err = HandlePullReviewCommentEvent(&fakeGithubClient{FakeClient: fc}, e, cfg, foc, cp, nil,
+			logrus.WithField("plugin", PluginName))
+		if err != nil {
 			t.Errorf("For case %s, didn't expect error from lgtmComment: %v", tc.name, err)
 			continue
 		}
@@ -570,6 +619,7 @@ func TestHandlePullRequest(t *testing.T) {
 		name             string
 		event            github.PullRequestEvent
 		prCommits        map[string][]github.RepositoryCommit
+		prChanges        []github.PullRequestChange
 		removeLabelErr   error
 		createCommentErr error
 
@@ -748,6 +798,75 @@ func TestHandlePullRequest(t *testing.T) {
 			},
 			expectNoComments: true,
 		},
+		{
+			name: "pr_synchronize, same patch id, keep label",
+			event: github.PullRequestEvent{
+				Action: github.PullRequestActionSynchronize,
+				PullRequest: github.PullRequest{
+					Number: 101,
+					Base: github.PullRequestBranch{
+						Repo: github.Repo{
+							Owner: github.User{
+								Login: "kubernetes",
+							},
+							Name: "kubernetes",
+						},
+					},
+					Head: github.PullRequestBranch{
+						SHA: SHA,
+					},
+				},
+			},
+			prChanges: []github.PullRequestChange{
+				{Filename: "a.go", Status: "modified", Patch: "@@ -5,2 +5,2 @@\n-a\n+b"},
+			},
+			issueComments: map[int][]github.IssueComment{
+				101: {
+					{
+						Body: (&canMergeState{sha: treeSHA, patchID: computePatchID([]github.PullRequestChange{
+							{Filename: "a.go", Status: "modified", Patch: "@@ -1,2 +1,2 @@\n-a\n+b"},
+						})}).notification(),
+						User: github.User{Login: fakegithub.Bot},
+					},
+				},
+			},
+			expectNoComments: true,
+		},
+		{
+			name: "pr_synchronize, different patch id, remove label",
+			event: github.PullRequestEvent{
+				Action: github.PullRequestActionSynchronize,
+				PullRequest: github.PullRequest{
+					Number: 101,
+					Base: github.PullRequestBranch{
+						Repo: github.Repo{
+							Owner: github.User{
+								Login: "kubernetes",
+							},
+							Name: "kubernetes",
+						},
+					},
+					Head: github.PullRequestBranch{
+						SHA: SHA,
+					},
+				},
+			},
+			prChanges: []github.PullRequestChange{
+				{Filename: "a.go", Status: "modified", Patch: "@@ -1,2 +1,2 @@\n-a\n+c"},
+			},
+			IssueLabelsRemoved: []string{externalplugins.CanMergeLabel},
+			issueComments: map[int][]github.IssueComment{
+				101: {
+					{
+						Body: (&canMergeState{sha: treeSHA, patchID: computePatchID([]github.PullRequestChange{
+							{Filename: "a.go", Status: "modified", Patch: "@@ -1,2 +1,2 @@\n-a\n+b"},
+						})}).notification(),
+						User: github.User{Login: fakegithub.Bot},
+					},
+				},
+			},
+			expectNoComments: false,
+		},
 	}
 	for _, testcase := range testcases {
 		tc := testcase
@@ -768,6 +887,9 @@ func TestHandlePullRequest(t *testing.T) {
 				Collaborators:    []string{"collab"},
 				IssueLabelsAdded: tc.IssueLabelsAdded,
 				CommitMap:        tc.prCommits,
+				PullRequestChanges: map[int][]github.PullRequestChange{
+					101: tc.prChanges,
+				},
 			}
 			fakeGitHub.IssueLabelsAdded = append(fakeGitHub.IssueLabelsAdded, prName+":"+externalplugins.CanMergeLabel)
 			commit := github.RepositoryCommit{}
@@ -783,10 +905,12 @@ func TestHandlePullRequest(t *testing.T) {
 				},
 			}
 
+			al := &fakeAuditLogger{}
 			err := HandlePullRequestEvent(
-				fakeGitHub,
+				&fakeGithubClient{FakeClient: fakeGitHub},
 				&tc.event,
 				cfg,
+				al,
 				logrus.WithField("plugin", PluginName),
 			)
 
@@ -807,6 +931,15 @@ func TestHandlePullRequest(t *testing.T) {
 				t.Fatalf("IssueLabelsRemoved length mismatch: got %d, want %d", got, want)
 			}
 
+			if got, want := len(al.records), len(tc.IssueLabelsRemoved); got != want {
+				t.Fatalf("audit records length mismatch: got %v, want %d", al.records, want)
+			}
+			for _, record := range al.records {
+				if record.Action != AuditActionAutoRemoval || record.SHA != SHA {
+					t.Fatalf("unexpected audit record: %v", record)
+				}
+			}
+
 			if got, want := fakeGitHub.IssueComments, tc.issueComments; !equality.Semantic.DeepEqual(got, want) {
 				t.Fatalf("LGTM revmoved notifications mismatch: got %v, want %v", got, want)
 			}
@@ -888,7 +1021,8 @@ func TestAddTreeHashComment(t *testing.T) {
 		needsLgtm:  2,
 	}
 
-	_ = handle(true, cfg, rc, fc, foc, &fakePruner{}, logrus.WithField("plugin", PluginName))
+	_ = handle(true, cfg, rc, &fakeGithubClient{FakeClient: fc}, foc, &fakePruner{}, nil,
+		logrus.WithField("plugin", PluginName))
 	found := false
 	for _, body := range fc.IssueCommentsAdded {
 		if addCanMergeLabelNotificationRe.MatchString(body) {
@@ -951,7 +1085,7 @@ func TestRemoveTreeHashComment(t *testing.T) {
 		needsLgtm:  2,
 	}
 
-	_ = handle(false, cfg, rc, fc, foc, fp, logrus.WithField("plugin", PluginName))
+	_ = handle(false, cfg, rc, &fakeGithubClient{FakeClient: fc}, foc, fp, nil, logrus.WithField("plugin", PluginName))
 	found := false
 	for _, body := range fc.IssueCommentsDeleted {
 		if addCanMergeLabelNotificationRe.MatchString(body) {
@@ -1067,11 +1201,15 @@ func TestHelpProvider(t *testing.T) {
 						Repos:              []string{"org2/repo"},
 						StoreTreeHash:      true,
 						PullOwnersEndpoint: "https://fake",
+						RequiredContexts:   []string{"ci/unit-test", "ci/lint"},
 					},
 				},
 			},
-			enabledRepos:       enabledRepos,
-			configInfoIncludes: []string{configInfoStoreTreeHash},
+			enabledRepos: enabledRepos,
+			configInfoIncludes: []string{
+				configInfoStoreTreeHash,
+				fmt.Sprintf(configInfoRequiredContexts, "ci/unit-test, ci/lint"),
+			},
 		},
 	}
 	for _, testcase := range testcases {
@@ -1099,114 +1237,207 @@ func TestHelpProvider(t *testing.T) {
 	}
 }
 
-func TestAllGuaranteed(t *testing.T) {
-	treeSHA := "6dcb09b5b57875f334f61aebed695e2e4193db5e"
+func TestComputePatchID(t *testing.T) {
+	changes := []github.PullRequestChange{
+		{
+			Filename: "b.go",
+			Status:   "modified",
+			Patch:    "@@ -1,3 +1,3 @@\n package b\n-var x = 1\n+var x = 2",
+		},
+		{
+			Filename: "a.png",
+			Status:   "added",
+			SHA:      "a1b2c3",
+		},
+	}
+	patchID := computePatchID(changes)
 
 	var testcases = []struct {
-		name             string
-		lastCanMergeSha  string
-		commits          []github.RepositoryCommit
-		expectGuaranteed bool
+		name          string
+		changes       []github.PullRequestChange
+		expectChanged bool
 	}{
 		{
-			name:            "No guaranteed commit",
-			lastCanMergeSha: treeSHA,
-			commits: []github.RepositoryCommit{
+			name: "line numbers, context lines and trailing whitespaces changed",
+			changes: []github.PullRequestChange{
 				{
-					SHA: "no-guaranteed",
+					Filename: "a.png",
+					Status:   "added",
+					SHA:      "a1b2c3",
+				},
+				{
+					Filename: "b.go",
+					Status:   "modified",
+					Patch:    "@@ -10,4 +10,4 @@\n package b\n import \"fmt\"\n-var x = 1 \n+var x = 2\r",
 				},
 			},
-			expectGuaranteed: false,
 		},
 		{
-			name:            "Only one commit",
-			lastCanMergeSha: treeSHA,
-			commits: []github.RepositoryCommit{
+			name: "code changed",
+			changes: []github.PullRequestChange{
+				{
+					Filename: "b.go",
+					Status:   "modified",
+					Patch:    "@@ -1,3 +1,3 @@\n package b\n-var x = 1\n+var x = 3",
+				},
 				{
-					SHA: treeSHA,
+					Filename: "a.png",
+					Status:   "added",
+					SHA:      "a1b2c3",
 				},
 			},
-			expectGuaranteed: true,
+			expectChanged: true,
 		},
 		{
-			name:            "All authored commits",
-			lastCanMergeSha: treeSHA,
-			commits: []github.RepositoryCommit{
+			name: "indentation changed",
+			changes: []github.PullRequestChange{
 				{
-					SHA: "some-sha",
+					Filename: "b.go",
+					Status:   "modified",
+					Patch:    "@@ -1,3 +1,3 @@\n package b\n-var x = 1\n+\tvar x = 2",
 				},
 				{
-					SHA: treeSHA,
+					Filename: "a.png",
+					Status:   "added",
+					SHA:      "a1b2c3",
 				},
 			},
-			expectGuaranteed: true,
+			expectChanged: true,
 		},
 		{
-			name:            "Guaranteed by github",
-			lastCanMergeSha: treeSHA,
-			commits: []github.RepositoryCommit{
+			name: "binary file changed",
+			changes: []github.PullRequestChange{
 				{
-					SHA: "some-sha",
+					Filename: "b.go",
+					Status:   "modified",
+					Patch:    "@@ -1,3 +1,3 @@\n package b\n-var x = 1\n+var x = 2",
 				},
 				{
-					SHA: treeSHA,
-				},
-				{
-					SHA: "some-sha",
-					Committer: github.User{
-						Login: githubUpdateCommitter,
-					},
+					Filename: "a.png",
+					Status:   "added",
+					SHA:      "d4e5f6",
 				},
 			},
-			expectGuaranteed: true,
+			expectChanged: true,
 		},
 		{
-			name:            "New commit not guaranteed",
-			lastCanMergeSha: treeSHA,
-			commits: []github.RepositoryCommit{
-				{
-					SHA: "some-sha",
-				},
+			name: "file removed",
+			changes: []github.PullRequestChange{
 				{
-					SHA: treeSHA,
+					Filename: "b.go",
+					Status:   "modified",
+					Patch:    "@@ -1,3 +1,3 @@\n package b\n-var x = 1\n+var x = 2",
 				},
+			},
+			expectChanged: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			changed := computePatchID(tc.changes) != patchID
+			if changed != tc.expectChanged {
+				t.Fatalf("patch id changed mismatch: got %v, want %v", changed, tc.expectChanged)
+			}
+		})
+	}
+}
+
+func TestFindCanMergeState(t *testing.T) {
+	state := &canMergeState{sha: "6dcb09b5b57875f334f61aebed695e2e4193db5e", patchID: "abcdef"}
+	botUserChecker := func(candidate string) bool {
+		return candidate == fakegithub.Bot
+	}
+	createdAt := time.Date(1981, 2, 21, 12, 30, 0, 0, time.UTC)
+	updatedAt := time.Date(1981, 2, 21, 12, 31, 0, 0, time.UTC)
+
+	var testcases = []struct {
+		name     string
+		comments []github.IssueComment
+		expect   *canMergeState
+	}{
+		{
+			name: "no notification",
+			comments: []github.IssueComment{
+				{Body: "/merge", User: github.User{Login: "collab1"}},
+			},
+		},
+		{
+			name: "notification",
+			comments: []github.IssueComment{
 				{
-					SHA: "some-sha",
+					Body:      state.notification(),
+					User:      github.User{Login: fakegithub.Bot},
+					CreatedAt: createdAt,
+					UpdatedAt: createdAt,
 				},
 			},
-			expectGuaranteed: false,
+			expect: state,
 		},
 		{
-			name:            "New commit and github update",
-			lastCanMergeSha: treeSHA,
-			commits: []github.RepositoryCommit{
+			name: "edited notification",
+			comments: []github.IssueComment{
 				{
-					SHA: "some-sha",
+					Body:      strings.Replace(state.notification(), "patch-id=abcdef", "patch-id=fedcba", 1),
+					User:      github.User{Login: fakegithub.Bot},
+					CreatedAt: createdAt,
+					UpdatedAt: updatedAt,
 				},
+			},
+		},
+		{
+			name: "edited notification falls back to the earlier one",
+			comments: []github.IssueComment{
+				{Body: state.notification(), User: github.User{Login: fakegithub.Bot}},
 				{
-					SHA: treeSHA,
+					Body: (&canMergeState{sha: "0bd3ed50c88cd53a09316bf7a298f900e9371652",
+						patchID: "fedcba"}).notification(),
+					User:      github.User{Login: fakegithub.Bot},
+					CreatedAt: createdAt,
+					UpdatedAt: updatedAt,
 				},
+			},
+			expect: state,
+		},
+		{
+			name: "notification not created by the bot",
+			comments: []github.IssueComment{
+				{Body: state.notification(), User: github.User{Login: "collab1"}},
+			},
+		},
+		{
+			name: "legacy notification",
+			comments: []github.IssueComment{
+				{Body: state.notification(), User: github.User{Login: fakegithub.Bot}},
 				{
-					SHA: "some-sha",
-					Committer: github.User{
-						Login: githubUpdateCommitter,
-					},
+					Body: fmt.Sprintf(addCanMergeLabelNotification, "0bd3ed50c88cd53a09316bf7a298f900e9371652"),
+					User: github.User{Login: fakegithub.Bot},
 				},
+			},
+			expect: &canMergeState{sha: "0bd3ed50c88cd53a09316bf7a298f900e9371652"},
+		},
+		{
+			name: "edited legacy notification",
+			comments: []github.IssueComment{
+				{Body: state.notification(), User: github.User{Login: fakegithub.Bot}},
 				{
-					SHA: "some-sha",
+					Body:      fmt.Sprintf(addCanMergeLabelNotification, "0bd3ed50c88cd53a09316bf7a298f900e9371652"),
+					User:      github.User{Login: fakegithub.Bot},
+					CreatedAt: createdAt,
+					UpdatedAt: updatedAt,
 				},
 			},
-			expectGuaranteed: false,
+			expect: state,
 		},
 	}
 
 	for _, testcase := range testcases {
 		tc := testcase
 		t.Run(tc.name, func(t *testing.T) {
-			isGuaranteed := isAllGuaranteed(tc.commits, tc.lastCanMergeSha, logrus.WithField("plugin", PluginName))
-
-			if isGuaranteed != tc.expectGuaranteed {
-				t.Fatalf("=guarantee mismatch: got %v, want %v", isGuaranteed, tc.expectGuaranteed)
+			got := findCanMergeState(tc.comments, botUserChecker)
+			if !reflect.DeepEqual(got, tc.expect) {
+				t.Fatalf("state mismatch: got %v, want %v", got, tc.expect)
 			}
 		})
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -27,6 +28,12 @@ const (
 )
 
 const configInfoAutoUpdatedMessagePrefix = "Auto updated message: "
+const configInfoPriorityOrderPrefix = "The out-of-date PRs are updated in the priority order: "
+const configInfoRebaseUpdateMethod = "The out-of-date PRs are updated by rebase."
+const configInfoFallbackToMerge = "The PRs which cannot be rebased are updated by merge instead."
+const configInfoMaxConcurrentUpdatesPrefix = "The maximum number of the PRs of each branch updated at a time: "
+const configInfoMaxPendingJobsPrefix = "The PRs are not updated when the pending CI jobs of the branch reach: "
+const configInfoBaseRequiredContextsPrefix = "The PRs are not updated when the base branch head fails: "
 const searchQueryPrefix = "archived:false is:pr is:open sort:created-asc"
 
 var sleep = time.Sleep
@@ -38,13 +45,17 @@ type githubClient interface {
 		comments []github.IssueComment, isStale func(github.IssueComment) bool) error
 	GetPullRequest(org, repo string, number int) (*github.PullRequest, error)
 	GetSingleCommit(org, repo, SHA string) (github.RepositoryCommit, error)
-	ListPRCommits(org, repo string, number int) ([]github.RepositoryCommit, error)
+	GetCombinedStatus(org, repo, ref string) (*github.CombinedStatus, error)
+	ListCheckRuns(org, repo, ref string) (*github.CheckRunList, error)
+	ListIssueComments(org, repo string, number int) ([]github.IssueComment, error)
 	UpdatePullRequestBranch(org, repo string, number int, expectedHeadSha *string) error
 	QueryWithGitHubAppsSupport(context.Context, interface{}, map[string]interface{}, string) error
+	MutateWithGitHubAppsSupport(context.Context, interface{}, githubql.Input, map[string]interface{}, string) error
 }
 
 // See: https://developer.github.com/v4/object/pullrequest/.
 type pullRequest struct {
+	ID         githubql.String
 	Number     githubql.Int
 	Repository struct {
 		Name  githubql.String
@@ -58,23 +69,25 @@ type pullRequest struct {
 	BaseRef struct {
 		Name githubql.String
 	}
-	Commits struct {
-		Nodes []struct {
-			Commit struct {
-				OID     githubql.GitObjectID `graphql:"oid"`
-				Parents struct {
-					Nodes []struct {
-						OID githubql.GitObjectID `graphql:"oid"`
-					}
-				} `graphql:"parents(first:5)"`
-			}
-		}
-	} `graphql:"commits(last:20)"`
-	Labels struct {
+	HeadRefName githubql.String
+	HeadRefOid  githubql.GitObjectID
+	CreatedAt   githubql.DateTime
+	Mergeable   githubql.MergeableState
+	Labels      struct {
 		Nodes []struct {
 			Name githubql.String
 		}
 	} `graphql:"labels(first:100)"`
+	TimelineItems struct {
+		Nodes []struct {
+			LabeledEvent struct {
+				CreatedAt githubql.DateTime
+				Label     struct {
+					Name githubql.String
+				}
+			} `graphql:"... on LabeledEvent"`
+		}
+	} `graphql:"timelineItems(itemTypes: [LABELED_EVENT], last: 50)"`
 }
 
 type searchQuery struct {
@@ -112,6 +125,53 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 
 			configInfoStrings = append(configInfoStrings, "<li>"+configInfoAutoUpdatedMessagePrefix+opts.Message+"</li>")
 
+			if len(opts.PriorityOrder) != 0 {
+				var priorities []string
+				for _, priority := range opts.PriorityOrder {
+					var matches []string
+					if len(priority.Labels) != 0 {
+						matches = append(matches, "labels "+strings.Join(priority.Labels, ", "))
+					}
+					if priority.CherryPick {
+						matches = append(matches, "cherry-pick PRs")
+					}
+					priorities = append(priorities, strings.Join(matches, " or "))
+				}
+				configInfoStrings = append(configInfoStrings,
+					"<li>"+configInfoPriorityOrderPrefix+strings.Join(priorities, "; ")+"</li>")
+				isConfigured = true
+			}
+
+			if opts.UpdateMethod == tiexternalplugins.RebaseUpdateMethod {
+				configInfoStrings = append(configInfoStrings, "<li>"+configInfoRebaseUpdateMethod+"</li>")
+				if opts.FallbackToMerge {
+					configInfoStrings = append(configInfoStrings, "<li>"+configInfoFallbackToMerge+"</li>")
+				}
+				isConfigured = true
+			}
+
+			if opts.MaxConcurrentUpdates > 1 {
+				configInfoStrings = append(configInfoStrings,
+					"<li>"+configInfoMaxConcurrentUpdatesPrefix+strconv.Itoa(opts.MaxConcurrentUpdates)+"</li>")
+				isConfigured = true
+			}
+
+			if opts.MaxPendingJobs > 0 {
+				configInfoStrings = append(configInfoStrings,
+					"<li>"+configInfoMaxPendingJobsPrefix+strconv.Itoa(opts.MaxPendingJobs)+"</li>")
+				isConfigured = true
+			}
+
+			if len(opts.BaseRequiredContexts) != 0 {
+				configInfo := configInfoBaseRequiredContextsPrefix + strings.Join(opts.BaseRequiredContexts, ", ")
+				if opts.BaseRedTimeoutMinutes > 0 {
+					configInfo += fmt.Sprintf(", unless it has failed for more than %d minutes",
+						opts.BaseRedTimeoutMinutes)
+				}
+				configInfoStrings = append(configInfoStrings, "<li>"+configInfo+"</li>")
+				isConfigured = true
+			}
+
 			configInfoStrings = append(configInfoStrings, "</ul>")
 			if isConfigured {
 				configInfo[repo.String()] = strings.Join(configInfoStrings, "\n")
@@ -124,6 +184,21 @@ func HelpProvider(epa *tiexternalplugins.ConfigAgent) externalplugins.ExternalPl
 					Message:       "Your PR was out of date, I have automatically updated it for you.",
 					OnlyWhenLabel: "status/can-merge",
 					ExcludeLabels: []string{"do-not-merge/hold"},
+					PriorityOrder: []tiexternalplugins.TarsPriority{
+						{Labels: []string{"priority/critical"}},
+						{CherryPick: true},
+					},
+					UpdateMethod:         tiexternalplugins.RebaseUpdateMethod,
+					FallbackToMerge:      true,
+					MaxConcurrentUpdates: 1,
+					MaxPendingJobs:       20,
+					Branches: map[string]tiexternalplugins.TiCommunityTarsBranchConfig{
+						"master": {
+							MaxConcurrentUpdates: 2,
+						},
+					},
+					BaseRequiredContexts:  []string{"unit-test", "build"},
+					BaseRedTimeoutMinutes: 120,
 				},
 			},
 		})
@@ -176,7 +251,6 @@ func handlePullRequest(log *logrus.Entry, ghc githubClient,
 	org := pr.Base.Repo.Owner.Login
 	repo := pr.Base.Repo.Name
 	number := pr.Number
-	updated := false
 	tars := cfg.TarsFor(org, repo)
 
 	hasTriggerLabel := false
@@ -199,32 +273,21 @@ func handlePullRequest(log *logrus.Entry, ghc githubClient,
 		}
 	}
 
-	prCommits, err := ghc.ListPRCommits(org, repo, pr.Number)
-	if err != nil {
-		return err
-	}
-	if len(prCommits) == 0 {
-		return nil
-	}
-
 	// Check if we update the base into PR.
-	currentBaseCommit, err := ghc.GetSingleCommit(org, repo, pr.Base.Ref)
+	behind, err := behindBy(ghc, org, repo, number, pr.Base.Ref)
 	if err != nil {
 		return err
 	}
-	for _, prCommit := range prCommits {
-		for _, parentCommit := range prCommit.Parents {
-			if parentCommit.SHA == currentBaseCommit.SHA {
-				updated = true
-			}
-		}
-	}
-
-	if updated {
+	if behind == 0 {
 		return nil
 	}
+	if pr.Mergable != nil && !*pr.Mergable {
+		log.Infof("PR %s/%s#%d has conflicts with the base branch.", org, repo, number)
+		return notifyConflict(ghc, org, repo, number, pr.User.Login, pr.Head.SHA)
+	}
 
-	return takeAction(log, ghc, org, repo, number, pr.User.Login, tars.Message)
+	_, err = takeAction(log, ghc, org, repo, number, pr.User.Login, pr.NodeID, pr.Head.SHA, tars)
+	return err
 }
 
 // HandlePushEvent handles a GitHub push event and update the PR.
@@ -252,31 +315,9 @@ func HandlePushEvent(log *logrus.Entry, ghc githubClient, pe *github.PushEvent,
 	if err != nil {
 		return err
 	}
+	sortPullRequests(prs, tars)
 	log.Infof("Considering %d PRs.", len(prs))
-	for i := range prs {
-		pr := prs[i]
-		org := string(pr.Repository.Owner.Login)
-		repo := string(pr.Repository.Name)
-		num := int(pr.Number)
-		l := log.WithFields(logrus.Fields{
-			"org":  org,
-			"repo": repo,
-			"pr":   num,
-		})
-
-		takenAction, err := handle(l, ghc, &pr, cfg)
-		if err != nil {
-			l.WithError(err).Error("Error handling PR.")
-			continue
-		}
-		// Only one PR is processed at a time, because even if other PRs are updated,
-		// they still need to be queued for another update and merge.
-		// To save testing resources we only process one PR at a time.
-		if takenAction {
-			l.Info("Successfully updated and completed this push event response process.")
-			break
-		}
-	}
+	updatePullRequests(log, ghc, prs, cfg)
 	return nil
 }
 
@@ -326,81 +367,32 @@ func HandleAll(log *logrus.Entry, ghc githubClient, config *plugins.Configuratio
 			continue
 		}
 
+		sortPullRequests(prs, tars)
 		log.Infof("Considering %d PRs of %s.", len(prs), repo)
-		branches := make(map[string]bool)
-		for i := range prs {
-			pr := prs[i]
-			org := string(pr.Repository.Owner.Login)
-			repo := string(pr.Repository.Name)
-			num := int(pr.Number)
-			base := string(pr.BaseRef.Name)
-			l := log.WithFields(logrus.Fields{
-				"org":  org,
-				"repo": repo,
-				"pr":   num,
-				"base": base,
-			})
-			// Process only one PR for per branch at a time, because even if other PRs are updated,
-			// they cannot be merged and will generate DOS attacks on the CI system.
-			updated, ok := branches[base]
-			if ok {
-				if updated {
-					continue
-				}
-			} else {
-				branches[base] = false
-			}
-
-			// Try to update.
-			takenAction, err := handle(l, ghc, &pr, externalConfig)
-			if err != nil {
-				l.WithError(err).Error("The PR update failed, but the remaining PRs will be processed anyway.")
-				continue
-			}
-			if takenAction {
-				// Mark this base branch as already having an updated PR.
-				branches[base] = takenAction
-				l.Info("Successfully updated.")
-			}
-		}
+		updatePullRequests(log, ghc, prs, externalConfig)
 	}
 
 	return nil
 }
 
-func handle(log *logrus.Entry, ghc githubClient, pr *pullRequest, cfg *tiexternalplugins.Configuration) (bool, error) {
+// handle updates the PR if it is behind the base branch by the commits, it returns false if the PR is not updated.
+func handle(log *logrus.Entry, ghc githubClient, pr *pullRequest, behind int,
+	cfg *tiexternalplugins.Configuration) (bool, error) {
 	org := string(pr.Repository.Owner.Login)
 	repo := string(pr.Repository.Name)
 	number := int(pr.Number)
-	updated := false
 	tars := cfg.TarsFor(org, repo)
 
-	// Must be at least one commit.
-	if len(pr.Commits.Nodes) == 0 {
-		return false, nil
-	}
-
 	// Check if we update the base into PR.
-	currentBaseCommit, err := ghc.GetSingleCommit(org, repo, string(pr.BaseRef.Name))
-	if err != nil {
-		return false, err
-	}
-
-check:
-	for _, prCommit := range pr.Commits.Nodes {
-		for _, prCommitParent := range prCommit.Commit.Parents.Nodes {
-			if string(prCommitParent.OID) == currentBaseCommit.SHA {
-				updated = true
-				break check
-			}
-		}
-	}
-
-	if updated {
+	if behind == 0 {
 		return false, nil
 	}
+	if pr.Mergeable == githubql.MergeableStateConflicting {
+		log.Infof("PR %s/%s#%d has conflicts with the base branch.", org, repo, number)
+		return false, notifyConflict(ghc, org, repo, number, string(pr.Author.Login), string(pr.HeadRefOid))
+	}
 
-	return true, takeAction(log, ghc, org, repo, number, string(pr.Author.Login), tars.Message)
+	return takeAction(log, ghc, org, repo, number, string(pr.Author.Login), string(pr.ID), string(pr.HeadRefOid), tars)
 }
 
 func search(ctx context.Context, log *logrus.Entry, ghc githubClient, org, q string) ([]pullRequest, error) {
@@ -430,35 +422,42 @@ func search(ctx context.Context, log *logrus.Entry, ghc githubClient, org, q str
 	return ret, nil
 }
 
-// takeAction updates the PR and comment ont it.
+// takeAction updates the PR and comment ont it, it returns false if the PR is left out of date.
 func takeAction(log *logrus.Entry, ghc githubClient, org, repo string, num int,
-	author string, message string) error {
+	author, nodeID, headSHA string, tars *tiexternalplugins.TiCommunityTars) (bool, error) {
 	botUserChecker, err := ghc.BotUserChecker()
 	if err != nil {
-		return err
+		return false, err
 	}
+	message := tars.Message
 	needsReply := len(message) != 0
 
 	if needsReply {
 		err = ghc.DeleteStaleComments(org, repo, num, nil, shouldPrune(botUserChecker, message))
 		if err != nil {
-			return err
+			return false, err
 		}
 	}
 
 	log.Infof("Update PR %s/%s#%d.", org, repo, num)
-	err = ghc.UpdatePullRequestBranch(org, repo, num, nil)
+	updated, notice, err := updatePullRequestBranch(log, ghc, org, repo, num, nodeID, headSHA, tars)
 	if err != nil {
-		return err
+		return false, err
 	}
-	if needsReply {
+	if !updated {
+		return false, notifyRebaseFailure(ghc, org, repo, num, author, headSHA, notice)
+	}
+	if len(notice) != 0 {
+		message = strings.TrimSpace(notice + "\n\n" + message)
+	}
+	if len(message) != 0 {
 		// Delay the reply because we may trigger the test in the reply.
 		// See: https://github.com/ti-community-infra/tichi/issues/181.
 		sleep(time.Second * 5)
 		msg := tiexternalplugins.FormatSimpleResponse(author, message)
-		return ghc.CreateComment(org, repo, num, msg)
+		return true, ghc.CreateComment(org, repo, num, msg)
 	}
-	return nil
+	return true, nil
 }
 
 func shouldPrune(isBot func(string) bool, message string) func(github.IssueComment) bool {
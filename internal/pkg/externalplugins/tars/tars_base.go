@@ -0,0 +1,188 @@
+package tars
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/github"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+// checkRunStatusCompleted is the status of the completed check runs, the others are queued or in progress.
+const checkRunStatusCompleted = "completed"
+
+// failedCheckRunConclusions specifies the conclusions of the failed check runs.
+var failedCheckRunConclusions = sets.NewString("failure", "timed_out", "cancelled", "action_required")
+
+var timeNow = time.Now
+
+// Postponement records why the updates of the PRs of a base branch are postponed.
+type Postponement struct {
+	Org    string `json:"org"`
+	Repo   string `json:"repo"`
+	Branch string `json:"branch"`
+	// SHA is the SHA of the base branch head.
+	SHA    string `json:"sha"`
+	Reason string `json:"reason"`
+	// Since is the time when the updates are postponed for the base branch head at first.
+	Since time.Time `json:"since"`
+}
+
+// postponementTracker tracks the base branches whose updates are postponed.
+type postponementTracker struct {
+	sync.Mutex
+	postponements map[string]Postponement
+}
+
+// postponements tracks the postponed base branches of all repos, which are exposed by the PostponementHandler.
+var postponements = &postponementTracker{postponements: make(map[string]Postponement)}
+
+// set records the postponement of the base branch, or clears it if the postponement is nil.
+func (t *postponementTracker) set(key string, postponement *Postponement) {
+	t.Lock()
+	defer t.Unlock()
+	if postponement == nil {
+		delete(t.postponements, key)
+		return
+	}
+	if previous, ok := t.postponements[key]; ok && previous.SHA == postponement.SHA {
+		postponement.Since = previous.Since
+	}
+	t.postponements[key] = *postponement
+}
+
+// list returns the postponements in the order of the base branches.
+func (t *postponementTracker) list() []Postponement {
+	t.Lock()
+	defer t.Unlock()
+	keys := make([]string, 0, len(t.postponements))
+	for key := range t.postponements {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	postponements := make([]Postponement, 0, len(keys))
+	for _, key := range keys {
+		postponements = append(postponements, t.postponements[key])
+	}
+	return postponements
+}
+
+// checkBaseBranch returns the reason why the updates of the PRs of the base branch should be postponed,
+// it is empty if the base branch head does not fail any of the required contexts.
+func checkBaseBranch(log *logrus.Entry, ghc githubClient, org, repo, base string,
+	tars *tiexternalplugins.TiCommunityTars) (string, error) {
+	postponement, err := basePostponement(log, ghc, org, repo, base, tars)
+	if err != nil {
+		return "", err
+	}
+	postponements.set(org+"/"+repo+":"+base, postponement)
+	if postponement == nil {
+		return "", nil
+	}
+	return postponement.Reason, nil
+}
+
+// basePostponement returns the postponement of the base branch without recording it,
+// it is nil if the updates of the PRs of the base branch should not be postponed.
+func basePostponement(log *logrus.Entry, ghc githubClient, org, repo, base string,
+	tars *tiexternalplugins.TiCommunityTars) (*Postponement, error) {
+	if len(tars.BaseRequiredContexts) == 0 {
+		return nil, nil
+	}
+
+	head, err := ghc.GetSingleCommit(org, repo, base)
+	if err != nil {
+		return nil, err
+	}
+	failedContexts, err := listFailedContexts(ghc, org, repo, head.SHA, tars.BaseRequiredContexts)
+	if err != nil {
+		return nil, err
+	}
+	if len(failedContexts) == 0 {
+		return nil, nil
+	}
+
+	now := timeNow()
+	timeout := time.Duration(tars.BaseRedTimeoutMinutes) * time.Minute
+	if timeout > 0 && now.Sub(head.Commit.Committer.Date) >= timeout {
+		log.Infof("The base branch %s head %s fails %s for more than %v, update the PRs anyway.",
+			base, head.SHA, strings.Join(failedContexts, ", "), timeout)
+		return nil, nil
+	}
+
+	return &Postponement{
+		Org:    org,
+		Repo:   repo,
+		Branch: base,
+		SHA:    head.SHA,
+		Reason: fmt.Sprintf("the base branch head %s fails %s", head.SHA, strings.Join(failedContexts, ", ")),
+		Since:  now,
+	}, nil
+}
+
+// listFailedContexts returns the required contexts which fail on the commit,
+// according to both of the commit statuses and the check runs.
+func listFailedContexts(ghc githubClient, org, repo, sha string, requiredContexts []string) ([]string, error) {
+	required := sets.NewString(requiredContexts...)
+	failed := sets.NewString()
+
+	combinedStatus, err := ghc.GetCombinedStatus(org, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range combinedStatus.Statuses {
+		if required.Has(status.Context) &&
+			(status.State == github.StatusFailure || status.State == github.StatusError) {
+			failed.Insert(status.Context)
+		}
+	}
+
+	checkRuns, err := ghc.ListCheckRuns(org, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	for _, checkRun := range checkRuns.CheckRuns {
+		if required.Has(checkRun.Name) && failedCheckRunConclusions.Has(checkRun.Conclusion) {
+			failed.Insert(checkRun.Name)
+		}
+	}
+	return failed.List(), nil
+}
+
+// PostponementResponse specifies the response to the request to list the postponements.
+type PostponementResponse struct {
+	Data    []Postponement `json:"data"`
+	Message string         `json:"message,omitempty"`
+}
+
+// PostponementHandler serves the HTTP API to list the base branches whose updates are postponed,
+// such as GET /postponements.
+type PostponementHandler struct {
+	Log *logrus.Entry
+}
+
+func (h *PostponementHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := &PostponementResponse{}
+	code := http.StatusOK
+	if r.Method != http.MethodGet {
+		code = http.StatusMethodNotAllowed
+		resp.Message = "Only GET is allowed."
+	} else {
+		resp.Data = postponements.list()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.Log.WithError(err).Error("Failed to write the postponement response.")
+	}
+}
@@ -0,0 +1,184 @@
+package tars
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestPostponeUpdatesForFailingBase(t *testing.T) {
+	oldSleep := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = oldSleep }()
+	timeNow = func() time.Time {
+		return time.Date(2021, 6, 1, 2, 0, 0, 0, time.UTC)
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	baseHead := github.RepositoryCommit{SHA: "base"}
+	baseHead.Commit.Committer.Date = time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name                  string
+		requiredContexts      []string
+		baseRedTimeoutMinutes int
+		statuses              []github.Status
+		checkRuns             []github.CheckRun
+
+		expectUpdated   []int
+		expectPostponed bool
+	}{
+		{
+			name:          "no required contexts",
+			statuses:      []github.Status{{Context: "unit-test", State: github.StatusFailure}},
+			expectUpdated: []int{1},
+		},
+		{
+			name:             "required status fails",
+			requiredContexts: []string{"unit-test", "build"},
+			statuses: []github.Status{
+				{Context: "unit-test", State: github.StatusFailure},
+				{Context: "build", State: github.StatusSuccess},
+			},
+			expectPostponed: true,
+		},
+		{
+			name:             "required check run fails",
+			requiredContexts: []string{"unit-test"},
+			checkRuns:        []github.CheckRun{{Name: "unit-test", Status: "completed", Conclusion: "timed_out"}},
+			expectPostponed:  true,
+		},
+		{
+			name:             "not required context fails",
+			requiredContexts: []string{"build"},
+			statuses:         []github.Status{{Context: "unit-test", State: github.StatusError}},
+			checkRuns:        []github.CheckRun{{Name: "lint", Status: "completed", Conclusion: "failure"}},
+			expectUpdated:    []int{1},
+		},
+		{
+			name:             "required context is pending",
+			requiredContexts: []string{"unit-test"},
+			statuses:         []github.Status{{Context: "unit-test", State: github.StatusPending}},
+			expectUpdated:    []int{1},
+		},
+		{
+			name:                  "failing within the timeout",
+			requiredContexts:      []string{"unit-test"},
+			baseRedTimeoutMinutes: 180,
+			statuses:              []github.Status{{Context: "unit-test", State: github.StatusFailure}},
+			expectPostponed:       true,
+		},
+		{
+			name:                  "failing for more than the timeout",
+			requiredContexts:      []string{"unit-test"},
+			baseRedTimeoutMinutes: 60,
+			statuses:              []github.Status{{Context: "unit-test", State: github.StatusFailure}},
+			expectUpdated:         []int{1},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			externalConfig := &externalplugins.Configuration{}
+			externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
+				{
+					Repos:                 []string{"org/repo"},
+					OnlyWhenLabel:         "trigger-update",
+					BaseRequiredContexts:  tc.requiredContexts,
+					BaseRedTimeoutMinutes: tc.baseRedTimeoutMinutes,
+				},
+			}
+			prs := []pullRequest{newPriorityPullRequest(1, "feature", 1, 1)}
+			newClient := func() *fakeGithub {
+				fc := newFakeGithubClient(prs, nil, true)
+				fc.baseHead = baseHead
+				fc.statuses = map[string][]github.Status{"base": tc.statuses}
+				fc.checkRuns = map[string][]github.CheckRun{"base": tc.checkRuns}
+				return fc
+			}
+			check := func(fc *fakeGithub) {
+				if !reflect.DeepEqual(fc.updated, tc.expectUpdated) {
+					t.Errorf("updated PRs mismatch: got %v, want %v", fc.updated, tc.expectUpdated)
+				}
+				list := postponements.list()
+				if postponed := len(list) != 0; postponed != tc.expectPostponed {
+					t.Errorf("postponed mismatch: got %v, want %v", list, tc.expectPostponed)
+				}
+			}
+
+			fc := newClient()
+			pe := &github.PushEvent{
+				Ref:  "refs/heads/main",
+				Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+			if err := HandlePushEvent(logrus.WithField("plugin", PluginName), fc, pe, externalConfig); err != nil {
+				t.Fatalf("error handling push event: %v", err)
+			}
+			check(fc)
+
+			fc = newClient()
+			config := &plugins.Configuration{
+				ExternalPlugins: map[string][]plugins.ExternalPlugin{
+					"org/repo": {{Name: PluginName}},
+				},
+			}
+			if err := HandleAll(logrus.WithField("plugin", PluginName), fc, config, externalConfig); err != nil {
+				t.Fatalf("error handling all PRs: %v", err)
+			}
+			check(fc)
+		})
+	}
+}
+
+func TestPostponementHandler(t *testing.T) {
+	since := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	postponements.set("org/repo:main", &Postponement{
+		Org:    "org",
+		Repo:   "repo",
+		Branch: "main",
+		SHA:    "base",
+		Reason: "the base branch head base fails unit-test",
+		Since:  since,
+	})
+	// The time since the postponement is kept for the same base branch head.
+	postponements.set("org/repo:main", &Postponement{
+		Org:    "org",
+		Repo:   "repo",
+		Branch: "main",
+		SHA:    "base",
+		Reason: "the base branch head base fails unit-test",
+		Since:  since.Add(time.Hour),
+	})
+	defer postponements.set("org/repo:main", nil)
+	handler := &PostponementHandler{Log: logrus.WithField("plugin", PluginName)}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/postponements", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("code mismatch: got %d, want %d", recorder.Code, http.StatusOK)
+	}
+	var resp PostponementResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to unmarshal the response: %v", err)
+	}
+	if len(resp.Data) != 1 || resp.Data[0].Branch != "main" || !resp.Data[0].Since.Equal(since) {
+		t.Errorf("unexpected postponements: %v", resp.Data)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/postponements", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("code mismatch: got %d, want %d", recorder.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,199 @@
+package tars
+
+import (
+	"github.com/sirupsen/logrus"
+	"k8s.io/test-infra/prow/github"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+// branchUpdates tracks the updates of the PRs of a base branch in one pass.
+type branchUpdates struct {
+	// updated is the number of the PRs updated in this pass.
+	updated int
+	// checkedBase specifies whether the base branch head has been checked.
+	checkedBase bool
+	// checked specifies whether the pending CI jobs of the branch have been checked.
+	checked bool
+	// busy specifies that the PRs of the branch are not updated in this pass, because the base branch head
+	// fails or the pending CI jobs of the branch reach the threshold.
+	busy bool
+	// behind records the number of the commits of the base branch which are not in each compared PR.
+	behind map[int]int
+}
+
+// behindBy returns the number of the commits of the base branch which are not in the PR,
+// each PR is compared only once in a pass, and the PRs of the branch are usually compared in one batch.
+func (s *branchUpdates) behindBy(ghc githubClient, org, repo string, num int, base string) (int, error) {
+	if behind, ok := s.behind[num]; ok {
+		return behind, nil
+	}
+	behind, err := behindBy(ghc, org, repo, num, base)
+	if err != nil {
+		return 0, err
+	}
+	if s.behind == nil {
+		s.behind = make(map[int]int)
+	}
+	s.behind[num] = behind
+	return behind, nil
+}
+
+// updatePullRequests updates the out-of-date PRs in order. At most max_concurrent_updates PRs of each base branch
+// are updated, because even if more PRs are updated, they still need to be queued for another update and merge.
+// The PRs of the base branch are not updated when its head fails or its pending CI jobs reach the threshold.
+func updatePullRequests(log *logrus.Entry, ghc githubClient, prs []pullRequest, cfg *tiexternalplugins.Configuration) {
+	branches := make(map[string]*branchUpdates)
+	for i := range prs {
+		pr := prs[i]
+		org := string(pr.Repository.Owner.Login)
+		repo := string(pr.Repository.Name)
+		num := int(pr.Number)
+		base := string(pr.BaseRef.Name)
+		l := log.WithFields(logrus.Fields{
+			"org":  org,
+			"repo": repo,
+			"pr":   num,
+			"base": base,
+		})
+
+		key := org + "/" + repo + ":" + base
+		state, ok := branches[key]
+		if !ok {
+			state = &branchUpdates{}
+			branches[key] = state
+		}
+		tars := cfg.TarsFor(org, repo)
+		maxConcurrentUpdates, maxPendingJobs := branchLimits(tars, base)
+		if state.busy || state.updated >= maxConcurrentUpdates {
+			continue
+		}
+
+		if !state.checkedBase {
+			state.checkedBase = true
+			reason, err := checkBaseBranch(l, ghc, org, repo, base, tars)
+			if err != nil {
+				l.WithError(err).Warn("Failed to check the base branch, the PRs are updated anyway.")
+			} else if len(reason) != 0 {
+				l.Infof("Postpone updating the PRs of %s, because %s.", base, reason)
+				state.busy = true
+				continue
+			}
+		}
+
+		if state.behind == nil {
+			behind, err := listBehindBy(ghc, org, repo, base, pullRequestNumbers(prs, org, repo, base))
+			if err != nil {
+				l.WithError(err).Warn("Failed to compare the PRs with the base branch, they are compared one by one.")
+				behind = make(map[int]int)
+			}
+			state.behind = behind
+		}
+
+		if maxPendingJobs > 0 && !state.checked {
+			state.checked = true
+			pendingJobs, err := countPendingJobs(ghc, prs, org, repo, base, state)
+			if err != nil {
+				l.WithError(err).Warn("Failed to count the pending CI jobs, the PRs are updated anyway.")
+			} else if pendingJobs >= maxPendingJobs {
+				l.Infof("Skip updating the PRs of %s, there are %d pending CI jobs, reaching the threshold %d.",
+					base, pendingJobs, maxPendingJobs)
+				state.busy = true
+				continue
+			}
+		}
+
+		// Try to update.
+		behind, err := state.behindBy(ghc, org, repo, num, base)
+		if err != nil {
+			l.WithError(err).Error("Failed to compare the PR with the base branch, " +
+				"but the remaining PRs will be processed anyway.")
+			continue
+		}
+		takenAction, err := handle(l, ghc, &pr, behind, cfg)
+		if err != nil {
+			l.WithError(err).Error("The PR update failed, but the remaining PRs will be processed anyway.")
+			continue
+		}
+		if takenAction {
+			state.updated++
+			l.Info("Successfully updated.")
+		}
+	}
+}
+
+// branchLimits returns the maximum number of the concurrent updates and the pending CI jobs of the base branch,
+// the branch level configuration overrides the repository level configuration.
+func branchLimits(tars *tiexternalplugins.TiCommunityTars, branch string) (int, int) {
+	maxConcurrentUpdates := tars.MaxConcurrentUpdates
+	maxPendingJobs := tars.MaxPendingJobs
+	if branchConfig, ok := tars.Branches[branch]; ok {
+		if branchConfig.MaxConcurrentUpdates > 0 {
+			maxConcurrentUpdates = branchConfig.MaxConcurrentUpdates
+		}
+		if branchConfig.MaxPendingJobs > 0 {
+			maxPendingJobs = branchConfig.MaxPendingJobs
+		}
+	}
+	if maxConcurrentUpdates <= 0 {
+		maxConcurrentUpdates = 1
+	}
+	return maxConcurrentUpdates, maxPendingJobs
+}
+
+// pullRequestNumbers returns the numbers of the PRs of the base branch.
+func pullRequestNumbers(prs []pullRequest, org, repo, base string) []int {
+	var nums []int
+	for i := range prs {
+		pr := &prs[i]
+		if string(pr.Repository.Owner.Login) == org && string(pr.Repository.Name) == repo &&
+			string(pr.BaseRef.Name) == base {
+			nums = append(nums, int(pr.Number))
+		}
+	}
+	return nums
+}
+
+// countPendingJobs counts the pending CI jobs of the PRs which have been updated with the base branch,
+// according to the pending commit statuses and the check runs which are not completed of their heads.
+// The PRs are compared with the base branch by the state of the updates of the branch, so that each PR
+// is compared only once in a pass.
+func countPendingJobs(ghc githubClient, prs []pullRequest, org, repo, base string,
+	state *branchUpdates) (int, error) {
+	pendingJobs := 0
+	for i := range prs {
+		pr := &prs[i]
+		if string(pr.Repository.Owner.Login) != org || string(pr.Repository.Name) != repo ||
+			string(pr.BaseRef.Name) != base {
+			continue
+		}
+		behind, err := state.behindBy(ghc, org, repo, int(pr.Number), base)
+		if err != nil {
+			return 0, err
+		}
+		if behind != 0 {
+			continue
+		}
+
+		combinedStatus, err := ghc.GetCombinedStatus(org, repo, string(pr.HeadRefOid))
+		if err != nil {
+			return 0, err
+		}
+		for _, status := range combinedStatus.Statuses {
+			if status.State == github.StatusPending {
+				pendingJobs++
+			}
+		}
+
+		checkRuns, err := ghc.ListCheckRuns(org, repo, string(pr.HeadRefOid))
+		if err != nil {
+			return 0, err
+		}
+		for _, checkRun := range checkRuns.CheckRuns {
+			if checkRun.Status != checkRunStatusCompleted {
+				pendingJobs++
+			}
+		}
+	}
+	return pendingJobs, nil
+}
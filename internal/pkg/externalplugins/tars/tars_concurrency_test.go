@@ -0,0 +1,211 @@
+package tars
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestUpdateConcurrently(t *testing.T) {
+	oldSleep := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = oldSleep }()
+
+	// The PR #4 has been updated with the current base and its CI jobs are running.
+	upToDatePR := newPriorityPullRequest(4, "feature", 4, 4)
+	upToDatePR.HeadRefOid = "head4"
+	prs := []pullRequest{
+		newPriorityPullRequest(1, "feature", 1, 1),
+		newPriorityPullRequest(2, "feature", 2, 2),
+		newPriorityPullRequest(3, "feature", 3, 3),
+		upToDatePR,
+	}
+	statuses := map[string][]github.Status{
+		"head4": {
+			{Context: "unit-test", State: github.StatusPending},
+			{Context: "integration-test", State: github.StatusPending},
+			{Context: "build", State: github.StatusSuccess},
+		},
+	}
+
+	testcases := []struct {
+		name                 string
+		maxConcurrentUpdates int
+		maxPendingJobs       int
+		branches             map[string]externalplugins.TiCommunityTarsBranchConfig
+
+		expectUpdated []int
+	}{
+		{
+			name:          "update one PR by default",
+			expectUpdated: []int{1},
+		},
+		{
+			name:                 "update multiple PRs",
+			maxConcurrentUpdates: 2,
+			expectUpdated:        []int{1, 2},
+		},
+		{
+			name:                 "branch overrides the concurrency",
+			maxConcurrentUpdates: 2,
+			branches: map[string]externalplugins.TiCommunityTarsBranchConfig{
+				"main": {MaxConcurrentUpdates: 5},
+			},
+			expectUpdated: []int{1, 2, 3},
+		},
+		{
+			name:           "pending CI jobs below the threshold",
+			maxPendingJobs: 3,
+			expectUpdated:  []int{1},
+		},
+		{
+			name:           "pending CI jobs reach the threshold",
+			maxPendingJobs: 2,
+		},
+		{
+			name:           "branch overrides the threshold",
+			maxPendingJobs: 2,
+			branches: map[string]externalplugins.TiCommunityTarsBranchConfig{
+				"main": {MaxPendingJobs: 10},
+			},
+			expectUpdated: []int{1},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			externalConfig := &externalplugins.Configuration{}
+			externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
+				{
+					Repos:                []string{"org/repo"},
+					OnlyWhenLabel:        "trigger-update",
+					MaxConcurrentUpdates: tc.maxConcurrentUpdates,
+					MaxPendingJobs:       tc.maxPendingJobs,
+					Branches:             tc.branches,
+				},
+			}
+
+			fc := newFakeGithubClient(prs, nil, true)
+			fc.behind = map[int]int{4: 0}
+			fc.statuses = statuses
+			pe := &github.PushEvent{
+				Ref:  "refs/heads/main",
+				Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+			}
+			if err := HandlePushEvent(logrus.WithField("plugin", PluginName), fc, pe, externalConfig); err != nil {
+				t.Fatalf("error handling push event: %v", err)
+			}
+			if !reflect.DeepEqual(fc.updated, tc.expectUpdated) {
+				t.Errorf("updated PRs mismatch for the push event: got %v, want %v", fc.updated, tc.expectUpdated)
+			}
+			// The PRs of the branch are compared in one batch.
+			if fc.compareQueries != 1 {
+				t.Errorf("expected the PRs to be compared in one query, but got %d queries", fc.compareQueries)
+			}
+
+			fc = newFakeGithubClient(prs, nil, true)
+			fc.behind = map[int]int{4: 0}
+			fc.statuses = statuses
+			config := &plugins.Configuration{
+				ExternalPlugins: map[string][]plugins.ExternalPlugin{
+					"org/repo": {{Name: PluginName}},
+				},
+			}
+			if err := HandleAll(logrus.WithField("plugin", PluginName), fc, config, externalConfig); err != nil {
+				t.Fatalf("error handling all PRs: %v", err)
+			}
+			if !reflect.DeepEqual(fc.updated, tc.expectUpdated) {
+				t.Errorf("updated PRs mismatch for the periodic update: got %v, want %v", fc.updated, tc.expectUpdated)
+			}
+		})
+	}
+}
+
+func TestBranchLimits(t *testing.T) {
+	tars := &externalplugins.TiCommunityTars{
+		MaxPendingJobs: 10,
+		Branches: map[string]externalplugins.TiCommunityTarsBranchConfig{
+			"master":      {MaxConcurrentUpdates: 3},
+			"release-5.0": {MaxPendingJobs: 5},
+		},
+	}
+
+	var testcases = []struct {
+		branch                     string
+		expectMaxConcurrentUpdates int
+		expectMaxPendingJobs       int
+	}{
+		{branch: "master", expectMaxConcurrentUpdates: 3, expectMaxPendingJobs: 10},
+		{branch: "release-5.0", expectMaxConcurrentUpdates: 1, expectMaxPendingJobs: 5},
+		{branch: "release-4.0", expectMaxConcurrentUpdates: 1, expectMaxPendingJobs: 10},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.branch, func(t *testing.T) {
+			maxConcurrentUpdates, maxPendingJobs := branchLimits(tars, tc.branch)
+			if maxConcurrentUpdates != tc.expectMaxConcurrentUpdates {
+				t.Errorf("max concurrent updates mismatch: got %d, want %d",
+					maxConcurrentUpdates, tc.expectMaxConcurrentUpdates)
+			}
+			if maxPendingJobs != tc.expectMaxPendingJobs {
+				t.Errorf("max pending jobs mismatch: got %d, want %d", maxPendingJobs, tc.expectMaxPendingJobs)
+			}
+		})
+	}
+}
+
+func TestCountPendingJobs(t *testing.T) {
+	outOfDatePR := newPriorityPullRequest(1, "feature", 1, 1)
+	outOfDatePR.HeadRefOid = "head1"
+	upToDatePR := newPriorityPullRequest(2, "feature", 2, 2)
+	upToDatePR.HeadRefOid = "head2"
+	otherBranchPR := newPriorityPullRequest(3, "feature", 3, 3)
+	otherBranchPR.BaseRef.Name = "release-5.0"
+	otherBranchPR.HeadRefOid = "head3"
+	prs := []pullRequest{outOfDatePR, upToDatePR, otherBranchPR}
+
+	fc := newFakeGithubClient(prs, nil, true)
+	fc.behind = map[int]int{2: 0, 3: 0}
+	fc.statuses = map[string][]github.Status{
+		"head1": {{Context: "unit-test", State: github.StatusPending}},
+		"head2": {
+			{Context: "unit-test", State: github.StatusPending},
+			{Context: "build", State: github.StatusSuccess},
+		},
+		"head3": {{Context: "unit-test", State: github.StatusPending}},
+	}
+	fc.checkRuns = map[string][]github.CheckRun{
+		"head2": {
+			{Name: "lint", Status: "in_progress"},
+			{Name: "e2e", Status: "queued"},
+			{Name: "docs", Status: "completed", Conclusion: "success"},
+		},
+	}
+
+	state := &branchUpdates{}
+	pendingJobs, err := countPendingJobs(fc, prs, "org", "repo", "main", state)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pendingJobs != 3 {
+		t.Errorf("expected 3 pending jobs, but got %d", pendingJobs)
+	}
+
+	// The compared PRs are not compared again in the same pass.
+	for _, pr := range prs[:2] {
+		if _, err := state.behindBy(fc, "org", "repo", int(pr.Number), "main"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	expectCompared := []string{"refs/heads/main...refs/pull/1/head", "refs/heads/main...refs/pull/2/head"}
+	if !reflect.DeepEqual(fc.compared, expectCompared) {
+		t.Errorf("compared refs mismatch: got %v, want %v", fc.compared, expectCompared)
+	}
+}
@@ -0,0 +1,155 @@
+package tars
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	githubql "github.com/shurcooL/githubv4"
+	"k8s.io/test-infra/prow/github"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+const (
+	// conflictMarkerFormat is the hidden marker of the comment about the conflicts of the PR head.
+	conflictMarkerFormat = "<!-- ti-community-tars conflict: %s -->"
+
+	conflictMessage = "Your PR is out of date, but I could not update it because it has conflicts " +
+		"with the base branch.\n\nPlease resolve the conflicts manually."
+)
+
+// conflictMarkerRe matches the marker of the comment about the conflicts.
+var conflictMarkerRe = regexp.MustCompile(`<!-- ti-community-tars conflict: \S+ -->`)
+
+// compareBatchSize specifies the max number of the PRs compared with the base branch in one query.
+const compareBatchSize = 50
+
+// comparison is the comparison between the base branch and the head of a PR, it is null if the head ref
+// can not be resolved. See: https://docs.github.com/en/graphql/reference/objects#comparison.
+type comparison struct {
+	AheadBy  githubql.Int
+	BehindBy githubql.Int
+}
+
+// pullHeadRef returns the pull ref of the head of the PR in the base repo, so that the PRs from the forks
+// can be compared with the base branch in the base repo.
+func pullHeadRef(num int) string {
+	return fmt.Sprintf("refs/pull/%d/head", num)
+}
+
+// newCompareQuery returns the query which compares the heads of the PRs with the base branch in one request,
+// the comparison of each PR is a field of the base ref aliased by the number of the PR, such as:
+//
+//	repository(owner: $owner, name: $name) {
+//	  ref(qualifiedName: $baseRef) {
+//	    pr1: compare(headRef: $head0) { aheadBy behindBy }
+//	    pr2: compare(headRef: $head1) { aheadBy behindBy }
+//	  }
+//	}
+func newCompareQuery(nums []int, vars map[string]interface{}) reflect.Value {
+	fields := make([]reflect.StructField, 0, len(nums))
+	for i, num := range nums {
+		head := fmt.Sprintf("head%d", i)
+		vars[head] = githubql.String(pullHeadRef(num))
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Compare%d", i),
+			Type: reflect.TypeOf(&comparison{}),
+			Tag:  reflect.StructTag(fmt.Sprintf(`graphql:"pr%d: compare(headRef: $%s)"`, num, head)),
+		})
+	}
+	refType := reflect.StructOf([]reflect.StructField{{
+		Name: "Ref",
+		Type: reflect.StructOf(fields),
+		Tag:  `graphql:"ref(qualifiedName: $baseRef)"`,
+	}})
+	queryType := reflect.StructOf([]reflect.StructField{{
+		Name: "Repository",
+		Type: refType,
+		Tag:  `graphql:"repository(owner: $owner, name: $name)"`,
+	}})
+	return reflect.New(queryType)
+}
+
+// listBehindBy returns the number of the commits of the base branch which are not in each PR. The PRs are
+// compared in batches instead of one request for each PR, each batch is one query with a comparison for each PR.
+// The PRs which can not be compared are left out.
+func listBehindBy(ghc githubClient, org, repo, base string, nums []int) (map[int]int, error) {
+	behind := make(map[int]int, len(nums))
+	for start := 0; start < len(nums); start += compareBatchSize {
+		end := start + compareBatchSize
+		if end > len(nums) {
+			end = len(nums)
+		}
+		batch := nums[start:end]
+
+		vars := map[string]interface{}{
+			"owner":   githubql.String(org),
+			"name":    githubql.String(repo),
+			"baseRef": githubql.String(branchRefsPrefix + base),
+		}
+		q := newCompareQuery(batch, vars)
+		if err := ghc.QueryWithGitHubAppsSupport(context.Background(), q.Interface(), vars, org); err != nil {
+			return nil, fmt.Errorf("failed to compare the PRs with the base branch %s: %v", base, err)
+		}
+
+		ref := q.Elem().FieldByName("Repository").FieldByName("Ref")
+		for i, num := range batch {
+			// The missing comparison must not be taken as up to date.
+			if c, ok := ref.Field(i).Interface().(*comparison); ok && c != nil {
+				behind[num] = int(c.BehindBy)
+			}
+		}
+	}
+	return behind, nil
+}
+
+// behindBy returns the number of the commits of the base branch which are not in the PR.
+func behindBy(ghc githubClient, org, repo string, num int, base string) (int, error) {
+	behind, err := listBehindBy(ghc, org, repo, base, []int{num})
+	if err != nil {
+		return 0, err
+	}
+	n, ok := behind[num]
+	if !ok {
+		return 0, fmt.Errorf("failed to compare %s with the base branch %s", pullHeadRef(num), base)
+	}
+	return n, nil
+}
+
+// notifyConflict comments the notice about the conflicts on the PR instead of updating it.
+func notifyConflict(ghc githubClient, org, repo string, num int, author, headSHA string) error {
+	return notifyOnce(ghc, org, repo, num, author, fmt.Sprintf(conflictMarkerFormat, headSHA),
+		conflictMarkerRe, conflictMessage)
+}
+
+// notifyOnce comments the notice with the marker on the PR only once for each head commit, because the
+// out-of-date PRs are checked periodically. The stale notices of the previous head commits are deleted.
+func notifyOnce(ghc githubClient, org, repo string, num int, author, marker string,
+	markerRe *regexp.Regexp, notice string) error {
+	botUserChecker, err := ghc.BotUserChecker()
+	if err != nil {
+		return err
+	}
+	comments, err := ghc.ListIssueComments(org, repo, num)
+	if err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		if botUserChecker(comment.User.Login) && strings.Contains(comment.Body, marker) {
+			return nil
+		}
+	}
+
+	isStale := func(ic github.IssueComment) bool {
+		return botUserChecker(ic.User.Login) && markerRe.MatchString(ic.Body)
+	}
+	if err := ghc.DeleteStaleComments(org, repo, num, comments, isStale); err != nil {
+		return err
+	}
+	msg := tiexternalplugins.FormatSimpleResponse(author, notice) + "\n" + marker
+	return ghc.CreateComment(org, repo, num, msg)
+}
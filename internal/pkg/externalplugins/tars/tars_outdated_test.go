@@ -0,0 +1,181 @@
+package tars
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestBehindBy(t *testing.T) {
+	fc := newFakeGithubClient(nil, nil, false)
+	fc.behind = map[int]int{5: 3}
+
+	behind, err := behindBy(fc, "org", "repo", 5, "release-5.0")
+	if err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if behind != 3 {
+		t.Errorf("behind mismatch: got %d, want %d", behind, 3)
+	}
+	// The head of the PR from the fork is referred by the pull ref of the base repo.
+	expectCompared := []string{"refs/heads/release-5.0...refs/pull/5/head"}
+	if !reflect.DeepEqual(fc.compared, expectCompared) {
+		t.Errorf("compared refs mismatch: got %v, want %v", fc.compared, expectCompared)
+	}
+}
+
+func TestListBehindBy(t *testing.T) {
+	fc := newFakeGithubClient(nil, nil, false)
+	fc.behind = map[int]int{1: 3}
+	fc.unresolved = map[int]bool{2: true}
+
+	var nums []int
+	for num := 1; num <= compareBatchSize+1; num++ {
+		nums = append(nums, num)
+	}
+	behind, err := listBehindBy(fc, "org", "repo", "master", nums)
+	if err != nil {
+		t.Fatalf("didn't expect error: %v", err)
+	}
+	if fc.compareQueries != 2 {
+		t.Errorf("expected the PRs to be compared in 2 queries, but got %d", fc.compareQueries)
+	}
+	if len(behind) != len(nums)-1 || behind[1] != 3 || behind[compareBatchSize+1] != 0 {
+		t.Errorf("unexpected comparisons: %v", behind)
+	}
+	// The PR which can not be compared must not be taken as up to date.
+	if _, ok := behind[2]; ok {
+		t.Errorf("expected the unresolved PR to be left out, but got %v", behind)
+	}
+	if _, err := behindBy(fc, "org", "repo", 2, "master"); err == nil {
+		t.Error("expected an error for the unresolved PR")
+	}
+}
+
+func TestHandleConflictingPullRequest(t *testing.T) {
+	oldSleep := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = oldSleep }()
+
+	conflictMarker := fmt.Sprintf(conflictMarkerFormat, "head")
+	mergeable := false
+
+	testcases := []struct {
+		name     string
+		comments []github.IssueComment
+
+		expectComment bool
+	}{
+		{
+			name:          "notify the conflicts",
+			expectComment: true,
+		},
+		{
+			name: "conflicts already notified",
+			comments: []github.IssueComment{
+				{User: github.User{Login: botName}, Body: "conflicts\n" + conflictMarker},
+			},
+		},
+		{
+			name: "conflicts notified for the previous head",
+			comments: []github.IssueComment{
+				{User: github.User{Login: botName}, Body: fmt.Sprintf(conflictMarkerFormat, "previous")},
+			},
+			expectComment: true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			externalConfig := &externalplugins.Configuration{}
+			externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
+				{
+					Repos:         []string{"org/repo"},
+					Message:       "updated",
+					OnlyWhenLabel: "trigger-update",
+				},
+			}
+			check := func(fc *fakeGithub) {
+				if len(fc.updated) != 0 {
+					t.Errorf("expected the conflicting PR not to be updated, but got %v", fc.updated)
+				}
+				if !tc.expectComment {
+					if len(fc.createdComments) != 0 {
+						t.Errorf("expected no comment, but got %v", fc.createdComments)
+					}
+					return
+				}
+				if len(fc.createdComments) != 1 || !strings.Contains(fc.createdComments[0], conflictMarker) {
+					t.Errorf("expected the comment about the conflicts, but got %v", fc.createdComments)
+				}
+			}
+
+			// The PR is commented.
+			pr := getPullRequest("org", "repo", 1)
+			pr.Head.SHA = "head"
+			pr.Mergable = &mergeable
+			pr.Labels = []github.Label{{Name: "trigger-update"}}
+			fc := newFakeGithubClient(nil, pr, true)
+			fc.comments = tc.comments
+			ice := &github.IssueCommentEvent{}
+			ice.Issue.PullRequest = &struct{}{}
+			if err := HandleIssueCommentEvent(logrus.WithField("plugin", PluginName), fc, ice, externalConfig); err != nil {
+				t.Fatalf("error handling issue comment event: %v", err)
+			}
+			check(fc)
+
+			// The PRs are checked periodically.
+			conflictingPR := newPriorityPullRequest(1, "feature", 1, 1)
+			conflictingPR.HeadRefOid = "head"
+			conflictingPR.Mergeable = githubql.MergeableStateConflicting
+			fc = newFakeGithubClient([]pullRequest{conflictingPR}, nil, true)
+			fc.comments = tc.comments
+			config := &plugins.Configuration{
+				ExternalPlugins: map[string][]plugins.ExternalPlugin{
+					"org/repo": {{Name: PluginName}},
+				},
+			}
+			if err := HandleAll(logrus.WithField("plugin", PluginName), fc, config, externalConfig); err != nil {
+				t.Fatalf("error handling all PRs: %v", err)
+			}
+			check(fc)
+		})
+	}
+}
+
+func TestConflictingPullRequestNotBlockingOthers(t *testing.T) {
+	oldSleep := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = oldSleep }()
+
+	conflictingPR := newPriorityPullRequest(1, "feature", 1, 1)
+	conflictingPR.Mergeable = githubql.MergeableStateConflicting
+	prs := []pullRequest{conflictingPR, newPriorityPullRequest(2, "feature", 2, 2)}
+	fc := newFakeGithubClient(prs, nil, true)
+	externalConfig := &externalplugins.Configuration{}
+	externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
+		{
+			Repos:         []string{"org/repo"},
+			OnlyWhenLabel: "trigger-update",
+		},
+	}
+	pe := &github.PushEvent{
+		Ref:  "refs/heads/main",
+		Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+	}
+	if err := HandlePushEvent(logrus.WithField("plugin", PluginName), fc, pe, externalConfig); err != nil {
+		t.Fatalf("error handling push event: %v", err)
+	}
+	if !reflect.DeepEqual(fc.updated, []int{2}) {
+		t.Errorf("updated PRs mismatch: got %v, want %v", fc.updated, []int{2})
+	}
+}
@@ -0,0 +1,304 @@
+package tars
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/test-infra/prow/plugins"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+// PullRequestPlan describes what would be done to a PR in the next update.
+type PullRequestPlan struct {
+	Number int    `json:"number"`
+	Author string `json:"author"`
+	// Behind is the number of the commits of the base branch which are not in the PR,
+	// it is only checked for the candidate PRs.
+	Behind      int  `json:"behind"`
+	UpToDate    bool `json:"up_to_date"`
+	Conflicting bool `json:"conflicting"`
+	// ExcludedReason is the reason why the PR is not a candidate to update, it is empty for the candidate PRs.
+	ExcludedReason string `json:"excluded_reason,omitempty"`
+	WouldUpdate    bool   `json:"would_update"`
+}
+
+// BranchPlan describes what would be done to the PRs of a base branch in the next update,
+// the PRs are in the order to be updated.
+type BranchPlan struct {
+	Branch string `json:"branch"`
+	// SkippedReason is the reason why none of the PRs of the branch would be updated.
+	SkippedReason string            `json:"skipped_reason,omitempty"`
+	PullRequests  []PullRequestPlan `json:"pull_requests"`
+}
+
+// RepoPlan describes what would be done to the PRs of a repo in the next update.
+type RepoPlan struct {
+	Org      string       `json:"org"`
+	Repo     string       `json:"repo"`
+	Branches []BranchPlan `json:"branches,omitempty"`
+	// Message is the error encountered when planning the updates of the repo.
+	Message string `json:"message,omitempty"`
+}
+
+// Plan runs the same search and selection as HandleAll without updating any PR, and returns what would be done
+// to the PRs of the repos which enabled this plugin. The repo in the org/repo format and the branch are optional
+// to narrow down the plan.
+func Plan(log *logrus.Entry, ghc githubClient, config *plugins.Configuration,
+	externalConfig *tiexternalplugins.Configuration, repo, branch string) []RepoPlan {
+	_, repos := config.EnabledReposForExternalPlugin(PluginName)
+
+	var plans []RepoPlan
+	for _, enabledRepo := range repos {
+		if len(repo) != 0 && enabledRepo != repo {
+			continue
+		}
+		slashSplit := strings.Split(enabledRepo, "/")
+		if n := len(slashSplit); n != 2 {
+			log.WithField("repo", enabledRepo).Warn("Found repo that was not in org/repo format, ignoring...")
+			continue
+		}
+		org := slashSplit[0]
+		repoName := slashSplit[1]
+
+		plan := RepoPlan{Org: org, Repo: repoName}
+		branches, err := planRepo(log, ghc, org, repoName, branch, externalConfig.TarsFor(org, repoName))
+		if err != nil {
+			log.WithError(err).Errorf("Failed to plan the updates of %s.", enabledRepo)
+			plan.Message = err.Error()
+		}
+		plan.Branches = branches
+		plans = append(plans, plan)
+	}
+	return plans
+}
+
+// planRepo plans the updates of all the open PRs of the repo, including the PRs excluded by the labels.
+func planRepo(log *logrus.Entry, ghc githubClient, org, repo, branch string,
+	tars *tiexternalplugins.TiCommunityTars) ([]BranchPlan, error) {
+	var query bytes.Buffer
+	fmt.Fprint(&query, searchQueryPrefix)
+	fmt.Fprintf(&query, " repo:\"%s/%s\"", org, repo)
+	if len(branch) != 0 {
+		fmt.Fprintf(&query, " base:\"%s\"", branch)
+	}
+	prs, err := search(context.Background(), log, ghc, org, query.String())
+	if err != nil {
+		return nil, err
+	}
+	sortPullRequests(prs, tars)
+
+	var branches []string
+	prsOfBranches := make(map[string][]pullRequest)
+	for i := range prs {
+		base := string(prs[i].BaseRef.Name)
+		if _, ok := prsOfBranches[base]; !ok {
+			branches = append(branches, base)
+		}
+		prsOfBranches[base] = append(prsOfBranches[base], prs[i])
+	}
+
+	plans := make([]BranchPlan, 0, len(branches))
+	for _, base := range branches {
+		plan, err := planBranch(log, ghc, org, repo, base, prsOfBranches[base], tars)
+		if err != nil {
+			return plans, err
+		}
+		plans = append(plans, *plan)
+	}
+	return plans, nil
+}
+
+// planBranch plans the updates of the PRs of the base branch in the same way as updatePullRequests.
+func planBranch(log *logrus.Entry, ghc githubClient, org, repo, base string, prs []pullRequest,
+	tars *tiexternalplugins.TiCommunityTars) (*BranchPlan, error) {
+	plan := &BranchPlan{Branch: base, PullRequests: make([]PullRequestPlan, 0, len(prs))}
+	// Compare the candidates with the base branch in batches.
+	var nums []int
+	for i := range prs {
+		if len(excludedReason(&prs[i], tars)) == 0 {
+			nums = append(nums, int(prs[i].Number))
+		}
+	}
+	behind, err := listBehindBy(ghc, org, repo, base, nums)
+	if err != nil {
+		return nil, err
+	}
+	state := &branchUpdates{behind: behind}
+	var candidates []pullRequest
+	for i := range prs {
+		pr := &prs[i]
+		prPlan := PullRequestPlan{
+			Number:         int(pr.Number),
+			Author:         string(pr.Author.Login),
+			ExcludedReason: excludedReason(pr, tars),
+		}
+		if len(prPlan.ExcludedReason) == 0 {
+			behind, err := state.behindBy(ghc, org, repo, prPlan.Number, base)
+			if err != nil {
+				return nil, err
+			}
+			prPlan.Behind = behind
+			prPlan.UpToDate = behind == 0
+			prPlan.Conflicting = pr.Mergeable == githubql.MergeableStateConflicting
+			candidates = append(candidates, *pr)
+		}
+		plan.PullRequests = append(plan.PullRequests, prPlan)
+	}
+	if len(candidates) == 0 {
+		return plan, nil
+	}
+
+	postponement, err := basePostponement(log, ghc, org, repo, base, tars)
+	if err != nil {
+		return nil, err
+	}
+	if postponement != nil {
+		plan.SkippedReason = postponement.Reason
+		return plan, nil
+	}
+
+	maxConcurrentUpdates, maxPendingJobs := branchLimits(tars, base)
+	if maxPendingJobs > 0 {
+		pendingJobs, err := countPendingJobs(ghc, candidates, org, repo, base, state)
+		if err != nil {
+			return nil, err
+		}
+		if pendingJobs >= maxPendingJobs {
+			plan.SkippedReason = fmt.Sprintf("there are %d pending CI jobs, reaching the threshold %d",
+				pendingJobs, maxPendingJobs)
+			return plan, nil
+		}
+	}
+
+	updated := 0
+	for i := range plan.PullRequests {
+		prPlan := &plan.PullRequests[i]
+		if updated >= maxConcurrentUpdates {
+			break
+		}
+		if len(prPlan.ExcludedReason) != 0 || prPlan.UpToDate || prPlan.Conflicting {
+			continue
+		}
+		prPlan.WouldUpdate = true
+		updated++
+	}
+	return plan, nil
+}
+
+// excludedReason returns the reason why the PR is not a candidate to update according to its labels.
+func excludedReason(pr *pullRequest, tars *tiexternalplugins.TiCommunityTars) string {
+	labels := sets.NewString()
+	for _, label := range pr.Labels.Nodes {
+		labels.Insert(string(label.Name))
+	}
+	if !labels.Has(tars.OnlyWhenLabel) {
+		return fmt.Sprintf("missing the trigger label %s", tars.OnlyWhenLabel)
+	}
+	for _, excludeLabel := range tars.ExcludeLabels {
+		if labels.Has(excludeLabel) {
+			return fmt.Sprintf("having the exclude label %s", excludeLabel)
+		}
+	}
+	return ""
+}
+
+// PlanResponse specifies the response to the request to plan the updates.
+type PlanResponse struct {
+	Data    []RepoPlan `json:"data,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+// planCacheTTL is how long the plans are cached by the PlanHandler.
+const planCacheTTL = time.Minute
+
+// cachedPlans is the plans of a repo and a branch planned at the time.
+type cachedPlans struct {
+	plans []RepoPlan
+	time  time.Time
+}
+
+// PlanHandler serves the HTTP API to plan the updates without updating any PR, such as
+// GET /plan?repo=ti-community-infra/tichi&branch=master.
+type PlanHandler struct {
+	log            *logrus.Entry
+	ghc            githubClient
+	config         func() *plugins.Configuration
+	externalConfig func() *tiexternalplugins.Configuration
+
+	// Planning sends many requests to GitHub, so the requests are planned one by one
+	// and the plans are cached to avoid using up the rate limit.
+	mu    sync.Mutex
+	cache map[string]cachedPlans
+}
+
+// NewPlanHandler creates a PlanHandler which plans the updates with the latest configurations.
+func NewPlanHandler(log *logrus.Entry, ghc githubClient, config func() *plugins.Configuration,
+	externalConfig func() *tiexternalplugins.Configuration) *PlanHandler {
+	return &PlanHandler{
+		log:            log,
+		ghc:            ghc,
+		config:         config,
+		externalConfig: externalConfig,
+		cache:          map[string]cachedPlans{},
+	}
+}
+
+func (h *PlanHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeResponse(w, http.StatusMethodNotAllowed, &PlanResponse{Message: "Only GET is allowed."})
+		return
+	}
+
+	values := r.URL.Query()
+	repo := values.Get("repo")
+	if len(repo) != 0 && len(strings.Split(repo, "/")) != 2 {
+		h.writeResponse(w, http.StatusBadRequest,
+			&PlanResponse{Message: "The repo " + strconv.Quote(repo) + " is not in org/repo format."})
+		return
+	}
+
+	plans := h.plan(repo, values.Get("branch"))
+	h.writeResponse(w, http.StatusOK, &PlanResponse{Data: plans})
+}
+
+// plan returns the cached plans of the repo and the branch, or plans the updates if the cache is expired.
+func (h *PlanHandler) plan(repo, branch string) []RepoPlan {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := timeNow()
+	key := repo + ":" + branch
+	if cached, ok := h.cache[key]; ok && now.Sub(cached.time) < planCacheTTL {
+		return cached.plans
+	}
+
+	// Drop the expired plans, so that the cache does not grow with the requested repos and branches.
+	for k, cached := range h.cache {
+		if now.Sub(cached.time) >= planCacheTTL {
+			delete(h.cache, k)
+		}
+	}
+	plans := Plan(h.log, h.ghc, h.config(), h.externalConfig(), repo, branch)
+	h.cache[key] = cachedPlans{plans: plans, time: now}
+	return plans
+}
+
+// writeResponse writes the response in JSON.
+func (h *PlanHandler) writeResponse(w http.ResponseWriter, code int, resp *PlanResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.log.WithError(err).Error("Failed to write the plan response.")
+	}
+}
@@ -0,0 +1,265 @@
+package tars
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestPlan(t *testing.T) {
+	notLabeledPR := newPriorityPullRequest(1, "feature", 1, 1)
+	notLabeledPR.Labels.Nodes = nil
+	conflictingPR := newPriorityPullRequest(4, "feature", 4, 4)
+	conflictingPR.Mergeable = githubql.MergeableStateConflicting
+	releasePR := newPriorityPullRequest(7, "feature", 7, 7)
+	releasePR.BaseRef.Name = "release-5.0"
+	prs := []pullRequest{
+		notLabeledPR,
+		newPriorityPullRequest(2, "feature", 2, 2, "do-not-merge/hold"),
+		newPriorityPullRequest(3, "feature", 3, 3),
+		conflictingPR,
+		newPriorityPullRequest(5, "feature", 5, 5),
+		newPriorityPullRequest(6, "feature", 6, 6),
+		releasePR,
+	}
+
+	testcases := []struct {
+		name             string
+		requiredContexts []string
+		repo             string
+		branch           string
+
+		expectPlans []RepoPlan
+	}{
+		{
+			name: "plan all branches",
+			expectPlans: []RepoPlan{
+				{
+					Org:  "org",
+					Repo: "repo",
+					Branches: []BranchPlan{
+						{
+							Branch: "main",
+							PullRequests: []PullRequestPlan{
+								{Number: 1, ExcludedReason: "missing the trigger label trigger-update"},
+								{Number: 2, ExcludedReason: "having the exclude label do-not-merge/hold"},
+								{Number: 3, UpToDate: true},
+								{Number: 4, Behind: 1, Conflicting: true},
+								{Number: 5, Behind: 1, WouldUpdate: true},
+								{Number: 6, Behind: 1},
+							},
+						},
+						{
+							Branch:       "release-5.0",
+							PullRequests: []PullRequestPlan{{Number: 7, Behind: 1, WouldUpdate: true}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:             "postponed by the failing base",
+			requiredContexts: []string{"unit-test"},
+			expectPlans: []RepoPlan{
+				{
+					Org:  "org",
+					Repo: "repo",
+					Branches: []BranchPlan{
+						{
+							Branch:        "main",
+							SkippedReason: "the base branch head base fails unit-test",
+							PullRequests: []PullRequestPlan{
+								{Number: 1, ExcludedReason: "missing the trigger label trigger-update"},
+								{Number: 2, ExcludedReason: "having the exclude label do-not-merge/hold"},
+								{Number: 3, UpToDate: true},
+								{Number: 4, Behind: 1, Conflicting: true},
+								{Number: 5, Behind: 1},
+								{Number: 6, Behind: 1},
+							},
+						},
+						{
+							Branch:        "release-5.0",
+							SkippedReason: "the base branch head base fails unit-test",
+							PullRequests:  []PullRequestPlan{{Number: 7, Behind: 1}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name: "repo not enabled",
+			repo: "org/other",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			fc := newFakeGithubClient(prs, nil, true)
+			fc.behind = map[int]int{3: 0}
+			fc.baseHead = github.RepositoryCommit{SHA: "base"}
+			fc.statuses = map[string][]github.Status{
+				"base": {{Context: "unit-test", State: github.StatusFailure}},
+			}
+			config := &plugins.Configuration{
+				ExternalPlugins: map[string][]plugins.ExternalPlugin{
+					"org/repo": {{Name: PluginName}},
+				},
+			}
+			externalConfig := &externalplugins.Configuration{}
+			externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
+				{
+					Repos:                []string{"org/repo"},
+					Message:              "updated",
+					OnlyWhenLabel:        "trigger-update",
+					ExcludeLabels:        []string{"do-not-merge/hold"},
+					BaseRequiredContexts: tc.requiredContexts,
+				},
+			}
+
+			plans := Plan(logrus.WithField("plugin", PluginName), fc, config, externalConfig, tc.repo, tc.branch)
+			if !reflect.DeepEqual(plans, tc.expectPlans) {
+				t.Errorf("plans mismatch: got %+v, want %+v", plans, tc.expectPlans)
+			}
+			if len(fc.updated) != 0 || len(fc.rebased) != 0 || len(fc.createdComments) != 0 {
+				t.Errorf("expected no PR to be changed, but got updated %v, rebased %v and comments %v",
+					fc.updated, fc.rebased, fc.createdComments)
+			}
+			if list := postponements.list(); len(list) != 0 {
+				t.Errorf("expected no postponement to be recorded, but got %v", list)
+			}
+		})
+	}
+}
+
+func TestPlanHandler(t *testing.T) {
+	fc := newFakeGithubClient([]pullRequest{newPriorityPullRequest(1, "feature", 1, 1)}, nil, true)
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{
+			"org/repo": {{Name: PluginName}},
+		},
+	}
+	externalConfig := &externalplugins.Configuration{}
+	externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
+		{
+			Repos:         []string{"org/repo"},
+			OnlyWhenLabel: "trigger-update",
+		},
+	}
+	handler := NewPlanHandler(logrus.WithField("plugin", PluginName), fc,
+		func() *plugins.Configuration { return config },
+		func() *externalplugins.Configuration { return externalConfig })
+
+	testcases := []struct {
+		name   string
+		method string
+		target string
+
+		expectCode int
+		expectData []RepoPlan
+	}{
+		{
+			name:       "plan the repo",
+			method:     http.MethodGet,
+			target:     "/plan?repo=org/repo&branch=main",
+			expectCode: http.StatusOK,
+			expectData: []RepoPlan{
+				{
+					Org:  "org",
+					Repo: "repo",
+					Branches: []BranchPlan{
+						{
+							Branch:       "main",
+							PullRequests: []PullRequestPlan{{Number: 1, Behind: 1, WouldUpdate: true}},
+						},
+					},
+				},
+			},
+		},
+		{
+			name:       "invalid repo",
+			method:     http.MethodGet,
+			target:     "/plan?repo=repo",
+			expectCode: http.StatusBadRequest,
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodPost,
+			target:     "/plan",
+			expectCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.target, nil))
+			if recorder.Code != tc.expectCode {
+				t.Fatalf("code mismatch: got %d, want %d", recorder.Code, tc.expectCode)
+			}
+			var resp PlanResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("failed to unmarshal the response: %v", err)
+			}
+			if !reflect.DeepEqual(resp.Data, tc.expectData) {
+				t.Errorf("plans mismatch: got %+v, want %+v", resp.Data, tc.expectData)
+			}
+		})
+	}
+}
+
+func TestPlanHandlerCache(t *testing.T) {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time {
+		return now
+	}
+	defer func() {
+		timeNow = time.Now
+	}()
+
+	fc := newFakeGithubClient([]pullRequest{newPriorityPullRequest(1, "feature", 1, 1)}, nil, true)
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{
+			"org/repo": {{Name: PluginName}},
+		},
+	}
+	externalConfig := &externalplugins.Configuration{}
+	externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
+		{
+			Repos:         []string{"org/repo"},
+			OnlyWhenLabel: "trigger-update",
+		},
+	}
+	handler := NewPlanHandler(logrus.WithField("plugin", PluginName), fc,
+		func() *plugins.Configuration { return config },
+		func() *externalplugins.Configuration { return externalConfig })
+
+	first := handler.plan("org/repo", "main")
+	// The PR is merged after the first plan.
+	fc.allPRs = nil
+
+	if cached := handler.plan("org/repo", "main"); !reflect.DeepEqual(cached, first) {
+		t.Errorf("expected the cached plans %+v, but got %+v", first, cached)
+	}
+	if other := handler.plan("org/repo", "release"); reflect.DeepEqual(other, first) {
+		t.Errorf("expected the plans of another branch not to be cached, but got %+v", other)
+	}
+
+	now = now.Add(planCacheTTL)
+	if expired := handler.plan("org/repo", "main"); reflect.DeepEqual(expired, first) {
+		t.Errorf("expected the expired plans to be replanned, but got %+v", expired)
+	}
+	if len(handler.cache) != 1 {
+		t.Errorf("expected the expired plans to be dropped, but got %d cached plans", len(handler.cache))
+	}
+}
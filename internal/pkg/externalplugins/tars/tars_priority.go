@@ -0,0 +1,81 @@
+package tars
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+// cherryPickBranchRe matches the head branch of the cherry-pick PRs created by the cherrypicker,
+// including the cherry-picks from other repos whose head branches contain the source repos.
+var cherryPickBranchRe = regexp.MustCompile(`^cherry-pick-([\w.-]+-)?\d+-to-`)
+
+// sortPullRequests sorts the PRs in the order to be updated. The PRs matching the earlier priority come first,
+// and the PRs with the same priority are ordered by the time since the trigger label was applied.
+// The PRs whose labeled time is unknown are ordered by the creation time.
+func sortPullRequests(prs []pullRequest, tars *tiexternalplugins.TiCommunityTars) {
+	ranks := make([]int, len(prs))
+	waitingSince := make([]time.Time, len(prs))
+	for i := range prs {
+		ranks[i] = priorityRank(&prs[i], tars.PriorityOrder)
+		waitingSince[i] = labeledTime(&prs[i], tars.OnlyWhenLabel)
+	}
+
+	indexes := make([]int, len(prs))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	// The search results are ordered by the creation time, so the stable sort keeps it for the ties.
+	sort.SliceStable(indexes, func(i, j int) bool {
+		a, b := indexes[i], indexes[j]
+		if ranks[a] != ranks[b] {
+			return ranks[a] < ranks[b]
+		}
+		return waitingSince[a].Before(waitingSince[b])
+	})
+
+	sorted := make([]pullRequest, len(prs))
+	for i, index := range indexes {
+		sorted[i] = prs[index]
+	}
+	copy(prs, sorted)
+}
+
+// priorityRank returns the index of the first priority the PR matches,
+// or the number of the priorities if it matches none of them.
+func priorityRank(pr *pullRequest, priorities []tiexternalplugins.TarsPriority) int {
+	labels := sets.NewString()
+	for _, label := range pr.Labels.Nodes {
+		labels.Insert(string(label.Name))
+	}
+
+	for i, priority := range priorities {
+		if labels.HasAny(priority.Labels...) {
+			return i
+		}
+		if priority.CherryPick && cherryPickBranchRe.MatchString(string(pr.HeadRefName)) {
+			return i
+		}
+	}
+	return len(priorities)
+}
+
+// labeledTime returns the time when the label was applied to the PR most recently,
+// it returns the creation time of the PR if the time is unknown.
+func labeledTime(pr *pullRequest, label string) time.Time {
+	var t time.Time
+	for _, node := range pr.TimelineItems.Nodes {
+		event := node.LabeledEvent
+		if string(event.Label.Name) == label && event.CreatedAt.After(t) {
+			t = event.CreatedAt.Time
+		}
+	}
+	if t.IsZero() {
+		return pr.CreatedAt.Time
+	}
+	return t
+}
@@ -0,0 +1,158 @@
+package tars
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+// newPriorityPullRequest returns a PR of org/repo with the labels,
+// which is created at the day and labeled with the trigger label at the labeled day.
+func newPriorityPullRequest(number int, headRef string, createdDay, labeledDay int, labels ...string) pullRequest {
+	pr := pullRequest{}
+	pr.Number = githubql.Int(number) //nolint:gosec
+	pr.Repository.Name = "repo"
+	pr.Repository.Owner.Login = "org"
+	pr.BaseRef.Name = "main"
+	pr.HeadRefName = githubql.String(headRef)
+	pr.CreatedAt = githubql.DateTime{Time: time.Date(2021, 6, createdDay, 0, 0, 0, 0, time.UTC)}
+
+	for _, label := range append(labels, "trigger-update") {
+		pr.Labels.Nodes = append(pr.Labels.Nodes, struct {
+			Name githubql.String
+		}{Name: githubql.String(label)})
+	}
+
+	if labeledDay != 0 {
+		event := struct {
+			LabeledEvent struct {
+				CreatedAt githubql.DateTime
+				Label     struct {
+					Name githubql.String
+				}
+			} `graphql:"... on LabeledEvent"`
+		}{}
+		event.LabeledEvent.CreatedAt = githubql.DateTime{Time: time.Date(2021, 6, labeledDay, 0, 0, 0, 0, time.UTC)}
+		event.LabeledEvent.Label.Name = "trigger-update"
+		pr.TimelineItems.Nodes = append(pr.TimelineItems.Nodes, event)
+	}
+	return pr
+}
+
+func TestSortPullRequests(t *testing.T) {
+	priorities := []externalplugins.TarsPriority{
+		{Labels: []string{"priority/critical", "priority/release-blocker"}},
+		{CherryPick: true},
+	}
+
+	var testcases = []struct {
+		name          string
+		prs           []pullRequest
+		priorities    []externalplugins.TarsPriority
+		expectNumbers []int
+	}{
+		{
+			name: "by the priorities",
+			prs: []pullRequest{
+				newPriorityPullRequest(1, "feature", 1, 2),
+				newPriorityPullRequest(2, "cherry-pick-1-to-release-5.0", 2, 3),
+				newPriorityPullRequest(3, "fix", 3, 4, "priority/critical"),
+				newPriorityPullRequest(4, "fix", 4, 5, "priority/release-blocker"),
+				newPriorityPullRequest(5, "cherry-pick-foo-bar-2-to-release-5.0", 5, 6),
+			},
+			priorities:    priorities,
+			expectNumbers: []int{3, 4, 2, 5, 1},
+		},
+		{
+			name: "by the time since the trigger label was applied",
+			prs: []pullRequest{
+				newPriorityPullRequest(1, "feature", 1, 9),
+				newPriorityPullRequest(2, "feature", 2, 3),
+				newPriorityPullRequest(3, "feature", 3, 0),
+			},
+			priorities:    priorities,
+			expectNumbers: []int{2, 3, 1},
+		},
+		{
+			name: "no priorities",
+			prs: []pullRequest{
+				newPriorityPullRequest(1, "cherry-pick-1-to-release-5.0", 1, 5, "priority/critical"),
+				newPriorityPullRequest(2, "feature", 2, 4),
+			},
+			expectNumbers: []int{2, 1},
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			sortPullRequests(tc.prs, &externalplugins.TiCommunityTars{
+				OnlyWhenLabel: "trigger-update",
+				PriorityOrder: tc.priorities,
+			})
+
+			var numbers []int
+			for _, pr := range tc.prs {
+				numbers = append(numbers, int(pr.Number))
+			}
+			if !reflect.DeepEqual(numbers, tc.expectNumbers) {
+				t.Errorf("order mismatch: got %v, want %v", numbers, tc.expectNumbers)
+			}
+		})
+	}
+}
+
+func TestUpdateByPriority(t *testing.T) {
+	oldSleep := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = oldSleep }()
+
+	prs := []pullRequest{
+		newPriorityPullRequest(1, "feature", 1, 2),
+		newPriorityPullRequest(2, "cherry-pick-1-to-release-5.0", 2, 3),
+		newPriorityPullRequest(3, "fix", 3, 4, "priority/critical"),
+	}
+	externalConfig := &externalplugins.Configuration{}
+	externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
+		{
+			Repos:         []string{"org/repo"},
+			OnlyWhenLabel: "trigger-update",
+			PriorityOrder: []externalplugins.TarsPriority{
+				{Labels: []string{"priority/critical"}},
+				{CherryPick: true},
+			},
+		},
+	}
+
+	// The push event and the periodic update use the same order.
+	fc := newFakeGithubClient(prs, nil, true)
+	pe := &github.PushEvent{
+		Ref:  "refs/heads/main",
+		Repo: github.Repo{Owner: github.User{Login: "org"}, Name: "repo"},
+	}
+	if err := HandlePushEvent(logrus.WithField("plugin", PluginName), fc, pe, externalConfig); err != nil {
+		t.Fatalf("error handling push event: %v", err)
+	}
+	if !reflect.DeepEqual(fc.updated, []int{3}) {
+		t.Errorf("updated PRs mismatch for the push event: got %v, want %v", fc.updated, []int{3})
+	}
+
+	fc = newFakeGithubClient(prs, nil, true)
+	config := &plugins.Configuration{
+		ExternalPlugins: map[string][]plugins.ExternalPlugin{
+			"org/repo": {{Name: PluginName}},
+		},
+	}
+	if err := HandleAll(logrus.WithField("plugin", PluginName), fc, config, externalConfig); err != nil {
+		t.Fatalf("error handling all PRs: %v", err)
+	}
+	if !reflect.DeepEqual(fc.updated, []int{3}) {
+		t.Errorf("updated PRs mismatch for the periodic update: got %v, want %v", fc.updated, []int{3})
+	}
+}
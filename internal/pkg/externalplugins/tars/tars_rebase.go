@@ -0,0 +1,100 @@
+package tars
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	githubql "github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+
+	tiexternalplugins "github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+)
+
+const (
+	// rebaseFailedMarkerFormat is the hidden marker of the comment about the rebase failure of the PR head.
+	rebaseFailedMarkerFormat = "<!-- ti-community-tars rebase failed: %s -->"
+
+	rebaseFailedMessage = "Your PR is out of date, but I could not update it by rebase: %v.\n\n" +
+		"Please rebase it onto the latest base branch manually. The rebase may be blocked by the conflicts, " +
+		"or the PR may not allow edits by maintainers."
+	rebaseFallbackMessage = "I could not update your PR by rebase: %v, so I have updated it by merge instead."
+)
+
+// rebaseFailedMarkerRe matches the marker of the comment about the rebase failure.
+var rebaseFailedMarkerRe = regexp.MustCompile(`<!-- ti-community-tars rebase failed: \S+ -->`)
+
+// rebaseUpdateMethod is the update method of the updatePullRequestBranch mutation which rebases the PR.
+const rebaseUpdateMethod PullRequestBranchUpdateMethod = "REBASE"
+
+// PullRequestBranchUpdateMethod is the possible method for updating a pull request's head branch
+// with the base branch.
+// See: https://docs.github.com/en/graphql/reference/enums#pullrequestbranchupdatemethod.
+type PullRequestBranchUpdateMethod string
+
+// UpdatePullRequestBranchInput is the input of the updatePullRequestBranch mutation. The one of githubv4
+// does not support the update method yet, and the type name must be kept for the GraphQL variable.
+// See: https://docs.github.com/en/graphql/reference/input-objects#updatepullrequestbranchinput.
+type UpdatePullRequestBranchInput struct {
+	// The Node ID of the pull request.
+	PullRequestID githubql.ID `json:"pullRequestId"`
+	// The head ref oid for the upstream branch.
+	ExpectedHeadOid *githubql.GitObjectID `json:"expectedHeadOid,omitempty"`
+	// The update branch method to use.
+	UpdateMethod *PullRequestBranchUpdateMethod `json:"updateMethod,omitempty"`
+}
+
+type updatePullRequestBranchMutation struct {
+	UpdatePullRequestBranch struct {
+		PullRequest struct {
+			Number githubql.Int
+		}
+	} `graphql:"updatePullRequestBranch(input: $input)"`
+}
+
+// updatePullRequestBranch updates the PR branch by the update method of the repo. It returns false if the PR
+// is left out of date, and the notice to the author if the PR cannot be updated by the update method.
+func updatePullRequestBranch(log *logrus.Entry, ghc githubClient, org, repo string, num int,
+	nodeID, headSHA string, tars *tiexternalplugins.TiCommunityTars) (bool, string, error) {
+	if tars.UpdateMethod != tiexternalplugins.RebaseUpdateMethod {
+		return true, "", ghc.UpdatePullRequestBranch(org, repo, num, nil)
+	}
+
+	rebaseErr := rebasePullRequestBranch(ghc, org, nodeID, headSHA)
+	if rebaseErr == nil {
+		return true, "", nil
+	}
+	log.WithError(rebaseErr).Warnf("Failed to rebase PR %s/%s#%d.", org, repo, num)
+
+	if !tars.FallbackToMerge {
+		return false, fmt.Sprintf(rebaseFailedMessage, rebaseErr), nil
+	}
+	log.Infof("Update PR %s/%s#%d by merge instead.", org, repo, num)
+	if err := ghc.UpdatePullRequestBranch(org, repo, num, nil); err != nil {
+		return false, "", err
+	}
+	return true, fmt.Sprintf(rebaseFallbackMessage, rebaseErr), nil
+}
+
+// rebasePullRequestBranch rebases the PR branch onto the base branch by GitHub, which fails if the PR
+// has conflicts with the base branch or the bot cannot push to the head repo.
+func rebasePullRequestBranch(ghc githubClient, org, nodeID, headSHA string) error {
+	method := rebaseUpdateMethod
+	input := UpdatePullRequestBranchInput{
+		PullRequestID: githubql.ID(nodeID),
+		UpdateMethod:  &method,
+	}
+	if len(headSHA) != 0 {
+		oid := githubql.GitObjectID(headSHA)
+		input.ExpectedHeadOid = &oid
+	}
+
+	var m updatePullRequestBranchMutation
+	return ghc.MutateWithGitHubAppsSupport(context.Background(), &m, input, nil, org)
+}
+
+// notifyRebaseFailure comments the notice about the rebase failure on the PR.
+func notifyRebaseFailure(ghc githubClient, org, repo string, num int, author, headSHA, notice string) error {
+	return notifyOnce(ghc, org, repo, num, author, fmt.Sprintf(rebaseFailedMarkerFormat, headSHA),
+		rebaseFailedMarkerRe, notice)
+}
@@ -0,0 +1,118 @@
+package tars
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/ti-community-infra/tichi/internal/pkg/externalplugins"
+	"k8s.io/test-infra/prow/github"
+	"k8s.io/test-infra/prow/plugins"
+)
+
+func TestUpdateByRebase(t *testing.T) {
+	oldSleep := sleep
+	sleep = func(time.Duration) {}
+	defer func() { sleep = oldSleep }()
+
+	failedMarker := fmt.Sprintf(rebaseFailedMarkerFormat, "head")
+
+	testcases := []struct {
+		name            string
+		updateMethod    string
+		fallbackToMerge bool
+		rebaseErr       error
+		comments        []github.IssueComment
+
+		expectUpdated []int
+		expectRebased []string
+		expectComment string
+	}{
+		{
+			name:          "update by merge",
+			updateMethod:  externalplugins.MergeUpdateMethod,
+			expectUpdated: []int{1},
+			expectComment: "updated",
+		},
+		{
+			name:          "update by rebase",
+			updateMethod:  externalplugins.RebaseUpdateMethod,
+			expectRebased: []string{"PR_1"},
+			expectComment: "updated",
+		},
+		{
+			name:          "rebase failed",
+			updateMethod:  externalplugins.RebaseUpdateMethod,
+			rebaseErr:     errors.New("merge conflict between base and head"),
+			expectComment: failedMarker,
+		},
+		{
+			name:         "rebase failed and already notified",
+			updateMethod: externalplugins.RebaseUpdateMethod,
+			rebaseErr:    errors.New("merge conflict between base and head"),
+			comments: []github.IssueComment{
+				{User: github.User{Login: botName}, Body: "rebase failed\n" + failedMarker},
+			},
+		},
+		{
+			name:            "rebase failed and fall back to merge",
+			updateMethod:    externalplugins.RebaseUpdateMethod,
+			fallbackToMerge: true,
+			rebaseErr:       errors.New("merge conflict between base and head"),
+			expectUpdated:   []int{1},
+			expectComment:   "updated it by merge instead",
+		},
+	}
+
+	for _, testcase := range testcases {
+		tc := testcase
+		t.Run(tc.name, func(t *testing.T) {
+			pr := newPriorityPullRequest(1, "feature", 1, 1)
+			pr.ID = "PR_1"
+			pr.HeadRefOid = "head"
+			fc := newFakeGithubClient([]pullRequest{pr}, nil, true)
+			fc.rebaseErr = tc.rebaseErr
+			fc.comments = tc.comments
+			externalConfig := &externalplugins.Configuration{}
+			externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
+				{
+					Repos:           []string{"org/repo"},
+					Message:         "updated",
+					OnlyWhenLabel:   "trigger-update",
+					UpdateMethod:    tc.updateMethod,
+					FallbackToMerge: tc.fallbackToMerge,
+				},
+			}
+			config := &plugins.Configuration{
+				ExternalPlugins: map[string][]plugins.ExternalPlugin{
+					"org/repo": {{Name: PluginName}},
+				},
+			}
+
+			err := HandleAll(logrus.WithField("plugin", PluginName), fc, config, externalConfig)
+			if err != nil {
+				t.Fatalf("error handling all PRs: %v", err)
+			}
+
+			if !reflect.DeepEqual(fc.updated, tc.expectUpdated) {
+				t.Errorf("updated PRs mismatch: got %v, want %v", fc.updated, tc.expectUpdated)
+			}
+			if !reflect.DeepEqual(fc.rebased, tc.expectRebased) {
+				t.Errorf("rebased PRs mismatch: got %v, want %v", fc.rebased, tc.expectRebased)
+			}
+			if len(tc.expectComment) == 0 {
+				if len(fc.createdComments) != 0 {
+					t.Errorf("expected no comment, but got %v", fc.createdComments)
+				}
+				return
+			}
+			if len(fc.createdComments) != 1 || !strings.Contains(fc.createdComments[0], tc.expectComment) {
+				t.Errorf("expected one comment containing %q, but got %v", tc.expectComment, fc.createdComments)
+			}
+		})
+	}
+}
@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -28,24 +31,42 @@ type fakeGithub struct {
 	}
 	pr *github.PullRequest
 
-	baseCommit github.RepositoryCommit
-
-	prCommits []github.RepositoryCommit
-
+	// outOfDate specifies whether the PRs not in behind are behind their base branches.
 	outOfDate bool
+	// behind maps the PR numbers to the number of the commits they are behind their base branches.
+	behind map[int]int
+	// compared records the compared refs in the form of base...head in order.
+	compared []string
+	// compareQueries is the number of the queries comparing the PRs with their base branches.
+	compareQueries int
+	// unresolved specifies the PRs whose head refs can not be resolved.
+	unresolved map[int]bool
+	// updated records the numbers of the updated PRs in order.
+	updated []int
+	// rebased records the node IDs of the rebased PRs in order.
+	rebased []string
+	// rebaseErr is the error of rebasing the PRs.
+	rebaseErr error
+	// comments are the existing comments of the PR.
+	comments []github.IssueComment
+	// createdComments records the bodies of the created comments in order.
+	createdComments []string
+	// statuses maps the head SHAs to their commit statuses.
+	statuses map[string][]github.Status
+	// baseHead is the head commit of the base branches.
+	baseHead github.RepositoryCommit
+	// checkRuns maps the head SHAs to their check runs.
+	checkRuns map[string][]github.CheckRun
 
 	// The following are maps are keyed using 'testKey'
 	commentCreated, commentDeleted map[string]bool
 }
 
-func newFakeGithubClient(prs []pullRequest, pr *github.PullRequest,
-	baseCommit github.RepositoryCommit, prCommits []github.RepositoryCommit, outOfDate bool) *fakeGithub {
+func newFakeGithubClient(prs []pullRequest, pr *github.PullRequest, outOfDate bool) *fakeGithub {
 	f := &fakeGithub{
 		commentCreated: make(map[string]bool),
 		commentDeleted: make(map[string]bool),
 		pr:             pr,
-		baseCommit:     baseCommit,
-		prCommits:      prCommits,
 		outOfDate:      outOfDate,
 	}
 
@@ -65,11 +86,16 @@ func (f *fakeGithub) BotUserChecker() (func(candidate string) bool, error) {
 	}, nil
 }
 
-func (f *fakeGithub) CreateComment(org, repo string, number int, _ string) error {
+func (f *fakeGithub) CreateComment(org, repo string, number int, comment string) error {
 	f.commentCreated[testKey(org, repo, number)] = true
+	f.createdComments = append(f.createdComments, comment)
 	return nil
 }
 
+func (f *fakeGithub) ListIssueComments(string, string, int) ([]github.IssueComment, error) {
+	return f.comments, nil
+}
+
 func (f *fakeGithub) DeleteStaleComments(org, repo string, number int,
 	_ []github.IssueComment, _ func(github.IssueComment) bool) error {
 	f.commentDeleted[testKey(org, repo, number)] = true
@@ -77,12 +103,73 @@ func (f *fakeGithub) DeleteStaleComments(org, repo string, number int,
 }
 
 func (f *fakeGithub) QueryWithGitHubAppsSupport(
-	_ context.Context, q interface{}, _ map[string]interface{}, _ string) error {
-	query, ok := q.(*searchQuery)
-	if !ok {
+	_ context.Context, q interface{}, vars map[string]interface{}, _ string) error {
+	switch query := q.(type) {
+	case *searchQuery:
+		query.Search.Nodes = f.allPRs
+	default:
+		return f.compare(q, vars)
+	}
+	return nil
+}
+
+// compareFieldTagRe matches the graphql tag of the comparison of each PR in the compare query.
+var compareFieldTagRe = regexp.MustCompile(`^pr(\d+): compare\(headRef: \$(head\d+)\)$`)
+
+// compare fills the comparisons of the compare query, it checks that the head of each PR is referred
+// by the pull ref of the PR.
+func (f *fakeGithub) compare(q interface{}, vars map[string]interface{}) error {
+	v := reflect.ValueOf(q)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("invalid query format")
+	}
+	repository := v.Elem().FieldByName("Repository")
+	if !repository.IsValid() || !repository.FieldByName("Ref").IsValid() {
 		return errors.New("invalid query format")
 	}
-	query.Search.Nodes = f.allPRs
+	ref := repository.FieldByName("Ref")
+	f.compareQueries++
+
+	for i := 0; i < ref.NumField(); i++ {
+		m := compareFieldTagRe.FindStringSubmatch(ref.Type().Field(i).Tag.Get("graphql"))
+		if m == nil {
+			return fmt.Errorf("invalid comparison field %s", ref.Type().Field(i).Tag)
+		}
+		headRef, ok := vars[m[2]].(githubql.String)
+		if !ok || string(headRef) != "refs/pull/"+m[1]+"/head" {
+			return fmt.Errorf("invalid head ref %v of PR %s", vars[m[2]], m[1])
+		}
+		f.compared = append(f.compared, fmt.Sprintf("%s...%s", vars["baseRef"], headRef))
+
+		number, err := strconv.Atoi(m[1])
+		if err != nil {
+			return err
+		}
+		if f.unresolved[number] {
+			continue
+		}
+		behind, ok := f.behind[number]
+		if !ok && f.outOfDate {
+			behind = 1
+		}
+		ref.Field(i).Set(reflect.ValueOf(&comparison{BehindBy: githubql.Int(behind)})) //nolint:gosec
+	}
+	return nil
+}
+
+func (f *fakeGithub) MutateWithGitHubAppsSupport(
+	_ context.Context, m interface{}, input githubql.Input, _ map[string]interface{}, _ string) error {
+	if _, ok := m.(*updatePullRequestBranchMutation); !ok {
+		return errors.New("invalid mutation format")
+	}
+	in, ok := input.(UpdatePullRequestBranchInput)
+	if !ok {
+		return errors.New("invalid mutation input")
+	}
+	if f.rebaseErr != nil {
+		return f.rebaseErr
+	}
+	f.rebased = append(f.rebased, fmt.Sprintf("%v", in.PullRequestID))
 	return nil
 }
 
@@ -94,17 +181,23 @@ func (f *fakeGithub) GetPullRequest(org, repo string, number int) (*github.PullR
 }
 
 func (f *fakeGithub) GetSingleCommit(string, string, string) (github.RepositoryCommit, error) {
-	return f.baseCommit, nil
+	return f.baseHead, nil
+}
+
+func (f *fakeGithub) ListCheckRuns(_, _, ref string) (*github.CheckRunList, error) {
+	return &github.CheckRunList{CheckRuns: f.checkRuns[ref]}, nil
 }
 
-func (f *fakeGithub) ListPRCommits(string, string, int) ([]github.RepositoryCommit, error) {
-	return f.prCommits, nil
+func (f *fakeGithub) GetCombinedStatus(_, _, ref string) (*github.CombinedStatus, error) {
+	return &github.CombinedStatus{SHA: ref, Statuses: f.statuses[ref]}, nil
 }
 
-func (f *fakeGithub) UpdatePullRequestBranch(string, string, int, *string) error {
-	if f.outOfDate {
-		f.outOfDate = false
+func (f *fakeGithub) UpdatePullRequestBranch(_, _ string, number int, _ *string) error {
+	f.updated = append(f.updated, number)
+	if f.behind == nil {
+		f.behind = make(map[int]int)
 	}
+	f.behind[number] = 0
 	return nil
 }
 
@@ -124,7 +217,7 @@ func (f *fakeGithub) compareExpected(t *testing.T, org, repo string,
 	}
 
 	if expectUpdate {
-		if f.outOfDate {
+		if behind, ok := f.behind[num]; !ok || behind != 0 {
 			t.Errorf("Expected update pull request %s, but still out of date.", key)
 		}
 	}
@@ -144,53 +237,20 @@ func getPullRequest(org string, repo string, num int) *github.PullRequest {
 }
 
 func TestHandleIssueCommentEvent(t *testing.T) {
-	currentBaseSHA := "0bd3ed50c88cd53a09316bf7a298f900e9371652"
-	outOfDateSHA := "0bd3ed50c88cd53a0931609dsa9d-0a9d0-as9d0"
 	triggerLabel := "trigger-update"
 	excludeLabel := "exclude"
 
-	baseCommit := github.RepositoryCommit{
-		SHA: currentBaseSHA,
-	}
-
-	outOfDatePrCommits := func() []github.RepositoryCommit {
-		prCommits := []github.RepositoryCommit{
-			{
-				Parents: []github.GitCommit{
-					{
-						SHA: outOfDateSHA,
-					},
-				},
-			},
-		}
-		return prCommits
-	}
-	updatedPrCommits := func() []github.RepositoryCommit {
-		prCommits := []github.RepositoryCommit{
-			{
-				Parents: []github.GitCommit{
-					{
-						SHA: currentBaseSHA,
-					},
-				},
-			},
-		}
-		return prCommits
-	}
-
 	oldSleep := sleep
 	sleep = func(time.Duration) {}
 	defer func() { sleep = oldSleep }()
 
 	testcases := []struct {
-		name       string
-		pr         *github.PullRequest
-		labels     []github.Label
-		baseCommit github.RepositoryCommit
-		prCommits  []github.RepositoryCommit
-		outOfDate  bool
-		commenter  string
-		message    string
+		name      string
+		pr        *github.PullRequest
+		labels    []github.Label
+		outOfDate bool
+		commenter string
+		message   string
 
 		expectComment  bool
 		expectDeletion bool
@@ -207,9 +267,7 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit: baseCommit,
-			prCommits:  updatedPrCommits(),
-			outOfDate:  false,
+			outOfDate: false,
 		},
 		{
 			name: "out of date with message",
@@ -219,8 +277,6 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "updated",
 			expectDeletion: true,
@@ -235,8 +291,6 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "",
 			expectDeletion: false,
@@ -251,8 +305,6 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 					Name: "random",
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "updated",
 			expectDeletion: false,
@@ -270,8 +322,6 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 					Name: excludeLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "updated",
 			expectDeletion: false,
@@ -286,8 +336,6 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "updated",
 			expectDeletion: true,
@@ -302,8 +350,6 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			commenter:      botName,
 			message:        "updated",
@@ -316,7 +362,7 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 	for _, testcase := range testcases {
 		tc := testcase
 		t.Run(tc.name, func(t *testing.T) {
-			fc := newFakeGithubClient(nil, tc.pr, tc.baseCommit, tc.prCommits, tc.outOfDate)
+			fc := newFakeGithubClient(nil, tc.pr, tc.outOfDate)
 			ice := &github.IssueCommentEvent{}
 			if tc.pr != nil {
 				ice.Issue.PullRequest = &struct{}{}
@@ -347,49 +393,15 @@ func TestHandleIssueCommentEvent(t *testing.T) {
 }
 
 func TestHandlePushEvent(t *testing.T) {
-	currentBaseSHA := "0bd3ed50c88cd53a09316bf7a298f900e9371652"
-	outOfDateSHA := "0bd3ed50c88cd53a0931609dsa9d-0a9d0-as9d0"
 	triggerLabel := "trigger-update"
 
-	baseCommit := github.RepositoryCommit{
-		SHA: currentBaseSHA,
-	}
-
-	outOfDatePrCommits := func() []github.RepositoryCommit {
-		prCommits := []github.RepositoryCommit{
-			{
-				Parents: []github.GitCommit{
-					{
-						SHA: outOfDateSHA,
-					},
-				},
-			},
-		}
-		return prCommits
-	}
-
-	updatedPrCommits := func() []github.RepositoryCommit {
-		prCommits := []github.RepositoryCommit{
-			{
-				Parents: []github.GitCommit{
-					{
-						SHA: currentBaseSHA,
-					},
-				},
-			},
-		}
-		return prCommits
-	}
-
 	testcases := []struct {
-		name       string
-		pe         *github.PushEvent
-		pr         *github.PullRequest
-		labels     []github.Label
-		baseCommit github.RepositoryCommit
-		prCommits  []github.RepositoryCommit
-		outOfDate  bool
-		message    string
+		name      string
+		pe        *github.PushEvent
+		pr        *github.PullRequest
+		labels    []github.Label
+		outOfDate bool
+		message   string
 
 		expectComment  bool
 		expectDeletion bool
@@ -412,9 +424,7 @@ func TestHandlePushEvent(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit: baseCommit,
-			prCommits:  updatedPrCommits(),
-			outOfDate:  false,
+			outOfDate: false,
 		},
 		{
 			name: "out of date with message",
@@ -427,8 +437,6 @@ func TestHandlePushEvent(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "updated",
 			expectDeletion: true,
@@ -446,8 +454,6 @@ func TestHandlePushEvent(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "",
 			expectDeletion: false,
@@ -465,8 +471,6 @@ func TestHandlePushEvent(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "updated",
 			expectDeletion: true,
@@ -485,9 +489,9 @@ func TestHandlePushEvent(t *testing.T) {
 			// For now we only add one pr.
 			var prs []pullRequest
 			if tc.pr != nil {
-				prs = generatePullRequests("org1", "repo1", tc.pr, tc.prCommits, tc.labels)
+				prs = generatePullRequests("org1", "repo1", tc.pr, tc.labels)
 			}
-			fc := newFakeGithubClient(prs, tc.pr, tc.baseCommit, tc.prCommits, tc.outOfDate)
+			fc := newFakeGithubClient(prs, tc.pr, tc.outOfDate)
 			externalConfig := &externalplugins.Configuration{}
 			externalConfig.TiCommunityTars = []externalplugins.TiCommunityTars{
 				{
@@ -505,52 +509,14 @@ func TestHandlePushEvent(t *testing.T) {
 }
 
 func TestHandleAll(t *testing.T) {
-	currentBaseSHA := "0bd3ed50c88cd53a09316bf7a298f900e9371652"
-	outOfDateSHA := "0bd3ed50c88cd53a0931609dsa9d-0a9d0-as9d0"
 	triggerLabel := "trigger-update"
 
-	baseCommit := github.RepositoryCommit{
-		SHA: currentBaseSHA,
-	}
-
-	outOfDatePrCommits := func() []github.RepositoryCommit {
-		prCommits := []github.RepositoryCommit{
-			{
-				SHA: "314506403e9c39bf599b53be524e16b25c8124cf",
-				Parents: []github.GitCommit{
-					{
-						SHA: "f0a713b8f7b52e3aebfd16e68911b1b69129bf11",
-					},
-				},
-			},
-			{
-				SHA: outOfDateSHA,
-				Parents: []github.GitCommit{
-					{
-						SHA: "314506403e9c39bf599b53be524e16b25c8124cf",
-					},
-				},
-			},
-			{
-				SHA: "546c9f753db86f80e50f26f4da588d0d24b78c51",
-				Parents: []github.GitCommit{
-					{
-						SHA: outOfDateSHA,
-					},
-				},
-			},
-		}
-		return prCommits
-	}
-
 	testcases := []struct {
-		name       string
-		pr         *github.PullRequest
-		labels     []github.Label
-		baseCommit github.RepositoryCommit
-		prCommits  []github.RepositoryCommit
-		outOfDate  bool
-		message    string
+		name      string
+		pr        *github.PullRequest
+		labels    []github.Label
+		outOfDate bool
+		message   string
 
 		expectComment  bool
 		expectDeletion bool
@@ -560,80 +526,13 @@ func TestHandleAll(t *testing.T) {
 			name: "No pull request, ignoring",
 		},
 		{
-			name: "PR is based on the latest commit of target branch, ignoring",
-			pr:   getPullRequest("org", "repo", 5),
-			labels: []github.Label{
-				{
-					Name: triggerLabel,
-				},
-			},
-			baseCommit: baseCommit,
-			prCommits: []github.RepositoryCommit{
-				{
-					SHA: "314506403e9c39bf599b53be524e16b25c8124cf",
-					Parents: []github.GitCommit{
-						{
-							SHA: currentBaseSHA,
-						},
-					},
-				},
-				{
-					SHA: "546c9f753db86f80e50f26f4da588d0d24b78c51",
-					Parents: []github.GitCommit{
-						{
-							SHA: "314506403e9c39bf599b53be524e16b25c8124cf",
-						},
-					},
-				},
-				{
-					SHA: "e8de18edf50ed760701f3b8b91245142b9d0d974",
-					Parents: []github.GitCommit{
-						{
-							SHA: "546c9f753db86f80e50f26f4da588d0d24b78c51",
-						},
-					},
-				},
-			},
-			outOfDate: false,
-		},
-		{
-			name: "PR has already merged the latest commit of target branch, ignoring",
+			name: "PR is up to date with the target branch, ignoring",
 			pr:   getPullRequest("org", "repo", 5),
 			labels: []github.Label{
 				{
 					Name: triggerLabel,
 				},
 			},
-			baseCommit: baseCommit,
-			prCommits: []github.RepositoryCommit{
-				{
-					SHA: "314506403e9c39bf599b53be524e16b25c8124cf",
-					Parents: []github.GitCommit{
-						{
-							SHA: "f0a713b8f7b52e3aebfd16e68911b1b69129bf11",
-						},
-					},
-				},
-				{
-					SHA: "546c9f753db86f80e50f26f4da588d0d24b78c51",
-					Parents: []github.GitCommit{
-						{
-							SHA: "314506403e9c39bf599b53be524e16b25c8124cf",
-						},
-						{
-							SHA: currentBaseSHA,
-						},
-					},
-				},
-				{
-					SHA: "e8de18edf50ed760701f3b8b91245142b9d0d974",
-					Parents: []github.GitCommit{
-						{
-							SHA: "546c9f753db86f80e50f26f4da588d0d24b78c51",
-						},
-					},
-				},
-			},
 			outOfDate: false,
 		},
 		{
@@ -644,8 +543,6 @@ func TestHandleAll(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "updated",
 			expectDeletion: true,
@@ -660,8 +557,6 @@ func TestHandleAll(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "",
 			expectDeletion: false,
@@ -676,8 +571,6 @@ func TestHandleAll(t *testing.T) {
 					Name: triggerLabel,
 				},
 			},
-			baseCommit:     baseCommit,
-			prCommits:      outOfDatePrCommits(),
 			outOfDate:      true,
 			message:        "updated",
 			expectDeletion: true,
@@ -696,9 +589,9 @@ func TestHandleAll(t *testing.T) {
 			// For now we only add one pr.
 			var prs []pullRequest
 			if tc.pr != nil {
-				prs = generatePullRequests("org", "repo", tc.pr, tc.prCommits, tc.labels)
+				prs = generatePullRequests("org", "repo", tc.pr, tc.labels)
 			}
-			fc := newFakeGithubClient(prs, tc.pr, tc.baseCommit, tc.prCommits, tc.outOfDate)
+			fc := newFakeGithubClient(prs, tc.pr, tc.outOfDate)
 			cfg := &plugins.Configuration{
 				ExternalPlugins: map[string][]plugins.ExternalPlugin{"/": {{Name: PluginName}}},
 			}
@@ -718,8 +611,7 @@ func TestHandleAll(t *testing.T) {
 	}
 }
 
-func generatePullRequests(org string, repo string, pr *github.PullRequest,
-	prCommits []github.RepositoryCommit, labels []github.Label) []pullRequest {
+func generatePullRequests(org string, repo string, pr *github.PullRequest, labels []github.Label) []pullRequest {
 	var prs []pullRequest
 
 	graphPr := pullRequest{}
@@ -730,30 +622,6 @@ func generatePullRequests(org string, repo string, pr *github.PullRequest,
 	graphPr.Author.Login = githubql.String(pr.User.Login)
 	graphPr.BaseRef.Name = githubql.String(pr.Base.Ref)
 
-	// Convert the commit.
-	for _, prCommit := range prCommits {
-		graphCommit := struct {
-			Commit struct {
-				OID     githubql.GitObjectID `graphql:"oid"`
-				Parents struct {
-					Nodes []struct {
-						OID githubql.GitObjectID `graphql:"oid"`
-					}
-				} `graphql:"parents(first:5)"`
-			}
-		}{}
-		graphCommit.Commit.OID = githubql.GitObjectID(prCommit.Commit.SHA)
-		for _, parent := range prCommit.Parents {
-			s := struct {
-				OID githubql.GitObjectID `graphql:"oid"`
-			}{
-				OID: githubql.GitObjectID(parent.SHA),
-			}
-			graphCommit.Commit.Parents.Nodes = append(graphCommit.Commit.Parents.Nodes, s)
-		}
-		graphPr.Commits.Nodes = append(graphPr.Commits.Nodes, graphCommit)
-	}
-
 	// Set the labels.
 	if len(labels) != 0 {
 		pr.Labels = labels
@@ -845,20 +713,27 @@ func TestHelpProvider(t *testing.T) {
 			name:               "Empty config",
 			config:             &externalplugins.Configuration{},
 			enabledRepos:       enabledRepos,
-			configInfoExcludes: []string{configInfoAutoUpdatedMessagePrefix},
+			configInfoExcludes: []string{configInfoAutoUpdatedMessagePrefix, configInfoRebaseUpdateMethod},
 		},
 		{
 			name: "All configs enabled",
 			config: &externalplugins.Configuration{
 				TiCommunityTars: []externalplugins.TiCommunityTars{
 					{
-						Repos:   []string{"org2/repo"},
-						Message: "updated",
+						Repos:                []string{"org2/repo"},
+						Message:              "updated",
+						UpdateMethod:         externalplugins.RebaseUpdateMethod,
+						FallbackToMerge:      true,
+						MaxConcurrentUpdates: 2,
+						MaxPendingJobs:       10,
+						BaseRequiredContexts: []string{"unit-test"},
 					},
 				},
 			},
-			enabledRepos:       enabledRepos,
-			configInfoIncludes: []string{configInfoAutoUpdatedMessagePrefix},
+			enabledRepos: enabledRepos,
+			configInfoIncludes: []string{configInfoAutoUpdatedMessagePrefix, configInfoRebaseUpdateMethod,
+				configInfoFallbackToMerge, configInfoMaxConcurrentUpdatesPrefix, configInfoMaxPendingJobsPrefix,
+				configInfoBaseRequiredContextsPrefix},
 		},
 	}
 	for _, testcase := range testcases {